@@ -0,0 +1,54 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// Lists of the activity types command, each an endpoint of the user's activity types
+var activityTypeLists = []string{"favorite", "frequent", "recent"}
+
+// Activity type of a list, as written by the activity-types command
+type listedActivityType struct {
+	List        string `json:"list"` // favorite, frequent or recent
+	ActivityID  int    `json:"activityId"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Parses the arguments following the activity-types command: none for all the lists, or one of them
+func parseActivityTypesArgs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return activityTypeLists, nil
+	}
+	if len(args) != 1 || !slices.Contains(activityTypeLists, args[0]) {
+		return nil, fmt.Errorf("unknown activity types list, use: activity-types [favorite|frequent|recent]")
+	}
+	return args, nil
+}
+
+// Writes the activity types of the lists, e.g. the favorite ones, as CSV or as JSON. Their IDs are those of
+// the activity catalog, e.g. to log activities of the types the user does
+func exportActivityTypes(out io.Writer, lists []string, jsonOutput bool) error {
+	activityTypes := []listedActivityType{}
+	var rows [][]string
+	for _, list := range lists {
+		body, err := apiGet(userURL("activities/" + list + ".json"))
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s activity types: %w", list, err)
+		}
+		var shortcuts []data.ActivityShortcut
+		if err := json.Unmarshal(body, &shortcuts); err != nil {
+			return fmt.Errorf("failed to unmarshal %s activity types: %s", list, err)
+		}
+		for _, shortcut := range shortcuts {
+			activityTypes = append(activityTypes, listedActivityType{List: list, ActivityID: shortcut.ActivityID, Name: shortcut.Name, Description: shortcut.Description})
+			rows = append(rows, []string{list, strconv.Itoa(shortcut.ActivityID), shortcut.Name, shortcut.Description})
+		}
+	}
+	return writeHealthRecords(out, jsonOutput, activityTypes, []string{"list", "activity_id", "name", "description"}, rows)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestExportActivityTypes(t *testing.T) {
+	var requested []string
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		switch r.URL.Path {
+		case "/1/user/-/activities/favorite.json":
+			w.Write([]byte(`[{"activityId":90013,"description":"Walking less than 2 mph, strolling very slowly","mets":2,"name":"Walk"}]`))
+		case "/1/user/-/activities/frequent.json":
+			w.Write([]byte(`[{"activityId":90009,"calories":412,"description":"Running - 5 mph (12 min/mile)","distance":5.2,"duration":1800000,"name":"Run"},
+				{"activityId":90013,"calories":120,"description":"","distance":2.1,"duration":1500000,"name":"Walk"}]`))
+		case "/1/user/-/activities/recent.json":
+			w.Write([]byte(`[]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	var out bytes.Buffer
+	assert.NoError(t, exportActivityTypes(&out, activityTypeLists, false))
+	assert.Equal(t, []string{"/1/user/-/activities/favorite.json", "/1/user/-/activities/frequent.json", "/1/user/-/activities/recent.json"}, requested)
+	assert.Equal(t, "list,activity_id,name,description\n"+
+		"favorite,90013,Walk,\"Walking less than 2 mph, strolling very slowly\"\n"+
+		"frequent,90009,Run,Running - 5 mph (12 min/mile)\n"+
+		"frequent,90013,Walk,\n", out.String())
+
+	// JSON of a single list
+	out.Reset()
+	assert.NoError(t, exportActivityTypes(&out, []string{"favorite"}, true))
+	assert.JSONEq(t, `[{"list":"favorite","activityId":90013,"name":"Walk","description":"Walking less than 2 mph, strolling very slowly"}]`, out.String())
+
+	// No activity types
+	out.Reset()
+	assert.NoError(t, exportActivityTypes(&out, []string{"recent"}, true))
+	assert.JSONEq(t, `[]`, out.String())
+}
+
+func TestParseActivityTypesArgs(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		args          []string
+		expected      []string
+		expectedError bool
+	}{
+		{"SUCCESS - All lists", []string{}, []string{"favorite", "frequent", "recent"}, false},
+		{"SUCCESS - Recent", []string{"recent"}, []string{"recent"}, false},
+		{"FAILURE - Unknown list", []string{"popular"}, nil, true},
+		{"FAILURE - Two lists", []string{"favorite", "recent"}, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			lists, err := parseActivityTypesArgs(tc.args)
+			if tc.expectedError {
+				assert.ErrorContains(t, err, "unknown activity types list")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, lists)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Height of a floor climbed, Fitbit counts a floor for every 10 feet
+const metersPerFloor = 10 * metersPerFoot
+
+// Tells whether the TCX has GPS track points but no altitude, e.g. recorded by a tracker without barometer
+func needsAltitude(xmlDoc *etree.Document) bool {
+	return xmlDoc.FindElement("//Trackpoint/Position") != nil && xmlDoc.FindElement("//Trackpoint/AltitudeMeters") == nil
+}
+
+// Gets the meters climbed during the activity, by local minute, e.g. "2024-09-07T10:05". Trackers without
+// elevation data count the floors only, then they are converted at 10 feet each. The intraday data needs a personal
+// application, or one approved by Fitbit for intraday access
+func fetchClimbPerMinute(activity data.Activity) (map[string]float64, error) {
+	climb, err := fetchIntradayClimb(activity, "elevation")
+	if err != nil || len(climb) > 0 {
+		return climb, err
+	}
+	return fetchIntradayClimb(activity, "floors")
+}
+
+// Gets the elevation or floors resource of the activity by minute, in meters, leaving out the minutes without climb
+func fetchIntradayClimb(activity data.Activity, resource string) (map[string]float64, error) {
+	start, end, err := activityWindow(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	url := userURL(fmt.Sprintf("activities/%s/date/%s/1d/1min/time/%s/%s.json",
+		resource, activity.StartDate, start.Format("15:04"), end.Format("15:04")))
+	body, err := apiGet(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", resource, err)
+	}
+	var intraday data.ElevationIntraday
+	if err := json.Unmarshal(body, &intraday); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %s", resource, err)
+	}
+	dataset := intraday.Elevation.Dataset
+	if resource == "floors" {
+		dataset = intraday.Floors.Dataset
+	}
+	climb := map[string]float64{}
+	for _, minute := range dataset {
+		if minute.Value <= 0 || len(minute.Time) < len("15:04") {
+			continue
+		}
+		meters := elevationMeters(minute.Value, apiUnits)
+		if resource == "floors" {
+			meters = minute.Value * metersPerFloor
+		}
+		climb[activity.StartDate+"T"+minute.Time[:len("15:04")]] = meters
+	}
+	return climb, nil
+}
+
+// Adds the altitude to the track points of the TCX, relative to the start of the activity: the meters climbed
+// until the track point, spread evenly over each minute. Fitbit gives the ascent only, so the altitude never
+// decreases; the elevation gain is right, the profile of the descents is lost
+func addTrackpointAltitude(xmlDoc *etree.Document, climbPerMinute map[string]float64) {
+	climbed := newMinuteTotals(climbPerMinute)
+	for _, trackpoint := range xmlDoc.FindElements("//Trackpoint") {
+		timeElement := trackpoint.SelectElement("Time")
+		if timeElement == nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, timeElement.Text())
+		if err != nil {
+			continue
+		}
+
+		// AltitudeMeters follows the Time and the Position of the track point
+		element := etree.NewElement("AltitudeMeters")
+		element.SetText(strconv.FormatFloat(climbed.at(t), 'f', 1, 64))
+		after := timeElement
+		if position := trackpoint.SelectElement("Position"); position != nil {
+			after = position
+		}
+		trackpoint.InsertChildAt(after.Index()+1, element)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestNeedsAltitude(t *testing.T) {
+	testCases := []struct {
+		testName string
+		tcx      string
+		expected bool
+	}{
+		{"SUCCESS - GPS without altitude", `<Track><Trackpoint><Time>2024-09-07T08:00:00Z</Time><Position><LatitudeDegrees>47.5</LatitudeDegrees><LongitudeDegrees>19.0</LongitudeDegrees></Position></Trackpoint></Track>`, true},
+		{"SUCCESS - GPS with altitude", `<Track><Trackpoint><Time>2024-09-07T08:00:00Z</Time><Position><LatitudeDegrees>47.5</LatitudeDegrees><LongitudeDegrees>19.0</LongitudeDegrees></Position><AltitudeMeters>110.2</AltitudeMeters></Trackpoint></Track>`, false},
+		{"SUCCESS - Without GPS", `<Track><Trackpoint><Time>2024-09-07T08:00:00Z</Time><HeartRateBpm><Value>120</Value></HeartRateBpm></Trackpoint></Track>`, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			xmlDoc := etree.NewDocument()
+			assert.NoError(t, xmlDoc.ReadFromString(tc.tcx))
+			assert.Equal(t, tc.expected, needsAltitude(xmlDoc))
+		})
+	}
+}
+
+func TestFetchClimbPerMinute(t *testing.T) {
+	testCases := []struct {
+		testName  string
+		units     unitSystem
+		elevation string
+		expected  map[string]float64
+	}{
+		{"SUCCESS - Elevation", unitsMetric, `[{"time":"10:00:00","value":0},{"time":"10:01:00","value":3.2}]`, map[string]float64{"2024-09-07T10:01": 3.2}},
+		{"SUCCESS - Elevation in feet", unitsImperial, `[{"time":"10:01:00","value":10}]`, map[string]float64{"2024-09-07T10:01": 3.048}},
+		{"SUCCESS - Floors without elevation", unitsMetric, `[{"time":"10:00:00","value":0}]`, map[string]float64{"2024-09-07T10:02": 6.096}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/1/user/-/activities/elevation/date/2024-09-07/1d/1min/time/10:00/10:30.json":
+					w.Write([]byte(`{"activities-elevation-intraday":{"dataset":` + tc.elevation + `,"datasetInterval":1,"datasetType":"minute"}}`))
+				case "/1/user/-/activities/floors/date/2024-09-07/1d/1min/time/10:00/10:30.json":
+					w.Write([]byte(`{"activities-floors-intraday":{"dataset":[{"time":"10:02:00","value":2}],"datasetInterval":1,"datasetType":"minute"}}`))
+				default:
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+			}))
+			token = &oauth2.Token{AccessToken: "access"}
+			apiUnits = tc.units
+			defer func() { apiUnits = unitsMetric }()
+
+			climb, err := fetchClimbPerMinute(data.Activity{LogID: 1, StartDate: "2024-09-07", StartTime: "10:00", Duration: 1800000})
+			assert.NoError(t, err)
+			assert.Len(t, climb, len(tc.expected))
+			for minute, meters := range tc.expected {
+				assert.InDelta(t, meters, climb[minute], 1e-9)
+			}
+		})
+	}
+}
+
+func TestAddTrackpointAltitude(t *testing.T) {
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Running"><Lap><Track>
+		<Trackpoint><Time>2024-09-07T08:00:30Z</Time><Position><LatitudeDegrees>47.5</LatitudeDegrees><LongitudeDegrees>19.0</LongitudeDegrees></Position><DistanceMeters>0</DistanceMeters></Trackpoint>
+		<Trackpoint><Time>2024-09-07T10:01:30.000+02:00</Time><Position><LatitudeDegrees>47.5</LatitudeDegrees><LongitudeDegrees>19.0</LongitudeDegrees></Position></Trackpoint>
+		<Trackpoint><Time>2024-09-07T08:05:00Z</Time><HeartRateBpm><Value>120</Value></HeartRateBpm></Trackpoint>
+		</Track></Lap></Activity></Activities></TrainingCenterDatabase>`))
+
+	addTrackpointAltitude(xmlDoc, map[string]float64{"2024-09-07T10:01": 4, "2024-09-07T10:03": 2.5})
+
+	trackpoints := xmlDoc.FindElements("//Trackpoint")
+	assert.Equal(t, "0.0", trackpoints[0].SelectElement("AltitudeMeters").Text())
+	assert.Equal(t, 2, trackpoints[0].SelectElement("AltitudeMeters").Index())
+	assert.Equal(t, "2.0", trackpoints[1].SelectElement("AltitudeMeters").Text())
+	assert.Equal(t, "6.5", trackpoints[2].SelectElement("AltitudeMeters").Text())
+	assert.Equal(t, 1, trackpoints[2].SelectElement("AltitudeMeters").Index())
+}
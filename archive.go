@@ -0,0 +1,104 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ZIP archive the exported files are streamed into with --zip, instead of the output directory. Its
+// manifest.json is written last, when the archive is closed
+type zipArchive struct {
+	fileName string
+	file     *os.File
+	writer   *zip.Writer
+	names    map[string]bool // Names in the archive, a name can only be added once
+	manifest []manifestEntry // Exported activities
+}
+
+// Creates the archive, an existing file is only replaced with overwrite
+func createZipArchive(fileName string, overwrite bool) (*zipArchive, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(fileName, flags, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("'%s' already exists, use --overwrite to replace it", fileName)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %s", err)
+	}
+	return &zipArchive{fileName: fileName, file: file, writer: zip.NewWriter(file), names: map[string]bool{}}, nil
+}
+
+// Adds the file to the archive. A name already in the archive gets a number, e.g. "Swim-12345-1.tcx".
+// Returns the name in the archive
+func (a *zipArchive) add(name string, content []byte) (string, error) {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	ext := path.Ext(name)
+	for i := 1; a.names[name]; i++ {
+		name = strings.TrimSuffix(name, ext)
+		if i > 1 {
+			name = strings.TrimSuffix(name, "-"+strconv.Itoa(i-1))
+		}
+		name += "-" + strconv.Itoa(i) + ext
+	}
+
+	w, err := a.writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return "", fmt.Errorf("failed to add %s to %s: %s", name, a.fileName, err)
+	}
+	if _, err := w.Write(content); err != nil {
+		return "", fmt.Errorf("failed to add %s to %s: %s", name, a.fileName, err)
+	}
+	a.names[name] = true
+	return name, nil
+}
+
+// Adds the exported tcx of the activity, and records it for the manifest
+func (a *zipArchive) addActivity(name string, content []byte, activity data.Activity) (string, error) {
+	name, err := a.add(name, content)
+	if err != nil {
+		return "", err
+	}
+	a.manifest = append(a.manifest, newManifestEntry(name, content, activity))
+	return name, nil
+}
+
+// Writes the manifest and finishes the archive
+func (a *zipArchive) close() error {
+	if len(a.manifest) > 0 {
+		sortManifest(a.manifest)
+		byteValue, err := json.MarshalIndent(manifest{Updated: time.Now().Format(time.RFC3339), Files: a.manifest}, "", "\t")
+		if err != nil {
+			a.file.Close()
+			return fmt.Errorf("failed to marshal manifest: %s", err)
+		}
+		if _, err := a.add(manifestFile, byteValue); err != nil {
+			a.file.Close()
+			return err
+		}
+	}
+	if err := a.writer.Close(); err != nil {
+		a.file.Close()
+		return fmt.Errorf("failed to finish archive %s: %s", a.fileName, err)
+	}
+	return a.file.Close()
+}
+
+// Sorts the entries by date and file
+func sortManifest(entries []manifestEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Date != entries[j].Date {
+			return entries[i].Date < entries[j].Date
+		}
+		return entries[i].File < entries[j].File
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestExportActivitiesZip(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testActivityTcx))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+	zipFile := filepath.Join(t.TempDir(), "out.zip")
+
+	archive, err := createZipArchive(zipFile, false)
+	assert.NoError(t, err)
+	// Both activities are named after the date, the second one gets a number
+	opts := exportOptions{fileTemplate: "{date}/{sport}", archive: archive, batch: "2024-09-07"}
+	assert.NoError(t, exportActivities([]data.Activity{
+		{ActivityParentName: "Swim", LogID: 1, StartDate: "2024-09-07"},
+		{ActivityParentName: "Swim", LogID: 2, StartDate: "2024-09-07"},
+	}, opts))
+	assert.NoError(t, archive.close())
+
+	// Nothing is written to the output directory
+	entries, _ := os.ReadDir(outputDir)
+	assert.Empty(t, entries)
+
+	reader, err := zip.OpenReader(zipFile)
+	assert.NoError(t, err)
+	defer reader.Close()
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, []string{"2024-09-07/Swim.tcx", "2024-09-07/Swim-1.tcx", "manifest.json"}, names)
+
+	manifestReader, err := reader.File[2].Open()
+	assert.NoError(t, err)
+	byteValue, _ := io.ReadAll(manifestReader)
+	var m manifest
+	assert.NoError(t, json.Unmarshal(byteValue, &m))
+	assert.Len(t, m.Files, 2)
+	assert.Equal(t, "2024-09-07/Swim-1.tcx", m.Files[0].File)
+	assert.Equal(t, int64(2), m.Files[0].LogID)
+
+	// An existing archive is only replaced with --overwrite
+	_, err = createZipArchive(zipFile, false)
+	assert.Error(t, err)
+	archive, err = createZipArchive(zipFile, true)
+	assert.NoError(t, err)
+	assert.NoError(t, archive.close())
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Namespace of the Active Zone Minutes lap extension, TCX has no element for them
+const azmNamespace = "https://github.com/david-biro/FitbitNonLocTcx/ActiveZoneMinutes/v1"
+
+// Active Zone Minutes earned in a lap, by heart rate zone. Cardio and peak minutes count twice in the total
+type azmTotals struct {
+	Total   int `json:"total"`
+	FatBurn int `json:"fatBurn"`
+	Cardio  int `json:"cardio"`
+	Peak    int `json:"peak"`
+}
+
+// Gets the Active Zone Minutes of the activity minute by minute. The intraday data needs a personal
+// application, or one approved by Fitbit for intraday access
+func fetchActiveZoneMinutes(activity data.Activity) ([]data.ActiveZoneMinutesMinute, error) {
+	start, end, err := activityWindow(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	url := userURL(fmt.Sprintf("activities/active-zone-minutes/date/%s/1d/1min/time/%s/%s.json",
+		activity.StartDate, start.Format("15:04"), end.Format("15:04")))
+	body, err := apiGet(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Active Zone Minutes: %w", err)
+	}
+	var intraday data.ActiveZoneMinutesIntraday
+	if err := json.Unmarshal(body, &intraday); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Active Zone Minutes: %s", err)
+	}
+	var minutes []data.ActiveZoneMinutesMinute
+	for _, day := range intraday.Days {
+		minutes = append(minutes, day.Minutes...)
+	}
+	return minutes, nil
+}
+
+// Adds the Active Zone Minutes earned in each lap of the TCX as a lap extension
+func addLapActiveZoneMinutes(xmlDoc *etree.Document, minutes []data.ActiveZoneMinutesMinute) error {
+	for _, lap := range xmlDoc.FindElements("/TrainingCenterDatabase/Activities/Activity/Lap") {
+		start, err := time.Parse(time.RFC3339, lap.SelectAttrValue("StartTime", ""))
+		if err != nil {
+			return fmt.Errorf("invalid lap start time: %s", err)
+		}
+		var seconds float64
+		if totalTime := lap.SelectElement("TotalTimeSeconds"); totalTime != nil {
+			seconds, _ = strconv.ParseFloat(totalTime.Text(), 64)
+		}
+		totals := sumActiveZoneMinutes(minutes, start, start.Add(time.Duration(seconds*float64(time.Second))))
+
+		extensions := lap.SelectElement("Extensions")
+		if extensions == nil {
+			extensions = lap.CreateElement("Extensions")
+		}
+		azm := extensions.CreateElement("ActiveZoneMinutes")
+		azm.CreateAttr("xmlns", azmNamespace)
+		azm.CreateElement("Total").SetText(strconv.Itoa(totals.Total))
+		azm.CreateElement("FatBurn").SetText(strconv.Itoa(totals.FatBurn))
+		azm.CreateElement("Cardio").SetText(strconv.Itoa(totals.Cardio))
+		azm.CreateElement("Peak").SetText(strconv.Itoa(totals.Peak))
+	}
+	return nil
+}
+
+// Sums the Active Zone Minutes of the minutes starting in [start, end)
+func sumActiveZoneMinutes(minutes []data.ActiveZoneMinutesMinute, start time.Time, end time.Time) azmTotals {
+	var totals azmTotals
+	for _, minute := range minutes {
+		t, err := time.ParseInLocation("2006-01-02T15:04:05", minute.Minute, userLocation)
+		if err != nil || t.Before(start) || !t.Before(end) {
+			continue
+		}
+		totals.Total += minute.Value.ActiveZoneMinutes
+		totals.FatBurn += minute.Value.FatBurnActiveZoneMinutes
+		totals.Cardio += minute.Value.CardioActiveZoneMinutes
+		totals.Peak += minute.Value.PeakActiveZoneMinutes
+	}
+	return totals
+}
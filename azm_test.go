@@ -0,0 +1,63 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestFetchActiveZoneMinutes(t *testing.T) {
+	var path string
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"activities-active-zone-minutes-intraday":[{"dateTime":"2024-09-07","minutes":[
+			{"minute":"2024-09-07T23:30:00","value":{"activeZoneMinutes":2,"cardioActiveZoneMinutes":2}}]}]}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	// The window ends at midnight
+	minutes, err := fetchActiveZoneMinutes(data.Activity{LogID: 1, StartDate: "2024-09-07", StartTime: "23:00", Duration: 3600000})
+	assert.NoError(t, err)
+	assert.Equal(t, "/1/user/-/activities/active-zone-minutes/date/2024-09-07/1d/1min/time/23:00/23:59.json", path)
+	assert.Len(t, minutes, 1)
+	assert.Equal(t, 2, minutes[0].Value.CardioActiveZoneMinutes)
+
+	_, err = fetchActiveZoneMinutes(data.Activity{LogID: 1, StartDate: "2024-09-07"})
+	assert.Error(t, err)
+}
+
+func TestAddLapActiveZoneMinutes(t *testing.T) {
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+
+	// Two laps of 4 minutes from 10:00 local time
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(testActivityTcx))
+	_, err := injectActivityTcx(xmlDoc, data.Activity{ActivityParentID: activityTypeSwim, ActivityParentName: "Swim"}, 8*time.Minute, 50, 80, 2, nil)
+	assert.NoError(t, err)
+
+	var minutes []data.ActiveZoneMinutesMinute
+	assert.NoError(t, json.Unmarshal([]byte(`[
+		{"minute":"2024-09-07T10:01:00","value":{"activeZoneMinutes":1,"fatBurnActiveZoneMinutes":1}},
+		{"minute":"2024-09-07T10:05:00","value":{"activeZoneMinutes":2,"cardioActiveZoneMinutes":2}},
+		{"minute":"2024-09-07T10:07:00","value":{"activeZoneMinutes":2,"peakActiveZoneMinutes":2}},
+		{"minute":"2024-09-07T10:09:00","value":{"activeZoneMinutes":1,"fatBurnActiveZoneMinutes":1}}]`), &minutes))
+	assert.NoError(t, addLapActiveZoneMinutes(xmlDoc, minutes))
+
+	laps := xmlDoc.FindElements("//Lap")
+	assert.Len(t, laps, 2)
+	azm := laps[0].FindElement("Extensions/ActiveZoneMinutes")
+	assert.Equal(t, azmNamespace, azm.SelectAttrValue("xmlns", ""))
+	assert.Equal(t, "1", azm.SelectElement("Total").Text())
+	assert.Equal(t, "1", azm.SelectElement("FatBurn").Text())
+	azm = laps[1].FindElement("Extensions/ActiveZoneMinutes")
+	assert.Equal(t, "4", azm.SelectElement("Total").Text())
+	assert.Equal(t, "2", azm.SelectElement("Cardio").Text())
+	assert.Equal(t, "2", azm.SelectElement("Peak").Text())
+}
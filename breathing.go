@@ -0,0 +1,68 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Longest date range of a single breathing rate request
+const breathingRateMaxDays = 30
+
+// Breathing rate of a night, per sleep stage with intraday
+type breathingRate struct {
+	Date          string  `json:"date"`
+	BreathingRate float64 `json:"breathingRate,omitempty"`
+	Deep          float64 `json:"deep,omitempty"`
+	Light         float64 `json:"light,omitempty"`
+	REM           float64 `json:"rem,omitempty"`
+	Full          float64 `json:"full,omitempty"`
+}
+
+// Writes the breathing rate (breaths per minute) of the nights of the date range as CSV or as JSON, with intraday
+// per sleep stage. Fitbit assigns a night to the day it ends on, nights without enough sleep have none
+func exportBreathingRate(out io.Writer, start time.Time, end time.Time, intraday bool, jsonOutput bool) error {
+	rates := []breathingRate{}
+	err := forDateChunks(start, end, breathingRateMaxDays, func(chunkStart time.Time, chunkEnd time.Time) error {
+		url := userURL("br/date/" + chunkStart.Format(dateLayout) + "/" + chunkEnd.Format(dateLayout))
+		if intraday {
+			url += "/all"
+		}
+		body, err := apiGet(url + ".json")
+		if err != nil {
+			return fmt.Errorf("failed to fetch breathing rate from %s to %s: %w", chunkStart.Format(dateLayout), chunkEnd.Format(dateLayout), err)
+		}
+		var chunk data.BreathingRates
+		if err := json.Unmarshal(body, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal breathing rate: %s", err)
+		}
+		for _, night := range chunk.BR {
+			rates = append(rates, breathingRate{
+				Date:          night.DateTime,
+				BreathingRate: night.Value.BreathingRate,
+				Deep:          night.Value.DeepSleepSummary.BreathingRate,
+				Light:         night.Value.LightSleepSummary.BreathingRate,
+				REM:           night.Value.RemSleepSummary.BreathingRate,
+				Full:          night.Value.FullSleepSummary.BreathingRate,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	if intraday {
+		for _, rate := range rates {
+			rows = append(rows, []string{rate.Date, formatHealthValue(rate.Deep), formatHealthValue(rate.Light), formatHealthValue(rate.REM), formatHealthValue(rate.Full)})
+		}
+		return writeHealthRecords(out, jsonOutput, rates, []string{"date", "deep", "light", "rem", "full"}, rows)
+	}
+	for _, rate := range rates {
+		rows = append(rows, []string{rate.Date, formatHealthValue(rate.BreathingRate)})
+	}
+	return writeHealthRecords(out, jsonOutput, rates, []string{"date", "breathing_rate"}, rows)
+}
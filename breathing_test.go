@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestExportBreathingRate(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/user/-/br/date/2024-09-06/2024-09-07.json":
+			w.Write([]byte(`{"br":[{"value":{"breathingRate":17.8},"dateTime":"2024-09-06"},{"value":{"breathingRate":16.5},"dateTime":"2024-09-07"}]}`))
+		case "/1/user/-/br/date/2024-09-06/2024-09-07/all.json":
+			w.Write([]byte(`{"br":[{"value":{"deepSleepSummary":{"breathingRate":15.2},"remSleepSummary":{"breathingRate":17.1},
+				"fullSleepSummary":{"breathingRate":16.5},"lightSleepSummary":{"breathingRate":16.8}},"dateTime":"2024-09-07"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	start := time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 9, 7, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	assert.NoError(t, exportBreathingRate(&out, start, end, false, false))
+	assert.Equal(t, "date,breathing_rate\n2024-09-06,17.8\n2024-09-07,16.5\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, exportBreathingRate(&out, start, end, true, false))
+	assert.Equal(t, "date,deep,light,rem,full\n2024-09-07,15.2,16.8,17.1,16.5\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, exportBreathingRate(&out, start, end, true, true))
+	assert.JSONEq(t, `[{"date":"2024-09-07","deep":15.2,"light":16.8,"rem":17.1,"full":16.5}]`, out.String())
+}
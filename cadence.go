@@ -0,0 +1,102 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Namespace of the Garmin track point extension, which has the run cadence
+const activityExtensionNamespace = "http://www.garmin.com/xmlschemas/ActivityExtension/v2"
+
+// Tells whether the cadence of the activity can be derived from its steps, the activities on foot with the
+// cadence recipe
+func hasCadence(activity data.Activity) bool {
+	return config.sportMapping(activity).has(recipeCadence)
+}
+
+// Gets the steps per minute during the activity, by local minute, e.g. "2024-09-07T10:05". The intraday data
+// needs a personal application, or one approved by Fitbit for intraday access
+func fetchStepsPerMinute(activity data.Activity) (map[string]int, error) {
+	start, end, err := activityWindow(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	url := userURL(fmt.Sprintf("activities/steps/date/%s/1d/1min/time/%s/%s.json",
+		activity.StartDate, start.Format("15:04"), end.Format("15:04")))
+	body, err := apiGet(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch steps: %w", err)
+	}
+	var intraday data.StepsIntraday
+	if err := json.Unmarshal(body, &intraday); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal steps: %s", err)
+	}
+	steps := map[string]int{}
+	for _, minute := range intraday.Intraday.Dataset {
+		if len(minute.Time) >= len("15:04") {
+			steps[activity.StartDate+"T"+minute.Time[:len("15:04")]] = minute.Value
+		}
+	}
+	return steps, nil
+}
+
+// Adds the cadence of the minute to each track point of the TCX, as the ns3:TPX/ns3:RunCadence of the Garmin
+// track point extension, declared on the root so Garmin Connect and Strava chart it. RunCadence counts the
+// strides of one foot, half of the steps per minute
+func addRunCadence(xmlDoc *etree.Document, stepsPerMinute map[string]int) {
+	prefix := ""
+	for _, trackpoint := range xmlDoc.FindElements("//Trackpoint") {
+		timeElement := trackpoint.SelectElement("Time")
+		if timeElement == nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, timeElement.Text())
+		if err != nil {
+			continue
+		}
+		steps, ok := stepsPerMinute[t.In(userLocation).Format("2006-01-02T15:04")]
+		if !ok {
+			continue
+		}
+
+		extensions := trackpoint.SelectElement("Extensions")
+		if extensions == nil {
+			extensions = trackpoint.CreateElement("Extensions")
+		}
+		// A TPX of the export keeps its own namespace declaration or prefix
+		tpx := extensions.SelectElement("TPX")
+		if tpx == nil {
+			if prefix == "" {
+				prefix = activityExtensionPrefix(xmlDoc.Root())
+			}
+			tpx = extensions.CreateElement(prefix + ":TPX")
+		}
+		runCadence := "RunCadence"
+		if tpx.Space != "" {
+			runCadence = tpx.Space + ":" + runCadence
+		}
+		tpx.CreateElement(runCadence).SetText(strconv.Itoa((steps + 1) / 2))
+	}
+}
+
+// Returns the prefix of the Garmin track point extension, declared on the root element: ns3 as in the TCX of
+// Garmin, the prefix already declared for it, or the next free nsN when ns3 is taken
+func activityExtensionPrefix(root *etree.Element) string {
+	for _, attr := range root.Attr {
+		if attr.Space == "xmlns" && attr.Value == activityExtensionNamespace {
+			return attr.Key
+		}
+	}
+	prefix := "ns3"
+	for n := 4; root.SelectAttr("xmlns:"+prefix) != nil; n++ {
+		prefix = "ns" + strconv.Itoa(n)
+	}
+	root.CreateAttr("xmlns:"+prefix, activityExtensionNamespace)
+	return prefix
+}
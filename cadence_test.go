@@ -0,0 +1,89 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestHasCadence(t *testing.T) {
+	assert.True(t, hasCadence(data.Activity{ActivityID: 20047, ActivityParentName: "Treadmill"}))
+	assert.True(t, hasCadence(data.Activity{ActivityID: 90013, ActivityParentID: 90013, ActivityParentName: "Walk", Name: "Walk"}))
+	assert.True(t, hasCadence(data.Activity{ActivityID: 12345, ActivityParentID: 90009, ActivityParentName: "Laufen"}))
+	assert.False(t, hasCadence(data.Activity{ActivityID: 90024, ActivityParentID: 90024, ActivityParentName: "Swim"}))
+	assert.False(t, hasCadence(data.Activity{ActivityParentName: "Walk"}))
+}
+
+func TestFetchStepsPerMinute(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1/user/-/activities/steps/date/2024-09-07/1d/1min/time/10:00/10:30.json", r.URL.Path)
+		w.Write([]byte(`{"activities-steps":[{"dateTime":"2024-09-07","value":"4200"}],
+			"activities-steps-intraday":{"dataset":[{"time":"10:00:00","value":150},{"time":"10:01:00","value":171}],"datasetInterval":1,"datasetType":"minute"}}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	steps, err := fetchStepsPerMinute(data.Activity{LogID: 1, StartDate: "2024-09-07", StartTime: "10:00", Duration: 1800000})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2024-09-07T10:00": 150, "2024-09-07T10:01": 171}, steps)
+}
+
+func TestAddRunCadence(t *testing.T) {
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Running"><Lap><Track>
+		<Trackpoint><Time>2024-09-07T08:00:30Z</Time></Trackpoint>
+		<Trackpoint><Time>2024-09-07T10:01:10.000+02:00</Time><Extensions><TPX xmlns="http://www.garmin.com/xmlschemas/ActivityExtension/v2"><Speed>3.1</Speed></TPX></Extensions></Trackpoint>
+		<Trackpoint><Time>2024-09-07T08:02:00Z</Time></Trackpoint>
+		</Track></Lap></Activity></Activities></TrainingCenterDatabase>`))
+
+	addRunCadence(xmlDoc, map[string]int{"2024-09-07T10:00": 150, "2024-09-07T10:01": 171})
+
+	trackpoints := xmlDoc.FindElements("//Trackpoint")
+	assert.Equal(t, activityExtensionNamespace, xmlDoc.Root().SelectAttrValue("xmlns:ns3", ""))
+	assert.Equal(t, "75", trackpoints[0].FindElement("Extensions/ns3:TPX/ns3:RunCadence").Text())
+	assert.Equal(t, "86", trackpoints[1].FindElement("Extensions/TPX/RunCadence").Text())
+	assert.Empty(t, trackpoints[1].FindElement("Extensions/TPX/RunCadence").Space)
+	assert.Len(t, trackpoints[1].FindElements("Extensions/TPX"), 1)
+	assert.Nil(t, trackpoints[2].SelectElement("Extensions"))
+}
+
+func TestActivityExtensionPrefix(t *testing.T) {
+	tests := []struct {
+		testName string
+		root     string
+		expected string
+	}{
+		{
+			testName: "SUCCESS - declares ns3",
+			root:     `<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"/>`,
+			expected: "ns3",
+		},
+		{
+			testName: "SUCCESS - keeps the declared prefix",
+			root:     `<TrainingCenterDatabase xmlns:ax="http://www.garmin.com/xmlschemas/ActivityExtension/v2"/>`,
+			expected: "ax",
+		},
+		{
+			testName: "SUCCESS - skips the taken prefixes",
+			root:     `<TrainingCenterDatabase xmlns:ns3="urn:other" xmlns:ns4="urn:another"/>`,
+			expected: "ns5",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			xmlDoc := etree.NewDocument()
+			assert.NoError(t, xmlDoc.ReadFromString(test.root))
+
+			assert.Equal(t, test.expected, activityExtensionPrefix(xmlDoc.Root()))
+			assert.Equal(t, activityExtensionNamespace, xmlDoc.Root().SelectAttrValue("xmlns:"+test.expected, ""))
+			assert.Equal(t, test.expected, activityExtensionPrefix(xmlDoc.Root()))
+		})
+	}
+}
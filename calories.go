@@ -0,0 +1,73 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Namespace of the calories track point extension, TCX only has the calories of the laps
+const caloriesNamespace = "https://github.com/david-biro/FitbitNonLocTcx/Calories/v1"
+
+// Gets the calories burned during the activity minute by minute, their time with the date, e.g.
+// "2024-09-07T10:05:00". The intraday data needs a personal application, or one approved by Fitbit for intraday access
+func fetchCaloriesPerMinute(activity data.Activity) ([]data.CaloriesMinute, error) {
+	start, end, err := activityWindow(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	url := userURL(fmt.Sprintf("activities/calories/date/%s/1d/1min/time/%s/%s.json",
+		activity.StartDate, start.Format("15:04"), end.Format("15:04")))
+	body, err := apiGet(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch calories: %w", err)
+	}
+	var intraday data.CaloriesIntraday
+	if err := json.Unmarshal(body, &intraday); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal calories: %s", err)
+	}
+	minutes := intraday.Intraday.Dataset
+	for i := range minutes {
+		minutes[i].Time = activity.StartDate + "T" + minutes[i].Time
+	}
+	return minutes, nil
+}
+
+// Adds the calories burned in the minute of each track point of the TCX as a track point extension, in kcal
+// per minute. Track points of a minute share its value, it is a rate, not a share of the total
+func addTrackpointCalories(xmlDoc *etree.Document, minutes []data.CaloriesMinute) {
+	calories := map[string]float64{}
+	for _, minute := range minutes {
+		if len(minute.Time) >= len("2006-01-02T15:04") {
+			calories[minute.Time[:len("2006-01-02T15:04")]] = minute.Value
+		}
+	}
+
+	for _, trackpoint := range xmlDoc.FindElements("//Trackpoint") {
+		timeElement := trackpoint.SelectElement("Time")
+		if timeElement == nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, timeElement.Text())
+		if err != nil {
+			continue
+		}
+		value, ok := calories[t.In(userLocation).Format("2006-01-02T15:04")]
+		if !ok {
+			continue
+		}
+
+		extensions := trackpoint.SelectElement("Extensions")
+		if extensions == nil {
+			extensions = trackpoint.CreateElement("Extensions")
+		}
+		element := extensions.CreateElement("CaloriesPerMinute")
+		element.CreateAttr("xmlns", caloriesNamespace)
+		element.SetText(strconv.FormatFloat(value, 'f', -1, 64))
+	}
+}
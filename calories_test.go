@@ -0,0 +1,49 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestFetchCaloriesPerMinute(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1/user/-/activities/calories/date/2024-09-07/1d/1min/time/10:00/10:30.json", r.URL.Path)
+		w.Write([]byte(`{"activities-calories":[{"dateTime":"2024-09-07","value":"2345"}],
+			"activities-calories-intraday":{"dataset":[{"level":2,"mets":62,"time":"10:00:00","value":7.25},{"level":3,"mets":95,"time":"10:01:00","value":11.1}],"datasetInterval":1,"datasetType":"minute"}}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	minutes, err := fetchCaloriesPerMinute(data.Activity{LogID: 1, StartDate: "2024-09-07", StartTime: "10:00", Duration: 1800000})
+	assert.NoError(t, err)
+	assert.Equal(t, []data.CaloriesMinute{
+		{Time: "2024-09-07T10:00:00", Value: 7.25, Level: 2, Mets: 62},
+		{Time: "2024-09-07T10:01:00", Value: 11.1, Level: 3, Mets: 95},
+	}, minutes)
+}
+
+func TestAddTrackpointCalories(t *testing.T) {
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Other"><Lap><Track>
+		<Trackpoint><Time>2024-09-07T08:00:30Z</Time></Trackpoint>
+		<Trackpoint><Time>2024-09-07T10:01:10.000+02:00</Time><Extensions><TPX xmlns="http://www.garmin.com/xmlschemas/ActivityExtension/v2"><Speed>3.1</Speed></TPX></Extensions></Trackpoint>
+		<Trackpoint><Time>2024-09-07T08:02:00Z</Time></Trackpoint>
+		</Track></Lap></Activity></Activities></TrainingCenterDatabase>`))
+
+	addTrackpointCalories(xmlDoc, []data.CaloriesMinute{{Time: "2024-09-07T10:00:00", Value: 7.25}, {Time: "2024-09-07T10:01:00", Value: 11.1}})
+
+	trackpoints := xmlDoc.FindElements("//Trackpoint")
+	assert.Equal(t, "7.25", trackpoints[0].FindElement("Extensions/CaloriesPerMinute").Text())
+	assert.Equal(t, caloriesNamespace, trackpoints[0].FindElement("Extensions/CaloriesPerMinute").SelectAttrValue("xmlns", ""))
+	assert.Equal(t, "11.1", trackpoints[1].FindElement("Extensions/CaloriesPerMinute").Text())
+	assert.Equal(t, "3.1", trackpoints[1].FindElement("Extensions/TPX/Speed").Text())
+	assert.Nil(t, trackpoints[2].SelectElement("Extensions"))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// The activity type catalog rarely changes, the cached copy is fetched again after a month
+const catalogMaxAge = 30 * 24 * time.Hour
+
+// TCX sports of the catalog categories, the activities of the other categories are Other
+var categorySports = map[string]string{
+	"Running":   "Running",
+	"Bicycling": "Biking",
+}
+
+// Activity types of the built-in sport mappings, by activity ID. Their names depend on the language of
+// the account, e.g. "Schwimmen" for Swim
+const (
+	activityTypeWeights       = 2030
+	activityTypeWorkout       = 3000
+	activityTypeTreadmill     = 20047
+	activityTypeStairclimber  = 20048
+	activityTypeRowingMachine = 20050
+	activityTypeYoga          = 52001
+	activityTypeSpinning      = 55001
+	activityTypeRun           = 90009
+	activityTypeWalk          = 90013
+	activityTypeElliptical    = 90017
+	activityTypeSwim          = 90024
+)
+
+// TCX sport of each activity type of the catalog by activity ID, nil when the catalog is not loaded
+var activitySports map[int]string
+
+// Returns the location of the cached activity type catalog, ~/.cache/fitbittcx/activities.json
+func catalogCacheFile() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %s", err)
+	}
+	return filepath.Join(cacheDir, "fitbittcx", "activities.json"), nil
+}
+
+// Gets the public activity type catalog, from the cache file when it is recent enough, otherwise from the API,
+// then cached. Without a cache file, e.g. in the demo, it is always fetched
+func loadActivityCatalog(fileName string) (data.ActivityCatalog, error) {
+	var body []byte
+	if info, err := os.Stat(fileName); err == nil && time.Since(info.ModTime()) <= catalogMaxAge {
+		body, _ = os.ReadFile(fileName)
+	}
+	if body == nil {
+		var err error
+		if body, err = apiGet(apiURL("activities.json")); err != nil {
+			return data.ActivityCatalog{}, fmt.Errorf("failed to fetch activity catalog: %w", err)
+		}
+		if fileName != "" {
+			if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+				return data.ActivityCatalog{}, fmt.Errorf("failed to create cache directory: %s", err)
+			}
+			if err := os.WriteFile(fileName, body, 0600); err != nil {
+				return data.ActivityCatalog{}, fmt.Errorf("failed to cache activity catalog: %s", err)
+			}
+		}
+	}
+
+	var catalog data.ActivityCatalog
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		return data.ActivityCatalog{}, fmt.Errorf("failed to unmarshal activity catalog: %s", err)
+	}
+	return catalog, nil
+}
+
+// Gets the TCX sport of every activity type of the catalog
+func loadActivitySports(fileName string) (map[int]string, error) {
+	catalog, err := loadActivityCatalog(fileName)
+	if err != nil {
+		return nil, err
+	}
+	sports := map[int]string{}
+	for _, category := range catalog.Categories {
+		sport, ok := categorySports[category.Name]
+		if !ok {
+			sport = "Other"
+		}
+		addCategorySports(sports, category, sport)
+	}
+	return sports, nil
+}
+
+// Assigns the sport to the activity types of the category and of its subcategories
+func addCategorySports(sports map[int]string, category data.ActivityCategory, sport string) {
+	for _, activityType := range category.Activities {
+		sports[activityType.ID] = sport
+	}
+	for _, subCategory := range category.SubCategories {
+		addCategorySports(sports, subCategory, sport)
+	}
+}
+
+// Finds the activity type of the name in the catalog, case-insensitively, e.g. "swim"
+func findActivityType(categories []data.ActivityCategory, name string) (data.CatalogActivityType, bool) {
+	for _, category := range categories {
+		for _, activityType := range category.Activities {
+			if strings.EqualFold(activityType.Name, name) {
+				return activityType, true
+			}
+		}
+		if activityType, ok := findActivityType(category.SubCategories, name); ok {
+			return activityType, true
+		}
+	}
+	return data.CatalogActivityType{}, false
+}
+
+// Sets the TCX sport of the activity type, or of its parent type, from the catalog. The sport Fitbit wrote
+// is kept for activity types missing from the catalog
+func setCatalogSport(xmlDoc *etree.Document, activity data.Activity) {
+	sport, ok := activitySports[activity.ActivityID]
+	if !ok {
+		sport, ok = activitySports[activity.ActivityParentID]
+	}
+	element := xmlDoc.FindElement("/TrainingCenterDatabase/Activities/Activity")
+	if !ok || element == nil {
+		return
+	}
+	element.CreateAttr("Sport", sport)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+const testActivityCatalog = `{"categories":[
+	{"id":1,"name":"Running","activities":[{"id":90009,"name":"Run","hasSpeed":true}],"subCategories":[
+		{"id":11,"name":"Treadmill","activities":[{"id":90019,"name":"Treadmill","hasSpeed":true}]}]},
+	{"id":2,"name":"Bicycling","activities":[{"id":90001,"name":"Bike","hasSpeed":true}]},
+	{"id":3,"name":"Sports and Workouts","activities":[{"id":52001,"name":"Yoga","hasSpeed":false}]}]}`
+
+func TestLoadActivitySports(t *testing.T) {
+	requests := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1/activities.json", r.URL.Path)
+		requests++
+		w.Write([]byte(testActivityCatalog))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	fileName := filepath.Join(t.TempDir(), "fitbittcx", "activities.json")
+	expected := map[int]string{90009: "Running", 90019: "Running", 90001: "Biking", 52001: "Other"}
+
+	sports, err := loadActivitySports(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, sports)
+	assert.FileExists(t, fileName)
+
+	// From the cache
+	sports, err = loadActivitySports(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, sports)
+	assert.Equal(t, 1, requests)
+
+	// Fetched again once outdated
+	outdated := time.Now().Add(-catalogMaxAge - time.Hour)
+	assert.NoError(t, os.Chtimes(fileName, outdated, outdated))
+	_, err = loadActivitySports(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestSetCatalogSport(t *testing.T) {
+	activitySports = map[int]string{90009: "Running", 90001: "Biking", 52001: "Other"}
+	defer func() { activitySports = nil }()
+
+	testCases := []struct {
+		testName string
+		activity data.Activity
+		expected string
+	}{
+		{"SUCCESS - Activity type", data.Activity{ActivityID: 90001, ActivityParentID: 90001}, "Biking"},
+		{"SUCCESS - Parent activity type", data.Activity{ActivityID: 12345, ActivityParentID: 90009}, "Running"},
+		{"SUCCESS - Activity type without speed", data.Activity{ActivityID: 52001}, "Other"},
+		{"SUCCESS - Unknown activity type", data.Activity{ActivityID: 1}, "Running"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			xmlDoc := etree.NewDocument()
+			assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Running"><Id>2024-09-07T10:00:00.000+02:00</Id><Creator/></Activity></Activities></TrainingCenterDatabase>`))
+
+			setCatalogSport(xmlDoc, tc.activity)
+			assert.Equal(t, tc.expected, xmlDoc.FindElement("//Activity").SelectAttrValue("Sport", ""))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Shared HTTP client of the OAuth token requests and the Fitbit API calls, its connections are kept alive and
+// reused by the following requests. The transport honors the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+var httpClient = &http.Client{Timeout: time.Minute, Transport: newTransport()}
+
+// Creates the transport of the shared client. It keeps an idle connection for each parallel export, the default
+// transport only keeps 2 per host and reconnects for the others
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxConcurrency
+	return transport
+}
+
+// Routes all requests of the shared client through the given proxy, overriding the environment variables
+func configureProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("failed to parse proxy URL: %s", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("unsupported proxy URL %q, use http://, https:// or socks5://host:port", proxy)
+	}
+
+	transport := newTransport()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	httpClient.Transport = transport
+	return nil
+}
+
+// Base URL of the Fitbit Web API, replaced with --api-base, e.g. by a mock server for testing
+var apiBase = "https://api.fitbit.com"
+
+// Fitbit user ID of the data requested, "-" for the authorized user, replaced with --user
+var apiUser = "-"
+
+// Fitbit user ID, its encoded ID, e.g. "ABC123"
+var fitbitUserID = regexp.MustCompile(`^[0-9A-Z]+$`)
+
+// Versions of the endpoints not at version 1, by resource, the first path element after user/<user ID>/
+var apiVersions = map[string]string{
+	"sleep":       "1.2",
+	"oauth2":      "1.1",
+	"leaderboard": "1.1",
+}
+
+// Returns the URL of the endpoint, e.g. of "activities.json", with the version of its resource
+func apiURL(path string) string {
+	resource := path
+	if userPath, ok := strings.CutPrefix(path, "user/"); ok {
+		_, resource, _ = strings.Cut(userPath, "/")
+	}
+	resource, _, _ = strings.Cut(resource, "/")
+	version, ok := apiVersions[strings.TrimSuffix(resource, ".json")]
+	if !ok {
+		version = "1"
+	}
+	return apiBase + "/" + version + "/" + path
+}
+
+// Returns the URL of the endpoint of the data of the user, e.g. of "activities/date/2024-09-07.json"
+func userURL(path string) string {
+	return apiURL("user/" + apiUser + "/" + path)
+}
+
+// Sets the Fitbit user whose data is requested, e.g. "ABC123" of a family member who authorized the app
+func configureAPIUser(userID string) error {
+	if userID == "" {
+		return nil
+	}
+	if !fitbitUserID.MatchString(userID) {
+		return fmt.Errorf("invalid Fitbit user ID %q, e.g. ABC123", userID)
+	}
+	apiUser = userID
+	return nil
+}
+
+// Sets the base URL of the API requests, e.g. http://localhost:9000
+func configureAPIBase(base string) error {
+	if base == "" {
+		return nil
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+		return fmt.Errorf("invalid API base URL %q, use http(s)://host[:port]", base)
+	}
+	apiBase = strings.TrimSuffix(base, "/")
+	return nil
+}
+
+// Returns a context making the oauth2 package use the shared HTTP client
+func clientContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+}
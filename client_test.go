@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestConfigureProxy(t *testing.T) {
+	transport := httpClient.Transport
+	defer func() { httpClient.Transport = transport }()
+
+	// The proxy receives the absolute request URI of the API call and of the token exchange
+	var proxied []string
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		if r.URL.Path == "/oauth2/token" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"access","token_type":"Bearer","expires_in":28800}`))
+			return
+		}
+		w.Write([]byte(`{"activities":[]}`))
+	}))
+	defer proxyServer.Close()
+
+	assert.NoError(t, configureProxy(proxyServer.URL))
+
+	body, status, err := doAPIRequest(http.MethodGet, "http://api.fitbit.invalid/1/user/-/activities/date/2024-09-07.json", nil, "access")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"activities":[]}`, string(body))
+
+	oauthCfg = &oauth2.Config{ClientID: "test-client-id", Endpoint: oauth2.Endpoint{TokenURL: "http://api.fitbit.invalid/oauth2/token", AuthStyle: oauth2.AuthStyleInParams}}
+	_, err = exchangeCode(context.Background(), "abc123", "testverifier")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"http://api.fitbit.invalid/1/user/-/activities/date/2024-09-07.json", "http://api.fitbit.invalid/oauth2/token"}, proxied)
+}
+
+func TestConfigureProxyInvalid(t *testing.T) {
+	transport := httpClient.Transport
+	defer func() { httpClient.Transport = transport }()
+
+	assert.NoError(t, configureProxy(""))
+	assert.Same(t, transport, httpClient.Transport)
+	assert.Error(t, configureProxy("ftp://proxy:21"))
+	assert.Error(t, configureProxy("http://proxy host:3128"))
+}
+
+func TestAPIURL(t *testing.T) {
+	testCases := []struct {
+		testName string
+		url      string
+		expected string
+	}{
+		{"SUCCESS - User endpoint", userURL("activities/date/2024-09-07.json"), "https://api.fitbit.com/1/user/-/activities/date/2024-09-07.json"},
+		{"SUCCESS - User resource file", userURL("profile.json"), "https://api.fitbit.com/1/user/-/profile.json"},
+		{"SUCCESS - Version override", userURL("sleep/date/2024-09-01/2024-09-30.json"), "https://api.fitbit.com/1.2/user/-/sleep/date/2024-09-01/2024-09-30.json"},
+		{"SUCCESS - Leaderboard version", userURL("leaderboard/friends.json"), "https://api.fitbit.com/1.1/user/-/leaderboard/friends.json"},
+		{"SUCCESS - Public endpoint", apiURL("activities.json"), "https://api.fitbit.com/1/activities.json"},
+		{"SUCCESS - Token introspection", apiURL("oauth2/introspect"), "https://api.fitbit.com/1.1/oauth2/introspect"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.url)
+		})
+	}
+}
+
+func TestConfigureAPIBase(t *testing.T) {
+	defer func() { apiBase = "https://api.fitbit.com" }()
+
+	assert.NoError(t, configureAPIBase(""))
+	assert.Equal(t, "https://api.fitbit.com/1/user/-/profile.json", userURL("profile.json"))
+	assert.NoError(t, configureAPIBase("http://localhost:9000/"))
+	assert.Equal(t, "http://localhost:9000/1/user/-/profile.json", userURL("profile.json"))
+	assert.Error(t, configureAPIBase("localhost:9000"))
+	assert.Error(t, configureAPIBase("ftp://localhost"))
+}
+
+func TestConfigureAPIUser(t *testing.T) {
+	defer func() { apiUser = "-" }()
+
+	testCases := []struct {
+		testName    string
+		userID      string
+		expectedURL string
+		expectedErr bool
+	}{
+		{"SUCCESS - Authorized user", "", "https://api.fitbit.com/1/user/-/activities/date/2024-09-07.json", false},
+		{"SUCCESS - Other user", "ABC123", "https://api.fitbit.com/1/user/ABC123/activities/date/2024-09-07.json", false},
+		{"FAILURE - Lowercase user ID", "abc123", "", true},
+		{"FAILURE - Path in user ID", "ABC123/../-", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			apiUser = "-"
+			err := configureAPIUser(tc.userID)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				assert.Equal(t, "-", apiUser)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedURL, userURL("activities/date/2024-09-07.json"))
+		})
+	}
+
+	// The version of the resource does not depend on the user
+	apiUser = "ABC123"
+	assert.Equal(t, "https://api.fitbit.com/1.2/user/ABC123/sleep/date/2024-09-01/2024-09-30.json", userURL("sleep/date/2024-09-01/2024-09-30.json"))
+}
+
+func TestSharedTransport(t *testing.T) {
+	transport, ok := httpClient.Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t, maxConcurrency, transport.MaxIdleConnsPerHost)
+	assert.False(t, transport.DisableKeepAlives)
+
+	// Every request reuses the connection of the previous one
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	for i := 0; i < 3; i++ {
+		_, _, err := doAPIRequest(http.MethodGet, server.URL+"/1/user/-/profile.json", nil, "access")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), connections.Load())
+}
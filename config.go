@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Persistent defaults, read from config.yaml. Every key except "sports" and "privacy-zones" is the name of a command
+// line flag (e.g. out-dir, filename, type), its value is used when the flag is not given on the command line:
+//
+//	out-dir: ~/tcx
+//	filename: "{date}/{sport}-{logid}"
+//	exclude-type: [Walk, Run]
+//	sports:
+//	  Treadmill: Running
+//	privacy-zones:
+//	  home: {latitude: 47.4979, longitude: 19.0402}
+type fileConfig struct {
+	flags        map[string]string       // Flag name to value
+	sports       map[string]sportMapping // Fitbit activity ID or lower case activity name to sport mapping
+	privacyZones []privacyZone           // Places whose track points lose their positions, by name
+}
+
+// Sports of the TCX schema, those of config.yaml. The built-in Swim of the swims, which they have always been
+// exported with, is outside of it and cannot be configured
+var tcxSports = []string{"Running", "Biking", "Other"}
+
+// Returns the default location of the configuration file, ~/.config/fitbittcx/config.yaml
+func defaultConfigFile() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %s", err)
+	}
+	return filepath.Join(configDir, "fitbittcx", "config.yaml"), nil
+}
+
+// Reads the configuration file, a missing file is an empty configuration
+func loadConfig(fileName string) (*fileConfig, error) {
+	cfg := &fileConfig{flags: map[string]string{}, sports: map[string]sportMapping{}}
+	byteValue, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %s", err)
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(byteValue, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %s", fileName, err)
+	}
+	for key, value := range values {
+		if key == "sports" {
+			sports, ok := stringKeys(value)
+			if !ok {
+				return nil, fmt.Errorf("config file %s: sports must map activity names or IDs to TCX sports", fileName)
+			}
+			for name, value := range sports {
+				mapping, err := parseSportMapping(name, value)
+				if err != nil {
+					return nil, fmt.Errorf("config file %s: %s", fileName, err)
+				}
+				cfg.sports[strings.ToLower(name)] = mapping
+			}
+			continue
+		}
+		if key == "privacy-zones" {
+			zones, ok := stringKeys(value)
+			if !ok {
+				return nil, fmt.Errorf("config file %s: privacy-zones must map names to a latitude, a longitude and a radius", fileName)
+			}
+			for name, value := range zones {
+				zone, err := parsePrivacyZone(name, value)
+				if err != nil {
+					return nil, fmt.Errorf("config file %s: %s", fileName, err)
+				}
+				cfg.privacyZones = append(cfg.privacyZones, zone)
+			}
+			sort.Slice(cfg.privacyZones, func(i, j int) bool { return cfg.privacyZones[i].name < cfg.privacyZones[j].name })
+			continue
+		}
+		cfg.flags[key] = configValue(value)
+	}
+	return cfg, nil
+}
+
+// Converts a YAML value to the string form of a flag value, lists are comma separated and "~/" is the home directory
+func configValue(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	s := fmt.Sprint(value)
+	if strings.HasPrefix(s, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			s = filepath.Join(home, s[2:])
+		}
+	}
+	return s
+}
+
+// Sets the flags not given on the command line to the values of the configuration
+func (cfg *fileConfig) apply(fs *flag.FlagSet) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	names := make([]string, 0, len(cfg.flags))
+	for name := range cfg.flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("unknown config key %q", name)
+		}
+		if given[name] {
+			continue
+		}
+		if err := fs.Set(name, cfg.flags[name]); err != nil {
+			return fmt.Errorf("invalid config value of %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Returns the YAML mapping with its keys as strings, e.g. the activity IDs of the sports
+func stringKeys(value interface{}) (map[string]interface{}, bool) {
+	switch mapping := value.(type) {
+	case map[string]interface{}:
+		return mapping, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(mapping))
+		for key, value := range mapping {
+			converted[fmt.Sprint(key)] = value
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+// Returns the item equal to s ignoring case, as spelled in the items
+func findFold(items []string, s string) (string, bool) {
+	for _, item := range items {
+		if strings.EqualFold(item, s) {
+			return item, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(fileName, []byte(`
+out-dir: /data/tcx
+filename: "{date}/{sport}-{logid}"
+exclude-type: [Walk, Run]
+all: true
+sports:
+  Treadmill: Running
+  Spinning: biking
+privacy-zones:
+  work: {latitude: 47.5136, longitude: 19.0560, radius: 300}
+  home: {latitude: 47.4979, longitude: 19.0402}
+`), 0600))
+
+	cfg, err := loadConfig(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"out-dir": "/data/tcx", "filename": "{date}/{sport}-{logid}", "exclude-type": "Walk,Run", "all": "true"}, cfg.flags)
+	assert.Equal(t, map[string]sportMapping{"treadmill": {sport: "Running"}, "spinning": {sport: "Biking"}}, cfg.sports)
+	assert.Equal(t, []privacyZone{{name: "home", latitude: 47.4979, longitude: 19.0402, radius: 200}, {name: "work", latitude: 47.5136, longitude: 19.0560, radius: 300}}, cfg.privacyZones)
+
+	// A missing file is an empty configuration
+	cfg, err = loadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.flags)
+
+	assert.NoError(t, os.WriteFile(fileName, []byte("sports:\n  Swim: Swimming\n"), 0600))
+	_, err = loadConfig(fileName)
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(fileName, []byte("privacy-zones:\n  home: {latitude: 47.4979}\n"), 0600))
+	_, err = loadConfig(fileName)
+	assert.Error(t, err)
+
+	// JSON is YAML too
+	assert.NoError(t, os.WriteFile(fileName, []byte(`{"all": true, "sports": {"90025": {"sport": "Other", "recipes": ["pool-lengths"]}}}`), 0600))
+	cfg, err = loadConfig(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"all": "true"}, cfg.flags)
+	assert.Equal(t, map[string]sportMapping{"90025": {sport: "Other", recipes: []string{recipePoolLengths}}}, cfg.sports)
+
+	assert.NoError(t, os.WriteFile(fileName, []byte("out-dir: [\n"), 0600))
+	_, err = loadConfig(fileName)
+	assert.Error(t, err)
+}
+
+func TestConfigApply(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *string, *string, *bool) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		outDir := fs.String("out-dir", "", "")
+		filename := fs.String("filename", defaultFileTemplate, "")
+		all := fs.Bool("all", false, "")
+		return fs, outDir, filename, all
+	}
+	cfg := &fileConfig{flags: map[string]string{"out-dir": "/data/tcx", "filename": "{date}-{logid}", "all": "true"}}
+
+	// Command line flags take precedence over the configuration
+	fs, outDir, filename, all := newFlags()
+	assert.NoError(t, fs.Parse([]string{"--out-dir", "/tmp/tcx", "2024-09-07"}))
+	assert.NoError(t, cfg.apply(fs))
+	assert.Equal(t, "/tmp/tcx", *outDir)
+	assert.Equal(t, "{date}-{logid}", *filename)
+	assert.True(t, *all)
+	assert.Equal(t, []string{"2024-09-07"}, fs.Args())
+
+	fs, _, _, _ = newFlags()
+	assert.Error(t, (&fileConfig{flags: map[string]string{"outdir": "/data"}}).apply(fs))
+	assert.Error(t, (&fileConfig{flags: map[string]string{"all": "sometimes"}}).apply(fs))
+}
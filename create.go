@@ -0,0 +1,89 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Activity to log manually, given to the log create command
+type manualActivity struct {
+	sport    string        // Activity type of the catalog, e.g. "Swim"
+	start    time.Time     // Local start, its time zone is ignored
+	duration time.Duration // e.g. 45m
+	distance float64       // In the unit system of the API requests, 0 without distance
+	calories int           // 0 to let Fitbit estimate them, needed for names missing from the catalog
+}
+
+// Parses the arguments following the log command: create and its flags
+func parseLogArgs(args []string) (manualActivity, error) {
+	if len(args) == 0 || args[0] != "create" {
+		return manualActivity{}, fmt.Errorf("unknown log command, use: log create --sport NAME --start DATETIME --duration DURATION")
+	}
+	fs := flag.NewFlagSet("log create", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	sport := fs.String("sport", "", "activity type, e.g. Swim, as in the activity catalog of Fitbit")
+	start := fs.String("start", "", "local start, e.g. 2024-09-07T18:30")
+	duration := fs.Duration("duration", 0, "duration, e.g. 45m or 1h10m")
+	distance := fs.Float64("distance", 0, "distance in kilometers, or miles with imperial units")
+	calories := fs.Int("calories", 0, "calories burned, estimated by Fitbit when not given")
+	if err := fs.Parse(args[1:]); err != nil {
+		return manualActivity{}, fmt.Errorf("log create: %s", err)
+	}
+	if fs.NArg() != 0 || *sport == "" || *start == "" || *duration <= 0 {
+		return manualActivity{}, fmt.Errorf("log create needs --sport, --start and a positive --duration")
+	}
+	if *distance < 0 || *calories < 0 {
+		return manualActivity{}, fmt.Errorf("log create: the distance and the calories cannot be negative")
+	}
+	var startTime time.Time
+	var err error
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04"} {
+		if startTime, err = time.Parse(layout, *start); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return manualActivity{}, fmt.Errorf("invalid --start %q, use YYYY-MM-DDTHH:MM", *start)
+	}
+	return manualActivity{sport: *sport, start: startTime, duration: *duration, distance: *distance, calories: *calories}, nil
+}
+
+// Logs the activity at Fitbit, e.g. a workout recorded elsewhere. The sport is looked up in the activity
+// catalog, a name missing from it is logged as a custom activity, which needs the calories
+func createActivityLog(out io.Writer, activity manualActivity, catalog data.ActivityCatalog) error {
+	form := url.Values{}
+	if activityType, ok := findActivityType(catalog.Categories, activity.sport); ok {
+		form.Set("activityId", strconv.Itoa(activityType.ID))
+	} else if activity.calories > 0 {
+		form.Set("activityName", activity.sport)
+	} else {
+		return withExitCode(exitUsage, fmt.Errorf("%q is not in the activity catalog of Fitbit, give its --calories to log it as a custom activity", activity.sport))
+	}
+	if activity.calories > 0 {
+		form.Set("manualCalories", strconv.Itoa(activity.calories))
+	}
+	form.Set("date", activity.start.Format(dateLayout))
+	form.Set("startTime", activity.start.Format("15:04"))
+	form.Set("durationMillis", strconv.FormatInt(activity.duration.Milliseconds(), 10))
+	if activity.distance > 0 {
+		form.Set("distance", strconv.FormatFloat(activity.distance, 'f', -1, 64))
+	}
+
+	body, err := apiPost(userURL("activities.json"), form)
+	if err != nil {
+		return fmt.Errorf("failed to log the activity: %w", err)
+	}
+	var created data.CreatedActivityLog
+	if err := json.Unmarshal(body, &created); err != nil {
+		return fmt.Errorf("failed to unmarshal the logged activity: %s", err)
+	}
+	fmt.Fprintf(out, "Logged %s on %s at %s, log ID %d\n", created.ActivityLog.ActivityName, created.ActivityLog.StartDate,
+		created.ActivityLog.StartTime, created.ActivityLog.LogID)
+	return nil
+}
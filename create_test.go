@@ -0,0 +1,83 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestParseLogArgs(t *testing.T) {
+	testCases := []struct {
+		testName string
+		args     []string
+		expected manualActivity
+		err      bool
+	}{
+		{"SUCCESS - Swim", []string{"create", "--sport", "Swim", "--start", "2024-09-07T18:30", "--duration", "45m", "--distance", "1.5"},
+			manualActivity{sport: "Swim", start: time.Date(2024, 9, 7, 18, 30, 0, 0, time.UTC), duration: 45 * time.Minute, distance: 1.5}, false},
+		{"SUCCESS - Start with space and calories", []string{"create", "--sport", "Bouldering", "--start", "2024-09-07 18:30", "--duration", "1h", "--calories", "400"},
+			manualActivity{sport: "Bouldering", start: time.Date(2024, 9, 7, 18, 30, 0, 0, time.UTC), duration: time.Hour, calories: 400}, false},
+		{"FAILURE - Unknown subcommand", []string{"delete"}, manualActivity{}, true},
+		{"FAILURE - Without sport", []string{"create", "--start", "2024-09-07T18:30", "--duration", "45m"}, manualActivity{}, true},
+		{"FAILURE - Without duration", []string{"create", "--sport", "Swim", "--start", "2024-09-07T18:30"}, manualActivity{}, true},
+		{"FAILURE - Invalid start", []string{"create", "--sport", "Swim", "--start", "yesterday", "--duration", "45m"}, manualActivity{}, true},
+		{"FAILURE - Negative distance", []string{"create", "--sport", "Swim", "--start", "2024-09-07T18:30", "--duration", "45m", "--distance", "-1"}, manualActivity{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			activity, err := parseLogArgs(tc.args)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.expected, activity)
+		})
+	}
+}
+
+func TestCreateActivityLog(t *testing.T) {
+	catalog := data.ActivityCatalog{Categories: []data.ActivityCategory{
+		{Name: "Water Activities", SubCategories: []data.ActivityCategory{{Name: "Swimming", Activities: []data.CatalogActivityType{{ID: 90024, Name: "Swim"}}}}},
+	}}
+	start := time.Date(2024, 9, 7, 18, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		testName string
+		activity manualActivity
+		expected map[string]string
+		err      bool
+	}{
+		{"SUCCESS - Activity of the catalog", manualActivity{sport: "swim", start: start, duration: 45 * time.Minute, distance: 1.5},
+			map[string]string{"activityId": "90024", "date": "2024-09-07", "startTime": "18:30", "durationMillis": "2700000", "distance": "1.5"}, false},
+		{"SUCCESS - Custom activity", manualActivity{sport: "Bouldering", start: start, duration: time.Hour, calories: 400},
+			map[string]string{"activityName": "Bouldering", "manualCalories": "400", "date": "2024-09-07", "startTime": "18:30", "durationMillis": "3600000"}, false},
+		{"FAILURE - Custom activity without calories", manualActivity{sport: "Bouldering", start: start, duration: time.Hour}, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			var form map[string]string
+			stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/1/user/-/activities.json", r.URL.Path)
+				assert.NoError(t, r.ParseForm())
+				form = map[string]string{}
+				for key := range r.PostForm {
+					form[key] = r.PostForm.Get(key)
+				}
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"activityLog":{"activityId":90024,"logId":12345,"name":"Swim","startDate":"2024-09-07","startTime":"18:30"}}`))
+			}))
+			token = &oauth2.Token{AccessToken: "access"}
+
+			var out bytes.Buffer
+			err := createActivityLog(&out, tc.activity, catalog)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.expected, form)
+			if !tc.err {
+				assert.Equal(t, "Logged Swim on 2024-09-07 at 18:30, log ID 12345\n", out.String())
+			}
+		})
+	}
+}
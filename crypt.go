@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/term"
+)
+
+// Encrypts and decrypts files with age (https://age-encryption.org), using an identity file or a passphrase
+type ageCrypter struct {
+	identityFile   string                 // Path of an age identity (key) file, the passphrase is used when empty
+	passphrase     string                 // Passphrase, asked only once per run
+	workFactor     int                    // scrypt work factor of new passphrase encrypted files, age's default when 0
+	readPassphrase func() (string, error) // Asks for the passphrase
+}
+
+// Reports whether the data is an age encrypted file, binary or armored
+func isAgeEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("age-encryption.org/")) || bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header))
+}
+
+// Decrypts an age encrypted file, binary or armored
+func (c *ageCrypter) Decrypt(ciphertext []byte) ([]byte, error) {
+	identities, err := c.identities()
+	if err != nil {
+		return nil, err
+	}
+
+	var src io.Reader = bytes.NewReader(ciphertext)
+	if bytes.HasPrefix(bytes.TrimSpace(ciphertext), []byte(armor.Header)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(ciphertext)))
+	}
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %s", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %s", err)
+	}
+	return plaintext, nil
+}
+
+// Encrypts the data to the identity file's recipients or with the passphrase
+func (c *ageCrypter) Encrypt(plaintext []byte) ([]byte, error) {
+	recipients, err := c.recipients()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %s", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns the identities of the identity file, or a scrypt identity of the passphrase
+func (c *ageCrypter) identities() ([]age.Identity, error) {
+	if c.identityFile != "" {
+		f, err := os.Open(c.identityFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open age identity file: %s", err)
+		}
+		defer f.Close()
+		identities, err := age.ParseIdentities(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse age identity file: %s", err)
+		}
+		return identities, nil
+	}
+
+	passphrase, err := c.getPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return []age.Identity{identity}, nil
+}
+
+// Returns the recipients of the identity file's X25519 keys, or a scrypt recipient of the passphrase
+func (c *ageCrypter) recipients() ([]age.Recipient, error) {
+	if c.identityFile != "" {
+		identities, err := c.identities()
+		if err != nil {
+			return nil, err
+		}
+		recipients := []age.Recipient{}
+		for _, identity := range identities {
+			if x25519, ok := identity.(*age.X25519Identity); ok {
+				recipients = append(recipients, x25519.Recipient())
+			}
+		}
+		if len(recipients) == 0 {
+			return nil, fmt.Errorf("no X25519 key found in age identity file %s", c.identityFile)
+		}
+		return recipients, nil
+	}
+
+	passphrase, err := c.getPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if c.workFactor > 0 {
+		recipient.SetWorkFactor(c.workFactor)
+	}
+	return []age.Recipient{recipient}, nil
+}
+
+// Asks for the passphrase on the first use
+func (c *ageCrypter) getPassphrase() (string, error) {
+	if c.passphrase == "" {
+		passphrase, err := c.readPassphrase()
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %s", err)
+		}
+		if passphrase == "" {
+			return "", fmt.Errorf("error: empty passphrase")
+		}
+		c.passphrase = passphrase
+	}
+	return c.passphrase, nil
+}
+
+// Prompts for the passphrase on the terminal without echo, or reads a line from a non-terminal stdin
+func promptPassphrase() (string, error) {
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	defer fmt.Fprintln(os.Stderr)
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+		return string(passphrase), err
+	}
+	passphrase, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && passphrase == "" {
+		return "", err
+	}
+	return strings.TrimRight(passphrase, "\r\n"), nil
+}
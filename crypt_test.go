@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestAgeCrypterPassphrase(t *testing.T) {
+	prompts := 0
+	crypter := &ageCrypter{workFactor: 10, readPassphrase: func() (string, error) {
+		prompts++
+		return "correct horse battery staple", nil
+	}}
+
+	ciphertext, err := crypter.Encrypt([]byte(`{"clientID":"test-client-id"}`))
+	assert.NoError(t, err)
+	assert.True(t, isAgeEncrypted(ciphertext))
+
+	plaintext, err := crypter.Decrypt(ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"clientID":"test-client-id"}`, string(plaintext))
+	assert.Equal(t, 1, prompts, "the passphrase is asked only once")
+
+	wrong := &ageCrypter{readPassphrase: func() (string, error) { return "wrong", nil }}
+	_, err = wrong.Decrypt(ciphertext)
+	assert.Error(t, err)
+
+	empty := &ageCrypter{readPassphrase: func() (string, error) { return "", nil }}
+	_, err = empty.Encrypt([]byte("data"))
+	assert.Error(t, err)
+}
+
+func TestAgeCrypterIdentityFile(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	assert.NoError(t, os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600))
+
+	// Armored file, as written by "age -a -r <recipient>"
+	var buf bytes.Buffer
+	armorWriter := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armorWriter, identity.Recipient())
+	assert.NoError(t, err)
+	w.Write([]byte("secret"))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, armorWriter.Close())
+	assert.True(t, isAgeEncrypted(buf.Bytes()))
+
+	crypter := &ageCrypter{identityFile: identityFile}
+	plaintext, err := crypter.Decrypt(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	ciphertext, err := crypter.Encrypt([]byte("secret"))
+	assert.NoError(t, err)
+	plaintext, err = crypter.Decrypt(ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	assert.False(t, isAgeEncrypted([]byte(`{"clientID":""}`)))
+}
+
+func TestEncryptedTokenStore(t *testing.T) {
+	crypter := &ageCrypter{workFactor: 10, readPassphrase: func() (string, error) { return "passphrase", nil }}
+	store := encryptedTokenStore{fileName: filepath.Join(t.TempDir(), "token.json.age"), crypter: crypter}
+
+	_, err := store.Load()
+	assert.Error(t, err)
+
+	assert.NoError(t, store.Save(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}))
+	ciphertext, err := os.ReadFile(store.fileName)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "refresh")
+
+	loaded, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "access", loaded.AccessToken)
+	assert.Equal(t, "refresh", loaded.RefreshToken)
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -21,14 +22,435 @@ type Activity struct {
 	StartDate            string    `json:"startDate"`
 	StartTime            string    `json:"startTime"`
 	Steps                int       `json:"steps"`
+	Synthetic            bool      `json:"-"` // Made from the all-day steps, not logged in Fitbit
 }
 
 type Activities struct {
 	Activities []Activity `json:"activities"`
+	Summary    DaySummary `json:"summary"`
+}
+
+// Totals of the day, of the daily activity summary
+type DaySummary struct {
+	Steps     int `json:"steps"`
+	Distances []struct {
+		Activity string  `json:"activity"` // "total", "tracker", "loggedActivities", ...
+		Distance float64 `json:"distance"` // In kilometers or miles
+	} `json:"distances"`
 }
 
 type Credentials struct {
-	CId         string `json:"clientID"`
-	CSecret     string `json:"clientSecret"`
-	RedirectURL string `json:"redirectUrl"`
+	CId           string   `json:"clientID"`
+	CSecret       string   `json:"clientSecret"`
+	RedirectURL   string   `json:"redirectUrl"`
+	Scopes        []string `json:"scopes,omitempty"`        // Requested scopes, activity, heartrate, location and profile when empty
+	AppType       string   `json:"appType,omitempty"`       // Fitbit application type: "client", "personal" or "server", detected from CSecret when empty
+	TokenStore    string   `json:"tokenStore,omitempty"`    // "file" (default), "keychain" or "encrypted"
+	ListenAddr    string   `json:"listenAddr,omitempty"`    // Callback server address, derived from RedirectURL when empty
+	CallbackPath  string   `json:"callbackPath,omitempty"`  // Callback handler path, derived from RedirectURL when empty
+	TLSCert       string   `json:"tlsCert,omitempty"`       // Certificate file of the https callback server, self-signed when empty
+	TLSKey        string   `json:"tlsKey,omitempty"`        // Private key file of the https callback server
+	AuthURL       string   `json:"authUrl,omitempty"`       // Authorization endpoint, Fitbit's when empty
+	TokenURL      string   `json:"tokenUrl,omitempty"`      // Token endpoint, Fitbit's when empty
+	PerUserOutput bool     `json:"perUserOutput,omitempty"` // Save the exports into a directory named after the Fitbit user ID
+
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"` // Named profiles, overriding the settings above
+}
+
+// Response of the token introspection endpoint
+type TokenInfo struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope"` // e.g. "{ACTIVITY=READ, HEARTRATE=READ}"
+	ClientID  string `json:"client_id"`
+	UserID    string `json:"user_id"`
+	TokenType string `json:"token_type"`
+	Exp       int64  `json:"exp"` // Expiration time in milliseconds since epoch
+	Iat       int64  `json:"iat"` // Issue time in milliseconds since epoch
+}
+
+// Response of the profile endpoint, only the fields used by the app
+type Profile struct {
+	User ProfileUser `json:"user"`
+}
+
+type ProfileUser struct {
+	EncodedID           string `json:"encodedId"`
+	Timezone            string `json:"timezone"`            // IANA time zone, e.g. "Europe/Budapest"
+	OffsetFromUTCMillis int64  `json:"offsetFromUTCMillis"` // Current offset of the time zone
+	DistanceUnit        string `json:"distanceUnit"`        // Unit system of distances, "en_US" (miles) or "METRIC"
+}
+
+// Entry of the activity log list endpoint, only the fields used by the app
+type ActivityLog struct {
+	LogID          int64   `json:"logId"`
+	ActivityName   string  `json:"activityName"`
+	Description    string  `json:"description"` // Only set for some logs, e.g. manually logged activities
+	ActivityTypeID int     `json:"activityTypeId"`
+	Calories       int     `json:"calories"`
+	Distance       float64 `json:"distance"`
+	DistanceUnit   string  `json:"distanceUnit"`
+	Duration       int64   `json:"duration"`  // Milliseconds
+	StartTime      string  `json:"startTime"` // Local time with offset, e.g. "2024-09-07T18:30:00.000+02:00"
+	Steps          int     `json:"steps"`
+	HasGPS         bool    `json:"hasGps"`
+	PoolLength     float64 `json:"poolLength"`     // Length of the pool of swims
+	PoolLengthUnit string  `json:"poolLengthUnit"` // e.g. "Meter"
+	SwimLengths    int     `json:"swimLengths"`    // Number of pool lengths of swims
+	TcxLink        string  `json:"tcxLink"`
+	Source         struct {
+		ID   string `json:"id"`   // ID of the device, as in the devices endpoint
+		Name string `json:"name"` // e.g. "Charge 6", or the app of a manual log
+		Type string `json:"type"` // e.g. "tracker" or "app"
+	} `json:"source"` // What recorded the activity
+
+	ActiveZoneMinutes struct {
+		TotalMinutes int `json:"totalMinutes"`
+	} `json:"activeZoneMinutes"`
+
+	Raw json.RawMessage `json:"-"` // The entry as received, with all the fields the app does not use
+}
+
+// Entry of the devices endpoint, only the fields used by the app
+type Device struct {
+	ID            string `json:"id"`
+	DeviceVersion string `json:"deviceVersion"` // Model, e.g. "Charge 6"
+	Type          string `json:"type"`          // "TRACKER" or "SCALE"
+	LastSyncTime  string `json:"lastSyncTime"`  // Local time, e.g. "2024-09-08T07:12:34.000"
+}
+
+type ActivityLogList struct {
+	Activities []ActivityLog `json:"activities"`
+	Pagination struct {
+		Next string `json:"next"` // URL of the next page, empty on the last page
+	} `json:"pagination"`
+}
+
+// Response of the intraday Active Zone Minutes endpoint
+type ActiveZoneMinutesIntraday struct {
+	Days []struct {
+		DateTime string                    `json:"dateTime"`
+		Minutes  []ActiveZoneMinutesMinute `json:"minutes"`
+	} `json:"activities-active-zone-minutes-intraday"`
+}
+
+// Active Zone Minutes earned in a minute, only the minutes in a zone are listed
+type ActiveZoneMinutesMinute struct {
+	Minute string `json:"minute"` // Local time, e.g. "2024-09-07T10:00:00"
+	Value  struct {
+		ActiveZoneMinutes        int `json:"activeZoneMinutes"`
+		FatBurnActiveZoneMinutes int `json:"fatBurnActiveZoneMinutes"`
+		CardioActiveZoneMinutes  int `json:"cardioActiveZoneMinutes"`
+		PeakActiveZoneMinutes    int `json:"peakActiveZoneMinutes"`
+	} `json:"value"`
+}
+
+// Entry of the SpO2 summary endpoint, a day without readings has no value
+type SpO2Summary struct {
+	DateTime string `json:"dateTime"`
+	Value    struct {
+		Avg float64 `json:"avg"`
+		Min float64 `json:"min"`
+		Max float64 `json:"max"`
+	} `json:"value"`
+}
+
+// Entry of the SpO2 intraday endpoint, the readings of a night
+type SpO2Intraday struct {
+	DateTime string        `json:"dateTime"`
+	Minutes  []SpO2Reading `json:"minutes"`
+}
+
+type SpO2Reading struct {
+	Minute string  `json:"minute"` // Local time, e.g. "2024-09-07T03:12:00"
+	Value  float64 `json:"value"`  // Percent
+}
+
+// Response of the intraday steps endpoint
+type StepsIntraday struct {
+	Intraday struct {
+		Dataset []struct {
+			Time  string `json:"time"` // Local time of the day, e.g. "10:05:00"
+			Value int    `json:"value"`
+		} `json:"dataset"`
+	} `json:"activities-steps-intraday"`
+}
+
+// Response of the intraday heart rate endpoint. The dataset has a reading every few seconds with the 1sec
+// detail level, one per minute with 1min; it is missing without intraday access
+type HeartRateIntraday struct {
+	Intraday struct {
+		Dataset []struct {
+			Time  string `json:"time"` // Local time of the day, e.g. "10:05:07"
+			Value int    `json:"value"`
+		} `json:"dataset"`
+		DatasetInterval int    `json:"datasetInterval"`
+		DatasetType     string `json:"datasetType"` // "second" or "minute"
+	} `json:"activities-heart-intraday"`
+}
+
+// Response of the friends leaderboard endpoint, the steps of the last 7 days of the user and the friends
+type Leaderboard struct {
+	Data []struct {
+		Type       string `json:"type"` // "ranked-user", or "inactive-user" without steps
+		ID         string `json:"id"`
+		Attributes struct {
+			StepAverage float64 `json:"step-average"`
+			StepRank    int     `json:"step-rank"`
+			StepSummary float64 `json:"step-summary"`
+		} `json:"attributes"`
+	} `json:"data"`
+	Included []struct {
+		Type       string `json:"type"` // "person"
+		ID         string `json:"id"`
+		Attributes struct {
+			Name string `json:"name"`
+		} `json:"attributes"`
+	} `json:"included"`
+}
+
+// Response of the daily Active Zone Minutes time series, the days without them are missing
+type ActiveZoneMinutesSeries struct {
+	Days []struct {
+		DateTime string `json:"dateTime"`
+		Value    struct {
+			ActiveZoneMinutes        int `json:"activeZoneMinutes"`
+			FatBurnActiveZoneMinutes int `json:"fatBurnActiveZoneMinutes"`
+			CardioActiveZoneMinutes  int `json:"cardioActiveZoneMinutes"`
+			PeakActiveZoneMinutes    int `json:"peakActiveZoneMinutes"`
+		} `json:"value"`
+	} `json:"activities-active-zone-minutes"`
+}
+
+// Day of an activity time series, e.g. of activities-minutesVeryActive
+type ActivitySeriesDay struct {
+	DateTime string `json:"dateTime"`
+	Value    string `json:"value"` // A number, e.g. "42"
+}
+
+// Response of the intraday elevation and floors endpoints, only the one requested is set
+type ElevationIntraday struct {
+	Elevation struct {
+		Dataset []IntradayValue `json:"dataset"`
+	} `json:"activities-elevation-intraday"`
+	Floors struct {
+		Dataset []IntradayValue `json:"dataset"`
+	} `json:"activities-floors-intraday"`
+}
+
+// Response of the intraday distance endpoint
+type DistanceIntraday struct {
+	Intraday struct {
+		Dataset []IntradayValue `json:"dataset"` // In kilometers or miles
+	} `json:"activities-distance-intraday"`
+}
+
+// Value of an intraday minute
+type IntradayValue struct {
+	Time  string  `json:"time"` // Local time of the day, e.g. "10:05:00"
+	Value float64 `json:"value"`
+}
+
+// Response of the intraday calories endpoint
+type CaloriesIntraday struct {
+	Intraday struct {
+		Dataset []CaloriesMinute `json:"dataset"`
+	} `json:"activities-calories-intraday"`
+}
+
+// Calories burned in a minute
+type CaloriesMinute struct {
+	Time  string  `json:"time"`  // Local time of the day, e.g. "10:05:00"; the date is added by the app
+	Value float64 `json:"value"` // kcal
+	Level int     `json:"level"` // Activity level: 0 sedentary, 1 lightly, 2 fairly, 3 very active
+	Mets  float64 `json:"mets"`  // Metabolic equivalent, in tenths, e.g. 35 for 3.5 METs
+}
+
+// Response of the Cardio Fitness Score endpoint
+type CardioScores struct {
+	CardioScore []struct {
+		DateTime string `json:"dateTime"`
+		Value    struct {
+			VO2Max string `json:"vo2Max"` // A range, e.g. "44-48", or a value, e.g. "46.2"
+		} `json:"value"`
+	} `json:"cardioScore"`
+}
+
+// Response of the breathing rate endpoints, the summary has the breathing rate of the night, intraday the
+// breathing rate per sleep stage
+type BreathingRates struct {
+	BR []struct {
+		DateTime string `json:"dateTime"`
+		Value    struct {
+			BreathingRate     float64              `json:"breathingRate"`
+			DeepSleepSummary  BreathingRateSummary `json:"deepSleepSummary"`
+			LightSleepSummary BreathingRateSummary `json:"lightSleepSummary"`
+			RemSleepSummary   BreathingRateSummary `json:"remSleepSummary"`
+			FullSleepSummary  BreathingRateSummary `json:"fullSleepSummary"`
+		} `json:"value"`
+	} `json:"br"`
+}
+
+type BreathingRateSummary struct {
+	BreathingRate float64 `json:"breathingRate"` // Breaths per minute
+}
+
+// Response of the skin temperature endpoint
+type SkinTemperatures struct {
+	TempSkin []struct {
+		DateTime string `json:"dateTime"`
+		Value    struct {
+			NightlyRelative float64 `json:"nightlyRelative"` // Deviation from the baseline, °C
+		} `json:"value"`
+		LogType string `json:"logType"` // e.g. "dedicated_temp_sensor" or "other_sensors"
+	} `json:"tempSkin"`
+}
+
+// Response of the sleep log endpoint (v1.2), only the fields used by the app
+type SleepLogs struct {
+	Sleep []SleepLog `json:"sleep"`
+}
+
+type SleepLog struct {
+	LogID         int64  `json:"logId"`
+	DateOfSleep   string `json:"dateOfSleep"` // The day the sleep ends on
+	StartTime     string `json:"startTime"`   // Local time, e.g. "2024-09-06T23:10:30.000"
+	EndTime       string `json:"endTime"`
+	IsMainSleep   bool   `json:"isMainSleep"`
+	Efficiency    int    `json:"efficiency"`
+	MinutesAsleep int    `json:"minutesAsleep"`
+	MinutesAwake  int    `json:"minutesAwake"`
+	TimeInBed     int    `json:"timeInBed"`
+	Type          string `json:"type"` // "stages", or "classic" (asleep, restless, awake) without enough heart rate data
+	Levels        struct {
+		Summary map[string]struct {
+			Minutes int `json:"minutes"`
+		} `json:"summary"`
+		Data      []SleepStage `json:"data"`
+		ShortData []SleepStage `json:"shortData"` // Short wakes during the stages
+	} `json:"levels"`
+
+	Raw json.RawMessage `json:"-"` // The log as received
+}
+
+// Period of a sleep stage
+type SleepStage struct {
+	DateTime string `json:"dateTime"`
+	Level    string `json:"level"` // e.g. "deep", "light", "rem", "wake"
+	Seconds  int    `json:"seconds"`
+}
+
+// Response of the HRV endpoints, the summary has the value of the day, intraday the minutes
+type HRVs struct {
+	HRV []struct {
+		DateTime string `json:"dateTime"`
+		Value    struct {
+			DailyRmssd float64 `json:"dailyRmssd"` // Milliseconds
+			DeepRmssd  float64 `json:"deepRmssd"`  // Milliseconds, during deep sleep
+		} `json:"value"`
+		Minutes []HRVMinute `json:"minutes"`
+	} `json:"hrv"`
+}
+
+type HRVMinute struct {
+	Minute string `json:"minute"` // Local time, e.g. "2024-09-07T02:04:00.000"
+	Value  struct {
+		Rmssd    float64 `json:"rmssd"`
+		Coverage float64 `json:"coverage"` // Share of the minute with good data
+		HF       float64 `json:"hf"`       // High frequency power
+		LF       float64 `json:"lf"`       // Low frequency power
+	} `json:"value"`
+}
+
+// Response of the activity type catalog endpoint, the activity types by category
+type ActivityCatalog struct {
+	Categories []ActivityCategory `json:"categories"`
+}
+
+// Category of the activity catalog, e.g. "Running", with its activity types and subcategories
+type ActivityCategory struct {
+	ID            int                   `json:"id"`
+	Name          string                `json:"name"`
+	Activities    []CatalogActivityType `json:"activities"`
+	SubCategories []ActivityCategory    `json:"subCategories"`
+}
+
+// Activity type of the catalog, its ID is the activityId of the logged activities
+type CatalogActivityType struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	HasSpeed bool   `json:"hasSpeed"`
+}
+
+// Subscription to a collection of the user's data, the subscriber is notified of its changes
+type Subscription struct {
+	CollectionType string `json:"collectionType"` // e.g. "activities"
+	OwnerID        string `json:"ownerId"`
+	OwnerType      string `json:"ownerType"`
+	SubscriberID   string `json:"subscriberId"`
+	SubscriptionID string `json:"subscriptionId"`
+}
+
+// Response of the subscription list endpoint
+type Subscriptions struct {
+	APISubscriptions []Subscription `json:"apiSubscriptions"`
+}
+
+// Notification sent to the subscriber when data of a subscribed collection changes, e.g. an activity synced
+type SubscriptionNotification struct {
+	CollectionType string `json:"collectionType"`
+	Date           string `json:"date"` // Day of the changed data, e.g. "2024-09-07"
+	OwnerID        string `json:"ownerId"`
+	OwnerType      string `json:"ownerType"`
+	SubscriptionID string `json:"subscriptionId"`
+}
+
+// Response of the activity log creation endpoint, only the fields used by the app
+type CreatedActivityLog struct {
+	ActivityLog struct {
+		LogID        int64  `json:"logId"`
+		ActivityName string `json:"name"`
+		StartDate    string `json:"startDate"`
+		StartTime    string `json:"startTime"`
+	} `json:"activityLog"`
+}
+
+// Response of the lifetime statistics endpoint, only the fields used by the app
+type LifetimeStats struct {
+	Best struct {
+		Total struct {
+			Distance LifetimeBest `json:"distance"`
+			Floors   LifetimeBest `json:"floors"`
+			Steps    LifetimeBest `json:"steps"`
+		} `json:"total"`
+	} `json:"best"`
+	Lifetime struct {
+		Total struct {
+			Distance float64 `json:"distance"`
+			Floors   float64 `json:"floors"`
+			Steps    float64 `json:"steps"`
+		} `json:"total"`
+	} `json:"lifetime"`
+}
+
+// Best day of a lifetime statistic
+type LifetimeBest struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+}
+
+// Response of the daily and weekly activity goals endpoints, by goal name, e.g. steps. The weekly goals
+// have no activeMinutes and caloriesOut
+type ActivityGoals struct {
+	Goals map[string]float64 `json:"goals"`
+}
+
+// Activity type of the favorite, frequent and recent activities endpoints. The favorites have no calories,
+// distance and duration, the others have those of the last log of the type
+type ActivityShortcut struct {
+	ActivityID  int     `json:"activityId"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Calories    int     `json:"calories"`
+	Distance    float64 `json:"distance"`
+	Duration    int64   `json:"duration"` // In milliseconds
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02" // Date format of the Fitbit API, YYYY-MM-DD
+
+// Time zone of the user's Fitbit profile, the local time zone when unknown
+var userLocation = time.Local
+
+var daysAgoPattern = regexp.MustCompile(`^-(\d+)d$`)
+
+var isoWeekPattern = regexp.MustCompile(`^(\d{4})-W(\d{2})$`)
+
+// Resolves a date given as YYYY-MM-DD, "today", "yesterday" or "-<n>d" (n days ago) relative to now
+func resolveDate(expr string, now time.Time) (string, error) {
+	switch expr {
+	case "today":
+		return now.Format(dateLayout), nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1).Format(dateLayout), nil
+	}
+	if match := daysAgoPattern.FindStringSubmatch(expr); match != nil {
+		days, err := strconv.Atoi(match[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid date %q: %s", expr, err)
+		}
+		return now.AddDate(0, 0, -days).Format(dateLayout), nil
+	}
+	if _, err := time.Parse(dateLayout, expr); err != nil {
+		return "", fmt.Errorf("invalid date %q, use YYYY-MM-DD, today, yesterday or -<n>d", expr)
+	}
+	return expr, nil
+}
+
+// Commands without a date, their arguments are not dates
+var undatedCommands = map[string]bool{
+	"search": true, "stats": true, "quota": true, "leaderboard": true, "activity-types": true, "goals": true,
+	"subscriptions": true, "serve": true, "delete": true, "log": true,
+}
+
+// Returns the date arguments of the command, e.g. "" of the export or "list": without a date or date range, the
+// date asked for on an interactive console, Enter accepting today, or today without asking, e.g. in a cron job.
+// Tells whether today was taken without asking. The commands without dates keep their arguments
+func commandDates(command string, args []string, dateRange bool, interactive bool, in io.Reader, out io.Writer) ([]string, bool, error) {
+	if undatedCommands[command] || dateRange || len(args) > 0 {
+		return args, false, nil
+	}
+	if !interactive {
+		return []string{"today"}, true, nil
+	}
+	date, err := promptDate(in, out)
+	if err != nil {
+		return nil, false, err
+	}
+	return []string{date}, false, nil
+}
+
+// Asks for the date of the activities until a valid one is entered, an empty answer is today
+func promptDate(in io.Reader, out io.Writer) (string, error) {
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprint(out, "Enter the date of the activities (YYYY-MM-DD, today, yesterday or -<n>d) [today]: ")
+		input, err := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if err != nil && (err != io.EOF || input == "") {
+			fmt.Fprintln(out)
+			return "", fmt.Errorf("no date specified: %w", err)
+		}
+		if input == "" {
+			return "today", nil
+		}
+		if _, err := resolveDate(input, time.Now()); err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		return input, nil
+	}
+}
+
+// Tells whether the date has to be resolved against the current date
+func isRelativeDate(expr string) bool {
+	return expr == "today" || expr == "yesterday" || daysAgoPattern.MatchString(expr)
+}
+
+// Parses the first and last date of a date range, relative dates are resolved against now
+func parseDateRange(from string, to string, now time.Time) (time.Time, time.Time, error) {
+	if from == "" || to == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("both --from and --to are required")
+	}
+	from, err := resolveDate(from, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("--from: %s", err)
+	}
+	to, err = resolveDate(to, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("--to: %s", err)
+	}
+	start, _ := time.Parse(dateLayout, from)
+	end, _ := time.Parse(dateLayout, to)
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("--to %s is before --from %s", to, from)
+	}
+	return start, end, nil
+}
+
+// Returns the first and last day of the month given as YYYY-MM, e.g. 2024-09
+func parseMonth(month string) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01", month)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid month %q, use YYYY-MM", month)
+	}
+	return start, start.AddDate(0, 1, -1), nil
+}
+
+// Returns the Monday and Sunday of the ISO 8601 week given as YYYY-Www, e.g. 2024-W37
+func parseISOWeek(week string) (time.Time, time.Time, error) {
+	match := isoWeekPattern.FindStringSubmatch(week)
+	if match == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid week %q, use YYYY-Www, e.g. 2024-W37", week)
+	}
+	year, _ := strconv.Atoi(match[1])
+	number, _ := strconv.Atoi(match[2])
+
+	// Week 1 is the week of January 4th
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	start := jan4.AddDate(0, 0, -(int(jan4.Weekday())+6)%7+(number-1)*7)
+	if y, w := start.ISOWeek(); number < 1 || y != year || w != number {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid week %q, %d has no week %d", week, year, number)
+	}
+	return start, start.AddDate(0, 0, 6), nil
+}
+
+// Limits a date range to the days that have passed, the current month or week ends today
+func clampToToday(start time.Time, end time.Time, now time.Time) (time.Time, time.Time, error) {
+	today, _ := time.Parse(dateLayout, now.Format(dateLayout))
+	if start.After(today) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s is in the future", start.Format(dateLayout))
+	}
+	if end.After(today) {
+		end = today
+	}
+	return start, end, nil
+}
+
+// Loads the time zone of the profile, so "today" is the user's today, falling back to its current offset when the zone database lacks it
+func profileLocation(user data.ProfileUser) (*time.Location, error) {
+	if user.Timezone == "" {
+		return nil, fmt.Errorf("profile has no time zone")
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return time.FixedZone(user.Timezone, int(user.OffsetFromUTCMillis/1000)), nil
+	}
+	return loc, nil
+}
+
+// Returns the start and the end of the activity in the time zone of the user, for the intraday endpoints.
+// Their window ends on the day it starts, so the end is at most 23:59 of the start date
+func activityWindow(activity data.Activity) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(dateLayout+" 15:04", activity.StartDate+" "+activity.StartTime, userLocation)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start of activity %d: %s", activity.LogID, err)
+	}
+	end := start.Add(time.Duration(activity.Duration) * time.Millisecond)
+	if end.Format(dateLayout) != activity.StartDate {
+		end = time.Date(start.Year(), start.Month(), start.Day(), 23, 59, 0, 0, start.Location())
+	}
+	return start, end, nil
+}
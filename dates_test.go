@@ -0,0 +1,208 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveDate(t *testing.T) {
+	now := time.Date(2024, 9, 7, 0, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	testCases := []struct {
+		testName     string
+		expr         string
+		expectedDate string
+		expectedErr  bool
+	}{
+		{testName: "SUCCESS - date", expr: "2024-08-11", expectedDate: "2024-08-11"},
+		{testName: "SUCCESS - today", expr: "today", expectedDate: "2024-09-07"},
+		{testName: "SUCCESS - yesterday", expr: "yesterday", expectedDate: "2024-09-06"},
+		{testName: "SUCCESS - 7 days ago", expr: "-7d", expectedDate: "2024-08-31"},
+		{testName: "SUCCESS - 0 days ago", expr: "-0d", expectedDate: "2024-09-07"},
+		{testName: "FAILURE - invalid date", expr: "2024-02-30", expectedErr: true},
+		{testName: "FAILURE - days in the future", expr: "+7d", expectedErr: true},
+		{testName: "FAILURE - weeks", expr: "-1w", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			date, err := resolveDate(tc.expr, now)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedDate, date)
+			}
+		})
+	}
+
+	// "today" is the date in the given time zone, not UTC
+	date, err := resolveDate("today", now)
+	assert.NoError(t, err)
+	assert.NotEqual(t, now.UTC().Format(dateLayout), date)
+}
+
+func TestParseDateRange(t *testing.T) {
+	now := time.Date(2024, 9, 7, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		testName      string
+		from          string
+		to            string
+		expectedStart string
+		expectedEnd   string
+		expectedErr   bool
+	}{
+		{testName: "SUCCESS - month", from: "2024-09-01", to: "2024-09-30", expectedStart: "2024-09-01", expectedEnd: "2024-09-30"},
+		{testName: "SUCCESS - single day", from: "2024-09-07", to: "2024-09-07", expectedStart: "2024-09-07", expectedEnd: "2024-09-07"},
+		{testName: "SUCCESS - last week", from: "-7d", to: "yesterday", expectedStart: "2024-08-31", expectedEnd: "2024-09-06"},
+		{testName: "FAILURE - missing --to", from: "2024-09-01", expectedErr: true},
+		{testName: "FAILURE - invalid date", from: "2024-09-01", to: "2024-09-31", expectedErr: true},
+		{testName: "FAILURE - reversed", from: "2024-09-30", to: "2024-09-01", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			start, end, err := parseDateRange(tc.from, tc.to, now)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedStart, start.Format(dateLayout))
+				assert.Equal(t, tc.expectedEnd, end.Format(dateLayout))
+			}
+		})
+	}
+}
+
+func TestProfileLocation(t *testing.T) {
+	loc, err := profileLocation(data.ProfileUser{Timezone: "UTC"})
+	assert.NoError(t, err)
+	assert.Equal(t, "UTC", loc.String())
+
+	// Unknown zones fall back to the current offset
+	loc, err = profileLocation(data.ProfileUser{Timezone: "Mars/Olympus_Mons", OffsetFromUTCMillis: 3600000})
+	assert.NoError(t, err)
+	_, offset := time.Date(2024, 9, 7, 0, 0, 0, 0, loc).Zone()
+	assert.Equal(t, 3600, offset)
+
+	_, err = profileLocation(data.ProfileUser{})
+	assert.Error(t, err)
+}
+
+func TestParseMonth(t *testing.T) {
+	start, end, err := parseMonth("2024-02")
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-02-01", start.Format(dateLayout))
+	assert.Equal(t, "2024-02-29", end.Format(dateLayout))
+
+	_, _, err = parseMonth("2024-13")
+	assert.Error(t, err)
+}
+
+func TestParseISOWeek(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		week          string
+		expectedStart string
+		expectedEnd   string
+		wantErr       bool
+	}{
+		{"SUCCESS - Week of September", "2024-W37", "2024-09-09", "2024-09-15", false},
+		{"SUCCESS - First week starts in the previous year", "2025-W01", "2024-12-30", "2025-01-05", false},
+		{"SUCCESS - Week 53", "2020-W53", "2020-12-28", "2021-01-03", false},
+		{"FAILURE - No week 53", "2024-W53", "", "", true},
+		{"FAILURE - Week 0", "2024-W00", "", "", true},
+		{"FAILURE - Invalid format", "2024-37", "", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			start, end, err := parseISOWeek(tc.week)
+			assert.Equal(t, tc.wantErr, err != nil)
+			if !tc.wantErr {
+				assert.Equal(t, tc.expectedStart, start.Format(dateLayout))
+				assert.Equal(t, tc.expectedEnd, end.Format(dateLayout))
+			}
+		})
+	}
+}
+
+func TestClampToToday(t *testing.T) {
+	// Already the 11th in the user's time zone, still the 10th in UTC
+	now := time.Date(2024, 9, 11, 0, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	start, end, err := parseISOWeek("2024-W37")
+	assert.NoError(t, err)
+
+	start, end, err = clampToToday(start, end, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-09-09", start.Format(dateLayout))
+	assert.Equal(t, "2024-09-11", end.Format(dateLayout))
+
+	start, end, _ = parseMonth("2024-10")
+	_, _, err = clampToToday(start, end, now)
+	assert.Error(t, err)
+}
+
+func TestPromptDate(t *testing.T) {
+	testCases := []struct {
+		testName string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"SUCCESS - Date", "2024-09-07\n", "2024-09-07", false},
+		{"SUCCESS - Empty answer is today", "\n", "today", false},
+		{"SUCCESS - Relative date without newline", "-3d", "-3d", false},
+		{"SUCCESS - Asks again after an invalid date", "2024-13-01\nyesterday\n", "yesterday", false},
+		{"FAILURE - No input", "", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			var out bytes.Buffer
+			date, err := promptDate(strings.NewReader(tc.input), &out)
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.expected, date)
+		})
+	}
+}
+
+func TestCommandDates(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		command       string
+		args          []string
+		dateRange     bool
+		interactive   bool
+		input         string
+		expected      []string
+		expectedToday bool
+		expectedAsked bool
+	}{
+		{testName: "SUCCESS - Export asks on a console", command: "", interactive: true, input: "yesterday\n", expected: []string{"yesterday"}, expectedAsked: true},
+		{testName: "SUCCESS - List takes today without a console", command: "list", expected: []string{"today"}, expectedToday: true},
+		{testName: "SUCCESS - Given date", command: "2024-09-07", args: []string{"2024-09-07"}, interactive: true, expected: []string{"2024-09-07"}},
+		{testName: "SUCCESS - Date range", command: "spo2", dateRange: true, interactive: true},
+		{testName: "SUCCESS - Quota takes no date on a console", command: "quota", interactive: true},
+		{testName: "SUCCESS - Log takes no date without a console", command: "log"},
+		{testName: "SUCCESS - Stats keeps its arguments", command: "stats", args: []string{"stats", "lifetime"}, interactive: true, expected: []string{"stats", "lifetime"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			var out bytes.Buffer
+			args, today, err := commandDates(tc.command, tc.args, tc.dateRange, tc.interactive, strings.NewReader(tc.input), &out)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, args)
+			assert.Equal(t, tc.expectedToday, today)
+			assert.Equal(t, tc.expectedAsked, out.Len() > 0)
+		})
+	}
+
+	// No answer on the console
+	_, _, err := commandDates("", nil, false, true, strings.NewReader(""), &bytes.Buffer{})
+	assert.Error(t, err)
+}
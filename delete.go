@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Activity to delete, given to the delete command, e.g. delete --log-id 12345 --yes
+type activityDeletion struct {
+	logID int64
+	yes   bool // Delete without asking
+}
+
+// Parses the flags following the delete command
+func parseDeleteArgs(args []string) (activityDeletion, error) {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	logID := fs.Int64("log-id", 0, "log ID of the activity, as shown by list")
+	yes := fs.Bool("yes", false, "delete without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return activityDeletion{}, fmt.Errorf("delete: %s", err)
+	}
+	if *logID <= 0 || fs.NArg() != 0 {
+		return activityDeletion{}, fmt.Errorf("unknown delete command, use: delete --log-id ID [--yes]")
+	}
+	return activityDeletion{logID: *logID, yes: *yes}, nil
+}
+
+// Deletes the activity log from Fitbit, e.g. a duplicate, after asking for confirmation unless yes is given.
+// The deletion cannot be undone
+func deleteActivity(in io.Reader, out io.Writer, deletion activityDeletion) error {
+	logID := strconv.FormatInt(deletion.logID, 10)
+	if !deletion.yes {
+		answer, err := prompt(bufio.NewReader(in), out, "Delete activity "+logID+" from Fitbit? It cannot be undone [y/N]", "n")
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			return fmt.Errorf("aborted, activity %s kept", logID)
+		}
+	}
+
+	if _, err := apiDelete(userURL("activities/" + logID + ".json")); err != nil {
+		return fmt.Errorf("failed to delete activity %s: %w", logID, err)
+	}
+	fmt.Fprintf(out, "Deleted activity %s\n", logID)
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestParseDeleteArgs(t *testing.T) {
+	testCases := []struct {
+		testName string
+		args     []string
+		expected activityDeletion
+		err      bool
+	}{
+		{"SUCCESS - Confirmed", []string{"--log-id", "12345"}, activityDeletion{12345, false}, false},
+		{"SUCCESS - Without confirmation", []string{"--log-id", "12345", "--yes"}, activityDeletion{12345, true}, false},
+		{"FAILURE - Without log ID", []string{"--yes"}, activityDeletion{}, true},
+		{"FAILURE - Extra argument", []string{"--log-id", "12345", "12346"}, activityDeletion{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			deletion, err := parseDeleteArgs(tc.args)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.expected, deletion)
+		})
+	}
+}
+
+func TestDeleteActivity(t *testing.T) {
+	testCases := []struct {
+		testName string
+		input    string
+		yes      bool
+		deleted  bool
+	}{
+		{"SUCCESS - Confirmed", "y\n", false, true},
+		{"SUCCESS - Without confirmation", "", true, true},
+		{"FAILURE - Declined", "\n", false, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			deleted := false
+			stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodDelete, r.Method)
+				assert.Equal(t, "/1/user/-/activities/12345.json", r.URL.Path)
+				deleted = true
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			token = &oauth2.Token{AccessToken: "access"}
+
+			var out bytes.Buffer
+			err := deleteActivity(strings.NewReader(tc.input), &out, activityDeletion{12345, tc.yes})
+			assert.Equal(t, tc.deleted, err == nil)
+			assert.Equal(t, tc.deleted, deleted)
+			if tc.deleted {
+				assert.Contains(t, out.String(), "Deleted activity 12345")
+			}
+		})
+	}
+}
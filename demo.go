@@ -0,0 +1,315 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Fitbit user of the demo
+const demoUserID = "DEMO00"
+
+// Activity of each day of the demo, its log ID is the date and its number, e.g. 202409071 for the first
+// activity of 2024-09-07
+type demoActivity struct {
+	activityID int
+	name       string
+	start      string // Local start, e.g. "07:00"
+	duration   time.Duration
+	distance   float64 // Kilometers, 0 without distance
+	calories   int
+	tcx        string // TCX of the activity: "gps" (a full track), "partial" (track points without position), "empty" (no lap) or "" for none
+	lengths    int    // Pool lengths of swims
+}
+
+var demoActivities = []demoActivity{
+	{activityID: activityTypeRun, name: "Run", start: "07:00", duration: 30 * time.Minute, distance: 5.4, calories: 380, tcx: "gps"},
+	{activityID: activityTypeTreadmill, name: "Treadmill", start: "12:30", duration: 25 * time.Minute, distance: 4.1, calories: 290, tcx: "partial"},
+	{activityID: activityTypeSwim, name: "Swim", start: "17:00", duration: 20 * time.Minute, distance: 0.5, calories: 180, tcx: "empty", lengths: 20},
+	{activityID: 52001, name: "Yoga", start: "20:00", duration: 45 * time.Minute, calories: 120},
+}
+
+// Rate limit of the demo, as the Fitbit API: 150 requests per hour
+const demoRateLimit = 150
+
+// Starts a mock of the Fitbit Web API serving made up data of every day until today: a GPS run, a treadmill run,
+// a pool swim and a manually logged yoga session, with their TCX, the activity log list, the profile, the
+// tracker, the activity catalog and types and the intraday data of the activities. Its URL replaces the API base
+func newMockFitbitServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /1/user/{user}/profile.json", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, data.Profile{User: data.ProfileUser{EncodedID: demoUserID, Timezone: "UTC", DistanceUnit: "METRIC"}})
+	})
+	mux.HandleFunc("GET /1/user/{user}/devices.json", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, []data.Device{{ID: "1", DeviceVersion: "Charge 6", Type: "TRACKER", LastSyncTime: time.Now().UTC().Format("2006-01-02T15:04:05.000")}})
+	})
+	mux.HandleFunc("GET /1/activities.json", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, data.ActivityCatalog{Categories: []data.ActivityCategory{
+			{ID: 1, Name: "Running", Activities: []data.CatalogActivityType{{ID: activityTypeRun, Name: "Run", HasSpeed: true}, {ID: activityTypeTreadmill, Name: "Treadmill", HasSpeed: true}}},
+			{ID: 2, Name: "Swimming", Activities: []data.CatalogActivityType{{ID: activityTypeSwim, Name: "Swim", HasSpeed: true}}},
+			{ID: 3, Name: "Sports and Workouts", Activities: []data.CatalogActivityType{{ID: 52001, Name: "Yoga"}}},
+		}})
+	})
+	mux.HandleFunc("GET /1/user/{user}/activities/date/{file}", mockDailySummary)
+	mux.HandleFunc("GET /1/user/{user}/activities/list.json", mockActivityList)
+	for _, list := range activityTypeLists {
+		mux.HandleFunc("GET /1/user/{user}/activities/"+list+".json", mockActivityTypes)
+	}
+	mux.HandleFunc("GET /1/user/{user}/activities/{file}", mockActivityTcx)
+	mux.HandleFunc("GET /1/user/{user}/activities/{resource}/date/{date}/1d/{detail}/time/{start}/{end}", mockIntraday)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeMockError(w, http.StatusNotFound, "not_found", "the demo has no data of "+r.URL.Path)
+	})
+	return httptest.NewServer(withMockRateLimit(mux))
+}
+
+// Sends the Fitbit-Rate-Limit-* headers of the Fitbit API on every response of the mock API. The quota is
+// counted down by the requests of the hour and resets at the top of the hour, it never runs out not to make
+// the demo wait
+func withMockRateLimit(next http.Handler) http.Handler {
+	var mu sync.Mutex
+	var hour time.Time
+	requests := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		mu.Lock()
+		if current := now.Truncate(time.Hour); !current.Equal(hour) {
+			hour, requests = current, 0
+		}
+		requests++
+		remaining := max(demoRateLimit-requests, 1)
+		mu.Unlock()
+
+		w.Header().Set("Fitbit-Rate-Limit-Limit", strconv.Itoa(demoRateLimit))
+		w.Header().Set("Fitbit-Rate-Limit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("Fitbit-Rate-Limit-Reset", strconv.Itoa(int(math.Ceil(hour.Add(time.Hour).Sub(now).Seconds()))))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Writes the response of the mock API as JSON
+func writeMockJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Writes an error response of the mock API, in the format of the Fitbit API
+func writeMockError(w http.ResponseWriter, status int, errorType string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"errors": []map[string]string{{"errorType": errorType, "message": message}}})
+}
+
+// Parses the date of a mock request, e.g. of "2024-09-07.json". The demo has no data after today
+func mockDate(value string) (time.Time, bool) {
+	date, err := time.Parse(dateLayout, strings.TrimSuffix(value, ".json"))
+	return date, err == nil && !date.After(time.Now().UTC())
+}
+
+// Returns the demo activity of the log ID, and its date
+func mockActivityOfLog(logID int64) (demoActivity, time.Time, bool) {
+	number := int(logID % 10)
+	date, err := time.Parse("20060102", strconv.FormatInt(logID/10, 10))
+	if err != nil || date.After(time.Now().UTC()) || number < 1 || number > len(demoActivities) {
+		return demoActivity{}, time.Time{}, false
+	}
+	return demoActivities[number-1], date, true
+}
+
+// Log ID of the demo activity of the date, by its number from 1
+func mockLogID(date time.Time, number int) int64 {
+	yyyymmdd, _ := strconv.ParseInt(date.Format("20060102"), 10, 64)
+	return yyyymmdd*10 + int64(number)
+}
+
+// Start of the demo activity on the date
+func (a demoActivity) startOn(date time.Time) time.Time {
+	start, _ := time.Parse("15:04", a.start)
+	return date.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+}
+
+// Serves the daily activity summary, the demo activities of the date
+func mockDailySummary(w http.ResponseWriter, r *http.Request) {
+	date, ok := mockDate(r.PathValue("file"))
+	if !ok {
+		writeMockError(w, http.StatusBadRequest, "validation", "invalid date "+r.PathValue("file"))
+		return
+	}
+	var activities []map[string]any
+	steps := 0
+	for i, activity := range demoActivities {
+		activityStep := int(activity.distance * 1300)
+		steps += activityStep
+		activities = append(activities, map[string]any{
+			"activityId": activity.activityID, "activityParentId": activity.activityID, "activityParentName": activity.name,
+			"name": activity.name, "calories": activity.calories, "distance": activity.distance,
+			"duration": activity.duration.Milliseconds(), "hasStartTime": true, "logId": mockLogID(date, i+1),
+			"startDate": date.Format(dateLayout), "startTime": activity.start, "steps": activityStep,
+		})
+	}
+	writeMockJSON(w, map[string]any{"activities": activities, "summary": map[string]any{
+		"steps": steps + 4000, "distances": []map[string]any{{"activity": "total", "distance": 13}},
+	}})
+}
+
+// Serves the activity log list, a page per week from the afterDate on
+func mockActivityList(w http.ResponseWriter, r *http.Request) {
+	first, ok := mockDate(r.URL.Query().Get("afterDate"))
+	if !ok {
+		writeMockJSON(w, map[string]any{"activities": []any{}, "pagination": map[string]string{"next": ""}})
+		return
+	}
+	var logs []map[string]any
+	for day := 0; day < 7; day++ {
+		date, ok := mockDate(first.AddDate(0, 0, day).Format(dateLayout))
+		if !ok {
+			break
+		}
+		for i, activity := range demoActivities {
+			log := map[string]any{
+				"logId": mockLogID(date, i+1), "activityName": activity.name, "activityTypeId": activity.activityID,
+				"calories": activity.calories, "distance": activity.distance, "distanceUnit": "Kilometer",
+				"duration": activity.duration.Milliseconds(), "startTime": activity.startOn(date).Format("2006-01-02T15:04:05.000-07:00"),
+				"steps": int(activity.distance * 1300), "hasGps": activity.tcx == "gps",
+			}
+			if activity.tcx != "" {
+				log["tcxLink"] = fmt.Sprintf("https://www.fitbit.com/activities/exercise/%d?export=tcx", mockLogID(date, i+1))
+				log["source"] = map[string]string{"id": "1", "name": "Charge 6", "type": "tracker"}
+			} else {
+				log["source"] = map[string]string{"id": "fitbit-android", "name": "Fitbit for Android", "type": "app"}
+			}
+			if activity.lengths > 0 {
+				log["poolLength"], log["poolLengthUnit"], log["swimLengths"] = 25, "Meter", activity.lengths
+			}
+			logs = append(logs, log)
+		}
+	}
+	next := ""
+	if following := first.AddDate(0, 0, 7); !following.After(time.Now().UTC()) {
+		query := r.URL.Query()
+		query.Set("afterDate", following.Format(dateLayout))
+		next = (&url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path, RawQuery: query.Encode()}).String()
+	}
+	writeMockJSON(w, map[string]any{"activities": logs, "pagination": map[string]string{"next": next}})
+}
+
+// Serves the favorite, frequent and recent activity types, the types of the demo activities
+func mockActivityTypes(w http.ResponseWriter, r *http.Request) {
+	shortcuts := []data.ActivityShortcut{}
+	for _, activity := range demoActivities {
+		shortcuts = append(shortcuts, data.ActivityShortcut{ActivityID: activity.activityID, Name: activity.name, Calories: activity.calories,
+			Distance: activity.distance, Duration: activity.duration.Milliseconds()})
+	}
+	writeMockJSON(w, shortcuts)
+}
+
+// Serves the TCX of a demo activity. Without includePartialTCX=true, the activities without a full GPS track
+// only have their laps
+func mockActivityTcx(w http.ResponseWriter, r *http.Request) {
+	logID, err := strconv.ParseInt(strings.TrimSuffix(r.PathValue("file"), ".tcx"), 10, 64)
+	if err != nil || !strings.HasSuffix(r.PathValue("file"), ".tcx") {
+		writeMockError(w, http.StatusNotFound, "not_found", "the demo has no data of "+r.URL.Path)
+		return
+	}
+	activity, date, ok := mockActivityOfLog(logID)
+	if !ok || activity.tcx == "" {
+		writeMockError(w, http.StatusNotFound, "not_found", fmt.Sprintf("activity %d has no TCX", logID))
+		return
+	}
+
+	start := activity.startOn(date)
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	root := doc.CreateElement("TrainingCenterDatabase")
+	root.CreateAttr("xmlns", tcxNamespace)
+	activityElement := root.CreateElement("Activities").CreateElement("Activity")
+	activityElement.CreateAttr("Sport", "Running")
+	activityElement.CreateElement("Id").SetText(start.Format("2006-01-02T15:04:05.000-07:00"))
+	if activity.tcx == "empty" {
+		// Like the swims, only the activity, the export adds the laps
+		activityElement.CreateAttr("Sport", "Other")
+		activityElement.CreateElement("Creator")
+		doc.Indent(2)
+		w.Header().Set("Content-Type", "application/vnd.garmin.tcx+xml")
+		doc.WriteTo(w)
+		return
+	}
+	lap := activityElement.CreateElement("Lap")
+	lap.CreateAttr("StartTime", start.Format("2006-01-02T15:04:05.000-07:00"))
+	lap.CreateElement("TotalTimeSeconds").SetText(strconv.FormatFloat(activity.duration.Seconds(), 'f', -1, 64))
+	lap.CreateElement("DistanceMeters").SetText(strconv.FormatFloat(activity.distance*1000, 'f', -1, 64))
+	lap.CreateElement("Calories").SetText(strconv.Itoa(activity.calories))
+	lap.CreateElement("Intensity").SetText("Active")
+	lap.CreateElement("TriggerMethod").SetText("Manual")
+
+	partial := r.URL.Query().Get("includePartialTCX") == "true"
+	if activity.tcx == "gps" || (activity.tcx == "partial" && partial) {
+		track := lap.CreateElement("Track")
+		for offset := time.Duration(0); offset <= activity.duration; offset += 10 * time.Second {
+			progress := offset.Seconds() / activity.duration.Seconds()
+			trackpoint := track.CreateElement("Trackpoint")
+			trackpoint.CreateElement("Time").SetText(start.Add(offset).Format("2006-01-02T15:04:05.000-07:00"))
+			if activity.tcx == "gps" {
+				// Laps of a 1.35 km loop
+				angle := 2 * math.Pi * activity.distance / 1.35 * progress
+				position := trackpoint.CreateElement("Position")
+				position.CreateElement("LatitudeDegrees").SetText(strconv.FormatFloat(47.5270+0.0019*math.Sin(angle), 'f', 6, 64))
+				position.CreateElement("LongitudeDegrees").SetText(strconv.FormatFloat(19.0470+0.0028*math.Cos(angle), 'f', 6, 64))
+				trackpoint.CreateElement("AltitudeMeters").SetText(strconv.FormatFloat(104+3*math.Sin(angle), 'f', 1, 64))
+				trackpoint.CreateElement("DistanceMeters").SetText(strconv.FormatFloat(activity.distance*1000*progress, 'f', 1, 64))
+			}
+			trackpoint.CreateElement("HeartRateBpm").CreateElement("Value").SetText(strconv.Itoa(mockHeartRate(offset)))
+		}
+	}
+	activityElement.CreateElement("Creator")
+
+	doc.Indent(2)
+	w.Header().Set("Content-Type", "application/vnd.garmin.tcx+xml")
+	doc.WriteTo(w)
+}
+
+// Heart rate of the demo activities, from the start of the activity
+func mockHeartRate(offset time.Duration) int {
+	return 95 + int(60*(1-math.Exp(-offset.Minutes()/4))) + int(5*math.Sin(offset.Minutes()))
+}
+
+// Serves the intraday data of a resource, a value per minute of the time range: steps, heart rate, distance,
+// elevation, floors or calories
+func mockIntraday(w http.ResponseWriter, r *http.Request) {
+	resource := r.PathValue("resource")
+	start, err1 := time.Parse("15:04", r.PathValue("start"))
+	end, err2 := time.Parse("15:04", strings.TrimSuffix(r.PathValue("end"), ".json"))
+	if err1 != nil || err2 != nil {
+		writeMockError(w, http.StatusBadRequest, "validation", "invalid time range")
+		return
+	}
+	value := map[string]func(minute time.Duration) float64{
+		"steps":     func(minute time.Duration) float64 { return 150 + float64(int(minute.Minutes())%7) },
+		"heart":     func(minute time.Duration) float64 { return float64(mockHeartRate(minute)) },
+		"distance":  func(minute time.Duration) float64 { return 0.17 },
+		"elevation": func(minute time.Duration) float64 { return float64(int(minute.Minutes()) % 2 * 3) },
+		"floors":    func(minute time.Duration) float64 { return float64(int(minute.Minutes()) % 2) },
+		"calories":  func(minute time.Duration) float64 { return 11.5 },
+	}[resource]
+	if value == nil {
+		writeMockError(w, http.StatusNotFound, "not_found", "the demo has no intraday "+resource)
+		return
+	}
+	dataset := []map[string]any{}
+	for t := start; !t.After(end); t = t.Add(time.Minute) {
+		dataset = append(dataset, map[string]any{"time": t.Format(time.TimeOnly), "value": value(t.Sub(start))})
+	}
+	writeMockJSON(w, map[string]any{"activities-" + resource + "-intraday": map[string]any{
+		"dataset": dataset, "datasetInterval": 1, "datasetType": "minute",
+	}})
+}
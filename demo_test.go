@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// Points the API base to the mock Fitbit API of the demo
+func startMockFitbitServer(t *testing.T) {
+	server := newMockFitbitServer()
+	t.Cleanup(server.Close)
+	base := apiBase
+	apiBase = server.URL
+	t.Cleanup(func() { apiBase = base })
+	token = &oauth2.Token{AccessToken: "demo"}
+	userLocation = time.UTC
+	t.Cleanup(func() { userLocation = time.Local })
+}
+
+func TestDemoExport(t *testing.T) {
+	startMockFitbitServer(t)
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+
+	assert.NoError(t, fetchActivityData([]string{"2024-09-07"}, exportOptions{all: true}))
+
+	run, err := os.ReadFile(filepath.Join(outputDir, "Run-202409071.tcx"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(run), "<LatitudeDegrees>")
+	treadmill, err := os.ReadFile(filepath.Join(outputDir, "Treadmill-202409072.tcx"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(treadmill), "<Trackpoint>")
+	assert.FileExists(t, filepath.Join(outputDir, "Swim-202409073.tcx"))
+	assert.FileExists(t, filepath.Join(outputDir, "Yoga-202409074.tcx"))
+}
+
+func TestDemoExportRecordingDevice(t *testing.T) {
+	startMockFitbitServer(t)
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+	var err error
+	pairedDevices, err = fetchPairedDevices()
+	assert.NoError(t, err)
+	defer func() { pairedDevices = nil }()
+
+	assert.NoError(t, fetchActivityData([]string{"2024-09-07"}, exportOptions{all: true}))
+
+	// The tracker is the Creator of the activities it recorded, Fitbit of the manually logged ones
+	run, err := os.ReadFile(filepath.Join(outputDir, "Run-202409071.tcx"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(run), "<Name>Charge 6</Name>")
+	yoga, err := os.ReadFile(filepath.Join(outputDir, "Yoga-202409074.tcx"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(yoga), "<Name>Fitbit</Name>")
+}
+
+func TestDemoExportLogID(t *testing.T) {
+	startMockFitbitServer(t)
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+	var list bytes.Buffer
+	console = &list
+	defer func() { console = os.Stdout }()
+
+	// The TCX of the activity, without the list of the activities to choose from
+	var stdout bytes.Buffer
+	assert.NoError(t, fetchActivityData([]string{"2024-09-07"}, exportOptions{logID: 202409073, stdout: &stdout}))
+	assert.Contains(t, stdout.String(), `<Activity Sport="Swim">`)
+	assert.NotContains(t, list.String(), "Available Activities")
+	assert.NoFileExists(t, filepath.Join(outputDir, "Swim-202409073.tcx"))
+
+	assert.ErrorContains(t, fetchActivityData([]string{"2024-09-07"}, exportOptions{logID: 202409083, stdout: &stdout}), "no activity with log ID 202409083 on 2024-09-07")
+}
+
+func TestDemoExportGPSOnly(t *testing.T) {
+	startMockFitbitServer(t)
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+
+	assert.NoError(t, fetchActivityData([]string{"2024-09-07"}, exportOptions{selection: "2", gpsOnly: true}))
+
+	treadmill, err := os.ReadFile(filepath.Join(outputDir, "Treadmill-202409072.tcx"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(treadmill), "<Trackpoint>")
+	assert.NoFileExists(t, filepath.Join(outputDir, "Run-202409071.tcx"))
+}
+
+func TestDemoListActivities(t *testing.T) {
+	startMockFitbitServer(t)
+
+	start := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 9, 10, 0, 0, 0, 0, time.UTC)
+	activities, err := getListActivities(start, end)
+	assert.NoError(t, err)
+	// 10 days from the two pages of the list
+	if assert.Len(t, activities, 40) {
+		assert.Equal(t, int64(202409011), activities[0].LogID)
+		assert.Equal(t, "Run", activities[0].ActivityParentName)
+		assert.Equal(t, int64(202409104), activities[39].LogID)
+	}
+}
+
+func TestDemoQuota(t *testing.T) {
+	startMockFitbitServer(t)
+	rateLimit = rateLimiter{maxWait: time.Hour}
+	t.Cleanup(func() { rateLimit = rateLimiter{maxWait: time.Hour} })
+
+	var out bytes.Buffer
+	assert.NoError(t, printQuota(&out, false))
+	assert.Contains(t, out.String(), "Limit:      150 requests per hour\n")
+	assert.Contains(t, out.String(), "Remaining:  149\n")
+
+	// The quota goes down with the requests of the demo
+	_, err := fetchProfile()
+	assert.NoError(t, err)
+	quota, ok := rateLimit.quota()
+	if assert.True(t, ok) {
+		assert.Equal(t, 148, quota.Remaining)
+		assert.WithinDuration(t, time.Now().Truncate(time.Hour).Add(time.Hour), quota.ResetAt, 2*time.Second)
+	}
+}
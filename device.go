@@ -0,0 +1,57 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"FitbitNonLocTcx/tcx"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Paired trackers and watches, named as the Creator of the exported TCX of the activities they recorded
+var pairedDevices []data.Device
+
+// Gets the paired trackers and watches, without the scales. Needs the settings scope
+func fetchPairedDevices() ([]data.Device, error) {
+	body, err := apiGet(userURL("devices.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch devices: %w", err)
+	}
+	var devices []data.Device
+	if err := json.Unmarshal(body, &devices); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal devices: %s", err)
+	}
+
+	var trackers []data.Device
+	for _, device := range devices {
+		if !strings.EqualFold(device.Type, "SCALE") {
+			trackers = append(trackers, device)
+		}
+	}
+	return trackers, nil
+}
+
+// Returns the paired device that recorded the activity of the log, by the ID of its source or, without one, by
+// its name. Nil when it was logged manually or recorded with a device no longer paired, e.g. an earlier tracker
+func recordingDevice(log data.ActivityLog, devices []data.Device) *data.Device {
+	for i, device := range devices {
+		if log.Source.ID != "" && log.Source.ID == device.ID {
+			return &devices[i]
+		}
+		if log.Source.ID == "" && log.Source.Name != "" && strings.EqualFold(log.Source.Name, device.DeviceVersion) {
+			return &devices[i]
+		}
+	}
+	return nil
+}
+
+// Returns the TCX Creator of the device: its model as name, e.g. "Charge 6", and its ID. The API does not tell the
+// product ID and the firmware version, they are left 0
+func deviceCreator(device data.Device) *tcx.Creator {
+	unitID, err := strconv.ParseUint(device.ID, 10, 32)
+	if err != nil {
+		unitID = 0
+	}
+	return &tcx.Creator{Name: device.DeviceVersion, UnitID: strconv.FormatUint(unitID, 10), ProductID: "0", Version: &tcx.Version{}}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestFetchPairedDevices(t *testing.T) {
+	testCases := []struct {
+		testName string
+		response string
+		status   int
+		expected []data.Device
+		wantErr  bool
+	}{
+		{"SUCCESS - Trackers without the scale", `[
+			{"id":"111","deviceVersion":"Aria Air","type":"SCALE","lastSyncTime":"2024-09-09T07:00:00.000"},
+			{"id":"222","deviceVersion":"Charge 5","type":"TRACKER","lastSyncTime":"2024-01-02T10:00:00.000"},
+			{"id":"333","deviceVersion":"Charge 6","type":"TRACKER","lastSyncTime":"2024-09-08T07:12:34.000"}]`, http.StatusOK,
+			[]data.Device{{ID: "222", DeviceVersion: "Charge 5", Type: "TRACKER", LastSyncTime: "2024-01-02T10:00:00.000"},
+				{ID: "333", DeviceVersion: "Charge 6", Type: "TRACKER", LastSyncTime: "2024-09-08T07:12:34.000"}}, false},
+		{"SUCCESS - Only a scale", `[{"id":"111","deviceVersion":"Aria Air","type":"SCALE"}]`, http.StatusOK, nil, false},
+		{"FAILURE - Settings scope not granted", `{"errors":[{"errorType":"insufficient_scope"}]}`, http.StatusForbidden, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/1/user/-/devices.json", r.URL.Path)
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.response))
+			}))
+			token = &oauth2.Token{AccessToken: "access"}
+
+			devices, err := fetchPairedDevices()
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.expected, devices)
+		})
+	}
+}
+
+func TestRecordingDevice(t *testing.T) {
+	devices := []data.Device{{ID: "222", DeviceVersion: "Charge 5", Type: "TRACKER"}, {ID: "333", DeviceVersion: "Charge 6", Type: "TRACKER"}}
+	source := func(id string, name string, sourceType string) data.ActivityLog {
+		var log data.ActivityLog
+		log.Source.ID, log.Source.Name, log.Source.Type = id, name, sourceType
+		return log
+	}
+	testCases := []struct {
+		testName string
+		log      data.ActivityLog
+		expected *data.Device
+	}{
+		{"SUCCESS - By ID", source("222", "Charge 5", "tracker"), &devices[0]},
+		{"SUCCESS - By name without ID", source("", "charge 6", "tracker"), &devices[1]},
+		{"SUCCESS - Earlier tracker no longer paired", source("111", "Inspire 2", "tracker"), nil},
+		{"SUCCESS - Logged manually", source("", "Fitbit for Android", "app"), nil},
+		{"SUCCESS - Without source", data.ActivityLog{}, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, recordingDevice(tc.log, devices))
+		})
+	}
+}
+
+func TestInjectActivityTcxDevice(t *testing.T) {
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(testActivityTcx))
+
+	_, err := injectActivityTcx(xmlDoc, data.Activity{ActivityID: activityTypeTreadmill, ActivityParentName: "Treadmill"}, 10*time.Minute, 0, 100, 0, &data.Device{ID: "333", DeviceVersion: "Charge 6"})
+	assert.NoError(t, err)
+
+	creator := xmlDoc.FindElement("//Creator")
+	assert.Equal(t, "Charge 6", creator.SelectElement("Name").Text())
+	assert.Equal(t, "333", creator.SelectElement("UnitId").Text())
+	assert.Equal(t, "0", creator.FindElement("Version/VersionMajor").Text())
+	assert.Len(t, creator.SelectElements("Name"), 1)
+}
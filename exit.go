@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Exit codes of the app, documented in the README
+const (
+	exitOK          = 0 // Done, every activity exported
+	exitFailure     = 1 // Any other failure
+	exitUsage       = 2 // Invalid flags, arguments or configuration
+	exitAuth        = 3 // Authorization failed, or the Fitbit API rejected the token
+	exitRateLimited = 4 // Fitbit API rate limit exceeded
+	exitPartial     = 5 // Batch export finished, but some of the activities failed
+)
+
+// Error with the exit code it should end the app with
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// Attaches the exit code to the error, nil stays nil
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// Failed Fitbit API request, the response status and body
+type apiError struct {
+	status  int
+	body    string
+	resetIn time.Duration // Time until the rate limit resets, of a request rejected by the rate limit
+}
+
+func (e *apiError) Error() string {
+	if e.resetIn > 0 {
+		return fmt.Sprintf("request failed with status %d: %s (rate limit resets in %s)", e.status, e.body, e.resetIn.Round(time.Second))
+	}
+	return fmt.Sprintf("request failed with status %d: %s", e.status, e.body)
+}
+
+// Returns the exit code of the error: the attached one, or the one derived from a failed API request
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		switch apiErr.status {
+		case http.StatusTooManyRequests:
+			return exitRateLimited
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitAuth
+		}
+	}
+	return exitFailure
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	testCases := []struct {
+		testName     string
+		err          error
+		expectedCode int
+	}{
+		{testName: "SUCCESS - no error", err: nil, expectedCode: exitOK},
+		{testName: "SUCCESS - plain error", err: errors.New("failed"), expectedCode: exitFailure},
+		{testName: "SUCCESS - attached code", err: withExitCode(exitUsage, errors.New("invalid date")), expectedCode: exitUsage},
+		{testName: "SUCCESS - wrapped attached code", err: fmt.Errorf("export: %w", withExitCode(exitPartial, errors.New("1 failed"))), expectedCode: exitPartial},
+		{testName: "SUCCESS - rate limited", err: fmt.Errorf("fetch: %w", &apiError{status: http.StatusTooManyRequests}), expectedCode: exitRateLimited},
+		{testName: "SUCCESS - token rejected", err: &apiError{status: http.StatusUnauthorized}, expectedCode: exitAuth},
+		{testName: "SUCCESS - server error", err: &apiError{status: http.StatusInternalServerError}, expectedCode: exitFailure},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedCode, exitCode(tc.err))
+		})
+	}
+
+	assert.Nil(t, withExitCode(exitUsage, nil))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Goals that can be set by period, the distance in the unit system of the API requests
+var goalNames = map[string][]string{
+	"daily":  {"activeMinutes", "caloriesOut", "distance", "floors", "steps"},
+	"weekly": {"distance", "floors", "steps"},
+}
+
+// Activity goal as printed by the goals command
+type activityGoal struct {
+	Period string  `json:"period"`
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+}
+
+// Goals to update, given after goals set, e.g. goals set daily steps=12000
+type goalsUpdate struct {
+	period string
+	values url.Values
+}
+
+// Parses the arguments following the goals command: none to print the goals, or set daily|weekly and
+// name=value pairs to update them
+func parseGoalsArgs(args []string) (*goalsUpdate, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if args[0] != "set" || len(args) < 3 || goalNames[args[1]] == nil {
+		return nil, fmt.Errorf("unknown goals command, use: goals [set daily|weekly NAME=VALUE...]")
+	}
+	update := &goalsUpdate{period: args[1], values: url.Values{}}
+	for _, arg := range args[2:] {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || !slices.Contains(goalNames[update.period], name) {
+			return nil, fmt.Errorf("invalid %s goal %q, use NAME=VALUE with NAME one of: %s", update.period, arg, strings.Join(goalNames[update.period], ", "))
+		}
+		if f, err := strconv.ParseFloat(value, 64); err != nil || f < 0 {
+			return nil, fmt.Errorf("invalid %s goal %q, the value must be a positive number", update.period, arg)
+		}
+		update.values.Set(name, value)
+	}
+	return update, nil
+}
+
+// Prints the daily and weekly activity goals as a table or as JSON. With an update, it sets the goals of its
+// period first and prints the goals of that period as saved by Fitbit
+func printActivityGoals(out io.Writer, update *goalsUpdate, jsonOutput bool) error {
+	var goals []activityGoal
+	periods := []string{"daily", "weekly"}
+	if update != nil {
+		periods = []string{update.period}
+	}
+	for _, period := range periods {
+		goalsURL := userURL("activities/goals/" + period + ".json")
+		var body []byte
+		var err error
+		if update != nil {
+			body, err = apiPost(goalsURL, update.values)
+			if err != nil {
+				return fmt.Errorf("failed to update the %s goals: %w", period, err)
+			}
+		} else {
+			body, err = apiGet(goalsURL)
+			if err != nil {
+				return fmt.Errorf("failed to fetch the %s goals: %w", period, err)
+			}
+		}
+		var periodGoals data.ActivityGoals
+		if err := json.Unmarshal(body, &periodGoals); err != nil {
+			return fmt.Errorf("failed to unmarshal the %s goals: %s", period, err)
+		}
+		names := make([]string, 0, len(periodGoals.Goals))
+		for name := range periodGoals.Goals {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			goals = append(goals, activityGoal{period, name, periodGoals.Goals[name]})
+		}
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(goals)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tGOAL\tVALUE")
+	for _, goal := range goals {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", goal.Period, goal.Name, formatHealthValue(goal.Value))
+	}
+	return w.Flush()
+}
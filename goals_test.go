@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestParseGoalsArgs(t *testing.T) {
+	testCases := []struct {
+		testName string
+		args     []string
+		expected *goalsUpdate
+		err      bool
+	}{
+		{"SUCCESS - Print the goals", nil, nil, false},
+		{"SUCCESS - Daily goals", []string{"set", "daily", "steps=12000", "distance=8.5"}, &goalsUpdate{"daily", map[string][]string{"steps": {"12000"}, "distance": {"8.5"}}}, false},
+		{"SUCCESS - Weekly goal", []string{"set", "weekly", "floors=70"}, &goalsUpdate{"weekly", map[string][]string{"floors": {"70"}}}, false},
+		{"FAILURE - Unknown subcommand", []string{"get"}, nil, true},
+		{"FAILURE - Unknown period", []string{"set", "monthly", "steps=1"}, nil, true},
+		{"FAILURE - No goal", []string{"set", "daily"}, nil, true},
+		{"FAILURE - Goal not weekly", []string{"set", "weekly", "caloriesOut=20000"}, nil, true},
+		{"FAILURE - Missing value", []string{"set", "daily", "steps"}, nil, true},
+		{"FAILURE - Invalid value", []string{"set", "daily", "steps=many"}, nil, true},
+		{"FAILURE - Negative value", []string{"set", "daily", "steps=-1"}, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			update, err := parseGoalsArgs(tc.args)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, update)
+		})
+	}
+}
+
+func TestPrintActivityGoals(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		switch r.URL.Path {
+		case "/1/user/-/activities/goals/daily.json":
+			w.Write([]byte(`{"goals":{"activeMinutes":30,"caloriesOut":2500,"distance":8.05,"floors":10,"steps":10000}}`))
+		case "/1/user/-/activities/goals/weekly.json":
+			w.Write([]byte(`{"goals":{"distance":56.33,"floors":70,"steps":70000}}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	var out bytes.Buffer
+	assert.NoError(t, printActivityGoals(&out, nil, false))
+	assert.Contains(t, out.String(), "PERIOD")
+	assert.Contains(t, out.String(), "8.05")
+	assert.Contains(t, out.String(), "70000")
+
+	out.Reset()
+	assert.NoError(t, printActivityGoals(&out, nil, true))
+	var goals []activityGoal
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &goals))
+	assert.Len(t, goals, 8)
+	assert.Equal(t, activityGoal{"daily", "activeMinutes", 30}, goals[0])
+	assert.Equal(t, activityGoal{"weekly", "steps", 70000}, goals[7])
+}
+
+func TestUpdateActivityGoals(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/1/user/-/activities/goals/daily.json", r.URL.Path)
+		assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "12000", r.PostForm.Get("steps"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"goals":{"activeMinutes":30,"caloriesOut":2500,"distance":8.05,"floors":10,"steps":12000}}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	update, err := parseGoalsArgs([]string{"set", "daily", "steps=12000"})
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	assert.NoError(t, printActivityGoals(&out, update, true))
+	var goals []activityGoal
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &goals))
+	assert.Contains(t, goals, activityGoal{"daily", "steps", 12000})
+}
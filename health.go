@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Exporters of the health data commands by command name, they write the data of the date range as CSV or JSON.
+// With intraday, the detailed data instead of the daily summary
+var healthCommands = map[string]func(out io.Writer, start time.Time, end time.Time, intraday bool, jsonOutput bool) error{
+	"spo2":             exportSpO2,
+	"breathing-rate":   exportBreathingRate,
+	"skin-temperature": exportSkinTemperature,
+	"sleep":            exportSleep,
+	"hrv":              exportHRV,
+}
+
+// Parses the flags following a health data command, e.g. spo2 --intraday 2024-09-07. Returns the remaining date arguments
+func parseHealthArgs(command string, args []string) (bool, []string, error) {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	intraday := fs.Bool("intraday", false, "export the detailed data instead of the daily summary")
+	if err := fs.Parse(args); err != nil {
+		return false, nil, fmt.Errorf("%s: %s", command, err)
+	}
+	return *intraday, fs.Args(), nil
+}
+
+// Calls fetch for the consecutive chunks of the date range, each at most maxDays long, the longest range of
+// a single request of the endpoint
+func forDateChunks(start time.Time, end time.Time, maxDays int, fetch func(chunkStart time.Time, chunkEnd time.Time) error) error {
+	for chunkStart := start; !chunkStart.After(end); chunkStart = chunkStart.AddDate(0, 0, maxDays) {
+		chunkEnd := chunkStart.AddDate(0, 0, maxDays-1)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		if err := fetch(chunkStart, chunkEnd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the records as indented JSON, or the rows as CSV with the header
+func writeHealthRecords(out io.Writer, jsonOutput bool, records any, header []string, rows [][]string) error {
+	if jsonOutput {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(records)
+	}
+	w := csv.NewWriter(out)
+	w.Write(header)
+	w.WriteAll(rows)
+	return w.Error()
+}
+
+// Formats a value of a CSV row
+func formatHealthValue(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHealthArgs(t *testing.T) {
+	intraday, args, err := parseHealthArgs("spo2", []string{"--intraday", "2024-09-07"})
+	assert.NoError(t, err)
+	assert.True(t, intraday)
+	assert.Equal(t, []string{"2024-09-07"}, args)
+
+	intraday, args, err = parseHealthArgs("spo2", nil)
+	assert.NoError(t, err)
+	assert.False(t, intraday)
+	assert.Empty(t, args)
+
+	_, _, err = parseHealthArgs("breathing-rate", []string{"--hourly"})
+	assert.ErrorContains(t, err, "breathing-rate:")
+}
+
+func TestForDateChunks(t *testing.T) {
+	var chunks []string
+	start := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 8, 20, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, forDateChunks(start, end, 7, func(chunkStart time.Time, chunkEnd time.Time) error {
+		chunks = append(chunks, chunkStart.Format(dateLayout)+".."+chunkEnd.Format(dateLayout))
+		return nil
+	}))
+	assert.Equal(t, []string{"2024-08-01..2024-08-07", "2024-08-08..2024-08-14", "2024-08-15..2024-08-20"}, chunks)
+}
+
+func TestWriteHealthRecords(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, writeHealthRecords(&out, false, nil, []string{"date", "value"}, [][]string{{"2024-09-07", "1.5"}}))
+	assert.Equal(t, "date,value\n2024-09-07,1.5\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, writeHealthRecords(&out, true, []int{}, nil, nil))
+	assert.Equal(t, "[]\n", out.String())
+}
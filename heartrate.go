@@ -0,0 +1,175 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Detail levels of the intraday heart rate: a reading every few seconds, or one per minute
+var heartRateDetails = []string{"1sec", "1min"}
+
+// Heart rate readings of an activity, sorted by time
+type heartRateSamples struct {
+	times  []time.Time
+	bpm    []int
+	maxAge time.Duration // A reading older than this does not apply to a track point
+}
+
+// Gets the heart rate readings during the activity at the detail level. When the 1sec detail is not available for
+// the account, e.g. the application is not a personal one, falls back to 1min
+func fetchHeartRate(activity data.Activity, detail string) (heartRateSamples, error) {
+	samples, err := fetchHeartRateDetail(activity, detail)
+	var apiErr *apiError
+	if detail == "1sec" && ((err == nil && len(samples.times) == 0) ||
+		(errors.As(err, &apiErr) && apiErr.status != http.StatusTooManyRequests)) {
+		slog.Info("Heart rate not available every second, falling back to every minute", "activity", activityLabel(activity), "err", err)
+		return fetchHeartRateDetail(activity, "1min")
+	}
+	return samples, err
+}
+
+// Gets the heart rate readings during the activity at the detail level, 1sec or 1min. The intraday data
+// needs a personal application, or one approved by Fitbit for intraday access
+func fetchHeartRateDetail(activity data.Activity, detail string) (heartRateSamples, error) {
+	start, end, err := activityWindow(activity)
+	if err != nil {
+		return heartRateSamples{}, err
+	}
+
+	url := userURL(fmt.Sprintf("activities/heart/date/%s/1d/%s/time/%s/%s.json",
+		activity.StartDate, detail, start.Format("15:04"), end.Format("15:04")))
+	body, err := apiGet(url)
+	if err != nil {
+		return heartRateSamples{}, fmt.Errorf("failed to fetch heart rate: %w", err)
+	}
+	var intraday data.HeartRateIntraday
+	if err := json.Unmarshal(body, &intraday); err != nil {
+		return heartRateSamples{}, fmt.Errorf("failed to unmarshal heart rate: %s", err)
+	}
+
+	// A minute reading applies to its whole minute, a second one until the next, at most a few seconds later
+	samples := heartRateSamples{maxAge: 15 * time.Second}
+	if intraday.Intraday.DatasetType == "minute" {
+		samples.maxAge = time.Minute
+	}
+	for _, reading := range intraday.Intraday.Dataset {
+		t, err := time.ParseInLocation(dateLayout+" 15:04:05", activity.StartDate+" "+reading.Time, userLocation)
+		if err != nil {
+			continue
+		}
+		samples.times = append(samples.times, t)
+		samples.bpm = append(samples.bpm, reading.Value)
+	}
+	sort.Sort(samples)
+	return samples, nil
+}
+
+func (s heartRateSamples) Len() int           { return len(s.times) }
+func (s heartRateSamples) Less(i, j int) bool { return s.times[i].Before(s.times[j]) }
+func (s heartRateSamples) Swap(i, j int) {
+	s.times[i], s.times[j] = s.times[j], s.times[i]
+	s.bpm[i], s.bpm[j] = s.bpm[j], s.bpm[i]
+}
+
+// Heart rate at t, the last reading before it, when it is not older than maxAge
+func (s heartRateSamples) at(t time.Time) (int, bool) {
+	i := sort.Search(len(s.times), func(i int) bool { return s.times[i].After(t) }) - 1
+	if i < 0 || t.Sub(s.times[i]) >= s.maxAge {
+		return 0, false
+	}
+	return s.bpm[i], true
+}
+
+// Adds the heart rate to the track points of the TCX recorded without it, e.g. of the activities without GPS
+func addTrackpointHeartRate(xmlDoc *etree.Document, samples heartRateSamples) {
+	for _, trackpoint := range xmlDoc.FindElements("//Trackpoint") {
+		timeElement := trackpoint.SelectElement("Time")
+		if timeElement == nil || trackpoint.SelectElement("HeartRateBpm") != nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, timeElement.Text())
+		if err != nil {
+			continue
+		}
+		bpm, ok := samples.at(t)
+		if !ok {
+			continue
+		}
+
+		// HeartRateBpm follows the Time, the Position, the AltitudeMeters and the DistanceMeters of the track point
+		element := etree.NewElement("HeartRateBpm")
+		element.CreateElement("Value").SetText(strconv.Itoa(bpm))
+		after := timeElement
+		for _, previous := range []string{"Position", "AltitudeMeters", "DistanceMeters"} {
+			if previousElement := trackpoint.SelectElement(previous); previousElement != nil {
+				after = previousElement
+			}
+		}
+		trackpoint.InsertChildAt(after.Index()+1, element)
+	}
+}
+
+// Adds the average and the maximum heart rate of its readings to each lap of the TCX recorded without them,
+// training platforms often show the heart rate of the laps rather than of the track points. Laps without a valid
+// start time are left as they are
+func addLapHeartRate(xmlDoc *etree.Document, samples heartRateSamples) {
+	for _, lap := range xmlDoc.FindElements("/TrainingCenterDatabase/Activities/Activity/Lap") {
+		if lap.SelectElement("AverageHeartRateBpm") != nil || lap.SelectElement("MaximumHeartRateBpm") != nil {
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, lap.SelectAttrValue("StartTime", ""))
+		if err != nil {
+			slog.Warn("Invalid lap start time, exporting the lap without heart rate", "err", err)
+			continue
+		}
+		var seconds float64
+		if totalTime := lap.SelectElement("TotalTimeSeconds"); totalTime != nil {
+			seconds, _ = strconv.ParseFloat(totalTime.Text(), 64)
+		}
+		average, maximum, ok := samples.summary(start, start.Add(time.Duration(seconds*float64(time.Second))))
+		if !ok {
+			continue
+		}
+
+		// The heart rate follows the Calories of the lap, and what precedes it
+		index := 0
+		for _, previous := range []string{"TotalTimeSeconds", "DistanceMeters", "MaximumSpeed", "Calories"} {
+			if element := lap.SelectElement(previous); element != nil {
+				index = element.Index() + 1
+			}
+		}
+		averageElement := etree.NewElement("AverageHeartRateBpm")
+		averageElement.CreateElement("Value").SetText(strconv.Itoa(average))
+		maximumElement := etree.NewElement("MaximumHeartRateBpm")
+		maximumElement.CreateElement("Value").SetText(strconv.Itoa(maximum))
+		lap.InsertChildAt(index, averageElement)
+		lap.InsertChildAt(index+1, maximumElement)
+	}
+}
+
+// Average, rounded, and maximum of the readings in [start, end). False without readings
+func (s heartRateSamples) summary(start time.Time, end time.Time) (int, int, bool) {
+	sum, count, maximum := 0, 0, 0
+	for i, t := range s.times {
+		if t.Before(start) || !t.Before(end) {
+			continue
+		}
+		sum += s.bpm[i]
+		count++
+		maximum = max(maximum, s.bpm[i])
+	}
+	if count == 0 {
+		return 0, 0, false
+	}
+	return int(math.Round(float64(sum) / float64(count))), maximum, true
+}
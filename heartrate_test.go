@@ -0,0 +1,134 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestFetchHeartRate(t *testing.T) {
+	const secondPath = "/1/user/-/activities/heart/date/2024-09-07/1d/1sec/time/10:00/10:30.json"
+	const minutePath = "/1/user/-/activities/heart/date/2024-09-07/1d/1min/time/10:00/10:30.json"
+	secondBody := `{"activities-heart":[],"activities-heart-intraday":{"dataset":[{"time":"10:00:05","value":101},{"time":"10:00:00","value":98}],"datasetInterval":1,"datasetType":"second"}}`
+	minuteBody := `{"activities-heart":[],"activities-heart-intraday":{"dataset":[{"time":"10:00:00","value":99},{"time":"10:01:00","value":112}],"datasetInterval":1,"datasetType":"minute"}}`
+
+	testCases := []struct {
+		testName string
+		detail   string
+		seconds  int    // Status of the 1sec request
+		body     string // Body of the 1sec request
+		expected []int
+		maxAge   time.Duration
+		requests []string
+		wantErr  bool
+	}{
+		{"SUCCESS - Every second", "1sec", http.StatusOK, secondBody, []int{98, 101}, 15 * time.Second, []string{secondPath}, false},
+		{"SUCCESS - Every minute", "1min", http.StatusOK, secondBody, []int{99, 112}, time.Minute, []string{minutePath}, false},
+		{"SUCCESS - Fallback when seconds are forbidden", "1sec", http.StatusForbidden, `{"errors":[]}`, []int{99, 112}, time.Minute, []string{secondPath, minutePath}, false},
+		{"SUCCESS - Fallback without intraday dataset", "1sec", http.StatusOK, `{"activities-heart":[]}`, []int{99, 112}, time.Minute, []string{secondPath, minutePath}, false},
+		{"FAILURE - Rate limited", "1sec", http.StatusTooManyRequests, `{"errors":[]}`, nil, 0, []string{secondPath}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			var requests []string
+			stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.URL.Path)
+				switch r.URL.Path {
+				case secondPath:
+					w.WriteHeader(tc.seconds)
+					w.Write([]byte(tc.body))
+				case minutePath:
+					w.Write([]byte(minuteBody))
+				default:
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+			}))
+			token = &oauth2.Token{AccessToken: "access"}
+			stubSleep(t)
+			rateLimit.maxWait = 0
+
+			samples, err := fetchHeartRate(data.Activity{LogID: 1, StartDate: "2024-09-07", StartTime: "10:00", Duration: 1800000}, tc.detail)
+			assert.Equal(t, tc.requests, requests)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, samples.bpm)
+			assert.Equal(t, tc.maxAge, samples.maxAge)
+		})
+	}
+}
+
+func TestAddTrackpointHeartRate(t *testing.T) {
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Running"><Lap><Track>
+		<Trackpoint><Time>2024-09-07T08:00:30Z</Time><DistanceMeters>0</DistanceMeters></Trackpoint>
+		<Trackpoint><Time>2024-09-07T10:01:10.000+02:00</Time><DistanceMeters>120</DistanceMeters><Extensions/></Trackpoint>
+		<Trackpoint><Time>2024-09-07T08:01:20Z</Time><HeartRateBpm><Value>130</Value></HeartRateBpm></Trackpoint>
+		<Trackpoint><Time>2024-09-07T08:03:00Z</Time></Trackpoint>
+		</Track></Lap></Activity></Activities></TrainingCenterDatabase>`))
+
+	location := userLocation
+	addTrackpointHeartRate(xmlDoc, heartRateSamples{
+		times:  []time.Time{time.Date(2024, 9, 7, 10, 0, 0, 0, location), time.Date(2024, 9, 7, 10, 1, 0, 0, location)},
+		bpm:    []int{99, 112},
+		maxAge: time.Minute,
+	})
+
+	trackpoints := xmlDoc.FindElements("//Trackpoint")
+	assert.Equal(t, "99", trackpoints[0].FindElement("HeartRateBpm/Value").Text())
+	assert.Equal(t, 2, trackpoints[0].SelectElement("HeartRateBpm").Index())
+	assert.Equal(t, "112", trackpoints[1].FindElement("HeartRateBpm/Value").Text())
+	assert.Equal(t, 2, trackpoints[1].SelectElement("HeartRateBpm").Index())
+	assert.Equal(t, "130", trackpoints[2].FindElement("HeartRateBpm/Value").Text())
+	assert.Len(t, trackpoints[2].SelectElements("HeartRateBpm"), 1)
+	assert.Nil(t, trackpoints[3].SelectElement("HeartRateBpm"))
+}
+
+func TestAddLapHeartRate(t *testing.T) {
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Running">
+		<Lap StartTime="2024-09-07T08:00:00Z"><TotalTimeSeconds>120</TotalTimeSeconds><DistanceMeters>400</DistanceMeters><Calories>20</Calories><Intensity>Active</Intensity><TriggerMethod>Manual</TriggerMethod></Lap>
+		<Lap StartTime="2024-09-07T08:02:00Z"><TotalTimeSeconds>60</TotalTimeSeconds><DistanceMeters>200</DistanceMeters><Calories>10</Calories><AverageHeartRateBpm><Value>150</Value></AverageHeartRateBpm><Intensity>Active</Intensity></Lap>
+		<Lap StartTime="2024-09-07T08:03:00Z"><TotalTimeSeconds>60</TotalTimeSeconds><Calories>10</Calories></Lap>
+		</Activity></Activities></TrainingCenterDatabase>`))
+
+	location := userLocation
+	samples := heartRateSamples{maxAge: time.Minute}
+	for i, bpm := range []int{98, 111, 125, 140} {
+		samples.times = append(samples.times, time.Date(2024, 9, 7, 10, i, 0, 0, location))
+		samples.bpm = append(samples.bpm, bpm)
+	}
+	addLapHeartRate(xmlDoc, samples)
+
+	laps := xmlDoc.FindElements("//Lap")
+	assert.Equal(t, "105", laps[0].FindElement("AverageHeartRateBpm/Value").Text())
+	assert.Equal(t, "111", laps[0].FindElement("MaximumHeartRateBpm/Value").Text())
+	assert.Equal(t, 3, laps[0].SelectElement("AverageHeartRateBpm").Index())
+	assert.Equal(t, 4, laps[0].SelectElement("MaximumHeartRateBpm").Index())
+	assert.Equal(t, "150", laps[1].FindElement("AverageHeartRateBpm/Value").Text())
+	assert.Nil(t, laps[1].SelectElement("MaximumHeartRateBpm"))
+	assert.Equal(t, "140", laps[2].FindElement("AverageHeartRateBpm/Value").Text())
+	assert.Equal(t, 2, laps[2].SelectElement("AverageHeartRateBpm").Index())
+
+	// A lap without start time is skipped, the next one still gets its heart rate
+	xmlDoc = etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Running"><Lap><TotalTimeSeconds>60</TotalTimeSeconds></Lap>
+		<Lap StartTime="2024-09-07T08:03:00Z"><TotalTimeSeconds>60</TotalTimeSeconds></Lap></Activity></Activities></TrainingCenterDatabase>`))
+	addLapHeartRate(xmlDoc, samples)
+	laps = xmlDoc.FindElements("//Lap")
+	assert.Nil(t, laps[0].SelectElement("AverageHeartRateBpm"))
+	assert.Equal(t, "140", laps[1].FindElement("AverageHeartRateBpm/Value").Text())
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Longest date range of a single HRV request
+const hrvMaxDays = 30
+
+// HRV of a day
+type hrvSummary struct {
+	Date       string  `json:"date"`
+	DailyRmssd float64 `json:"dailyRmssd"`
+	DeepRmssd  float64 `json:"deepRmssd"`
+}
+
+// Writes the heart rate variability (RMSSD in milliseconds) of the date range as CSV or as JSON: the daily and the
+// deep sleep RMSSD, or with intraday, the readings of the night by minute. Fitbit assigns a night to the day it ends on
+func exportHRV(out io.Writer, start time.Time, end time.Time, intraday bool, jsonOutput bool) error {
+	summaries := []hrvSummary{}
+	minutes := []data.HRVMinute{}
+	err := forDateChunks(start, end, hrvMaxDays, func(chunkStart time.Time, chunkEnd time.Time) error {
+		url := userURL("hrv/date/" + chunkStart.Format(dateLayout) + "/" + chunkEnd.Format(dateLayout))
+		if intraday {
+			url += "/all"
+		}
+		body, err := apiGet(url + ".json")
+		if err != nil {
+			return fmt.Errorf("failed to fetch HRV from %s to %s: %w", chunkStart.Format(dateLayout), chunkEnd.Format(dateLayout), err)
+		}
+		var chunk data.HRVs
+		if err := json.Unmarshal(body, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal HRV: %s", err)
+		}
+		for _, day := range chunk.HRV {
+			summaries = append(summaries, hrvSummary{Date: day.DateTime, DailyRmssd: day.Value.DailyRmssd, DeepRmssd: day.Value.DeepRmssd})
+			minutes = append(minutes, day.Minutes...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	if intraday {
+		for _, minute := range minutes {
+			rows = append(rows, []string{minute.Minute, formatHealthValue(minute.Value.Rmssd), formatHealthValue(minute.Value.Coverage),
+				formatHealthValue(minute.Value.HF), formatHealthValue(minute.Value.LF)})
+		}
+		return writeHealthRecords(out, jsonOutput, minutes, []string{"time", "rmssd", "coverage", "hf", "lf"}, rows)
+	}
+	for _, summary := range summaries {
+		rows = append(rows, []string{summary.Date, formatHealthValue(summary.DailyRmssd), formatHealthValue(summary.DeepRmssd)})
+	}
+	return writeHealthRecords(out, jsonOutput, summaries, []string{"date", "daily_rmssd", "deep_rmssd"}, rows)
+}
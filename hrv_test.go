@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestExportHRV(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/user/-/hrv/date/2024-09-07/2024-09-07.json":
+			w.Write([]byte(`{"hrv":[{"value":{"dailyRmssd":34.9,"deepRmssd":31.4},"dateTime":"2024-09-07"}]}`))
+		case "/1/user/-/hrv/date/2024-09-07/2024-09-07/all.json":
+			w.Write([]byte(`{"hrv":[{"minutes":[{"minute":"2024-09-07T02:04:00.000","value":{"rmssd":28.4,"coverage":0.99,"hf":127.3,"lf":638.9}}],"dateTime":"2024-09-07"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	day := time.Date(2024, 9, 7, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	assert.NoError(t, exportHRV(&out, day, day, false, false))
+	assert.Equal(t, "date,daily_rmssd,deep_rmssd\n2024-09-07,34.9,31.4\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, exportHRV(&out, day, day, true, false))
+	assert.Equal(t, "time,rmssd,coverage,hf,lf\n2024-09-07T02:04:00.000,28.4,0.99,127.3,638.9\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, exportHRV(&out, day, day, false, true))
+	assert.JSONEq(t, `[{"date":"2024-09-07","dailyRmssd":34.9,"deepRmssd":31.4}]`, out.String())
+}
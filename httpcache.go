@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Cache of the responses of the activity lists and of the TCX files, with their ETag and Last-Modified. They are
+// requested again with If-None-Match and If-Modified-Since, an unchanged response (304 Not Modified) is read from
+// the cache, so syncing the same period again costs almost nothing
+type responseCache struct {
+	dir string // Caching is off when empty
+}
+
+// Cache of the API requests, set up once the Fitbit user is known
+var responses responseCache
+
+// Cached response of a URL, with its validators
+type cachedResponse struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Body         string `json:"body"`
+}
+
+// Returns the location of the response cache of the Fitbit user, ~/.cache/fitbittcx/responses/<user ID>
+func responseCacheDir(userID string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %s", err)
+	}
+	if userID == "" {
+		userID = "default"
+	}
+	return filepath.Join(cacheDir, "fitbittcx", "responses", userID), nil
+}
+
+// Tells whether the responses of the URL are cached: the daily activity summaries, the activity log list
+// and the TCX files
+func conditionalURL(apiURL string) bool {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(u.Path, ".tcx") || strings.HasSuffix(u.Path, "/activities/list.json") ||
+		strings.Contains(u.Path, "/activities/date/")
+}
+
+// Cache file of the URL, named after its hash
+func (c responseCache) file(apiURL string) string {
+	sum := sha256.Sum256([]byte(apiURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Gets the cached response of the URL. False when it is not cached, or has no validator
+func (c responseCache) load(apiURL string) (cachedResponse, bool) {
+	if c.dir == "" || !conditionalURL(apiURL) {
+		return cachedResponse{}, false
+	}
+	content, err := os.ReadFile(c.file(apiURL))
+	if err != nil {
+		return cachedResponse{}, false
+	}
+	var cached cachedResponse
+	if err := json.Unmarshal(content, &cached); err != nil || cached.URL != apiURL || (cached.ETag == "" && cached.LastModified == "") {
+		return cachedResponse{}, false
+	}
+	return cached, true
+}
+
+// Caches the response of the URL when it has a validator. A failure is only logged, the URL is requested
+// unconditionally the next time
+func (c responseCache) store(apiURL string, header http.Header, body []byte) {
+	if c.dir == "" || !conditionalURL(apiURL) {
+		return
+	}
+	cached := cachedResponse{URL: apiURL, ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified"), Body: string(body)}
+	if cached.ETag == "" && cached.LastModified == "" {
+		return
+	}
+	content, err := json.Marshal(cached)
+	if err == nil {
+		err = os.MkdirAll(c.dir, 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(c.file(apiURL), content, 0600)
+	}
+	if err != nil {
+		slog.Warn("Failed to cache the response", "url", apiURL, "err", err)
+	}
+}
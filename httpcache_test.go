@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestConditionalURL(t *testing.T) {
+	testCases := []struct {
+		testName string
+		url      string
+		expected bool
+	}{
+		{"SUCCESS - TCX", "https://api.fitbit.com/1/user/-/activities/12345.tcx?includePartialTCX=true", true},
+		{"SUCCESS - Activity log list", "https://api.fitbit.com/1/user/-/activities/list.json?afterDate=2024-09-01&limit=100&offset=0&sort=asc", true},
+		{"SUCCESS - Daily activity summary", "https://api.fitbit.com/1/user/-/activities/date/2024-09-07.json", true},
+		{"SUCCESS - Intraday data", "https://api.fitbit.com/1/user/-/activities/steps/date/2024-09-07/1d/1min/time/10:00/10:30.json", false},
+		{"SUCCESS - Profile", "https://api.fitbit.com/1/user/-/profile.json", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, conditionalURL(tc.url))
+		})
+	}
+}
+
+func TestAPIGetConditional(t *testing.T) {
+	var conditions []string
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditions = append(conditions, r.Header.Get("If-None-Match")+"|"+r.Header.Get("If-Modified-Since"))
+		if r.Header.Get("If-None-Match") == `W/"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `W/"v1"`)
+		w.Header().Set("Last-Modified", "Sat, 07 Sep 2024 12:00:00 GMT")
+		w.Write([]byte(testActivityTcx))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	responses.dir = t.TempDir()
+	defer func() { responses.dir = "" }()
+
+	url := userURL("activities/12345.tcx?includePartialTCX=true")
+	for i := 0; i < 2; i++ {
+		body, err := apiGet(url)
+		assert.NoError(t, err)
+		assert.Equal(t, testActivityTcx, string(body))
+	}
+	assert.Equal(t, []string{"|", `W/"v1"|Sat, 07 Sep 2024 12:00:00 GMT`}, conditions)
+
+	// Responses without validators, and of the other endpoints, are not cached
+	entries, _ := os.ReadDir(responses.dir)
+	assert.Len(t, entries, 1)
+	_, err := apiGet(userURL("profile.json"))
+	assert.NoError(t, err)
+	entries, _ = os.ReadDir(responses.dir)
+	assert.Len(t, entries, 1)
+}
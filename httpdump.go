@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials in the dumped requests and responses: the Authorization header, the codes and tokens of the
+// OAuth form bodies, and the tokens of the OAuth JSON responses
+var (
+	authorizationHeader = regexp.MustCompile(`(?mi)^(Authorization: \S+) [^\r\n]*`)
+	formSecret          = regexp.MustCompile(`\b((?:code|code_verifier|client_secret|refresh_token|token)=)[^&\s]+`)
+	jsonSecret          = regexp.MustCompile(`("(?:access_token|refresh_token|id_token)"\s*:\s*)"[^"]*"`)
+)
+
+// Writes the requests and responses of the shared HTTP client, with their headers and bodies, to out, e.g. to
+// diagnose and report API problems. The credentials are redacted, see redactCredentials
+type dumpTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	out  io.Writer
+}
+
+// Dumps the requests and responses of the shared HTTP client into the file, created only readable by the user as
+// the bodies have the health data
+func configureHTTPDump(fileName string) (io.Closer, error) {
+	if fileName == "" {
+		return io.NopCloser(nil), nil
+	}
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP dump file: %s", err)
+	}
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	httpClient.Transport = &dumpTransport{next: next, out: file}
+	return file, nil
+}
+
+func (d *dumpTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Restores the body of the request
+	requestDump, err := httputil.DumpRequestOut(r, true)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := d.next.RoundTrip(r)
+	if err != nil {
+		d.write(requestDump, []byte("error: "+err.Error()+"\n"), time.Since(start))
+		return nil, err
+	}
+
+	header, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	d.write(requestDump, append(header, readableBody(resp.Header, body)...), time.Since(start))
+	return resp, nil
+}
+
+// Writes a request and its response, with the credentials redacted
+func (d *dumpTransport) write(request []byte, response []byte, elapsed time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintf(d.out, ">>> %s\n%s\n<<< %s\n%s\n\n", time.Now().Format(time.RFC3339),
+		strings.TrimSpace(redactCredentials(string(request))), elapsed.Round(time.Millisecond), strings.TrimSpace(redactCredentials(string(response))))
+}
+
+// Body of the response as text, decompressed when gzip encoded
+func readableBody(header http.Header, body []byte) []byte {
+	if !strings.EqualFold(header.Get("Content-Encoding"), "gzip") {
+		return body
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return []byte("(invalid gzip body)")
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		return []byte("(invalid gzip body)")
+	}
+	return decompressed
+}
+
+// Replaces the bearer token and the other credentials of the dump with REDACTED
+func redactCredentials(dump string) string {
+	dump = authorizationHeader.ReplaceAllString(dump, "$1 REDACTED")
+	dump = formSecret.ReplaceAllString(dump, "${1}REDACTED")
+	return jsonSecret.ReplaceAllString(dump, `$1"REDACTED"`)
+}
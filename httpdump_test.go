@@ -0,0 +1,63 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactCredentials(t *testing.T) {
+	testCases := []struct {
+		testName string
+		dump     string
+		expected string
+	}{
+		{"SUCCESS - Bearer token", "GET /1/user/-/profile.json HTTP/1.1\r\nAuthorization: Bearer eyJhbGciOi.abc\r\n", "GET /1/user/-/profile.json HTTP/1.1\r\nAuthorization: Bearer REDACTED\r\n"},
+		{"SUCCESS - Client credentials", "Authorization: Basic dGVzdDpzZWNyZXQ=\n", "Authorization: Basic REDACTED\n"},
+		{"SUCCESS - Token exchange", "client_id=ABC&code=abc123&code_verifier=xyz&grant_type=authorization_code", "client_id=ABC&code=REDACTED&code_verifier=REDACTED&grant_type=authorization_code"},
+		{"SUCCESS - Token refresh", "grant_type=refresh_token&refresh_token=r1", "grant_type=refresh_token&refresh_token=REDACTED"},
+		{"SUCCESS - Token response", `{"access_token": "a1","expires_in":28800,"refresh_token":"r1","user_id":"ABC"}`, `{"access_token": "REDACTED","expires_in":28800,"refresh_token":"REDACTED","user_id":"ABC"}`},
+		{"SUCCESS - Health data", `{"activities":[{"logId":1,"steps":4200}]}`, `{"activities":[{"logId":1,"steps":4200}]}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, redactCredentials(tc.dump))
+		})
+	}
+}
+
+func TestConfigureHTTPDump(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		writer.Write([]byte(`{"activities":[{"logId":1}]}`))
+		writer.Close()
+	}))
+	fileName := filepath.Join(t.TempDir(), "http.log")
+	httpDump, err := configureHTTPDump(fileName)
+	assert.NoError(t, err)
+
+	body, status, err := doAPIRequest(http.MethodGet, userURL("activities/date/2024-09-07.json"), nil, "secret-access-token")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"activities":[{"logId":1}]}`, string(body))
+	assert.NoError(t, httpDump.Close())
+
+	dump, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Contains(t, string(dump), "GET /1/user/-/activities/date/2024-09-07.json HTTP/1.1")
+	assert.Contains(t, string(dump), "Authorization: Bearer REDACTED")
+	assert.NotContains(t, string(dump), "secret-access-token")
+	assert.Contains(t, string(dump), "HTTP/1.1 200 OK")
+	assert.Contains(t, string(dump), `{"activities":[{"logId":1}]}`)
+	info, err := os.Stat(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	_, err = configureHTTPDump(filepath.Join(t.TempDir(), "missing", "http.log"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Running total of a value given per local minute, e.g. the meters climbed by minute "2024-09-07T10:05"
+type minuteTotals struct {
+	minutes   []string // Sorted
+	perMinute map[string]float64
+	before    []float64 // Total before each minute, and after the last one
+}
+
+func newMinuteTotals(perMinute map[string]float64) minuteTotals {
+	totals := minuteTotals{perMinute: perMinute, before: make([]float64, len(perMinute)+1)}
+	for minute := range perMinute {
+		totals.minutes = append(totals.minutes, minute)
+	}
+	sort.Strings(totals.minutes)
+	for i, minute := range totals.minutes {
+		totals.before[i+1] = totals.before[i] + perMinute[minute]
+	}
+	return totals
+}
+
+// Total until t, the value of its minute spread evenly over the minute
+func (m minuteTotals) at(t time.Time) float64 {
+	t = t.In(userLocation)
+	minute := t.Format("2006-01-02T15:04")
+	i := sort.SearchStrings(m.minutes, minute)
+	total := m.before[i]
+	if i < len(m.minutes) && m.minutes[i] == minute {
+		total += m.perMinute[minute] * (float64(t.Second()) + float64(t.Nanosecond())/1e9) / 60
+	}
+	return total
+}
+
+// Total of all the minutes
+func (m minuteTotals) total() float64 {
+	return m.before[len(m.before)-1]
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinuteTotals(t *testing.T) {
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+
+	totals := newMinuteTotals(map[string]float64{"2024-09-07T10:01": 4, "2024-09-07T10:03": 2})
+	assert.Equal(t, 6.0, totals.total())
+	assert.Equal(t, 0.0, totals.at(time.Date(2024, 9, 7, 8, 0, 30, 0, time.UTC)))
+	assert.Equal(t, 1.0, totals.at(time.Date(2024, 9, 7, 10, 1, 15, 0, userLocation)))
+	assert.Equal(t, 4.0, totals.at(time.Date(2024, 9, 7, 10, 2, 59, 0, userLocation)))
+	assert.Equal(t, 6.0, totals.at(time.Date(2024, 9, 7, 10, 30, 0, 0, userLocation)))
+	assert.Equal(t, 0.0, newMinuteTotals(nil).at(time.Now()))
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"FitbitNonLocTcx/tcx"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Length of the laps of --laps, a distance, e.g. 1000 meters of "1km", or a duration, e.g. 5 minutes of "5min"
+type lapSplit struct {
+	meters   float64
+	duration time.Duration
+}
+
+// Units of the lap distances in meters, the longer suffixes first
+var lapDistanceUnits = []struct {
+	suffix string
+	meters float64
+}{{"km", 1000}, {"mi", 1609.344}, {"m", 1}}
+
+// Units of the lap durations, as written for time.ParseDuration
+var lapDurationUnits = strings.NewReplacer("min", "m", "sec", "s")
+
+// Parses the --laps value, a distance such as 1km, 1mi or 400m, or a duration such as 5min, 90s or 1h. No split
+// when empty
+func parseLapSplit(value string) (lapSplit, error) {
+	if value == "" {
+		return lapSplit{}, nil
+	}
+	if strings.HasSuffix(value, "min") || strings.HasSuffix(value, "sec") || strings.HasSuffix(value, "s") || strings.HasSuffix(value, "h") {
+		duration, err := time.ParseDuration(lapDurationUnits.Replace(value))
+		if err != nil || duration < time.Second {
+			return lapSplit{}, fmt.Errorf("invalid --laps %q, use a duration of at least a second such as 5min, 90s or 1h", value)
+		}
+		return lapSplit{duration: duration}, nil
+	}
+	for _, unit := range lapDistanceUnits {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			distance, err := strconv.ParseFloat(number, 64)
+			if err != nil || distance <= 0 || math.IsInf(distance, 0) {
+				break
+			}
+			return lapSplit{meters: distance * unit.meters}, nil
+		}
+	}
+	return lapSplit{}, fmt.Errorf("invalid --laps %q, use a distance such as 1km, 1mi or 400m, or a duration such as 5min", value)
+}
+
+// Splits the laps of the activity into laps of the split distance or duration, each with its time, distance,
+// calories and the heart rate of the intraday samples or, without them, of its track points. The times of the distance splits, and the distances of the time
+// splits, are interpolated between the track points around them. Activities shorter than a lap, split by distance
+// without the distance of their track points, or with laps without a valid start time keep their laps
+func splitLaps(xmlDoc *etree.Document, split lapSplit, samples heartRateSamples) error {
+	db, err := parseTcxDocument(xmlDoc)
+	if err != nil {
+		return err
+	}
+	activity := db.FirstActivity()
+	if activity == nil || len(activity.Laps) == 0 {
+		return nil
+	}
+	start, err := time.Parse(time.RFC3339, activity.Laps[0].StartTime)
+	if err != nil {
+		slog.Warn("Invalid lap start time, keeping the laps", "err", err)
+		return nil
+	}
+	last := activity.Laps[len(activity.Laps)-1]
+	lastStart, err := time.Parse(time.RFC3339, last.StartTime)
+	if err != nil {
+		slog.Warn("Invalid lap start time, keeping the laps", "err", err)
+		return nil
+	}
+	end := lastStart.Add(time.Duration(last.TotalTimeSeconds * float64(time.Second)))
+
+	var trackpoints []tcx.Trackpoint
+	calories, lapsDistance := 0, 0.0
+	for _, lap := range activity.Laps {
+		calories += lap.Calories
+		lapsDistance += lap.DistanceMeters
+		for _, track := range lap.Tracks {
+			trackpoints = append(trackpoints, track.Trackpoints...)
+		}
+	}
+
+	// The distance curve of the track points
+	var curve distanceCurve
+	for _, trackpoint := range trackpoints {
+		t, err := time.Parse(time.RFC3339, trackpoint.Time)
+		if err != nil || trackpoint.DistanceMeters == nil {
+			continue
+		}
+		if len(curve) > 0 && *trackpoint.DistanceMeters < curve[len(curve)-1].distance {
+			continue
+		}
+		curve = append(curve, curvePoint{t, *trackpoint.DistanceMeters})
+	}
+
+	// Start of each lap, the end of the activity closes the last one
+	totalTime := end.Sub(start)
+	bounds := []time.Time{start}
+	if split.duration > 0 {
+		if totalTime <= split.duration {
+			return nil
+		}
+		for elapsed := split.duration; elapsed < totalTime; elapsed += split.duration {
+			bounds = append(bounds, start.Add(elapsed))
+		}
+	} else {
+		if len(curve) < 2 || curve.distance() <= split.meters {
+			return nil
+		}
+		for target := split.meters; target < curve.distance(); target += split.meters {
+			bounds = append(bounds, laterTime(curve.timeAt(target).Round(time.Second), bounds[len(bounds)-1]))
+		}
+	}
+	bounds = append(bounds, laterTime(end, bounds[len(bounds)-1]))
+
+	// Distance covered until the time, of the curve or, without it, of the laps at an even pace
+	distanceAt := func(t time.Time) float64 {
+		if len(curve) >= 2 {
+			return curve.distanceAt(t)
+		}
+		if totalTime <= 0 {
+			return 0
+		}
+		return lapsDistance * float64(t.Sub(start)) / float64(totalTime)
+	}
+	laps := make([]tcx.Lap, len(bounds)-1)
+	for i := range laps {
+		startTime := bounds[i].UTC().Format(time.RFC3339)
+		if i == 0 {
+			startTime = activity.Laps[0].StartTime
+		}
+		// The calories are split by the time of the laps
+		lapCalories := calories
+		if totalTime > 0 {
+			lapCalories = int(math.Round(float64(calories)*float64(bounds[i+1].Sub(start))/float64(totalTime))) -
+				int(math.Round(float64(calories)*float64(bounds[i].Sub(start))/float64(totalTime)))
+		}
+		lapDistance, triggerMethod := 0.0, "Time"
+		if split.duration > 0 {
+			lapDistance = distanceAt(bounds[i+1]) - distanceAt(bounds[i])
+		} else {
+			lapDistance, triggerMethod = min(split.meters, curve.distance()-float64(i)*split.meters), "Distance"
+		}
+		laps[i] = tcx.Lap{
+			StartTime:        startTime,
+			TotalTimeSeconds: bounds[i+1].Sub(bounds[i]).Seconds(),
+			DistanceMeters:   math.Round(lapDistance*100) / 100,
+			Calories:         lapCalories,
+			Intensity:        "Active",
+			TriggerMethod:    triggerMethod,
+			Tracks:           []tcx.Track{{}},
+		}
+	}
+
+	// Track points by time, those without a time stay in the lap of the previous one
+	lap := 0
+	for _, trackpoint := range trackpoints {
+		if t, err := time.Parse(time.RFC3339, trackpoint.Time); err == nil {
+			for lap < len(laps)-1 && !t.Before(bounds[lap+1]) {
+				lap++
+			}
+		}
+		laps[lap].Tracks[0].Trackpoints = append(laps[lap].Tracks[0].Trackpoints, trackpoint)
+	}
+	for i := range laps {
+		if average, maximum, ok := samples.summary(bounds[i], bounds[i+1]); ok {
+			laps[i].AverageHeartRateBpm, laps[i].MaximumHeartRateBpm = &tcx.HeartRate{Value: average}, &tcx.HeartRate{Value: maximum}
+		} else {
+			setLapHeartRate(&laps[i])
+		}
+		if len(laps[i].Tracks[0].Trackpoints) == 0 {
+			laps[i].Tracks = nil
+		}
+	}
+
+	activity.Laps = laps
+	return setTcxDocument(xmlDoc, db)
+}
+
+// Sets the average and maximum heart rate of the lap from its track points, none without heart rate
+func setLapHeartRate(lap *tcx.Lap) {
+	sum, count, maximum := 0, 0, 0
+	for _, track := range lap.Tracks {
+		for _, trackpoint := range track.Trackpoints {
+			if trackpoint.HeartRateBpm == nil {
+				continue
+			}
+			sum += trackpoint.HeartRateBpm.Value
+			count++
+			maximum = max(maximum, trackpoint.HeartRateBpm.Value)
+		}
+	}
+	if count == 0 {
+		return
+	}
+	lap.AverageHeartRateBpm = &tcx.HeartRate{Value: int(math.Round(float64(sum) / float64(count)))}
+	lap.MaximumHeartRateBpm = &tcx.HeartRate{Value: maximum}
+}
+
+// Cumulative distance of the track points by time, never decreasing
+type distanceCurve []curvePoint
+
+type curvePoint struct {
+	time     time.Time
+	distance float64
+}
+
+// Distance of the last point
+func (c distanceCurve) distance() float64 {
+	return c[len(c)-1].distance
+}
+
+// Time the distance is reached, interpolated between the points around it. The distance must be within the curve
+func (c distanceCurve) timeAt(distance float64) time.Time {
+	next := 1
+	for next < len(c)-1 && c[next].distance < distance {
+		next++
+	}
+	before, after := c[next-1], c[next]
+	fraction := 0.0
+	if after.distance > before.distance {
+		fraction = (distance - before.distance) / (after.distance - before.distance)
+	}
+	return before.time.Add(time.Duration(fraction * float64(after.time.Sub(before.time))))
+}
+
+// Distance covered until the time, interpolated between the points around it, the first or last distance outside
+// the curve
+func (c distanceCurve) distanceAt(t time.Time) float64 {
+	if !t.After(c[0].time) {
+		return c[0].distance
+	}
+	for i := 1; i < len(c); i++ {
+		if t.After(c[i].time) {
+			continue
+		}
+		before, after := c[i-1], c[i]
+		fraction := 0.0
+		if after.time.After(before.time) {
+			fraction = float64(t.Sub(before.time)) / float64(after.time.Sub(before.time))
+		}
+		return before.distance + fraction*(after.distance-before.distance)
+	}
+	return c.distance()
+}
+
+func laterTime(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLapSplit(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		value         string
+		expectedSplit lapSplit
+		expectedError string
+	}{
+		{"SUCCESS - None", "", lapSplit{}, ""},
+		{"SUCCESS - Kilometer", "1km", lapSplit{meters: 1000}, ""},
+		{"SUCCESS - Mile", "1mi", lapSplit{meters: 1609.344}, ""},
+		{"SUCCESS - Meters", "400m", lapSplit{meters: 400}, ""},
+		{"SUCCESS - Fraction", "0.5km", lapSplit{meters: 500}, ""},
+		{"SUCCESS - Minutes", "5min", lapSplit{duration: 5 * time.Minute}, ""},
+		{"SUCCESS - Seconds", "90s", lapSplit{duration: 90 * time.Second}, ""},
+		{"SUCCESS - Hour", "1h", lapSplit{duration: time.Hour}, ""},
+		{"FAILURE - Under a second", "500ms", lapSplit{}, `invalid --laps "500ms"`},
+		{"FAILURE - Invalid duration", "fivemin", lapSplit{}, `invalid --laps "fivemin"`},
+		{"FAILURE - No unit", "1000", lapSplit{}, `invalid --laps "1000"`},
+		{"FAILURE - Unknown unit", "1yd", lapSplit{}, `invalid --laps "1yd"`},
+		{"FAILURE - Zero", "0km", lapSplit{}, `invalid --laps "0km"`},
+		{"FAILURE - No number", "km", lapSplit{}, `invalid --laps "km"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			split, err := parseLapSplit(tc.value)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedSplit, split)
+		})
+	}
+}
+
+// TCX of a 10 minute activity in a single lap, with a track point every minute covering 250 meters
+func testDistanceTcx(withDistance bool) string {
+	var trackpoints strings.Builder
+	for minute := 0; minute <= 10; minute++ {
+		fmt.Fprintf(&trackpoints, "<Trackpoint><Time>2024-09-07T08:%02d:00Z</Time>", minute)
+		if withDistance {
+			fmt.Fprintf(&trackpoints, "<DistanceMeters>%d</DistanceMeters>", minute*250)
+		}
+		fmt.Fprintf(&trackpoints, "<HeartRateBpm><Value>%d</Value></HeartRateBpm></Trackpoint>", 100+minute*5)
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"><Activities><Activity Sport="Running">` +
+		`<Id>2024-09-07T10:00:00.000+02:00</Id><Lap StartTime="2024-09-07T10:00:00.000+02:00"><TotalTimeSeconds>600</TotalTimeSeconds>` +
+		`<DistanceMeters>2500</DistanceMeters><Calories>100</Calories><Intensity>Active</Intensity><TriggerMethod>Manual</TriggerMethod>` +
+		`<Track>` + trackpoints.String() + `</Track></Lap><Creator><Name>Fitbit</Name></Creator></Activity></Activities></TrainingCenterDatabase>`
+}
+
+func TestSplitLaps(t *testing.T) {
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(testDistanceTcx(true)))
+
+	assert.NoError(t, splitLaps(xmlDoc, lapSplit{meters: 1000}, heartRateSamples{}))
+
+	laps := xmlDoc.FindElements("//Lap")
+	assert.Len(t, laps, 3)
+	expected := []struct {
+		start, seconds, distance, calories, average, maximum string
+		trackpoints                                          int
+	}{
+		{"2024-09-07T10:00:00.000+02:00", "240", "1000", "40", "108", "115", 4},
+		{"2024-09-07T08:04:00Z", "240", "1000", "40", "128", "135", 4},
+		{"2024-09-07T08:08:00Z", "120", "500", "20", "145", "150", 3},
+	}
+	for i, lap := range laps {
+		assert.Equal(t, expected[i].start, lap.SelectAttrValue("StartTime", ""))
+		assert.Equal(t, expected[i].seconds, lap.SelectElement("TotalTimeSeconds").Text())
+		assert.Equal(t, expected[i].distance, lap.SelectElement("DistanceMeters").Text())
+		assert.Equal(t, expected[i].calories, lap.SelectElement("Calories").Text())
+		assert.Equal(t, expected[i].average, lap.FindElement("AverageHeartRateBpm/Value").Text())
+		assert.Equal(t, expected[i].maximum, lap.FindElement("MaximumHeartRateBpm/Value").Text())
+		assert.Equal(t, "Distance", lap.SelectElement("TriggerMethod").Text())
+		assert.Len(t, lap.FindElements("Track/Trackpoint"), expected[i].trackpoints)
+	}
+	assert.Equal(t, "Fitbit", xmlDoc.FindElement("//Creator/Name").Text())
+}
+
+func TestSplitLapsByTime(t *testing.T) {
+	// 4 minute laps of the track points with distance
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(testDistanceTcx(true)))
+
+	assert.NoError(t, splitLaps(xmlDoc, lapSplit{duration: 4 * time.Minute}, heartRateSamples{}))
+
+	laps := xmlDoc.FindElements("//Lap")
+	if assert.Len(t, laps, 3) {
+		assert.Equal(t, "2024-09-07T08:04:00Z", laps[1].SelectAttrValue("StartTime", ""))
+		assert.Equal(t, "120", laps[2].SelectElement("TotalTimeSeconds").Text())
+		assert.Equal(t, "1000", laps[1].SelectElement("DistanceMeters").Text())
+		assert.Equal(t, "Time", laps[1].SelectElement("TriggerMethod").Text())
+	}
+
+	// 15 minute laps of a manually logged yoga session, its single summary lap, with the intraday heart rate
+	xmlDoc = etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(testActivityTcx))
+	_, err := injectActivityTcx(xmlDoc, data.Activity{ActivityParentID: 52001, ActivityParentName: "Yoga"}, 45*time.Minute, 0, 121, 0, nil)
+	assert.NoError(t, err)
+
+	at := func(minute int) time.Time { return time.Date(2024, 9, 7, 8, minute, 0, 0, time.UTC) }
+	samples := heartRateSamples{times: []time.Time{at(5), at(20), at(25)}, bpm: []int{100, 120, 131}}
+	assert.NoError(t, splitLaps(xmlDoc, lapSplit{duration: 15 * time.Minute}, samples))
+
+	laps = xmlDoc.FindElements("//Lap")
+	if assert.Len(t, laps, 3) {
+		for i, calories := range []string{"40", "41", "40"} {
+			assert.Equal(t, "900", laps[i].SelectElement("TotalTimeSeconds").Text())
+			assert.Equal(t, "0", laps[i].SelectElement("DistanceMeters").Text())
+			assert.Equal(t, calories, laps[i].SelectElement("Calories").Text())
+		}
+		assert.Equal(t, "2024-09-07T08:30:00Z", laps[2].SelectAttrValue("StartTime", ""))
+		assert.Equal(t, "100", laps[0].FindElement("AverageHeartRateBpm/Value").Text())
+		assert.Equal(t, "126", laps[1].FindElement("AverageHeartRateBpm/Value").Text())
+		assert.Equal(t, "131", laps[1].FindElement("MaximumHeartRateBpm/Value").Text())
+		assert.Nil(t, laps[2].SelectElement("AverageHeartRateBpm"))
+	}
+}
+
+func TestSplitLapsUnchanged(t *testing.T) {
+	testCases := []struct {
+		testName string
+		document string
+		split    lapSplit
+	}{
+		{"SUCCESS - Without distance", testDistanceTcx(false), lapSplit{meters: 1000}},
+		{"SUCCESS - Shorter than a lap", testDistanceTcx(true), lapSplit{meters: 5000}},
+		{"SUCCESS - Shorter than a timed lap", testDistanceTcx(true), lapSplit{duration: 10 * time.Minute}},
+		{"SUCCESS - Invalid start time", strings.Replace(testDistanceTcx(true), `StartTime="2024-09-07T10:00:00.000+02:00"`, `StartTime="10:00"`, 1), lapSplit{meters: 1000}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			xmlDoc := etree.NewDocument()
+			assert.NoError(t, xmlDoc.ReadFromString(tc.document))
+
+			assert.NoError(t, splitLaps(xmlDoc, tc.split, heartRateSamples{}))
+
+			laps := xmlDoc.FindElements("//Lap")
+			assert.Len(t, laps, 1)
+			assert.Equal(t, "600", laps[0].SelectElement("TotalTimeSeconds").Text())
+			assert.Len(t, laps[0].FindElements("Track/Trackpoint"), 11)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Place of the friends leaderboard as written by the leaderboard command
+type leaderboardEntry struct {
+	Rank    int     `json:"rank,omitempty"` // 0 for the friends without steps
+	UserID  string  `json:"userId"`
+	Name    string  `json:"name"`
+	Steps   float64 `json:"steps"`        // Steps of the last 7 days
+	Average float64 `json:"dailyAverage"` // Daily average of the last 7 days
+}
+
+// Writes the friends leaderboard of the steps of the last 7 days, the user included, as CSV or as JSON.
+// It needs the social scope
+func exportLeaderboard(out io.Writer, jsonOutput bool) error {
+	body, err := apiGet(userURL("leaderboard/friends.json"))
+	if err != nil {
+		return fmt.Errorf("failed to fetch friends leaderboard: %w", err)
+	}
+	var leaderboard data.Leaderboard
+	if err := json.Unmarshal(body, &leaderboard); err != nil {
+		return fmt.Errorf("failed to unmarshal friends leaderboard: %s", err)
+	}
+
+	names := map[string]string{}
+	for _, person := range leaderboard.Included {
+		names[person.ID] = person.Attributes.Name
+	}
+	entries := []leaderboardEntry{}
+	var rows [][]string
+	for _, ranked := range leaderboard.Data {
+		entry := leaderboardEntry{UserID: ranked.ID, Name: names[ranked.ID]}
+		if ranked.Type == "ranked-user" {
+			entry.Rank = ranked.Attributes.StepRank
+			entry.Steps = ranked.Attributes.StepSummary
+			entry.Average = ranked.Attributes.StepAverage
+		}
+		entries = append(entries, entry)
+		rank := ""
+		if entry.Rank > 0 {
+			rank = strconv.Itoa(entry.Rank)
+		}
+		rows = append(rows, []string{rank, entry.UserID, entry.Name, formatHealthValue(entry.Steps), formatHealthValue(entry.Average)})
+	}
+	return writeHealthRecords(out, jsonOutput, entries, []string{"rank", "user_id", "name", "steps", "daily_average"}, rows)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+const testLeaderboard = `{"data":[
+	{"type":"ranked-user","id":"ABC123","attributes":{"step-average":9120,"step-rank":1,"step-summary":63840},"relationships":{"user":{"data":{"type":"person","id":"ABC123"}}}},
+	{"type":"ranked-user","id":"DEF456","attributes":{"step-average":7001.5,"step-rank":2,"step-summary":49011},"relationships":{"user":{"data":{"type":"person","id":"DEF456"}}}},
+	{"type":"inactive-user","id":"GHI789","attributes":{},"relationships":{"user":{"data":{"type":"person","id":"GHI789"}}}}],
+	"included":[
+	{"type":"person","id":"ABC123","attributes":{"name":"Anna","avatar":"https://static0.fitbit.com/images/profile/defaultProfile_100.png","child":false,"friend":false}},
+	{"type":"person","id":"DEF456","attributes":{"name":"Bence","child":false,"friend":true}},
+	{"type":"person","id":"GHI789","attributes":{"name":"Csilla","child":true,"friend":true}}]}`
+
+func TestExportLeaderboard(t *testing.T) {
+	testCases := []struct {
+		testName   string
+		jsonOutput bool
+		expected   string
+	}{
+		{"SUCCESS - CSV", false, "rank,user_id,name,steps,daily_average\n1,ABC123,Anna,63840,9120\n2,DEF456,Bence,49011,7001.5\n,GHI789,Csilla,0,0\n"},
+		{"SUCCESS - JSON", true, `[
+	{
+		"rank": 1,
+		"userId": "ABC123",
+		"name": "Anna",
+		"steps": 63840,
+		"dailyAverage": 9120
+	},
+	{
+		"rank": 2,
+		"userId": "DEF456",
+		"name": "Bence",
+		"steps": 49011,
+		"dailyAverage": 7001.5
+	},
+	{
+		"userId": "GHI789",
+		"name": "Csilla",
+		"steps": 0,
+		"dailyAverage": 0
+	}
+]
+`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/1.1/user/-/leaderboard/friends.json" {
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+				w.Write([]byte(testLeaderboard))
+			}))
+			token = &oauth2.Token{AccessToken: "access"}
+
+			var out bytes.Buffer
+			assert.NoError(t, exportLeaderboard(&out, tc.jsonOutput))
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+func TestExportLeaderboardWithoutScope(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":[{"errorType":"insufficient_scope","message":"This application does not have permission to access social data."}]}`, http.StatusForbidden)
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	assert.ErrorContains(t, exportLeaderboard(&bytes.Buffer{}, false), "insufficient_scope")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Activity as printed by the list command, the JSON output is meant to be consumed by other scripts
+type listedActivity struct {
+	LogID           int64   `json:"logId"`
+	Sport           string  `json:"sport"`
+	StartTime       string  `json:"startTime"`
+	DurationSeconds int64   `json:"durationSeconds"`
+	Distance        float64 `json:"distance"`
+	DistanceUnit    string  `json:"distanceUnit,omitempty"`
+	Calories        int     `json:"calories"`
+	HasGPS          bool    `json:"hasGps"`
+}
+
+// Prints the activities of the date range as a table or as JSON, filtered by the type filters of the options
+func listActivities(out io.Writer, start time.Time, end time.Time, opts exportOptions, jsonOutput bool) error {
+	logs, err := getActivityLogs(start, end)
+	if err != nil {
+		return err
+	}
+	return printActivityLogs(out, logs, opts, jsonOutput)
+}
+
+// Prints the activity logs as a table or as JSON, filtered by the type filters of the options
+func printActivityLogs(out io.Writer, logs []data.ActivityLog, opts exportOptions, jsonOutput bool) error {
+	listed := []listedActivity{}
+	for _, log := range logs {
+		if !typeFilterMatches(opts, log.ActivityName) {
+			continue
+		}
+		listed = append(listed, listedActivity{
+			LogID:           log.LogID,
+			Sport:           log.ActivityName,
+			StartTime:       log.StartTime,
+			DurationSeconds: log.Duration / 1000,
+			Distance:        log.Distance,
+			DistanceUnit:    log.DistanceUnit,
+			Calories:        log.Calories,
+			HasGPS:          log.HasGPS,
+		})
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(listed)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LOG ID\tSTART\tSPORT\tDURATION\tDISTANCE\tCALORIES\tGPS")
+	for _, activity := range listed {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%.2f %s\t%d\t%t\n", activity.LogID, formatStartTime(activity.StartTime), activity.Sport,
+			time.Duration(activity.DurationSeconds)*time.Second, activity.Distance, activity.DistanceUnit, activity.Calories, activity.HasGPS)
+	}
+	return w.Flush()
+}
+
+// Gets the activity logs of the date range from the activity log list endpoint, which, unlike the daily
+// activity summary, tells whether an activity has GPS data
+func getActivityLogs(start time.Time, end time.Time) ([]data.ActivityLog, error) {
+	query := url.Values{}
+	query.Set("afterDate", start.Format(dateLayout))
+	query.Set("sort", "asc")
+	query.Set("offset", "0")
+	query.Set("limit", "100")
+	next := userURL("activities/list.json?" + query.Encode())
+
+	first, last := start.Format(dateLayout), end.Format(dateLayout)
+	var logs []data.ActivityLog
+	for next != "" {
+		body, err := apiGet(next)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch activity list: %w", err)
+		}
+		var page data.ActivityLogList
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal activity list: %s", err)
+		}
+		var raw struct {
+			Activities []json.RawMessage `json:"activities"`
+		}
+		if err := json.Unmarshal(body, &raw); err == nil && len(raw.Activities) == len(page.Activities) {
+			for i := range page.Activities {
+				page.Activities[i].Raw = raw.Activities[i]
+			}
+		}
+
+		next = page.Pagination.Next
+		for _, log := range page.Activities {
+			date := log.StartTime
+			if len(date) > len(dateLayout) {
+				date = date[:len(dateLayout)]
+			}
+			if date > last {
+				// Sorted by start time, the rest is after the range
+				return logs, nil
+			}
+			if date >= first {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// Activity logs of the days already fetched, by date and log ID, so a batch fetches each day once
+var activityLogCache = struct {
+	sync.Mutex
+	days map[string]map[int64]data.ActivityLog
+}{days: map[string]map[int64]data.ActivityLog{}}
+
+// Gets the entry of the activity in the activity log list, which has more details than the daily summary,
+// and whether the list has it
+func activityLog(activity data.Activity) (data.ActivityLog, bool, error) {
+	activityLogCache.Lock()
+	defer activityLogCache.Unlock()
+
+	logs, ok := activityLogCache.days[activity.StartDate]
+	if !ok {
+		day, err := time.Parse(dateLayout, activity.StartDate)
+		if err != nil {
+			return data.ActivityLog{}, false, fmt.Errorf("invalid start date %q of activity %d", activity.StartDate, activity.LogID)
+		}
+		dayLogs, err := getActivityLogs(day, day)
+		if err != nil {
+			return data.ActivityLog{}, false, err
+		}
+		logs = map[int64]data.ActivityLog{}
+		for _, log := range dayLogs {
+			logs[log.LogID] = log
+		}
+		activityLogCache.days[activity.StartDate] = logs
+	}
+	log, ok := logs[activity.LogID]
+	return log, ok, nil
+}
+
+// Gets the activities of the date range from the activity log list, a request per 100 activities instead of
+// a request per day. The logs are cached for the lookups of the export, see activityLog
+func getListActivities(start time.Time, end time.Time) ([]data.Activity, error) {
+	logs, err := getActivityLogs(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	activityLogCache.Lock()
+	defer activityLogCache.Unlock()
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		activityLogCache.days[day.Format(dateLayout)] = map[int64]data.ActivityLog{}
+	}
+	activities := make([]data.Activity, 0, len(logs))
+	for _, log := range logs {
+		activity := activityFromLog(log)
+		if day, ok := activityLogCache.days[activity.StartDate]; ok {
+			day[log.LogID] = log
+		}
+		activities = append(activities, activity)
+	}
+	return activities, nil
+}
+
+// Converts the activity log list entry into the activity of the daily summary
+func activityFromLog(log data.ActivityLog) data.Activity {
+	activity := data.Activity{
+		ActivityID:           log.ActivityTypeID,
+		ActivityParentName:   log.ActivityName,
+		Calories:             log.Calories,
+		Description:          log.Description,
+		Distance:             log.Distance,
+		Duration:             log.Duration,
+		HasActiveZoneMinutes: log.ActiveZoneMinutes.TotalMinutes > 0,
+		LogID:                log.LogID,
+		Name:                 log.ActivityName,
+		Steps:                log.Steps,
+	}
+	// e.g. "2024-09-07T18:30:00.000+02:00", the summary has the local date and "18:30"
+	if t, err := time.Parse("2006-01-02T15:04:05.000-07:00", log.StartTime); err == nil {
+		activity.StartDate = t.Format(dateLayout)
+		activity.StartTime = t.Format("15:04")
+		activity.HasStartTime = true
+	} else if len(log.StartTime) >= len(dateLayout) {
+		activity.StartDate = log.StartTime[:len(dateLayout)]
+	}
+	return activity
+}
+
+// Shortens the start time of the activity log to "YYYY-MM-DD HH:MM"
+func formatStartTime(startTime string) string {
+	t, err := time.Parse("2006-01-02T15:04:05.000-07:00", startTime)
+	if err != nil {
+		return strings.Replace(startTime, "T", " ", 1)
+	}
+	return t.Format("2006-01-02 15:04")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// Serves three pages of the activity log list, the last one empty
+func stubActivityList(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/user/-/activities/list.json" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("offset") {
+		case "0":
+			assert.Equal(t, "2024-09-06", r.URL.Query().Get("afterDate"))
+			w.Write([]byte(`{"activities":[
+				{"logId":1,"activityName":"Swim","duration":1800000,"distance":1.5,"distanceUnit":"Kilometer","calories":300,"startTime":"2024-09-06T07:00:00.000+02:00","hasGps":false},
+				{"logId":2,"activityName":"Run","duration":3600000,"distance":10,"distanceUnit":"Kilometer","calories":700,"startTime":"2024-09-07T18:30:00.000+02:00","hasGps":true}],
+				"pagination":{"next":"https://api.fitbit.com/1/user/-/activities/list.json?afterDate=2024-09-06&sort=asc&offset=2&limit=100"}}`))
+		case "2":
+			w.Write([]byte(`{"activities":[
+				{"logId":3,"activityName":"Weights","description":"Leg day","duration":2400000,"calories":200,"startTime":"2024-09-08T10:00:00.000+02:00"}],
+				"pagination":{"next":"https://api.fitbit.com/1/user/-/activities/list.json?afterDate=2024-09-06&sort=asc&offset=3&limit=100"}}`))
+		case "3":
+			w.Write([]byte(`{"activities":[],"pagination":{"next":""}}`))
+		default:
+			t.Errorf("unexpected page %s", r.URL.RawQuery)
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+}
+
+func TestListActivitiesJSON(t *testing.T) {
+	stubActivityList(t)
+	start := time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 9, 7, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	assert.NoError(t, listActivities(&out, start, end, exportOptions{}, true))
+
+	var listed []listedActivity
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &listed))
+	assert.Equal(t, []listedActivity{
+		{LogID: 1, Sport: "Swim", StartTime: "2024-09-06T07:00:00.000+02:00", DurationSeconds: 1800, Distance: 1.5, DistanceUnit: "Kilometer", Calories: 300, HasGPS: false},
+		{LogID: 2, Sport: "Run", StartTime: "2024-09-07T18:30:00.000+02:00", DurationSeconds: 3600, Distance: 10, DistanceUnit: "Kilometer", Calories: 700, HasGPS: true},
+	}, listed)
+
+	// Type filters apply to the list too
+	out.Reset()
+	assert.NoError(t, listActivities(&out, start, end, exportOptions{types: []string{"run"}}, true))
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &listed))
+	assert.Len(t, listed, 1)
+	assert.Equal(t, int64(2), listed[0].LogID)
+}
+
+func TestListActivitiesTable(t *testing.T) {
+	stubActivityList(t)
+	start := time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 9, 8, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	assert.NoError(t, listActivities(&out, start, end, exportOptions{}, false))
+	assert.Contains(t, out.String(), "LOG ID")
+	assert.Contains(t, out.String(), "2024-09-07 18:30")
+	assert.Contains(t, out.String(), "1h0m0s")
+	assert.Contains(t, out.String(), "Weights")
+}
+
+func TestGetListActivities(t *testing.T) {
+	stubActivityList(t)
+	defer func() { activityLogCache.days = map[string]map[int64]data.ActivityLog{} }()
+	start := time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 9, 7, 0, 0, 0, 0, time.UTC)
+
+	activities, err := getListActivities(start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, []data.Activity{
+		{ActivityParentName: "Swim", Name: "Swim", LogID: 1, Duration: 1800000, Distance: 1.5, Calories: 300, StartDate: "2024-09-06", StartTime: "07:00", HasStartTime: true},
+		{ActivityParentName: "Run", Name: "Run", LogID: 2, Duration: 3600000, Distance: 10, Calories: 700, StartDate: "2024-09-07", StartTime: "18:30", HasStartTime: true},
+	}, activities)
+
+	// The export looks the logs up without fetching the days again
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL)
+	}))
+	log, ok, err := activityLog(activities[1])
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, log.HasGPS)
+}
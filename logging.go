@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+)
+
+// Diagnostics are logged to stderr with log/slog, stdout is kept for the user-facing output: the activity
+// list, prompts and command results. Levels: debug with --verbose (API requests and responses), info by
+// default (progress of the exports), warn with --quiet (fallbacks and failures only)
+
+// Creates the logger of the diagnostics and makes it the default, also of the log package
+func setupLogging(w io.Writer, verbose bool, quiet bool) *slog.Logger {
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	} else if quiet {
+		level = slog.LevelWarn
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	if !verbose {
+		// Timestamps only clutter the console of a short run
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		}
+	}
+	logger := slog.New(slog.NewTextHandler(w, opts))
+	slog.SetDefault(logger)
+	return logger
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupLogging(t *testing.T) {
+	defaultLogger := slog.Default()
+	defer func() {
+		slog.SetDefault(defaultLogger)
+		log.SetOutput(os.Stderr)
+	}()
+
+	testCases := []struct {
+		testName string
+		verbose  bool
+		quiet    bool
+		expected []string
+		hidden   []string
+	}{
+		{testName: "SUCCESS - default", expected: []string{"level=INFO msg=info", "level=WARN msg=warn"}, hidden: []string{"msg=debug", "time="}},
+		{testName: "SUCCESS - verbose", verbose: true, expected: []string{"level=DEBUG msg=debug", "level=INFO msg=info", "time="}},
+		{testName: "SUCCESS - quiet", quiet: true, expected: []string{"level=WARN msg=warn"}, hidden: []string{"msg=debug", "msg=info"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			var out bytes.Buffer
+			setupLogging(&out, tc.verbose, tc.quiet)
+			slog.Debug("debug")
+			slog.Info("info")
+			slog.Warn("warn")
+			for _, expected := range tc.expected {
+				assert.Contains(t, out.String(), expected)
+			}
+			for _, hidden := range tc.hidden {
+				assert.NotContains(t, out.String(), hidden)
+			}
+		})
+	}
+}
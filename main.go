@@ -2,464 +2,2279 @@ package main
 
 import (
 	"FitbitNonLocTcx/data"
+	"FitbitNonLocTcx/tcx"
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"math/big"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/beevik/etree"
+	"github.com/skip2/go-qrcode"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/fitbit"
+	"golang.org/x/term"
 )
 
 var (
-	codeVerifier  string            // A cryptographically secure random value.
-	codeChallenge string            // A base64-encoded SHA-256 transformation of the Code Verifier.
-	done          = make(chan bool) // Channel to signal when the server should stop.
-	server        *http.Server      // HTTP server to handle redirect.
-	stateAuth     string            // A unique value generated by the app in authorization URL.
-	stateRedir    string            // A unique value passed back from server in redirect request and validated by the app if it matches with the one in authorization URL.
-	token         string            // Access token to request user data.
+	codeVerifier  string                     // A cryptographically secure random value.
+	codeChallenge string                     // A base64-encoded SHA-256 transformation of the Code Verifier.
+	oauthCfg      *oauth2.Config             // OAuth2 client configuration, used for the token exchange.
+	authResultCh  = make(chan authResult, 1) // Channel to pass the result of the first callback from the callback handler.
+	server        *http.Server               // HTTP server to handle redirect.
+	oauthState    authState                  // A unique value generated by the app in authorization URL, validated once when passed back in the redirect request.
+	token         *oauth2.Token              // Access (and refresh) token to request user data.
+	tokens        tokenStore                 // Token cache, updated whenever the token is refreshed.
+	authOpts      authOptions                // Options of the authorization code flow, used to re-authenticate.
+	outputDir     string                     // Directory of the exported files, with per-user output a subdirectory named after the Fitbit user ID.
+	config        *fileConfig                // Defaults of config.yaml, and the sport mappings.
+	console       = io.Writer(os.Stdout)     // User-facing output (activity list, prompts), stderr when the TCX is written to stdout.
+	tokenMu       sync.Mutex                 // Guards the token, concurrent exports may replace a rejected token.
+	saveMu        sync.Mutex                 // Serializes writing the exported files, concurrent exports may resolve to the same name.
 )
 
-func handleError(err error) {
+// Options of the authorization code flow
+type authOptions struct {
+	noBrowser    bool          // Print the authorization URL and read the redirect from stdin
+	qr           bool          // Also render the printed authorization URL as a QR code
+	listenAddr   string        // Address of the local callback server, e.g. ":8080"
+	callbackPath string        // Path of the redirect URL handled by the callback server, e.g. "/callback"
+	timeout      time.Duration // Time to wait for the redirect before the callback server is shut down
+	tls          bool          // Serve the callback over https, the redirect URL is an https URL
+	tlsHost      string        // Host name of the self-signed certificate
+	tlsCert      string        // Certificate file, a self-signed certificate is generated when empty
+	tlsKey       string        // Private key file of the certificate
+}
+
+// Options of the activity export
+type exportOptions struct {
+	all          bool           // Export every activity of the date instead of choosing one
+	types        []string       // Only export activities of these types, all types when empty
+	excludeTypes []string       // Skip activities of these types
+	fileTemplate string         // Name of the exported files, see activityFileName
+	onConflict   conflictPolicy // What to do when the exported file already exists
+	batch        string         // Identifies a batch export (--all or a date range), whose progress is saved to resume it
+	resume       bool           // Continue the interrupted batch, skipping its finished activities
+	stdout       io.Writer      // Write the TCX of the single exported activity here instead of a file
+	concurrency  int            // Number of activities downloaded and transformed in parallel
+	notify       bool           // Show a desktop notification when the export finishes
+	archive      *zipArchive    // Stream the exported files into this archive instead of the output directory
+	sidecar      bool           // Save the Fitbit summary of the activity next to its tcx, see activitySummary
+	selection    string         // Numbers of the activities to export from the list of the date, e.g. "1,3,5-7", asked when empty
+	logID        int64          // Log ID of the activity of the date to export, without listing the activities, none when zero
+	fromList     bool           // Get the activities from the activity log list instead of the daily summaries
+	azm          bool           // Add the intraday Active Zone Minutes to the laps and the sidecar
+	cadence      bool           // Add the cadence of the activities on foot, derived from their intraday steps
+	vo2Max       bool           // Add the VO2 Max of the day to the notes of the TCX and to the sidecar
+	calories     bool           // Add the intraday calories to the sidecar
+	tpCalories   bool           // Add the intraday calories to the track points of the TCX too
+	altitude     bool           // Add the altitude to GPS track points without it, from the intraday elevation or floors
+	distCurve    bool           // Add the cumulative distance to the track points of Treadmill activities, from the intraday distance
+	heartRate    bool           // Add the intraday heart rate to the track points without it
+	hrDetail     string         // Detail level of the intraday heart rate, 1sec or 1min
+	dailyWalk    bool           // Export a synthetic walk of the all-day steps on the days without activities
+	gpsOnly      bool           // Request the TCX without includePartialTCX, the track points only of the full GPS tracks
+	laps         lapSplit       // Split the laps of the activities into laps of this distance or duration, none when zero
+	poolMeters   float64        // Length of the pool of the swims in meters, the lengths and the distance follow it; none when zero
+	stripGPS     bool           // Remove the positions of the track points, keeping their time, distance and heart rate
+}
+
+// Handling of an exported file that already exists
+type conflictPolicy int
+
+const (
+	conflictSkip      conflictPolicy = iota // Keep the existing file, skip the activity without downloading it, the default
+	conflictOverwrite                       // Replace the existing file
+	conflictRename                          // Save under a free name, e.g. "Swim-12345-1.tcx"
+)
+
+// Limit of --concurrency, more parallel requests only exhaust the hourly rate limit of the Fitbit API faster
+const maxConcurrency = 8
+
+// Default name of the exported files, e.g. "Swim-12345678901.tcx"
+const defaultFileTemplate = "{sport}-{logid}"
+
+var fileTemplatePlaceholder = regexp.MustCompile(`\{([a-z_]*)\}`)
+
+// Result of the authorization callback, the exchanged token or the reason of the failure
+type authResult struct {
+	token *oauth2.Token
+	err   error
+}
+
+// Single-use, expiring state of the pending authorization request
+type authState struct {
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+	used    bool
+}
+
+const stateLifetime = 10 * time.Minute // Validity of the state, the authorization must be completed within this window
+
+func main() {
+	err := run()
+	if err != nil {
+		slog.Error(err.Error())
+	}
+	os.Exit(exitCode(err))
+}
+
+// Runs the command given on the command line, the error decides the exit code
+func run() error {
+	noBrowser := flag.Bool("no-browser", false, "print the authorization URL and read the redirect URL or code from stdin instead of opening a browser")
+	qr := flag.Bool("qr", false, "with --no-browser, also render the authorization URL as a QR code to scan with a phone")
+	listenAddr := flag.String("listen", "", "listen address of the callback server (default: derived from the redirect URL, e.g. \":8080\")")
+	callbackPath := flag.String("callback-path", "", "path of the callback handler (default: derived from the redirect URL, e.g. \"/callback\")")
+	authTimeout := flag.Duration("auth-timeout", 2*time.Minute, "time to wait for the authorization in the browser")
+	proxy := flag.String("proxy", "", "proxy URL of all requests, e.g. http://proxy:3128 (default: HTTP_PROXY/HTTPS_PROXY/NO_PROXY)")
+	profile := flag.String("profile", "", "name of the credentials profile to use, each profile has its own token cache")
+	verbose := flag.Bool("verbose", false, "log diagnostics, e.g. the API requests, to stderr")
+	quiet := flag.Bool("quiet", false, "only log warnings and errors to stderr")
+	all := flag.Bool("all", false, "export every activity of the date instead of choosing one")
+	types := flag.String("type", "", "comma separated activity types to export, e.g. Swim,Treadmill,Weights or activity IDs such as 90024 (default: all types)")
+	excludeTypes := flag.String("exclude-type", "", "comma separated activity types to skip, e.g. Walk,Run")
+	outDir := flag.String("out-dir", "", "directory to save the exported files in (default: the working directory)")
+	fileTemplate := flag.String("filename", defaultFileTemplate, "name of the exported files, placeholders: {year}, {month}, {day}, {date}, {sport}, {logid}, {start_time}; may contain subdirectories, e.g. {date}/{sport}-{start_time}, a trailing / names the files as by default, e.g. {year}/{month}/{sport}/")
+	from := flag.String("from", "", "first date (YYYY-MM-DD, today, yesterday or -<n>d) of a date range to export every activity of, with --to")
+	to := flag.String("to", "", "last date (YYYY-MM-DD, today, yesterday or -<n>d) of a date range to export every activity of, with --from")
+	month := flag.String("month", "", "month (YYYY-MM) to export every activity of, shortcut of --from and --to")
+	week := flag.String("week", "", "ISO week (YYYY-Www, e.g. 2024-W37, Monday to Sunday) to export every activity of, shortcut of --from and --to")
+	overwrite := flag.Bool("overwrite", false, "replace exported files that already exist")
+	skipExisting := flag.Bool("skip-existing", false, "skip activities whose exported file already exists, without downloading them again (the default, unless --overwrite or --rename-on-conflict is given)")
+	renameOnConflict := flag.Bool("rename-on-conflict", false, "save under a new name (e.g. Swim-12345-1.tcx) when the exported file already exists")
+	resume := flag.Bool("resume", false, "continue an interrupted --all or --from/--to export, skipping the activities it already finished")
+	concurrency := flag.Int("concurrency", 1, fmt.Sprintf("number of activities of a batch export downloaded and transformed in parallel, at most %d", maxConcurrency))
+	units := flag.String("units", "auto", "unit system of the distances received from Fitbit: auto (the one of the profile), metric or imperial")
+	toStdout := flag.Bool("stdout", false, "write the TCX of the chosen activity to stdout instead of a file, e.g. to pipe it to gpsbabel; the activity list and prompts go to stderr")
+	selection := flag.String("select", "", "numbers of the activities to export from the list of the date, e.g. 1,3,5-7, instead of asking")
+	logID := flag.Int64("log-id", 0, "export the activity of the date with this log ID, as printed by the list command, without listing the activities nor asking, e.g. with --stdout")
+	sidecar := flag.Bool("sidecar", false, "save the full Fitbit summary of each activity (calories, steps, Active Zone Minutes, heart rate zones, device) next to its TCX as .json")
+	zipFile := flag.String("zip", "", "write the exported files, their sidecars and manifest.json into this ZIP archive instead of --out-dir, e.g. for Strava's bulk upload")
+	notify := flag.Bool("notify", false, "show a desktop notification when the export finishes (notify-send, osascript or a Windows toast)")
+	vo2Max := flag.Bool("vo2max", false, "add the VO2 Max estimate (Cardio Fitness Score) of the day to the notes of the TCX and to the --sidecar (needs the cardio_fitness scope)")
+	cadence := flag.Bool("cadence", false, "add the cadence of Treadmill, Run and Walk activities to the track points of the TCX, derived from the steps per minute (needs intraday access, e.g. a personal app)")
+	calories := flag.Bool("calories", false, "fetch the calories burned during the activities minute by minute, with their METs and activity level, and save them in the --sidecar (needs intraday access, e.g. a personal app)")
+	trackpointCalories := flag.Bool("trackpoint-calories", false, "like --calories, and add the calories per minute to the track points of the TCX as an extension")
+	altitude := flag.Bool("altitude", false, "add the altitude to the track points of GPS activities recorded without it, from the elevation (or floors) climbed per minute (needs intraday access, e.g. a personal app)")
+	distanceCurve := flag.Bool("distance-curve", false, "add the distance covered until each track point of Treadmill activities, from the distance per minute, so their pace can be charted (needs intraday access, e.g. a personal app)")
+	heartRate := flag.Bool("heart-rate", false, "add the heart rate to the track points of the TCX recorded without it, e.g. of the activities without GPS, from the intraday heart rate (needs intraday access, e.g. a personal app)")
+	laps := flag.String("laps", "", "split the activities into laps of this distance, e.g. 1km or 1mi, of the activities with a distance curve (GPS or --distance-curve), or of this duration, e.g. 5min, each with its time, distance, calories and heart rate (default: the laps of Fitbit)")
+	poolLength := flag.String("pool-length", "", "length of the pool of the swims, e.g. 25m, 33.33m or 25yd; the swims get a lap per length of it, and their distance is that of the lengths (default: the logged lengths and the distance of Fitbit)")
+	stripGPS := flag.Bool("strip-gps", false, "remove the GPS positions from the track points of the TCX, keeping their time, distance and heart rate, e.g. to publish the activities without revealing where they were recorded")
+	hrDetail := flag.String("hr-detail", "1sec", "detail level of the --heart-rate: 1sec (a reading every few seconds, larger files) or 1min; 1min is used when 1sec is not available")
+	partialTcx := flag.Bool("partial-tcx", true, "request the TCX with includePartialTCX, so the activities with connected or partial GPS, or without GPS, get track points too; with --partial-tcx=false only the full GPS tracks have track points, the others only their laps")
+	dailyWalk := flag.Bool("daily-walk", false, "on the days without logged activities, export a Walk made from the steps and the distance of the day, from the first to the last minute with steps (needs intraday access, e.g. a personal app)")
+	azm := flag.Bool("azm", false, "fetch the Active Zone Minutes of the activities minute by minute, add them to the laps of the TCX and to the --sidecar (needs intraday access, e.g. a personal app)")
+	source := flag.String("source", "daily", "endpoint to get the activities from: daily (the daily activity summaries) or list (the paginated activity log list, fewer requests for long date ranges)")
+	jsonProgress := flag.Bool("json-progress", false, "write the progress of the export as JSON events, one per line, to stdout; the activity list and prompts go to stderr")
+	retries := flag.Int("retries", 3, "retries of a request failing on a network error or a server error (5xx) of the Fitbit API, after a growing pause (1s, 2s, 4s, ...); only the requests reading data are retried, 0 fails right away")
+	rateLimitWait := flag.Duration("rate-limit-wait", time.Hour, "longest pause when the hourly rate limit of the Fitbit API is used up, the export continues once it resets; 0 fails right away")
+	jsonOutput := flag.Bool("json", false, "with the list and search commands, print the activities as JSON; with the health data commands (e.g. spo2), report, stats, goals, quota, leaderboard and activity-types, the data")
+	demo := flag.Bool("demo", false, "export the made up activities of a built-in mock of the Fitbit API, without credentials, e.g. to try out the commands and the TCX transformations")
+	offline := flag.Bool("offline", false, "export from the raw responses saved by earlier runs, in ~/.cache/fitbittcx/raw, without contacting Fitbit, e.g. to try out TCX transformations without using the rate limit")
+	debugHTTP := flag.String("debug-http", "", "write the HTTP requests and responses, with their headers and bodies, into this file to diagnose API problems; the tokens are redacted, the health data is not")
+	userID := flag.String("user", "", "Fitbit user ID whose data to export, e.g. ABC123 of a family member or friend who shared it with the authorized user (default: the authorized user)")
+	apiBaseURL := flag.String("api-base", "", "base URL of the Fitbit Web API, e.g. a mock server for testing (default https://api.fitbit.com)")
+	configPath := flag.String("config", "", "configuration file with default flag values (default: ~/.config/fitbittcx/config.yaml)")
+	ageIdentity := flag.String("age-identity", os.Getenv("FITBITTCX_AGE_IDENTITY"), "age identity file to decrypt credentials.json.age and the encrypted token cache (default: ask for a passphrase)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] YYYY-MM-DD|today|yesterday|-<n>d\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] --from DATE --to DATE\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] list DATE|--from DATE --to DATE\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] spo2|breathing-rate|skin-temperature|sleep|hrv [--intraday] DATE|--from DATE --to DATE\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] report azm [--markdown] DATE|--from DATE --to DATE\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] stats lifetime\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] quota\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] leaderboard\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] activity-types [favorite|frequent|recent]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] goals [set daily|weekly NAME=VALUE...]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] subscriptions list|add ID|delete ID\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] serve [--addr :8090] [--verify CODE]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] token status\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s edit --log-id ID --name NAME\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] delete --log-id ID [--yes]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] log create --sport NAME --start DATETIME --duration DURATION [--distance N] [--calories N]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s init\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Defaults of the configuration file, for the flags not given on the command line
+	var err error
+	if *configPath == "" {
+		if *configPath, err = defaultConfigFile(); err != nil {
+			return err
+		}
+	}
+	if config, err = loadConfig(*configPath); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if err := config.apply(flag.CommandLine); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+
+	setupLogging(os.Stderr, *verbose, *quiet)
+	if err := configureProxy(*proxy); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if err := configureAPIBase(*apiBaseURL); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if err := configureAPIUser(*userID); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	httpDump, err := configureHTTPDump(*debugHTTP)
+	if err != nil {
+		return err
+	}
+	defer httpDump.Close()
+
+	// The date arguments, of the list command or of the export
+	args := flag.Args()
+	listCommand := len(args) > 0 && args[0] == "list"
+	if listCommand {
+		args = args[1:]
+	}
+	// The search command scans a date range, given by its own flags
+	searchCommand := len(args) > 0 && args[0] == "search"
+	var search searchOptions
+	if searchCommand {
+		if *from != "" || *to != "" {
+			return withExitCode(exitUsage, fmt.Errorf("the search command takes --since and --until instead of --from and --to"))
+		}
+		if search, err = parseSearchArgs(args[1:]); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		*from, *to = search.since, search.until
+		args = nil
+	}
+	// The stats command prints the lifetime statistics, without dates
+	statsCommand := len(args) > 0 && args[0] == "stats"
+	if statsCommand && (len(args) != 2 || args[1] != "lifetime") {
+		return withExitCode(exitUsage, fmt.Errorf("unknown stats command, use: stats lifetime"))
+	}
+	if statsCommand && (*from != "" || *to != "" || *month != "" || *week != "") {
+		return withExitCode(exitUsage, fmt.Errorf("stats lifetime takes no dates"))
+	}
+	// The quota command prints the rate limit quota left, without dates
+	quotaCommand := len(args) > 0 && args[0] == "quota"
+	if quotaCommand {
+		if len(args) != 1 || *from != "" || *to != "" || *month != "" || *week != "" {
+			return withExitCode(exitUsage, fmt.Errorf("the quota command takes no arguments nor dates"))
+		}
+		args = nil
+	}
+	// The leaderboard command writes the friends leaderboard of the last 7 days, without dates
+	leaderboardCommand := len(args) > 0 && args[0] == "leaderboard"
+	if leaderboardCommand {
+		if len(args) != 1 || *from != "" || *to != "" || *month != "" || *week != "" {
+			return withExitCode(exitUsage, fmt.Errorf("the leaderboard command takes no arguments nor dates, it covers the last 7 days"))
+		}
+		args = nil
+	}
+	// The activity-types command writes the favorite, frequent and recent activity types, without dates
+	activityTypesCommand := len(args) > 0 && args[0] == "activity-types"
+	var activityTypes []string
+	if activityTypesCommand {
+		if activityTypes, err = parseActivityTypesArgs(args[1:]); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		if *from != "" || *to != "" || *month != "" || *week != "" {
+			return withExitCode(exitUsage, fmt.Errorf("the activity-types command takes no dates"))
+		}
+		args = nil
+	}
+	// The goals command prints, or updates, the activity goals, without dates
+	goalsCommand := len(args) > 0 && args[0] == "goals"
+	var goals *goalsUpdate
+	if goalsCommand {
+		if goals, err = parseGoalsArgs(args[1:]); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		if *from != "" || *to != "" || *month != "" || *week != "" {
+			return withExitCode(exitUsage, fmt.Errorf("the goals command takes no dates"))
+		}
+		args = nil
+	}
+	// The subscriptions command manages the notifications of new activities, the serve command receives them
+	subscriptionsCommand := len(args) > 0 && args[0] == "subscriptions"
+	var subscription subscriptionCommand
+	serveCommand := len(args) > 0 && args[0] == "serve"
+	var serve serveOptions
+	if subscriptionsCommand || serveCommand {
+		if subscriptionsCommand {
+			subscription, err = parseSubscriptionArgs(args[1:])
+		} else {
+			serve, err = parseServeArgs(args[1:])
+		}
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		if *from != "" || *to != "" || *month != "" || *week != "" {
+			return withExitCode(exitUsage, fmt.Errorf("the %s command takes no dates", args[0]))
+		}
+		if serveCommand && (*toStdout || *zipFile != "" || *selection != "" || *logID != 0 || *resume) {
+			return withExitCode(exitUsage, fmt.Errorf("serve cannot be used with --stdout, --zip, --select, --log-id or --resume"))
+		}
+		args = nil
+	}
+	// The delete command deletes an activity log, without dates
+	deleteCommand := len(args) > 0 && args[0] == "delete"
+	var deletion activityDeletion
+	if deleteCommand {
+		if deletion, err = parseDeleteArgs(args[1:]); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		if *from != "" || *to != "" || *month != "" || *week != "" {
+			return withExitCode(exitUsage, fmt.Errorf("the delete command takes no dates"))
+		}
+		args = nil
+	}
+	// The log command logs an activity, its start is given by its own flag
+	logCommand := len(args) > 0 && args[0] == "log"
+	var manual manualActivity
+	if logCommand {
+		if manual, err = parseLogArgs(args[1:]); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		if *from != "" || *to != "" || *month != "" || *week != "" {
+			return withExitCode(exitUsage, fmt.Errorf("log create takes --start instead of dates"))
+		}
+		args = nil
+	}
+	// The data of another user can be read, not changed
+	if apiUser != "-" && (goals != nil || subscriptionsCommand || serveCommand || deleteCommand || logCommand) {
+		return withExitCode(exitUsage, fmt.Errorf("--user reads the data of another user, it cannot be used with goals set, subscriptions, serve, delete or log"))
+	}
+	// The report command summarizes the active minutes of a date or date range by week
+	reportCommand := len(args) > 0 && args[0] == "report"
+	var reportMarkdown bool
+	if reportCommand {
+		if reportMarkdown, args, err = parseReportArgs(args[1:]); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+	}
+	// The health data commands, e.g. spo2, export other data of a date or date range instead of activities
+	healthCommand := ""
+	var healthIntraday bool
+	if len(args) > 0 && healthCommands[args[0]] != nil {
+		healthCommand = args[0]
+		if healthIntraday, args, err = parseHealthArgs(healthCommand, args[1:]); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+	}
+
+	// The month and week shortcuts expand into a date range
+	period := *month != "" || *week != ""
+	if period {
+		if *from != "" || *to != "" || searchCommand || (*month != "" && *week != "") {
+			return withExitCode(exitUsage, fmt.Errorf("--month and --week cannot be used together, nor with --from/--to or search"))
+		}
+		parse, value := parseMonth, *month
+		if *week != "" {
+			parse, value = parseISOWeek, *week
+		}
+		start, end, err := parse(value)
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		*from, *to = start.Format(dateLayout), end.Format(dateLayout)
+	}
+
+	// Validate the date range before the authorization
+	var rangeStart, rangeEnd time.Time
+	dateRange := *from != "" || *to != ""
+	if dateRange {
+		if len(args) != 0 {
+			return withExitCode(exitUsage, fmt.Errorf("a date cannot be given together with --from and --to"))
+		}
+		rangeStart, rangeEnd, err = parseDateRange(*from, *to, time.Now())
+		if err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("invalid date range: %w", err))
+		}
+	}
+
+	if err := validateFileTemplate(*fileTemplate); err != nil {
+		return withExitCode(exitUsage, fmt.Errorf("invalid --filename: %w", err))
+	}
+	onConflict, err := newConflictPolicy(*overwrite, *skipExisting, *renameOnConflict)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if *concurrency < 1 || *concurrency > maxConcurrency {
+		return withExitCode(exitUsage, fmt.Errorf("invalid --concurrency %d, use 1 to %d", *concurrency, maxConcurrency))
+	}
+	unitsFlag, err := parseUnits(*units)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if *source != "daily" && *source != "list" {
+		return withExitCode(exitUsage, fmt.Errorf("invalid --source %q, use daily or list", *source))
+	}
+	if *dailyWalk && *source == "list" {
+		return withExitCode(exitUsage, fmt.Errorf("--daily-walk needs the daily activity summaries, not --source list"))
+	}
+	lapSplits, err := parseLapSplit(*laps)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	poolMeters, err := parsePoolLength(*poolLength)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if !slices.Contains(heartRateDetails, *hrDetail) {
+		return withExitCode(exitUsage, fmt.Errorf("invalid --hr-detail %q, use 1sec or 1min", *hrDetail))
+	}
+	if *rateLimitWait < 0 {
+		return withExitCode(exitUsage, fmt.Errorf("invalid --rate-limit-wait %s", *rateLimitWait))
+	}
+	rateLimit.maxWait = *rateLimitWait
+	if *retries < 0 {
+		return withExitCode(exitUsage, fmt.Errorf("invalid --retries %d", *retries))
+	}
+	apiRetry.count = *retries
+	if *selection != "" && (*all || dateRange || listCommand || searchCommand || reportCommand || healthCommand != "") {
+		return withExitCode(exitUsage, fmt.Errorf("--select chooses from the activities of a date, it cannot be used with --all, --from/--to, list, search, report or the health data commands"))
+	}
+	if *logID != 0 && (*selection != "" || *all || dateRange || listCommand || searchCommand || reportCommand || healthCommand != "") {
+		return withExitCode(exitUsage, fmt.Errorf("--log-id chooses an activity of a date, it cannot be used with --select, --all, --from/--to, list, search, report or the health data commands"))
+	}
+	if *zipFile != "" && (*toStdout || *resume || listCommand || searchCommand || reportCommand || healthCommand != "") {
+		return withExitCode(exitUsage, fmt.Errorf("--zip cannot be used with --stdout, --resume, list, search, report or the health data commands"))
+	}
+	if *jsonProgress {
+		if *toStdout {
+			return withExitCode(exitUsage, fmt.Errorf("--json-progress and --stdout cannot be used together, both write to stdout"))
+		}
+		// Keep stdout for the events
+		progressEvents = os.Stdout
+		console = os.Stderr
+	}
+	if *toStdout {
+		if *all || dateRange || listCommand || searchCommand || reportCommand || healthCommand != "" {
+			return withExitCode(exitUsage, fmt.Errorf("--stdout writes a single activity, it cannot be used with --all, --from/--to, list, search, report or the health data commands"))
+		}
+		// Keep stdout for the TCX
+		console = os.Stderr
+	}
+
+	if flag.Arg(0) == "version" {
+		printVersion(os.Stdout)
+		return nil
+	}
+	if flag.Arg(0) == "init" {
+		return runInit(os.Stdin, os.Stdout, "credentials.json")
+	}
+	namesFile, err := activityNamesFile()
+	if err != nil {
+		return err
+	}
+	if flag.Arg(0) == "edit" {
+		rename, err := parseEditArgs(flag.Args()[1:])
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		return renameActivity(os.Stdout, namesFile, rename)
+	}
+
+	// The demo needs no credentials, its mock API accepts any token
+	apiCred := &data.Credentials{}
+	if *demo {
+		if *offline || *apiBaseURL != "" || *userID != "" || serveCommand {
+			return withExitCode(exitUsage, fmt.Errorf("--demo cannot be used with --offline, --api-base, --user or serve"))
+		}
+	} else {
+		crypter := &ageCrypter{identityFile: *ageIdentity, readPassphrase: promptPassphrase}
+		credReader, err := openCredFile(crypter)
+		if err != nil {
+			return err
+		}
+		apiCred, oauthCfg, err = readCredFile(credReader, *profile)
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+
+		tokens, err = newTokenStore(apiCred, *profile, crypter)
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		// One lock for all profiles, as profiles authorized as the same Fitbit user share their token
+		tokenLockFile, err = tokenCacheFile("")
+		if err != nil {
+			return err
+		}
+		tokenLockFile = filepath.Join(filepath.Dir(tokenLockFile), "token.lock")
+
+		// Commands that only need the token cache, not an authorized session
+		if flag.Arg(0) == "token" {
+			if flag.NArg() != 2 || flag.Arg(1) != "status" {
+				return withExitCode(exitUsage, fmt.Errorf("unknown token command, use: token status"))
+			}
+			return tokenStatus(context.Background(), tokens, os.Stdout)
+		}
+	}
+
+	// Without a date, ask for one on an interactive console, Enter accepting today. Without a console (e.g. a cron
+	// job) or with --log-id, the activities of today, in the time zone of the profile
+	command := ""
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+	args, defaultDate, err := commandDates(command, args, dateRange, *logID == 0 && term.IsTerminal(int(os.Stdin.Fd())), os.Stdin, console)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+
+	// Validate the date before the authorization
+	if !dateRange && len(args) == 1 {
+		if _, err := resolveDate(args[0], time.Now()); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+	}
+
+	if !*demo {
+		authOpts, err = newAuthOptions(apiCred, *noBrowser, *listenAddr, *callbackPath)
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		authOpts.timeout = *authTimeout
+		authOpts.qr = *qr
+	}
+
+	if *demo {
+		// The made up activities of the mock Fitbit API, see newMockFitbitServer
+		server := newMockFitbitServer()
+		defer server.Close()
+		apiBase = server.URL
+		token = &oauth2.Token{AccessToken: "demo", Expiry: time.Now().Add(time.Hour)}
+		slog.Info("Demo mode, exporting made up activities", "api", server.URL)
+	} else if *offline {
+		// The cached token only tells whose saved responses to export, it is not refreshed
+		rawResponses.offline = true
+		if token, err = tokens.Load(); err != nil {
+			token = &oauth2.Token{}
+		}
+	} else {
+		// Reuse the cached token, fall back to the browser flow only when it is missing or cannot be refreshed
+		err = withTokenLock(context.Background(), func() error {
+			token, err = cachedToken(context.Background(), oauthCfg, tokens)
+			if err != nil {
+				return err
+			}
+			return tokens.Save(token)
+		})
+		if err != nil {
+			slog.Info("No valid cached token, starting authorization", "reason", err)
+			if token, err = authorize(authOpts); err != nil {
+				return err
+			}
+			saveTokenLocked(token)
+		}
+	}
+
+	// The Fitbit user of the data, the authorized one unless given with --user
+	dataUserID := tokenUserID(token)
+	if apiUser != "-" {
+		dataUserID = apiUser
+	} else if *demo {
+		dataUserID = demoUserID
+	}
+
+	// Route the exports of each Fitbit user into its own directory
+	outputDir = *outDir
+	if apiCred.PerUserOutput {
+		outputDir = filepath.Join(outputDir, dataUserID)
+	}
+
+	// The demo leaves the caches of the Fitbit users alone
+	if !*demo {
+		// The responses of the Fitbit user, for the conditional requests
+		if responses.dir, err = responseCacheDir(dataUserID); err != nil {
+			slog.Warn("Requesting the activities unconditionally", "err", err)
+		}
+		// The raw responses of the Fitbit user, to export again with --offline
+		if rawResponses.dir, err = rawCacheDir(dataUserID); err != nil {
+			if *offline {
+				return err
+			}
+			slog.Warn("Not saving the raw responses", "err", err)
+		}
+	}
+
+	// The Fitbit profile, once, for the time zone and the unit system of the user
+	user, profileErr := fetchProfile()
+
+	// Request the distances in the unit system of the profile, unless given
+	apiUnits = unitsFlag
+	if apiUnits == "" {
+		apiUnits = profileUnits(user)
+		if profileErr != nil {
+			slog.Warn("Using metric units", "err", profileErr)
+		}
+	}
+
+	if statsCommand {
+		return printLifetimeStats(os.Stdout, *jsonOutput)
+	}
+	if quotaCommand {
+		return printQuota(os.Stdout, *jsonOutput)
+	}
+	if leaderboardCommand {
+		return exportLeaderboard(os.Stdout, *jsonOutput)
+	}
+	if activityTypesCommand {
+		return exportActivityTypes(os.Stdout, activityTypes, *jsonOutput)
+	}
+	if goalsCommand {
+		return printActivityGoals(os.Stdout, goals, *jsonOutput)
+	}
+	if subscriptionsCommand {
+		return manageSubscriptions(os.Stdout, subscription)
+	}
+	if deleteCommand {
+		return deleteActivity(os.Stdin, os.Stdout, deletion)
+	}
+	if logCommand {
+		catalogFile, err := catalogCacheFile()
+		if err != nil {
+			return err
+		}
+		if *demo {
+			catalogFile = ""
+		}
+		catalog, err := loadActivityCatalog(catalogFile)
+		if err != nil {
+			return err
+		}
+		return createActivityLog(os.Stdout, manual, catalog)
+	}
+
+	// Resolve relative dates, and the activity times without offset, in the time zone of the user's Fitbit profile
+	err = profileErr
+	if err == nil {
+		userLocation, err = profileLocation(user)
+	}
+	if err != nil {
+		slog.Warn("Using the local time zone", "err", err)
+		userLocation = time.Local
+	}
+	relativeDates := period || isRelativeDate(*from) || isRelativeDate(*to) || (len(args) == 1 && isRelativeDate(args[0]))
+	if relativeDates {
+		now := time.Now().In(userLocation)
+		if period {
+			// The current month or week ends today in the user's time zone
+			rangeStart, rangeEnd, err = clampToToday(rangeStart, rangeEnd, now)
+		} else if dateRange {
+			rangeStart, rangeEnd, err = parseDateRange(*from, *to, now)
+		} else {
+			args[0], err = resolveDate(args[0], now)
+		}
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+	}
+	if defaultDate {
+		fmt.Fprintf(console, "No date given, using today: %s\n", args[0])
+	}
+
+	opts := exportOptions{all: *all, types: splitList(*types), excludeTypes: splitList(*excludeTypes), fileTemplate: *fileTemplate, onConflict: onConflict, resume: *resume, concurrency: *concurrency, notify: *notify, selection: *selection, logID: *logID, sidecar: *sidecar, fromList: *source == "list", azm: *azm, cadence: *cadence, vo2Max: *vo2Max, calories: *calories || *trackpointCalories, tpCalories: *trackpointCalories, altitude: *altitude, distCurve: *distanceCurve, heartRate: *heartRate, hrDetail: *hrDetail, dailyWalk: *dailyWalk, gpsOnly: !*partialTcx, laps: lapSplits, poolMeters: poolMeters, stripGPS: *stripGPS}
+	if *toStdout {
+		opts.stdout = os.Stdout
+	}
+	if dateRange {
+		opts.batch = rangeStart.Format(dateLayout) + ".." + rangeEnd.Format(dateLayout)
+	} else if *all && len(args) == 1 {
+		opts.batch = args[0]
+	}
+	if opts.batch != "" {
+		opts.batch += " type=" + strings.Join(opts.types, ",") + " exclude-type=" + strings.Join(opts.excludeTypes, ",") + " filename=" + opts.fileTemplate
+	} else if *resume {
+		return withExitCode(exitUsage, fmt.Errorf("--resume needs a batch export, --all or --from/--to"))
+	}
+	if listCommand {
+		if !dateRange {
+			rangeStart, _ = time.Parse(dateLayout, args[0])
+			rangeEnd = rangeStart
+		}
+		return listActivities(os.Stdout, rangeStart, rangeEnd, opts, *jsonOutput)
+	}
+	if healthCommand != "" {
+		if !dateRange {
+			rangeStart, _ = time.Parse(dateLayout, args[0])
+			rangeEnd = rangeStart
+		}
+		return healthCommands[healthCommand](os.Stdout, rangeStart, rangeEnd, healthIntraday, *jsonOutput)
+	}
+	if reportCommand {
+		if !dateRange {
+			rangeStart, _ = time.Parse(dateLayout, args[0])
+			rangeEnd = rangeStart
+		}
+		return reportActiveMinutes(os.Stdout, rangeStart, rangeEnd, reportMarkdown, *jsonOutput)
+	}
+	if searchCommand {
+		return searchActivities(os.Stdout, search.query, rangeStart, rangeEnd, opts, *jsonOutput)
+	}
+	// The trackers recording the activities, named as the Creator of the TCX of their activities
+	if pairedDevices, err = fetchPairedDevices(); err != nil {
+		slog.Warn("Naming Fitbit as the recording device, add the settings scope to name the tracker", "err", err)
+	}
+	// The TCX sport of the activity types, the catalog of the mock API is not cached
+	catalogFile, err := catalogCacheFile()
+	if *demo {
+		catalogFile = ""
+	}
+	if err == nil {
+		activitySports, err = loadActivitySports(catalogFile)
+	}
+	if err != nil {
+		slog.Warn("Keeping the sports of the Fitbit TCX", "err", err)
+	}
+	// The names given to the activities with the edit command
+	if activityNames, err = loadActivityNames(namesFile); err != nil {
+		return err
+	}
+	if serveCommand {
+		return serveSubscriber(serve, apiCred.CSecret, opts)
+	}
+	if *zipFile != "" {
+		if opts.archive, err = createZipArchive(*zipFile, onConflict == conflictOverwrite); err != nil {
+			return err
+		}
+	}
+	if dateRange {
+		err = fetchActivityRange(rangeStart, rangeEnd, opts)
+	} else {
+		err = fetchActivityData(args, opts)
+	}
+	if opts.archive != nil {
+		if closeErr := opts.archive.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Builds the authorization options, command line flags take precedence over credentials.json, which takes precedence over the values derived from the redirect URL
+func newAuthOptions(apiCred *data.Credentials, noBrowser bool, listenAddr string, callbackPath string) (authOptions, error) {
+	derivedAddr, derivedPath, err := callbackAddr(apiCred.RedirectURL)
+	if err != nil {
+		return authOptions{}, err
+	}
+
+	opts := authOptions{noBrowser: noBrowser, listenAddr: derivedAddr, callbackPath: derivedPath}
+	if u, _ := url.Parse(apiCred.RedirectURL); u.Scheme == "https" {
+		opts.tls = true
+		opts.tlsHost = u.Hostname()
+		opts.tlsCert = apiCred.TLSCert
+		opts.tlsKey = apiCred.TLSKey
+	}
+	if apiCred.ListenAddr != "" {
+		opts.listenAddr = apiCred.ListenAddr
+	}
+	if apiCred.CallbackPath != "" {
+		opts.callbackPath = apiCred.CallbackPath
+	}
+	if listenAddr != "" {
+		opts.listenAddr = listenAddr
+	}
+	if callbackPath != "" {
+		opts.callbackPath = callbackPath
+	}
+	return opts, nil
+}
+
+// Derives the listen address (all interfaces, port of the redirect URL) and the callback path from the redirect URL
+func callbackAddr(redirectURL string) (string, string, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse redirect URL: %s", err)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("error: redirect URL %q has no host", redirectURL)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return ":" + port, path, nil
+}
+
+// Runs the authorization code flow, in the browser or headless, and returns the exchanged token
+func authorize(opts authOptions) (*oauth2.Token, error) {
+	tok, err := runAuthorization(opts)
+	if err != nil {
+		return nil, withExitCode(exitAuth, fmt.Errorf("authorization failed: %w", err))
+	}
+	return tok, nil
+}
+
+func runAuthorization(opts authOptions) (*oauth2.Token, error) {
+	var err error
+	if codeVerifier, err = generateCodeVerifier(43); err != nil {
+		return nil, err
+	}
+	if codeChallenge, err = generateCodeChallenge(codeVerifier); err != nil {
+		return nil, err
+	}
+
+	if opts.noBrowser {
+		return authorizeManually(opts)
+	}
+
+	// Without a local listener the redirect URL has to be pasted manually
+	listener, err := net.Listen("tcp", opts.listenAddr)
+	if err != nil {
+		slog.Warn("Cannot start the callback server", "err", err)
+		fmt.Fprintln(console, "After authorizing, copy the URL from the browser's address bar, even if the page fails to load.")
+		return authorizeManually(opts)
+	}
+	return authorizeInBrowser(opts, listener)
+}
+
+// Runs the headless flow, the redirect URL (or code) is read from stdin
+func authorizeManually(opts authOptions) (*oauth2.Token, error) {
+	return authorizeHeadless(os.Stdin, console, opts.qr)
+}
+
+// Replaces a rejected access token: refreshes it, or runs the authorization flow again when it cannot be refreshed
+func reauthenticate() error {
+	err := withTokenLock(context.Background(), func() error {
+		// Another invocation may have refreshed the token in the meantime, its refresh token replaced ours
+		if cached, err := tokens.Load(); err == nil && cached.AccessToken != token.AccessToken && cached.Valid() {
+			token = cached
+			return nil
+		} else if err == nil && cached.RefreshToken != "" {
+			token.RefreshToken = cached.RefreshToken
+		}
+
+		tok, err := refreshToken(context.Background(), oauthCfg, token)
+		if err != nil {
+			return err
+		}
+		token = tok
+		return tokens.Save(token)
+	})
+	if err != nil {
+		slog.Warn("Failed to refresh the access token, starting authorization", "err", err)
+		tok, err := authorize(authOpts)
+		if err != nil {
+			return err
+		}
+		token = tok
+		saveTokenLocked(token)
+	}
+	return nil
+}
+
+// Saves the token into the cache while holding the token lock
+func saveTokenLocked(tok *oauth2.Token) {
+	err := withTokenLock(context.Background(), func() error {
+		return tokens.Save(tok)
+	})
+	if err != nil {
+		slog.Warn("Failed to cache token", "err", err)
+	}
+}
+
+// Opens the authorization URL in the browser and receives the redirect on the local callback server listener
+func authorizeInBrowser(opts authOptions, listener net.Listener) (*oauth2.Token, error) {
+	// Discard a late result of a previous authorization
+	select {
+	case <-authResultCh:
+	default:
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(opts.callbackPath, handleOAuth2Callback)
+
+	server = &http.Server{Addr: opts.listenAddr, Handler: mux}
+
+	// Generate and print the authorization URL
+	authURL := getAuthURL(codeChallenge, oauthCfg)
+
+	// Open the URL in the default browser
+	if opts.tls && opts.tlsCert == "" {
+		// No certificate configured, the browser shows a warning for the self-signed one
+		cert, err := generateSelfSignedCert(opts.tlsHost)
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to generate self-signed certificate: %w", err)
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	err := openBrowser(authURL)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to open browser: %w", err)
+	}
+
+	go func() {
+		var err error
+		if opts.tls {
+			err = server.ServeTLS(listener, opts.tlsCert, opts.tlsKey)
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != http.ErrServerClosed {
+			// Ends the wait for the token, unless a result is already there
+			select {
+			case authResultCh <- authResult{err: fmt.Errorf("callback server failed: %w", err)}:
+			default:
+			}
+		}
+	}()
+
+	// Wait for the callback handler to exchange the authorization code, then stop the server
+	tok, err := waitForToken(authResultCh, opts.timeout)
+	if err := server.Shutdown(context.Background()); err != nil {
+		slog.Warn("Callback server shutdown failed", "err", err)
+	}
+	slog.Debug("Callback server stopped")
+	return tok, err
+}
+
+// Generates an in-memory self-signed certificate for the https callback server
+func generateSelfSignedCert(host string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// Waits for the result of the callback handler, at most for the timeout (no limit when 0)
+func waitForToken(results <-chan authResult, timeout time.Duration) (*oauth2.Token, error) {
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timeoutCh = time.After(timeout)
+	}
+	select {
+	case result := <-results:
+		return result.token, result.err
+	case <-timeoutCh:
+		return nil, fmt.Errorf("no authorization received within %s, was the browser tab closed? Retry or use --auth-timeout", timeout)
+	}
+}
+
+// Prints the authorization URL, then reads the redirect URL (or the bare code) pasted from another device
+func authorizeHeadless(in io.Reader, out io.Writer, qr bool) (*oauth2.Token, error) {
+	authURL := getAuthURL(codeChallenge, oauthCfg)
+	fmt.Fprintln(out, "Open the following URL on any device and authorize the app:")
+	fmt.Fprintln(out, authURL)
+	if qr {
+		qrCode, err := renderQRCode(authURL)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(out, "Or scan it with your phone:")
+		fmt.Fprint(out, qrCode)
+	}
+	fmt.Fprint(out, "Paste the URL you were redirected to (or the code parameter): ")
+
+	input, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && input == "" {
+		return nil, fmt.Errorf("failed to read redirect URL: %s", err)
+	}
+
+	code, state, err := parseRedirectInput(input)
+	if err != nil {
+		return nil, err
+	}
+	if state != "" {
+		if err := oauthState.validate(state); err != nil {
+			return nil, err
+		}
+	}
+	return exchangeCode(context.Background(), code, codeVerifier)
+}
+
+// Renders the text as a QR code of half-height block characters for the terminal
+func renderQRCode(text string) (string, error) {
+	code, err := qrcode.New(text, qrcode.Low)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate QR code: %s", err)
+	}
+	return code.ToSmallString(false), nil
+}
+
+// Extracts the authorization code and state from a pasted redirect URL, or accepts a bare code
+func parseRedirectInput(input string) (string, string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", "", fmt.Errorf("error: empty redirect URL or code")
+	}
+	if !strings.Contains(input, "=") {
+		return input, "", nil // bare code
+	}
+
+	query := input
+	if i := strings.Index(input, "?"); i >= 0 {
+		query = input[i+1:]
+	}
+	query = strings.TrimSuffix(strings.SplitN(query, "#", 2)[0], "#_=_")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse redirect URL: %s", err)
+	}
+	if authErr := values.Get("error"); authErr != "" {
+		return "", "", fmt.Errorf("authorization failed: %s %s", authErr, values.Get("error_description"))
+	}
+	if values.Get("code") == "" {
+		return "", "", fmt.Errorf("error: no code found in redirect URL")
+	}
+	return values.Get("code"), values.Get("state"), nil
+}
+
+// Opens credentials.json, or decrypts credentials.json.age. The file is optional when the credentials are given in environment variables
+func openCredFile(crypter *ageCrypter) (io.Reader, error) {
+	for _, fileName := range []string{"credentials.json", "credentials.json.age"} {
+		byteValue, err := os.ReadFile(fileName)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read file: %s", err)
+		}
+
+		if isAgeEncrypted(byteValue) {
+			byteValue, err = crypter.Decrypt(byteValue)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s: %s", fileName, err)
+			}
+		}
+		return bytes.NewReader(byteValue), nil
+	}
+	return strings.NewReader("{}"), nil
+}
+
+// Reads the credentials.json file, selecting the named profile when profile is not empty
+func readCredFile(reader io.Reader, profile string) (*data.Credentials, *oauth2.Config, error) {
+	var apiCred data.Credentials // Fitbit API credentials: OAuth 2.0 Client ID (and Client Secret in case of Application Type: Server)
+
+	// Read the file's content
+	byteValue, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %s", err)
+	}
+
+	// Unmarshal the JSON data into a struct
+	if err := json.Unmarshal(byteValue, &apiCred); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal JSON: %s", err)
+	}
+
+	// Settings of the profile override the top-level ones, missing settings are inherited
+	if profile != "" {
+		profileJSON, ok := apiCred.Profiles[profile]
+		if !ok {
+			return nil, nil, fmt.Errorf("profile %q not found in credentials file", profile)
+		}
+		if err := json.Unmarshal(profileJSON, &apiCred); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal profile %q: %s", profile, err)
+		}
+	}
+	apiCred.Profiles = nil
+	applyEnvCredentials(&apiCred)
+
+	// Endpoints can be overridden, e.g. to run the flow against a local mock server
+	endpoint := fitbit.Endpoint
+	if apiCred.AuthURL != "" {
+		endpoint.AuthURL = apiCred.AuthURL
+	}
+	if apiCred.TokenURL != "" {
+		endpoint.TokenURL = apiCred.TokenURL
+	}
+	authStyle, err := tokenAuthStyle(&apiCred)
+	if err != nil {
+		return nil, nil, err
+	}
+	endpoint.AuthStyle = authStyle
+
+	scopes := defaultScopes
+	if len(apiCred.Scopes) > 0 {
+		scopes = apiCred.Scopes
+	}
+
+	if (apiCred.CId != "") && (apiCred.RedirectURL != "") {
+		// OAuth2 Config setup
+		return &apiCred, &oauth2.Config{
+			ClientID:     apiCred.CId,
+			ClientSecret: apiCred.CSecret,
+			RedirectURL:  apiCred.RedirectURL,
+			Scopes:       scopes,
+			Endpoint:     endpoint,
+		}, nil
+	} else {
+		err := "The clientID and redirect URL cannot be empty."
+		return nil, nil, fmt.Errorf("ERROR %s", err)
+	}
+}
+
+// Selects how the client authenticates on the token endpoint. Server (confidential) applications send the
+// client ID and secret as HTTP Basic auth, client and personal (public) applications only send the client ID
+// in the request body, relying on PKCE. Without an explicit "appType", a configured secret means a server application
+func tokenAuthStyle(apiCred *data.Credentials) (oauth2.AuthStyle, error) {
+	appType := strings.ToLower(apiCred.AppType)
+	if appType == "" {
+		appType = "client"
+		if apiCred.CSecret != "" {
+			appType = "server"
+		}
+	}
+
+	switch appType {
+	case "server":
+		if apiCred.CSecret == "" {
+			return oauth2.AuthStyleAutoDetect, fmt.Errorf("the client secret is required for server applications")
+		}
+		return oauth2.AuthStyleInHeader, nil
+	case "client", "personal":
+		return oauth2.AuthStyleInParams, nil
+	default:
+		return oauth2.AuthStyleAutoDetect, fmt.Errorf("unknown application type %q, use \"client\", \"personal\" or \"server\"", apiCred.AppType)
+	}
+}
+
+// Overrides the credentials with the FITBIT_CLIENT_ID, FITBIT_CLIENT_SECRET and FITBIT_REDIRECT_URL environment variables
+func applyEnvCredentials(apiCred *data.Credentials) {
+	if clientID := os.Getenv("FITBIT_CLIENT_ID"); clientID != "" {
+		apiCred.CId = clientID
+	}
+	if clientSecret := os.Getenv("FITBIT_CLIENT_SECRET"); clientSecret != "" {
+		apiCred.CSecret = clientSecret
+	}
+	if redirectURL := os.Getenv("FITBIT_REDIRECT_URL"); redirectURL != "" {
+		apiCred.RedirectURL = redirectURL
+	}
+}
+
+// Generates a code challenge from the code verifier
+func generateCodeChallenge(codeVerifier string) (string, error) {
+	if codeVerifier == "" {
+		return "", fmt.Errorf("error: empty codeVerifier string")
+	}
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(hash[:]), nil
+}
+
+// Generates a random code verifier (need to change to use unreserved characters, RFC3986)
+/*func generateCodeVerifier() (string, error) {
+
+	cv := make([]byte, 43) // verifier length = 43
+	_, err := rand.Read(cv)
+	if err != nil {
+		log.Fatalf("Failed to generate random bytes: %v", err)
+		return "", err
+	}
+	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(cv), nil
+}*/
+
+// Generates a random code verifier accroding to RFC 7636 RFC3986
+func generateCodeVerifier(length int) (string, error) {
+	const rfc3986Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~"
+	if length < 43 || length > 128 {
+		return "", fmt.Errorf("code verifier length must be between 43 and 128 characters")
+	}
+
+	verifier := make([]byte, length)
+	for i := range verifier {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(rfc3986Chars))))
+		if err != nil {
+			return "", err
+		}
+		verifier[i] = rfc3986Chars[index.Int64()]
+	}
+	return string(verifier), nil
+}
+
+// Generates a random 32 character length string for "state", https://go.dev/play/p/Lwnd5B7VYIL
+func generateRandomString() string {
+	charset := "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	result := make([]byte, 32)
+	max := big.NewInt(int64(len(charset)))
+
+	for i := 0; i < 32; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		result[i] = charset[n.Int64()]
+	}
+	return string(result)
+}
+
+// Stores a new state value, replacing the previous one, and returns it
+func (s *authState) issue(value string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value = value
+	s.expires = time.Now().Add(stateLifetime)
+	s.used = false
+	return value
+}
+
+// Validates the state passed back in the redirect request. The state can be validated only once,
+// whether it matches or not, and is compared in constant time
+func (s *authState) validate(state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value == "" {
+		return fmt.Errorf("no authorization request in progress")
+	}
+	if s.used {
+		return fmt.Errorf("the authorization state has already been used, repeated callback rejected")
+	}
+	s.used = true
+	if time.Now().After(s.expires) {
+		return fmt.Errorf("the authorization state has expired, restart the authorization")
+	}
+	if subtle.ConstantTimeCompare([]byte(s.value), []byte(state)) != 1 {
+		return fmt.Errorf("state mismatch, the redirect request not originated from this app")
+	}
+	return nil
+}
+
+// Generates the authorization URL
+func getAuthURL(codeChallenge string, ouathCfg *oauth2.Config) string {
+	authURL := ouathCfg.Endpoint.AuthURL
+	if authURL == "" {
+		authURL = fitbit.Endpoint.AuthURL
+	}
+	return fmt.Sprintf(
+		"%s?response_type=code&client_id=%s&redirect_uri=%s&scope=%s&code_challenge=%s&code_challenge_method=%s&state=%s",
+		authURL, ouathCfg.ClientID, ouathCfg.RedirectURL, scopeStringBuilder(ouathCfg.Scopes), codeChallenge, "S256", oauthState.issue(generateRandomString()))
+}
+
+// Concatenates the scopes with a "+"
+func scopeStringBuilder(scopes []string) string {
+	var scopeString = ""
+	for _, s := range scopes {
+		scopeString = scopeString + s + "+"
+	}
+	if lastChar := len(scopeString) - 1; lastChar >= 0 && scopeString[lastChar] == '+' {
+		scopeString = scopeString[:lastChar]
+	}
+	return scopeString
+}
+
+// Opens a URL in the default browser
+func openBrowser(url string) error {
+	switch {
+	case strings.Contains(strings.ToLower(os.Getenv("OS")), "windows"):
+		cmd := exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+		return cmd.Start()
+	case strings.Contains(strings.ToLower(os.Getenv("OS")), "darwin"):
+		cmd := exec.Command("open", url)
+		return cmd.Start()
+	default:
+		cmd := exec.Command("xdg-open", url)
+		return cmd.Start()
+	}
+}
+
+// Handles the OAuth2 callback, exchanges the authorization code for tokens (RFC 7636, code_verifier)
+func handleOAuth2Callback(w http.ResponseWriter, r *http.Request) {
+	tok, err := completeCallback(r)
+	if err != nil {
+		slog.Error("Authorization failed", "err", err)
+		http.Error(w, "Authorization failed: "+err.Error(), http.StatusBadRequest)
+	} else {
+		w.Write([]byte("Authorization successful, you can close this window and return to the console."))
+	}
+
+	// Only the first callback completes the flow, later ones are rejected by the single-use state
+	select {
+	case authResultCh <- authResult{token: tok, err: err}:
+	default:
+	}
+}
+
+// Validates the redirect request and exchanges its authorization code
+func completeCallback(r *http.Request) (*oauth2.Token, error) {
+	if authErr := r.URL.Query().Get("error"); authErr != "" {
+		oauthState.validate(r.URL.Query().Get("state")) // invalidate the state
+		return nil, fmt.Errorf("%s %s", authErr, r.URL.Query().Get("error_description"))
+	}
+	if err := oauthState.validate(r.URL.Query().Get("state")); err != nil {
+		return nil, err
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return nil, fmt.Errorf("no authorization code received")
+	}
+	return exchangeCode(r.Context(), code, codeVerifier)
+}
+
+// Exchanges the authorization code for an access and refresh token, sending the PKCE code verifier
+// whose challenge was part of the authorization URL
+func exchangeCode(ctx context.Context, code string, verifier string) (*oauth2.Token, error) {
+	if verifier == "" {
+		return nil, fmt.Errorf("failed to exchange authorization code: missing PKCE code verifier")
+	}
+	tok, err := oauthCfg.Exchange(clientContext(ctx), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %s", err)
+	}
+	return tok, nil
+}
+
+// Fetches activity data using the access token, JSON
+func fetchActivityData(args []string, opts exportOptions) error {
+	slog.Info("Fetching activity data", "date", strings.Join(args, " "))
+
+	if len(args) == 1 {
+
+		var activities data.Activities
+		var err error
+		if opts.fromList {
+			day, parseErr := time.Parse(dateLayout, args[0])
+			if parseErr != nil {
+				return withExitCode(exitUsage, fmt.Errorf("invalid date %q, use YYYY-MM-DD", args[0]))
+			}
+			activities.Activities, err = getListActivities(day, day)
+		} else {
+			activities, err = getDayActivities(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch activity data: %w", err)
+		}
+		if opts.dailyWalk {
+			activities = addDailyWalk(args[0], activities)
+		}
+
+		activities.Activities = filterActivities(activities.Activities, opts)
+
+		if opts.all {
+			if len(activities.Activities) == 0 {
+				slog.Info("No activities found", "date", args[0])
+			}
+			return exportActivities(activities.Activities, opts)
+		}
+
+		// The activity chosen by its log ID, e.g. from the list command
+		if opts.logID != 0 {
+			for _, activity := range activities.Activities {
+				if activity.LogID == opts.logID {
+					return exportActivities([]data.Activity{activity}, opts)
+				}
+			}
+			return fmt.Errorf("no activity with log ID %d on %s", opts.logID, args[0])
+		}
+
+		// Display the list of activities with their index
+		fmt.Fprintln(console, "Available Activities:")
+		if err := printActivityChoices(console, activities.Activities); err != nil {
+			return err
+		}
+
+		// Prompt the user to choose the activities, unless chosen with --select
+		input := opts.selection
+		if input == "" {
+			reader := bufio.NewReader(os.Stdin)
+			fmt.Fprint(console, "Enter the numbers of the activities you want to choose (e.g. 1,3,5-7): ")
+			input, err = reader.ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+		}
+
+		choices, err := parseSelection(input, len(activities.Activities))
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		if opts.stdout != nil && len(choices) > 1 {
+			return withExitCode(exitUsage, fmt.Errorf("--stdout writes a single activity, choose one"))
+		}
+
+		var chosenActivities []data.Activity
+		for _, choice := range choices {
+			chosenActivity := activities.Activities[choice-1]
+			fmt.Fprintln(console, "You selected: "+strconv.Itoa(choice)+" "+chosenActivity.ActivityParentName+" "+chosenActivity.StartDate+" "+chosenActivity.StartTime)
+			chosenActivities = append(chosenActivities, chosenActivity)
+		}
+		return exportActivities(chosenActivities, opts)
+
+	} else if len(args) < 1 {
+		return withExitCode(exitUsage, fmt.Errorf("no date specified, give a date in a format YYYY-MM-DD"))
+	} else {
+		return withExitCode(exitUsage, fmt.Errorf("maximum of one date can be given in a format YYYY-MM-DD"))
+	}
+
+}
+
+// Parses the chosen activity numbers, a comma separated list of numbers and ranges, e.g. "1,3,5-7".
+// Returns the numbers in the order given, without duplicates
+func parseSelection(input string, count int) ([]int, error) {
+	input = strings.TrimSpace(input)
+	invalid := func() error {
+		return fmt.Errorf("invalid choice %q, enter the numbers of activities from 1 to %d, e.g. 1,3,5-7", input, count)
+	}
+
+	var choices []int
+	chosen := map[int]bool{}
+	for _, item := range strings.Split(input, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		from, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil {
+			return nil, invalid()
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(strings.TrimSpace(last)); err != nil {
+				return nil, invalid()
+			}
+		}
+		if from < 1 || to > count || from > to {
+			return nil, invalid()
+		}
+		for choice := from; choice <= to; choice++ {
+			if !chosen[choice] {
+				chosen[choice] = true
+				choices = append(choices, choice)
+			}
+		}
+	}
+	return choices, nil
+}
+
+// Prints the activities to choose from as a table, numbered from 1. Active Zone Minutes are computed
+// from the heart rate, so they tell whether the activity has heart rate data
+func printActivityChoices(out io.Writer, activities []data.Activity) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tSPORT\tSTART\tDURATION\tDISTANCE\tCALORIES\tHR")
+	for i, activity := range activities {
+		fmt.Fprintf(w, "%d\t%s\t%s %s\t%s\t%.2f\t%d\t%t\n", i+1, activity.Name, activity.StartDate, activity.StartTime,
+			time.Duration(activity.Duration/1000)*time.Second, activity.Distance, activity.Calories, activity.HasActiveZoneMinutes)
+	}
+	return w.Flush()
+}
+
+// Exports the activities of the date range, day by day, reporting the progress of each day
+func fetchActivityRange(start time.Time, end time.Time, opts exportOptions) error {
+	// Collect the activities first, so the progress of the export knows what remains
+	if opts.fromList {
+		activities, err := getListActivities(start, end)
+		if err != nil {
+			return fmt.Errorf("failed to fetch activity data from %s to %s: %w", start.Format(dateLayout), end.Format(dateLayout), err)
+		}
+		matching := filterActivities(activities, opts)
+		slog.Info("Exporting date range", "activities", len(matching), "from", start.Format(dateLayout), "to", end.Format(dateLayout))
+		return exportActivities(matching, opts)
+	}
+	days := int(end.Sub(start).Hours()/24) + 1
+	var matching []data.Activity
+	for day := 0; day < days; day++ {
+		date := start.AddDate(0, 0, day).Format(dateLayout)
+		activities, err := getDayActivities(date)
+		if err != nil {
+			return fmt.Errorf("failed to fetch activity data of %s: %w", date, err)
+		}
+		if opts.dailyWalk {
+			activities = addDailyWalk(date, activities)
+		}
+		dayMatching := filterActivities(activities.Activities, opts)
+		slog.Info("Fetched day", "day", fmt.Sprintf("%d/%d", day+1, days), "date", date, "activities", len(dayMatching))
+		matching = append(matching, dayMatching...)
+	}
+	slog.Info("Exporting date range", "activities", len(matching), "from", start.Format(dateLayout), "to", end.Format(dateLayout))
+	return exportActivities(matching, opts)
+}
+
+// Gets the activities logged on the date
+func getDayActivities(date string) (data.Activities, error) {
+	var activities data.Activities
+
+	url := userURL("activities/date/" + date + ".json")
+	body, err := apiGet(url)
 	if err != nil {
-		panic(err)
+		return activities, err
+	}
+
+	// Unmarshal the JSON into the Activities struct
+	if err := json.Unmarshal(body, &activities); err != nil {
+		return activities, fmt.Errorf("failed to unmarshal JSON: %s", err)
 	}
+	return activities, nil
 }
 
-func main() {
-	jsonFile, err := os.Open("credentials.json")
-	handleError(err)
-	defer jsonFile.Close()
-	ouathCfg, err := readCredFile(jsonFile)
-	handleError(err)
-	codeVerifier, err = generateCodeVerifier(43)
-	handleError(err)
-	codeChallenge, err = generateCodeChallenge(codeVerifier)
-	handleError(err)
+// Keeps the activities matching the type filters
+func filterActivities(activities []data.Activity, opts exportOptions) []data.Activity {
+	var filtered []data.Activity
+	for _, activity := range activities {
+		if typeFilterMatches(opts, activity.ActivityParentName, activity.Name, strconv.Itoa(activity.ActivityID), strconv.Itoa(activity.ActivityParentID)) {
+			filtered = append(filtered, activity)
+		}
+	}
+	return filtered
+}
 
-	http.HandleFunc("/callback", handleOAuth2Callback)
-	http.HandleFunc("/token-received", handleTokenReceived)
+// Tells whether an activity passes the type filters, types are matched case-insensitively against
+// the names of the activity (e.g. its name, its parent name and its activity IDs)
+func typeFilterMatches(opts exportOptions, names ...string) bool {
+	matches := func(types []string) bool {
+		for _, t := range types {
+			for _, name := range names {
+				if strings.EqualFold(t, name) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if len(opts.types) > 0 && !matches(opts.types) {
+		return false
+	}
+	return !matches(opts.excludeTypes)
+}
 
-	server = &http.Server{Addr: ":8080"}
+// Splits a comma separated list, dropping the empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
-	// Generate and print the authorization URL
-	authURL := getAuthURL(codeChallenge, ouathCfg)
+// Exports each activity, reporting the progress. A failed activity does not stop the others, the
+// error tells whether some (partial failure) or all of them failed
+func exportActivities(activities []data.Activity, opts exportOptions) error {
+	var state *resumeState
+	if opts.batch != "" && opts.archive == nil {
+		var err error
+		if state, err = loadResumeState(outputDir, opts.batch, opts.resume); err != nil {
+			return err
+		}
+	}
 
-	// Open the URL in the default browser
-	err = openBrowser(authURL)
-	if err != nil {
-		log.Fatalf("Error opening browser: %v", err)
+	progress := newExportProgress(len(activities))
+	exported := map[int64]string{} // File of each exported activity, for the manifest
+	var pending []data.Activity
+	for _, activity := range activities {
+		if state.isDone(activity.LogID) {
+			progress.start(activity)
+			progress.skip(activity, state.Done[activity.LogID])
+			exported[activity.LogID] = state.Done[activity.LogID]
+			continue
+		}
+		pending = append(pending, activity)
 	}
 
+	// Export on opts.concurrency workers, the resume state is only updated here
+	type exportResult struct {
+		logID    int64
+		fileName string
+		ok       bool
+	}
+	jobs := make(chan data.Activity)
+	results := make(chan exportResult)
+	var workers sync.WaitGroup
+	for i := 0; i < max(opts.concurrency, 1); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for activity := range jobs {
+				fileName, ok := exportActivity(activity, opts, progress)
+				results <- exportResult{activity.LogID, fileName, ok}
+			}
+		}()
+	}
 	go func() {
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatalf("HTTP server ListenAndServe: %v", err)
+		for _, activity := range pending {
+			jobs <- activity
 		}
+		close(jobs)
+		workers.Wait()
+		close(results)
 	}()
+	for result := range results {
+		if result.ok {
+			exported[result.logID] = result.fileName
+			if err := state.markDone(result.logID, result.fileName); err != nil {
+				slog.Warn("Failed to save resume state", "err", err)
+			}
+		}
+	}
+	progress.finish()
+	if opts.batch != "" && opts.archive == nil {
+		if err := updateManifest(outputDir, activities, exported); err != nil {
+			slog.Warn("Failed to write manifest", "err", err)
+		}
+	}
+	if opts.notify {
+		destination := outputDir
+		if opts.archive != nil {
+			destination = opts.archive.fileName
+		}
+		notifyExportFinished(progress.written, progress.skipped, progress.failed, destination)
+	}
 
-	// Wait for the server to finish
-	<-done
-	fmt.Println("Server stopped gracefully")
+	if progress.failed == 0 {
+		state.remove()
+		return nil
+	}
+	if progress.failed == progress.total {
+		return fmt.Errorf("failed to export %d activities: %w", progress.failed, progress.lastErr)
+	}
+	return withExitCode(exitPartial, fmt.Errorf("failed to export %d of %d activities", progress.failed, progress.total))
 }
 
-// Reads the credentials.json file
-func readCredFile(reader io.Reader) (*oauth2.Config, error) {
-	var apiCred data.Credentials // Fitbit API credentials: OAuth 2.0 Client ID (and Client Secret in case of Application Type: Server)
+// Describes the activity in the progress and the logs, e.g. "Swim 2024-09-07 10:00"
+func activityLabel(activity data.Activity) string {
+	return activity.ActivityParentName + " " + activity.StartDate + " " + activity.StartTime
+}
 
-	// Read the file's content
-	byteValue, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %s", err)
+// Downloads the tcx of the activity and saves it with the missing data injected, a failure is
+// reported to the progress and does not stop the batch. Returns the file and whether it is done, written or skipped.
+// Safe to call concurrently, the file names are resolved and written one at a time
+func exportActivity(activity data.Activity, opts exportOptions, progress *exportProgress) (string, bool) {
+	progress.start(activity)
+	fileName := filepath.Join(outputDir, activityFileName(opts.fileTemplate, activity)+".tcx")
+	if opts.archive != nil {
+		fileName = activityFileName(opts.fileTemplate, activity) + ".tcx"
+	} else if opts.stdout == nil {
+		// Skip or fail before downloading the activity
+		if _, skip, err := resolveConflict(fileName, opts.onConflict); err != nil {
+			progress.fail(activity, err)
+			return "", false
+		} else if skip {
+			progress.skip(activity, fileName)
+			return fileName, true
+		}
 	}
 
-	// Unmarshal the JSON data into a struct
-	json.Unmarshal(byteValue, &apiCred)
-	if err := json.Unmarshal(byteValue, &apiCred); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON: %s", err)
+	var xml *etree.Document
+	var err error
+	if activity.Synthetic {
+		xml, err = newDailyWalkTcx(activity)
+	} else if xml, err = getActivityTcx(activity.LogID, !opts.gpsOnly); missingTcx(xml, err) {
+		slog.Info("Activity has no TCX, creating it from the summary", "activity", activityLabel(activity))
+		xml, err = newActivityTcx(activity)
+	}
+	if err != nil {
+		progress.fail(activity, err)
+		return "", false
 	}
+	progress.downloadDone(activity)
 
-	if (apiCred.CId != "") && (apiCred.RedirectURL != "") {
-		// OAuth2 Config setup
-		return &oauth2.Config{
-			ClientID:     apiCred.CId,
-			ClientSecret: apiCred.CSecret,
-			RedirectURL:  apiCred.RedirectURL,
-			Scopes:       []string{"activity", "heartrate", "location", "profile"}, // only request what is really needed
-			//"activity", "cardio_fitness", "electrocardiogram", "heartrate", "location", "nutrition", "oxygen_saturation", "profile", "respiratory_rate", "settings", "sleep", "social", "temperature", "weight"
-			Endpoint: fitbit.Endpoint,
-		}, nil
-	} else {
-		err := "The clientID and redirect URL cannot be empty."
-		return nil, fmt.Errorf("ERROR %s", err)
+	// Pool swims are split into their lengths, as logged in the activity log list or of the --pool-length
+	mapping := config.sportMapping(activity)
+	lengths := 0
+	distMeters := distanceMeters(activity.Distance, apiUnits)
+	if mapping.has(recipePoolLengths) {
+		if log, ok, err := activityLog(activity); err != nil {
+			slog.Warn("Failed to get the swim lengths, exporting a single lap", "activity", activityLabel(activity), "err", err)
+		} else if ok {
+			lengths = log.SwimLengths
+		}
+		lengths, distMeters = poolSwim(lengths, distMeters, opts.poolMeters)
 	}
-}
 
-// Generates a code challenge from the code verifier
-func generateCodeChallenge(codeVerifier string) (string, error) {
-	if codeVerifier == "" {
-		return "", fmt.Errorf("error: empty codeVerifier string")
+	// The tracker or watch that recorded the activity, of its source in the activity log list
+	var device *data.Device
+	if len(pairedDevices) > 0 {
+		if log, ok, err := activityLog(activity); err != nil {
+			slog.Warn("Failed to get the recording device, naming Fitbit", "activity", activityLabel(activity), "err", err)
+		} else if ok {
+			device = recordingDevice(log, pairedDevices)
+		}
 	}
-	hash := sha256.Sum256([]byte(codeVerifier))
-	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(hash[:]), nil
-}
 
-// Generates a random code verifier (need to change to use unreserved characters, RFC3986)
-/*func generateCodeVerifier() (string, error) {
+	// Active Zone Minutes of the activity, for its laps and its sidecar
+	var azmMinutes []data.ActiveZoneMinutesMinute
+	if opts.azm && activity.HasActiveZoneMinutes {
+		if azmMinutes, err = fetchActiveZoneMinutes(activity); err != nil {
+			slog.Warn("Failed to get the Active Zone Minutes, exporting without them", "activity", activityLabel(activity), "err", err)
+		}
+	}
 
-	cv := make([]byte, 43) // verifier length = 43
-	_, err := rand.Read(cv)
-	if err != nil {
-		log.Fatalf("Failed to generate random bytes: %v", err)
-		return "", err
+	// Cadence of the activities on foot, from their steps
+	var stepsPerMinute map[string]int
+	if opts.cadence && hasCadence(activity) {
+		if stepsPerMinute, err = fetchStepsPerMinute(activity); err != nil {
+			slog.Warn("Failed to get the steps, exporting without cadence", "activity", activityLabel(activity), "err", err)
+		}
 	}
-	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(cv), nil
-}*/
 
-// Generates a random code verifier accroding to RFC 7636 RFC3986
-func generateCodeVerifier(length int) (string, error) {
-	const rfc3986Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~"
-	if length < 43 || length > 128 {
-		return "", fmt.Errorf("code verifier length must be between 43 and 128 characters")
+	// Altitude of the GPS activities recorded without it, from the climb
+	var climbPerMinute map[string]float64
+	if opts.altitude && needsAltitude(xml) {
+		if climbPerMinute, err = fetchClimbPerMinute(activity); err != nil {
+			slog.Warn("Failed to get the elevation, exporting without altitude", "activity", activityLabel(activity), "err", err)
+		}
 	}
 
-	verifier := make([]byte, length)
-	for i := range verifier {
-		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(rfc3986Chars))))
-		if err != nil {
-			return "", err
+	// Distance curve of the treadmill runs, which Fitbit exports without distance
+	var distancePerMinute map[string]float64
+	if opts.distCurve && mapping.has(recipeDistanceCurve) {
+		if distancePerMinute, err = fetchDistancePerMinute(activity); err != nil {
+			slog.Warn("Failed to get the distance per minute, exporting without distance curve", "activity", activityLabel(activity), "err", err)
 		}
-		verifier[i] = rfc3986Chars[index.Int64()]
 	}
-	return string(verifier), nil
-}
 
-// Generates a random 32 character length string for "state", https://go.dev/play/p/Lwnd5B7VYIL
-func generateRandomString() string {
-	charset := "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	result := make([]byte, 32)
-	max := big.NewInt(int64(len(charset)))
+	// Heart rate of the track points recorded without it
+	var hrSamples heartRateSamples
+	if opts.heartRate {
+		if hrSamples, err = fetchHeartRate(activity, opts.hrDetail); err != nil {
+			slog.Warn("Failed to get the heart rate, exporting without it", "activity", activityLabel(activity), "err", err)
+		}
+	}
 
-	for i := 0; i < 32; i++ {
-		n, err := rand.Int(rand.Reader, max)
-		if err != nil {
-			panic(err)
+	// Calories of the activity, for its sidecar and its track points
+	var caloriesMinutes []data.CaloriesMinute
+	if opts.calories {
+		if caloriesMinutes, err = fetchCaloriesPerMinute(activity); err != nil {
+			slog.Warn("Failed to get the calories per minute, exporting without them", "activity", activityLabel(activity), "err", err)
 		}
-		result[i] = charset[n.Int64()]
 	}
-	stateAuth = string(result) // Store it for later comparison
-	return stateAuth
-}
 
-// Generates the authorization URL
-func getAuthURL(codeChallenge string, ouathCfg *oauth2.Config) string {
-	return fmt.Sprintf(
-		"https://www.fitbit.com/oauth2/authorize?response_type=token&client_id=%s&redirect_uri=%s&scope=%s&code_challenge=%s&code_challenge_method=%s&state=%s",
-		ouathCfg.ClientID, ouathCfg.RedirectURL, scopeStringBuilder(ouathCfg.Scopes), codeChallenge, "S256", generateRandomString())
-}
+	// Cardio Fitness Score of the day
+	var vo2Max string
+	if opts.vo2Max {
+		if vo2Max, err = fetchVO2Max(activity.StartDate); err != nil {
+			slog.Warn("Failed to get the VO2 Max, exporting without it", "activity", activityLabel(activity), "err", err)
+		}
+	}
 
-// Concatenates the scopes with a "+"
-func scopeStringBuilder(scopes []string) string {
-	var scopeString = ""
-	for _, s := range scopes {
-		scopeString = scopeString + s + "+"
+	setCatalogSport(xml, activity)
+	if name := addActivityName(xml, activity.LogID); name != "" {
+		activity.Name = name
 	}
-	if lastChar := len(scopeString) - 1; lastChar >= 0 && scopeString[lastChar] == '+' {
-		scopeString = scopeString[:lastChar]
+	xmlString, err := injectActivityTcx(xml, activity, time.Duration(activity.Duration/1000)*time.Second,
+		distMeters, activity.Calories, lengths, device)
+	if err == nil && len(stepsPerMinute) > 0 {
+		addRunCadence(xml, stepsPerMinute)
 	}
-	return scopeString
-}
+	if err == nil && len(climbPerMinute) > 0 {
+		addTrackpointAltitude(xml, climbPerMinute)
+	}
+	if err == nil && len(distancePerMinute) > 0 {
+		err = addDistanceCurve(xml, distancePerMinute, time.Duration(activity.Duration/1000)*time.Second, distanceMeters(activity.Distance, apiUnits))
+	}
+	if err == nil && hrSamples.Len() > 0 {
+		addTrackpointHeartRate(xml, hrSamples)
+	}
+	// The laps are split once the track points have their distance and heart rate, before the summaries of the laps
+	split := opts.laps != lapSplit{} && !mapping.has(recipePoolLengths)
+	if err == nil && split {
+		err = splitLaps(xml, opts.laps, hrSamples)
+	}
+	if err == nil && len(azmMinutes) > 0 {
+		err = addLapActiveZoneMinutes(xml, azmMinutes)
+	}
+	if err == nil && hrSamples.Len() > 0 {
+		addLapHeartRate(xml, hrSamples)
+	}
+	if err == nil && opts.tpCalories && len(caloriesMinutes) > 0 {
+		addTrackpointCalories(xml, caloriesMinutes)
+	}
+	if err == nil && vo2Max != "" {
+		addActivityNotes(xml, "VO2 Max (Cardio Fitness Score): "+vo2Max)
+	}
+	// The positions are removed last, the other transformations work on the track as recorded
+	hidden := err == nil && config != nil && len(config.privacyZones) > 0 && hidePrivacyZones(xml, config.privacyZones)
+	stripped := err == nil && opts.stripGPS && stripPositions(xml)
+	if err == nil && (split || hidden || stripped || len(azmMinutes) > 0 || len(stepsPerMinute) > 0 || len(climbPerMinute) > 0 || len(distancePerMinute) > 0 || hrSamples.Len() > 0 || (opts.tpCalories && len(caloriesMinutes) > 0) || vo2Max != "") {
+		// Written again with the intraday data
+		xml.Indent(2)
+		xmlString, err = xml.WriteToString()
+	}
+	if err != nil {
+		progress.fail(activity, err)
+		return "", false
+	}
+	progress.transformDone(activity)
 
-// Opens a URL in the default browser
-func openBrowser(url string) error {
-	switch {
-	case strings.Contains(strings.ToLower(os.Getenv("OS")), "windows"):
-		cmd := exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
-		return cmd.Start()
-	case strings.Contains(strings.ToLower(os.Getenv("OS")), "darwin"):
-		cmd := exec.Command("open", url)
-		return cmd.Start()
-	default:
-		cmd := exec.Command("xdg-open", url)
-		return cmd.Start()
+	var summary []byte
+	if opts.sidecar && opts.stdout == nil {
+		extra := map[string]any{}
+		if len(azmMinutes) > 0 {
+			extra["activeZoneMinutesIntraday"] = azmMinutes
+		}
+		if len(caloriesMinutes) > 0 {
+			extra["caloriesIntraday"] = caloriesMinutes
+		}
+		if vo2Max != "" {
+			extra["vo2Max"] = vo2Max
+		}
+		if summary, err = activitySummary(activity, extra); err != nil {
+			progress.fail(activity, err)
+			return "", false
+		}
 	}
-}
 
-// Handles the OAuth2 callback
-func handleOAuth2Callback(w http.ResponseWriter, r *http.Request) {
-	// Construct a simple HTML page with JavaScript to extract the access token
-	html := `
-	<html>
-		<body>
-			<script type="text/javascript">
-				var fragmentString = window.location.hash.substr(1);
-				var params = {};
-				fragmentString.split("&").forEach(function (pair) {
-					var keyValue = pair.split("=");
-					params[keyValue[0]] = keyValue[1];
-				});
-				var accessToken = params["access_token"];
-				var state = params["state"];
-				if (accessToken && state) {
-					fetch('/token-received?token=' + accessToken + '&state=' + state)
-						.then(response => response.text())
-						.then(data => {
-							document.write("Access token and state received and sent to server.");
-						});
-				} else {
-					document.write("Error: Access token or state not found in the URL fragment.");
-				}
-			</script>
-		</body>
-		</html>`
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
-}
-
-// Handles the token reception
-func handleTokenReceived(w http.ResponseWriter, r *http.Request) {
-	token = r.URL.Query().Get("token")
-	stateRedir = r.URL.Query().Get("state")
-	if token != "" {
-		fmt.Println("Access Token:", token)
-		w.Write([]byte("Token received and printed to the server console."))
-		if strings.Compare(stateAuth, stateRedir) == 0 {
-			w.Write([]byte("State matches with the one sent in auth URL."))
-			fetchActivityData(os.Args)
-		} else {
-			w.Write([]byte("The redirect request not originated from this app."))
+	skip := false
+	fileNameToSave := "-"
+	saveMu.Lock()
+	if opts.stdout != nil {
+		_, err = io.WriteString(opts.stdout, xmlString)
+	} else if opts.archive != nil {
+		if fileNameToSave, err = opts.archive.addActivity(fileName, []byte(xmlString), activity); err == nil && summary != nil {
+			_, err = opts.archive.add(sidecarFileName(fileNameToSave), summary)
+		}
+	} else if fileNameToSave, skip, err = resolveConflict(fileName, opts.onConflict); err == nil && !skip {
+		// Resolved again, another concurrent export may have taken the name since
+		err = saveToFile(fileNameToSave, []byte(xmlString))
+		if err == nil && summary != nil {
+			err = saveToFile(sidecarFileName(fileNameToSave), summary)
 		}
-	} else {
-		w.Write([]byte("No token received."))
 	}
+	saveMu.Unlock()
+	if err != nil {
+		progress.fail(activity, err)
+		return "", false
+	} else if skip {
+		progress.skip(activity, fileNameToSave)
+		return fileNameToSave, true
+	}
+	progress.writeDone(activity, fileNameToSave)
+	return fileNameToSave, true
 }
 
-// Fetches activity data using the access token, JSON
-func fetchActivityData(args []string) {
-	fmt.Println("Fetching activity data...")
+// Returns the access token of the API requests
+func currentAccessToken() string {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	return token.AccessToken
+}
 
-	if len(args) == 2 {
+// Sends an authorized GET request to the Fitbit API and returns the response body
+func apiGet(url string) ([]byte, error) {
+	return apiRequest(http.MethodGet, url, nil)
+}
 
-		url := "https://api.fitbit.com/1/user/-/activities/date/" + args[1] + ".json"
+// Sends an authorized POST request to the Fitbit API with the form as body and returns the response body
+func apiPost(apiURL string, form url.Values) ([]byte, error) {
+	return apiRequest(http.MethodPost, apiURL, form)
+}
 
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			log.Fatalf("Failed to create request: %v", err)
+// Sends an authorized DELETE request to the Fitbit API and returns the response body
+func apiDelete(apiURL string) ([]byte, error) {
+	return apiRequest(http.MethodDelete, apiURL, nil)
+}
+
+// Sends an authorized request to the Fitbit API and returns the response body. When the access token
+// is rejected (expired or revoked), it is refreshed, or re-authorized, and the request is retried once
+func apiRequest(method string, apiURL string, form url.Values) ([]byte, error) {
+	if rawResponses.offline {
+		if method != http.MethodGet {
+			return nil, fmt.Errorf("cannot send a %s request offline", method)
 		}
-		req.Header.Add("Authorization", "Bearer "+token)
+		return rawResponses.load(apiURL)
+	}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+	accessToken := currentAccessToken()
+	body, status, err := rateLimitedAPIRequest(method, apiURL, form, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusUnauthorized {
+		tokenMu.Lock()
+		// A concurrent request may have replaced the token already
+		if token.AccessToken == accessToken {
+			slog.Warn("Access token rejected, re-authenticating", "response", strings.TrimSpace(string(body)))
+			err = reauthenticate()
+		}
+		tokenMu.Unlock()
 		if err != nil {
-			log.Fatalf("Failed to fetch activity data: %v", err)
+			return nil, err
 		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
+		body, status, err = rateLimitedAPIRequest(method, apiURL, form, currentAccessToken())
 		if err != nil {
-			log.Fatalf("Failed to read response body: %v", err)
+			return nil, err
 		}
-
-		var prettyJson bytes.Buffer
-		error := json.Indent(&prettyJson, body, "", "\t")
-		if error != nil {
-			log.Println("JSON parse error: ", error)
-			return
+	}
+	if status < 200 || status > 299 {
+		apiErr := &apiError{status: status, body: strings.TrimSpace(string(body))}
+		if status == http.StatusTooManyRequests {
+			apiErr.resetIn = rateLimit.resetIn()
 		}
-		fmt.Println("Activity Data:", prettyJson.String())
+		return nil, apiErr
+	}
+	if method == http.MethodGet {
+		rawResponses.save(apiURL, body)
+	}
+	return body, nil
+}
 
-		// Unmarshal the JSON into the Activities struct
-		var activities data.Activities
-		err = json.Unmarshal(body, &activities)
-		if err != nil {
-			log.Fatalf("Failed to unmarshal JSON: %v", err)
+// Sends the request once the rate limit allows it. A request rejected by the rate limit is sent again after
+// the limit resets, unless that takes longer than --rate-limit-wait. A GET request failing transiently is
+// retried, see retryPolicy
+func rateLimitedAPIRequest(method string, apiURL string, form url.Values, accessToken string) ([]byte, int, error) {
+	for n := 1; ; n++ {
+		rateLimit.wait()
+		body, status, err := doAPIRequest(method, apiURL, form, accessToken)
+		if err == nil && status == http.StatusTooManyRequests && rateLimit.wait() {
+			body, status, err = doAPIRequest(method, apiURL, form, accessToken)
 		}
-
-		// Display the list of activities with their index
-		fmt.Println("Available Activities:")
-		for i, activity := range activities.Activities {
-			fmt.Printf("ID: %d\n", i+1)
-			fmt.Printf("Activity Name: %s\n", activity.Name)
-			fmt.Printf("Distance: %.2f\n", activity.Distance)
-			fmt.Printf("Start date: %s\n", activity.StartDate+" "+activity.StartTime)
-			fmt.Println("-------------")
-		}
-
-		// Prompt the user to choose an activity
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Enter the number of the activity you want to choose: ")
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			log.Fatalf("Failed to read input: %v", err)
+		// Network blips and server errors of the GET requests are retried after a backoff
+		if n > apiRetry.count || !transientFailure(method, status, err) {
+			return body, status, err
 		}
+		pause := apiRetry.pause(n)
+		slog.Warn("API request failed, retrying", "url", apiURL, "status", status, "err", err, "retry", n, "wait", pause.Round(time.Millisecond))
+		sleep(pause)
+	}
+}
 
-		input = strings.TrimSpace(input)
-		choice, err := strconv.Atoi(input)
-		if err != nil || choice < 1 || choice > len(activities.Activities) {
-			fmt.Println("Invalid choice. Please enter a valid number.")
-			return
+// Sends a single request with the access token as bearer token, and the form, when given, as body
+func doAPIRequest(method string, apiURL string, form url.Values, accessToken string) ([]byte, int, error) {
+	var reqBody io.Reader
+	if form != nil {
+		reqBody = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, apiURL, reqBody)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %s", err)
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Set("User-Agent", userAgent())
+	// The names of the activities in English whatever the language of the account, for the file names, --type
+	// and the sports of config.yaml
+	req.Header.Set("Accept-Locale", "en_US")
+	if language := acceptLanguage(apiUnits); language != "" {
+		req.Header.Add("Accept-Language", language)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	// Unchanged lists and TCX files are not sent again
+	var cached cachedResponse
+	conditional := false
+	if method == http.MethodGet {
+		if cached, conditional = responses.load(apiURL); conditional {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
 		}
+	}
+
+	slog.Debug("API request", "method", method, "url", apiURL)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	rateLimit.update(resp.Header, resp.StatusCode)
 
-		chosenActivity := activities.Activities[choice-1]
-		fmt.Println("You selected: " + strconv.Itoa(choice) + " " + chosenActivity.ActivityParentName + " " + chosenActivity.StartDate + " " + chosenActivity.StartTime)
-		fileNameToSave := chosenActivity.ActivityParentName + "-" + strconv.FormatInt(chosenActivity.LogID, 10)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		slog.Debug("API response not modified, read from the cache", "url", apiURL)
+		return []byte(cached.Body), http.StatusOK, nil
+	}
+	slog.Debug("API response", "url", apiURL, "status", resp.StatusCode, "body", string(body))
+	if method == http.MethodGet && resp.StatusCode == http.StatusOK {
+		responses.store(apiURL, resp.Header, body)
+	}
+	return body, resp.StatusCode, nil
+}
 
-		// for debug purposes save all activity on that day
-		// saveToFile("All-"+args[1]+".json", prettyJson.Bytes())
+// Names the exported file of the activity, without extension, by replacing the placeholders of the template:
+// {date} start date (YYYY-MM-DD), {sport} activity type, {logid} log ID, {start_time} start time (HH-MM)
+func activityFileName(template string, activity data.Activity) string {
+	if template == "" {
+		template = defaultFileTemplate
+	} else if strings.HasSuffix(template, "/") {
+		// A directory template, e.g. {year}/{month}/{sport}/, the files are named as by default
+		template += defaultFileTemplate
+	}
+	// Values must not introduce directories or characters invalid in file names
+	sanitize := strings.NewReplacer("/", "_", "\\", "_", ":", "-")
+	year, month, day := "", "", ""
+	if date, err := time.Parse(dateLayout, activity.StartDate); err == nil {
+		year, month, day = date.Format("2006"), date.Format("01"), date.Format("02")
+	}
+	values := map[string]string{
+		"year":       year,
+		"month":      month,
+		"day":        day,
+		"date":       sanitize.Replace(activity.StartDate),
+		"sport":      sanitize.Replace(activity.ActivityParentName),
+		"logid":      strconv.FormatInt(activity.LogID, 10),
+		"start_time": sanitize.Replace(activity.StartTime),
+	}
+	name := fileTemplatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		return values[strings.Trim(placeholder, "{}")]
+	})
+	return strings.TrimSuffix(name, ".tcx")
+}
 
-		xml := getActivityTcx(chosenActivity.LogID)
+// Checks that the file name template only uses known placeholders
+func validateFileTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("empty file name template")
+	}
+	for _, match := range fileTemplatePlaceholder.FindAllStringSubmatch(template, -1) {
+		switch match[1] {
+		case "year", "month", "day", "date", "sport", "logid", "start_time":
+		default:
+			return fmt.Errorf("unknown placeholder %s, use {year}, {month}, {day}, {date}, {sport}, {logid} or {start_time}", match[0])
+		}
+	}
+	return nil
+}
 
-		injectActivityTcx(fileNameToSave, xml, chosenActivity.ActivityParentName, time.Duration(chosenActivity.Duration/1000)*time.Second,
-			strconv.FormatFloat(chosenActivity.Distance*1000.0, 'f', -1, 64), strconv.Itoa(chosenActivity.Calories))
-		// FormatFloat(f: output fixed point, -1: precision automatically det, 64: input is float 64)
+// Chooses the policy of the flags, at most one of them can be given
+func newConflictPolicy(overwrite bool, skipExisting bool, rename bool) (conflictPolicy, error) {
+	policy, given := conflictSkip, 0
+	if overwrite {
+		policy, given = conflictOverwrite, given+1
+	}
+	if skipExisting {
+		policy, given = conflictSkip, given+1
+	}
+	if rename {
+		policy, given = conflictRename, given+1
+	}
+	if given > 1 {
+		return conflictSkip, fmt.Errorf("only one of --overwrite, --skip-existing and --rename-on-conflict can be given")
+	}
+	return policy, nil
+}
 
-	} else if len(args) < 2 {
-		log.Fatalf("No date specified. Give a date in a format YYYY-MM-DD!")
-	} else {
-		log.Fatalf("Maximum of one date can be given in a format YYYY-MM-DD.")
+// Returns the name to save the exported file under according to the policy, or whether to skip it
+func resolveConflict(fileName string, policy conflictPolicy) (string, bool, error) {
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return fileName, false, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("failed to check '%s': %s", fileName, err)
 	}
 
+	switch policy {
+	case conflictOverwrite:
+		return fileName, false, nil
+	case conflictRename:
+		ext := filepath.Ext(fileName)
+		base := strings.TrimSuffix(fileName, ext)
+		for i := 1; ; i++ {
+			candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+			if _, err := os.Stat(candidate); os.IsNotExist(err) {
+				return candidate, false, nil
+			} else if err != nil {
+				return "", false, fmt.Errorf("failed to check '%s': %s", candidate, err)
+			}
+		}
+	default:
+		return fileName, true, nil
+	}
 }
 
 // Dumps the "data" byte slice into a file
-func saveToFile(fileName string, data []byte) {
+func saveToFile(fileName string, data []byte) error {
 	directory := filepath.Dir(fileName)
 	err := os.MkdirAll(directory, os.ModePerm)
 	if err != nil && !os.IsExist(err) {
-		log.Fatalf("Failed to create directory: %v", err)
+		return fmt.Errorf("failed to create directory: %s", err)
 	}
 
-	err = os.WriteFile(filepath.Join(directory, fileName), data, os.FileMode(0644))
+	err = os.WriteFile(fileName, data, os.FileMode(0644))
 	if err != nil {
-		log.Fatalf("Failed to save data to '%s': %v", fileName, err)
+		return fmt.Errorf("failed to save data to '%s': %s", fileName, err)
 	}
-
-	fmt.Println("Data saved to", fileName)
+	return nil
 }
 
-// Gets the selected activity in tcx, based on its logId (activities : logId)
-func getActivityTcx(logId int64) *etree.Document {
-	url := "https://api.fitbit.com/1/user/-/activities/" + strconv.FormatInt(logId, 10) + ".tcx?includePartialTCX=true"
+// Gets the selected activity in tcx, based on its logId (activities : logId). With partial, the activities without
+// a full GPS track have track points too, of their time and heart rate; without it only their laps
+func getActivityTcx(logId int64, partial bool) (*etree.Document, error) {
+	url := userURL("activities/" + strconv.FormatInt(logId, 10) + ".tcx?includePartialTCX=" + strconv.FormatBool(partial))
 
-	req, err := http.NewRequest("GET", url, nil)
+	body, err := apiGet(url)
 	if err != nil {
-		log.Fatalf("Failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to fetch activity data: %w", err)
 	}
-	req.Header.Add("Authorization", "Bearer "+token)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatalf("Failed to fetch activity data: %v", err)
+	// Manually logged activities may have an empty TCX
+	doc := etree.NewDocument()
+	if strings.TrimSpace(string(body)) == "" {
+		return doc, nil
 	}
-	defer resp.Body.Close()
+	if err := doc.ReadFromString(string(body)); err != nil {
+		return nil, fmt.Errorf("failed to parse XML: %s", err)
+	}
+	return doc, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// Modifies the acquired tcx file, returns the modified XML. The activity is modified through the typed model of
+// the tcx package, the document then has the modified activity for the transformations of the intraday data
+func injectActivityTcx(xmlDoc *etree.Document, activity data.Activity, totalTime time.Duration, distMeters float64, calories int, lengths int, device *data.Device) (string, error) {
+	db, err := parseTcxDocument(xmlDoc)
 	if err != nil {
-		log.Fatalf("Failed to read response body: %v", err)
+		return "", err
+	}
+	root := db.FirstActivity()
+	if root == nil || root.Creator == nil {
+		return "", fmt.Errorf("TCX has no activity with creator")
 	}
 
-	doc := etree.NewDocument()
-	if err := doc.ReadFromString(string(body)); err != nil {
-		log.Fatalf("Failed to parse XML: %v", err)
-	}
-	return doc
-}
-
-// Modifies the acquired tcx file
-func injectActivityTcx(fName string, xmlDoc *etree.Document, actName string, totalTime time.Duration, distMeters string, calories string) {
-
-	// modify TCX in case Swim, create trackPtElementStart as start and trackPtElementEnd as end point
-	if actName == "Swim" {
-		// Navigate to the root element
-		root := xmlDoc.SelectElement("TrainingCenterDatabase").SelectElement("Activities").SelectElement("Activity")
-		root.SelectAttr("Sport").Value = actName
-		idElement := string(root.SelectElement("Id").Text())
-		nameElement := etree.NewElement("Name")
-		nameElement.SetText("Fitbit")
-		creatorElement := root.SelectElement("Creator")
-		creatorElement.AddChild(nameElement)
-		lapElement := root.CreateElement("Lap")
-
-		tss, _ := convertTimestamp(idElement, 0) // Convert start timestamp
-		lapElement.CreateAttr("StartTime", tss)
-
-		totalTimeSecondsElement := etree.NewElement("TotalTimeSeconds")
-		totalTimeSecondsElement.SetText(strconv.FormatFloat(totalTime.Seconds(), 'f', -1, 64))
-		lapElement.AddChild(totalTimeSecondsElement)
-		lapElement.CreateElement("DistanceMeters").SetText(distMeters)
-		lapElement.CreateElement("Calories").SetText(calories)
-		lapElement.CreateElement("Intensity").SetText("Active")
-		lapElement.CreateElement("TriggerMethod").SetText("Manual")
-		trackElement := etree.NewElement("Track")
-		lapElement.AddChild(trackElement)
-		// Start point
-		trackPtElementStart := etree.NewElement("Trackpoint")
-		trackElement.AddChild(trackPtElementStart)
-		timeElementStart := etree.NewElement("Time")
-		timeElementStart.SetText(tss)
-		trackPtElementStart.AddChild(timeElementStart)
-		distMetElementStart := etree.NewElement("DistanceMeters")
-		distMetElementStart.SetText("0")
-		trackPtElementStart.AddChild(distMetElementStart)
-		// End point
-		trackPtElementEnd := etree.NewElement("Trackpoint")
-		trackElement.AddChild(trackPtElementEnd)
-		timeElementEnd := etree.NewElement("Time")
-
-		tse, _ := convertTimestamp(idElement, totalTime) // Convert end timestamp
-		timeElementEnd.SetText(tse)
-		trackPtElementEnd.AddChild(timeElementEnd)
-		distMetElementEnd := etree.NewElement("DistanceMeters")
-		distMetElementEnd.SetText(distMeters)
-		trackPtElementEnd.AddChild(distMetElementEnd)
-	}
-
-	// modify TCX in case Treadmill or Weights, add device name
-	if (actName == "Treadmill") || (actName == "Weights") {
-		// Navigate to the root element
-		root := xmlDoc.SelectElement("TrainingCenterDatabase").SelectElement("Activities").SelectElement("Activity").SelectElement("Creator")
-		nameElement := etree.NewElement("Name")
-		nameElement.SetText("Fitbit")
-		root.AddChild(nameElement)
+	// modify TCX in case Swim, create a lap per pool length (a single lap when unknown), each with a start and an end point.
+	// Activities without laps, e.g. logged manually, get a single lap of their summary the same way
+	mapping := config.sportMapping(activity)
+	swim := mapping.has(recipePoolLengths)
+	summaryLaps := swim || len(root.Laps) == 0
+	if summaryLaps {
+		if root.ID == "" {
+			return "", fmt.Errorf("TCX activity has no Id")
+		}
+
+		// Fitbit only logs the number of lengths, the time and calories are split evenly
+		laps := 1
+		if swim {
+			laps = max(lengths, 1)
+		}
+		for i := 0; i < laps; i++ {
+			start, end := totalTime*time.Duration(i)/time.Duration(laps), totalTime*time.Duration(i+1)/time.Duration(laps)
+			startDist, endDist := distMeters*float64(i)/float64(laps), distMeters*float64(i+1)/float64(laps)
+			lapCalories := calories*(i+1)/laps - calories*i/laps
+			root.Laps = append(root.Laps, summaryLap(root.ID, start, end, startDist, endDist, lapCalories, laps > 1))
+		}
+	}
+
+	// Sport of the sport mapping, built in (Swim) or configured in config.yaml
+	if mapping.sport != "" {
+		root.Sport = mapping.sport
+	}
+
+	// add the recording device, in case of the summary laps or the fitbit-creator recipe (Treadmill, Weights) at least the name Fitbit
+	if device != nil {
+		root.Creator = deviceCreator(*device)
+	} else if (summaryLaps || mapping.has(recipeFitbitCreator)) && root.Creator.Name == "" {
+		root.Creator.Name = "Fitbit"
 	}
 
+	if err := setTcxDocument(xmlDoc, db); err != nil {
+		return "", err
+	}
 	xmlDoc.Indent(2)
 	xmlString, err := xmlDoc.WriteToString()
 	if err != nil {
-		log.Fatalf("Failed to write XML to string: %v", err)
+		return "", fmt.Errorf("failed to write XML to string: %s", err)
+	}
+	return xmlString, nil
+}
+
+// Reads the TCX document into the typed model of the tcx package
+func parseTcxDocument(xmlDoc *etree.Document) (*tcx.TrainingCenterDatabase, error) {
+	source, err := xmlDoc.WriteToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write XML: %s", err)
+	}
+	return tcx.Parse(source)
+}
+
+// Replaces the content of the TCX document with the typed model, its XML declaration is kept
+func setTcxDocument(xmlDoc *etree.Document, db *tcx.TrainingCenterDatabase) error {
+	modified, err := db.Marshal()
+	if err != nil {
+		return err
+	}
+	modifiedDoc := etree.NewDocument()
+	if err := modifiedDoc.ReadFromBytes(modified); err != nil {
+		return fmt.Errorf("failed to parse XML: %s", err)
+	}
+	xmlDoc.SetRoot(modifiedDoc.Root())
+	return nil
+}
+
+// Returns a lap of the activity summary, from start to end after the start of the activity (its Id), with a start and
+// an end point. A lap per pool length is triggered by the distance, a single lap of the whole activity manually
+func summaryLap(id string, start time.Duration, end time.Duration, startDist float64, endDist float64, calories int, perLength bool) tcx.Lap {
+	triggerMethod := "Manual"
+	if perLength {
+		triggerMethod = "Distance"
+	}
+	tss, _ := convertTimestamp(id, start) // Convert start timestamp
+	tse, _ := convertTimestamp(id, end)   // Convert end timestamp
+	return tcx.Lap{
+		StartTime:        tss,
+		TotalTimeSeconds: (end - start).Seconds(),
+		DistanceMeters:   endDist - startDist,
+		Calories:         calories,
+		Intensity:        "Active",
+		TriggerMethod:    triggerMethod,
+		Tracks: []tcx.Track{{Trackpoints: []tcx.Trackpoint{
+			{Time: tss, DistanceMeters: &startDist},
+			{Time: tse, DistanceMeters: &endDist},
+		}}},
 	}
-	fmt.Println(string(xmlString))
-	saveToFile(fName+".tcx", []byte(xmlString))
-	// Shut down server
-	go func() {
-		if err := server.Shutdown(context.Background()); err != nil {
-			log.Fatalf("Server Shutdown Failed:%+v", err)
-		}
-		done <- true
-	}()
 }
 
 // Converts the timestamp from RFC3339 to UTC
 func convertTimestamp(timeStamp string, addSecond time.Duration) (string, error) {
 	t, err := time.Parse(time.RFC3339, timeStamp)
 	if err != nil {
-		return "", err
+		// Without offset, the local time of the user, e.g. "2024-09-07T10:00:00.000"
+		var localErr error
+		if t, localErr = time.ParseInLocation("2006-01-02T15:04:05", timeStamp, userLocation); localErr != nil {
+			return "", err
+		}
 	}
 	utcTime := t.UTC()
 	newTime := utcTime.Add(addSecond)
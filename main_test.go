@@ -1,17 +1,27 @@
 package main
 
 import (
+	"FitbitNonLocTcx/data"
+	"bytes"
+	"context"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/beevik/etree"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/fitbit"
@@ -54,7 +64,11 @@ func TestReadCredFile(t *testing.T) {
 				ClientSecret: "test-client-secret",
 				RedirectURL:  "https://test.com/redirect",
 				Scopes:       []string{"activity", "heartrate", "location", "profile"},
-				Endpoint:     fitbit.Endpoint,
+				Endpoint: oauth2.Endpoint{
+					AuthURL:   fitbit.Endpoint.AuthURL,
+					TokenURL:  fitbit.Endpoint.TokenURL,
+					AuthStyle: oauth2.AuthStyleInHeader, // a secret is given, server application
+				},
 			},
 		},
 		{
@@ -133,7 +147,7 @@ func TestReadCredFile(t *testing.T) {
 
 	for _, tc := range testCases {
 		reader := tc.osReaderMock(tc.actualJSON)
-		oauthCfg, err := readCredFile(reader)
+		_, oauthCfg, err := readCredFile(reader, "")
 		if tc.expectedResult {
 			assert.True(t, reflect.DeepEqual(tc.expectedOAuthConfig, oauthCfg))
 			assert.Nil(t, err)
@@ -205,6 +219,21 @@ func TestConvertTimestamp(t *testing.T) {
 	}
 }
 
+func TestConvertTimestampUserLocation(t *testing.T) {
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+
+	// Without offset, the time is local to the user's profile
+	result, err := convertTimestamp("2024-09-07T10:00:00.000", 30*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-09-07T08:00:30Z", result)
+
+	// An offset in the timestamp wins
+	result, err = convertTimestamp("2024-09-07T10:00:00-04:00", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-09-07T14:00:00Z", result)
+}
+
 func TestGenerateCodeChallenge(t *testing.T) {
 	tcTwoVerifier := "testverifier"
 	expectedHashTcTwo := sha256.Sum256([]byte(tcTwoVerifier))
@@ -295,7 +324,7 @@ func TestGetAuthURL(t *testing.T) {
 				Scopes:      []string{"activity", "heartrate", "profile"},
 			},
 			codeChallenge: testCodeChallenge,
-			expectedResult: "https://www.fitbit.com/oauth2/authorize?response_type=token" +
+			expectedResult: "https://www.fitbit.com/oauth2/authorize?response_type=code" +
 				"&client_id=test-client-id" +
 				"&redirect_uri=https%3A%2F%2Ftest.com%2Fredirect" +
 				"&scope=activity+heartrate+profile" +
@@ -307,7 +336,7 @@ func TestGetAuthURL(t *testing.T) {
 			testName:      "FAILURE - Empty Code Challenge",
 			oauthCfg:      &oauth2.Config{ClientID: testClientID, RedirectURL: testRedirectURL, Scopes: []string{"activity"}},
 			codeChallenge: "",
-			expectedResult: "https://www.fitbit.com/oauth2/authorize?response_type=token" +
+			expectedResult: "https://www.fitbit.com/oauth2/authorize?response_type=code" +
 				"&client_id=test-client-id" +
 				"&redirect_uri=https%3A%2F%2Ftest.com%2Fredirect" +
 				"&scope=activity" +
@@ -323,7 +352,7 @@ func TestGetAuthURL(t *testing.T) {
 				Scopes:      []string{"profile"},
 			},
 			codeChallenge: testCodeChallenge,
-			expectedResult: "https://www.fitbit.com/oauth2/authorize?response_type=token" +
+			expectedResult: "https://www.fitbit.com/oauth2/authorize?response_type=code" +
 				"&client_id=" +
 				"&redirect_uri=https%3A%2F%2Ftest.com%2Fredirect" +
 				"&scope=profile" +
@@ -339,7 +368,7 @@ func TestGetAuthURL(t *testing.T) {
 				Scopes:      []string{"heartrate"},
 			},
 			codeChallenge: testCodeChallenge,
-			expectedResult: "https://www.fitbit.com/oauth2/authorize?response_type=token" +
+			expectedResult: "https://www.fitbit.com/oauth2/authorize?response_type=code" +
 				"&client_id=test-client-id" +
 				"&redirect_uri=" +
 				"&scope=heartrate" +
@@ -368,3 +397,893 @@ func TestGetAuthURL(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRedirectInput(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		input         string
+		expectedCode  string
+		expectedState string
+		expectedErr   bool
+	}{
+		{testName: "SUCCESS - full redirect URL", input: "http://localhost:8080/callback?code=abc123&state=xyz#_=_\n", expectedCode: "abc123", expectedState: "xyz"},
+		{testName: "SUCCESS - query string only", input: "code=abc123&state=xyz", expectedCode: "abc123", expectedState: "xyz"},
+		{testName: "SUCCESS - bare code", input: "  abc123 \n", expectedCode: "abc123"},
+		{testName: "FAILURE - empty input", input: "\n", expectedErr: true},
+		{testName: "FAILURE - no code in URL", input: "http://localhost:8080/callback?state=xyz", expectedErr: true},
+		{testName: "FAILURE - authorization denied", input: "http://localhost:8080/callback?error=access_denied&state=xyz", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			code, state, err := parseRedirectInput(tc.input)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedCode, code)
+				assert.Equal(t, tc.expectedState, state)
+			}
+		})
+	}
+}
+
+func TestAuthorizeHeadless(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "abc123" || r.Form.Get("code_verifier") != "testverifier" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","refresh_token":"refresh","expires_in":28800}`))
+	}))
+	defer tokenServer.Close()
+
+	oauthCfg = &oauth2.Config{ClientID: "test-client-id", RedirectURL: "http://localhost:8080/callback", Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}}
+	codeVerifier = "testverifier"
+
+	var out bytes.Buffer
+	tok, err := authorizeHeadless(strings.NewReader("abc123\n"), &out, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "access", tok.AccessToken)
+	assert.Contains(t, out.String(), "state="+oauthState.value)
+
+	// The QR code is printed below the URL
+	out.Reset()
+	_, err = authorizeHeadless(strings.NewReader("abc123\n"), &out, true)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "█")
+
+	// The state of a pasted redirect URL must match the one in the authorization URL
+	out.Reset()
+	_, err = authorizeHeadless(strings.NewReader("http://localhost:8080/callback?code=abc123&state=forged\n"), &out, false)
+	assert.Error(t, err)
+}
+
+func TestCallbackAddr(t *testing.T) {
+	testCases := []struct {
+		testName     string
+		redirectURL  string
+		expectedAddr string
+		expectedPath string
+		expectedErr  bool
+	}{
+		{testName: "SUCCESS - default redirect URL", redirectURL: "http://localhost:8080/callback", expectedAddr: ":8080", expectedPath: "/callback"},
+		{testName: "SUCCESS - custom port and path", redirectURL: "http://127.0.0.1:9000/fitbit/redirect", expectedAddr: ":9000", expectedPath: "/fitbit/redirect"},
+		{testName: "SUCCESS - http without port", redirectURL: "http://localhost", expectedAddr: ":80", expectedPath: "/"},
+		{testName: "SUCCESS - https without port", redirectURL: "https://nas.local/callback", expectedAddr: ":443", expectedPath: "/callback"},
+		{testName: "FAILURE - no host", redirectURL: "/callback", expectedErr: true},
+		{testName: "FAILURE - invalid URL", redirectURL: "http://local host:8080", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			addr, path, err := callbackAddr(tc.redirectURL)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedAddr, addr)
+				assert.Equal(t, tc.expectedPath, path)
+			}
+		})
+	}
+}
+
+func TestNewAuthOptions(t *testing.T) {
+	apiCred := &data.Credentials{CId: "test-client-id", RedirectURL: "http://localhost:8080/callback"}
+
+	// Derived from the redirect URL
+	opts, err := newAuthOptions(apiCred, false, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, authOptions{listenAddr: ":8080", callbackPath: "/callback"}, opts)
+
+	// credentials.json overrides the derived values
+	apiCred.ListenAddr = "127.0.0.1:8080"
+	apiCred.CallbackPath = "/cb"
+	opts, err = newAuthOptions(apiCred, false, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, authOptions{listenAddr: "127.0.0.1:8080", callbackPath: "/cb"}, opts)
+
+	// Flags override credentials.json
+	opts, err = newAuthOptions(apiCred, true, ":9090", "/redirect")
+	assert.NoError(t, err)
+	assert.Equal(t, authOptions{noBrowser: true, listenAddr: ":9090", callbackPath: "/redirect"}, opts)
+}
+
+func TestReadCredFileProfile(t *testing.T) {
+	credJSON := `{
+		"clientID": "test-client-id",
+		"redirectUrl": "https://test.com/redirect",
+		"profiles": {
+			"partner": {"tokenStore": "keychain"},
+			"other-app": {"clientID": "other-client-id", "redirectUrl": "http://localhost:9000/callback"}
+		}
+	}`
+
+	testCases := []struct {
+		testName            string
+		profile             string
+		expectedClientID    string
+		expectedRedirectURL string
+		expectedTokenStore  string
+		expectedErr         bool
+	}{
+		{testName: "SUCCESS - top-level settings", profile: "", expectedClientID: "test-client-id", expectedRedirectURL: "https://test.com/redirect"},
+		{testName: "SUCCESS - profile inherits client", profile: "partner", expectedClientID: "test-client-id", expectedRedirectURL: "https://test.com/redirect", expectedTokenStore: "keychain"},
+		{testName: "SUCCESS - profile with own client", profile: "other-app", expectedClientID: "other-client-id", expectedRedirectURL: "http://localhost:9000/callback"},
+		{testName: "FAILURE - unknown profile", profile: "missing", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			apiCred, oauthCfg, err := readCredFile(strings.NewReader(credJSON), tc.profile)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedClientID, oauthCfg.ClientID)
+			assert.Equal(t, tc.expectedRedirectURL, oauthCfg.RedirectURL)
+			assert.Equal(t, tc.expectedTokenStore, apiCred.TokenStore)
+		})
+	}
+}
+
+func TestReadCredFileEnv(t *testing.T) {
+	credJSON := `{
+		"clientID": "file-client-id",
+		"clientSecret": "file-client-secret",
+		"redirectUrl": "https://test.com/redirect"
+	}`
+
+	// Environment variables take precedence over the file
+	t.Setenv("FITBIT_CLIENT_ID", "env-client-id")
+	t.Setenv("FITBIT_CLIENT_SECRET", "")
+	t.Setenv("FITBIT_REDIRECT_URL", "http://localhost:9000/callback")
+	_, oauthCfg, err := readCredFile(strings.NewReader(credJSON), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "env-client-id", oauthCfg.ClientID)
+	assert.Equal(t, "file-client-secret", oauthCfg.ClientSecret)
+	assert.Equal(t, "http://localhost:9000/callback", oauthCfg.RedirectURL)
+
+	// No credentials file at all
+	_, oauthCfg, err = readCredFile(strings.NewReader("{}"), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "env-client-id", oauthCfg.ClientID)
+}
+
+func TestAPIGetReauthenticates(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "refresh" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"new-access","token_type":"Bearer","refresh_token":"new-refresh","expires_in":28800}`))
+	}))
+	defer tokenServer.Close()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer new-access":
+			w.Write([]byte(`{"activities":[]}`))
+		case "Bearer broken":
+			http.Error(w, `{"errors":[{"errorType":"system"}]}`, http.StatusInternalServerError)
+		default:
+			http.Error(w, `{"errors":[{"errorType":"expired_token"}]}`, http.StatusUnauthorized)
+		}
+	}))
+	defer apiServer.Close()
+	stubSleep(t) // The server errors are retried
+
+	oauthCfg = &oauth2.Config{ClientID: "test-client-id", Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}}
+	tokens = fileTokenStore{fileName: filepath.Join(t.TempDir(), "token.json")}
+
+	// Expired access token is refreshed, the request retried and the new token cached
+	token = &oauth2.Token{AccessToken: "old-access", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+	body, err := apiGet(apiServer.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"activities":[]}`, string(body))
+	assert.Equal(t, "new-access", token.AccessToken)
+	cached, err := tokens.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "new-refresh", cached.RefreshToken)
+
+	// Other errors are returned without re-authentication
+	token = &oauth2.Token{AccessToken: "broken", RefreshToken: "refresh"}
+	_, err = apiGet(apiServer.URL)
+	assert.Error(t, err)
+	assert.Equal(t, "broken", token.AccessToken)
+}
+
+func TestWaitForToken(t *testing.T) {
+	ch := make(chan authResult, 1)
+
+	ch <- authResult{token: &oauth2.Token{AccessToken: "access"}}
+	tok, err := waitForToken(ch, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "access", tok.AccessToken)
+
+	_, err = waitForToken(ch, 10*time.Millisecond)
+	assert.Error(t, err)
+
+	ch <- authResult{token: &oauth2.Token{AccessToken: "no-timeout"}}
+	tok, err = waitForToken(ch, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "no-timeout", tok.AccessToken)
+
+	ch <- authResult{err: errors.New("state mismatch")}
+	_, err = waitForToken(ch, time.Second)
+	assert.Error(t, err)
+}
+
+func TestReadCredFileEndpoints(t *testing.T) {
+	credJSON := `{
+		"clientID": "test-client-id",
+		"redirectUrl": "http://localhost:8080/callback",
+		"authUrl": "http://localhost:9999/oauth2/authorize",
+		"tokenUrl": "http://localhost:9999/oauth2/token"
+	}`
+
+	_, oauthCfg, err := readCredFile(strings.NewReader(credJSON), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:9999/oauth2/authorize", oauthCfg.Endpoint.AuthURL)
+	assert.Equal(t, "http://localhost:9999/oauth2/token", oauthCfg.Endpoint.TokenURL)
+
+	authURL, err := url.Parse(getAuthURL("testCodeChallenge", oauthCfg))
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:9999", authURL.Host)
+	assert.Equal(t, "/oauth2/authorize", authURL.Path)
+
+	// Fitbit's endpoints are used by default
+	authURL, err = url.Parse(getAuthURL("testCodeChallenge", &oauth2.Config{ClientID: "test-client-id"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "www.fitbit.com", authURL.Host)
+}
+
+func TestNewAuthOptionsTLS(t *testing.T) {
+	apiCred := &data.Credentials{CId: "test-client-id", RedirectURL: "https://nas.local:8443/callback", TLSCert: "cert.pem", TLSKey: "key.pem"}
+
+	opts, err := newAuthOptions(apiCred, false, "", "")
+	assert.NoError(t, err)
+	assert.True(t, opts.tls)
+	assert.Equal(t, ":8443", opts.listenAddr)
+	assert.Equal(t, "nas.local", opts.tlsHost)
+	assert.Equal(t, "cert.pem", opts.tlsCert)
+	assert.Equal(t, "key.pem", opts.tlsKey)
+}
+
+func TestGenerateSelfSignedCert(t *testing.T) {
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		t.Run(host, func(t *testing.T) {
+			cert, err := generateSelfSignedCert(host)
+			assert.NoError(t, err)
+
+			parsed, err := x509.ParseCertificate(cert.Certificate[0])
+			assert.NoError(t, err)
+			assert.NoError(t, parsed.VerifyHostname(host))
+			assert.True(t, parsed.NotAfter.After(time.Now()))
+		})
+	}
+}
+
+func TestTokenAuthStyle(t *testing.T) {
+	testCases := []struct {
+		testName          string
+		appType           string
+		clientSecret      string
+		expectedAuthStyle oauth2.AuthStyle
+		expectedErr       bool
+	}{
+		{testName: "SUCCESS - detected client application", expectedAuthStyle: oauth2.AuthStyleInParams},
+		{testName: "SUCCESS - detected server application", clientSecret: "secret", expectedAuthStyle: oauth2.AuthStyleInHeader},
+		{testName: "SUCCESS - personal application", appType: "personal", clientSecret: "secret", expectedAuthStyle: oauth2.AuthStyleInParams},
+		{testName: "SUCCESS - server application", appType: "Server", clientSecret: "secret", expectedAuthStyle: oauth2.AuthStyleInHeader},
+		{testName: "FAILURE - server application without secret", appType: "server", expectedErr: true},
+		{testName: "FAILURE - unknown application type", appType: "desktop", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			authStyle, err := tokenAuthStyle(&data.Credentials{AppType: tc.appType, CSecret: tc.clientSecret})
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedAuthStyle, authStyle)
+			}
+		})
+	}
+}
+
+func TestServerAppTokenExchange(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "test-client-id" || clientSecret != "test-client-secret" || r.Form.Get("client_secret") != "" {
+			http.Error(w, `{"errors":[{"errorType":"invalid_client"}]}`, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","refresh_token":"refresh","expires_in":28800}`))
+	}))
+	defer tokenServer.Close()
+
+	credJSON := `{
+		"clientID": "test-client-id",
+		"clientSecret": "test-client-secret",
+		"redirectUrl": "http://localhost:8080/callback",
+		"appType": "server",
+		"tokenUrl": "` + tokenServer.URL + `"
+	}`
+
+	var err error
+	_, oauthCfg, err = readCredFile(strings.NewReader(credJSON), "")
+	assert.NoError(t, err)
+	codeVerifier = "testverifier"
+
+	tok, err := exchangeCode(context.Background(), "abc123", "testverifier")
+	assert.NoError(t, err)
+	assert.Equal(t, "access", tok.AccessToken)
+}
+
+func TestExchangeCodeSendsVerifier(t *testing.T) {
+	var form url.Values
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","refresh_token":"refresh","expires_in":28800}`))
+	}))
+	defer tokenServer.Close()
+	oauthCfg = &oauth2.Config{ClientID: "test-client-id", RedirectURL: "http://localhost:8080/callback", Endpoint: oauth2.Endpoint{AuthURL: "https://www.fitbit.com/oauth2/authorize", TokenURL: tokenServer.URL}}
+
+	verifier, err := generateCodeVerifier(43)
+	assert.NoError(t, err)
+	challenge, err := generateCodeChallenge(verifier)
+	assert.NoError(t, err)
+	authURL, err := url.Parse(getAuthURL(challenge, oauthCfg))
+	assert.NoError(t, err)
+
+	_, err = exchangeCode(context.Background(), "abc123", verifier)
+	assert.NoError(t, err)
+	assert.Equal(t, "authorization_code", form.Get("grant_type"))
+	assert.Equal(t, "abc123", form.Get("code"))
+	assert.Equal(t, verifier, form.Get("code_verifier"))
+
+	// The verifier sent to the token endpoint must match the challenge of the authorization URL
+	hash := sha256.Sum256([]byte(form.Get("code_verifier")))
+	assert.Equal(t, authURL.Query().Get("code_challenge"), base64.RawURLEncoding.EncodeToString(hash[:]))
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+
+	// Without a verifier the exchange is not attempted
+	form = nil
+	_, err = exchangeCode(context.Background(), "abc123", "")
+	assert.Error(t, err)
+	assert.Nil(t, form)
+}
+
+func TestAuthState(t *testing.T) {
+	var state authState
+	assert.Error(t, state.validate(""), "no authorization in progress")
+
+	// Single-use
+	value := state.issue("state-1")
+	assert.NoError(t, state.validate(value))
+	assert.Error(t, state.validate(value))
+
+	// Mismatch consumes the state too
+	state.issue("state-2")
+	assert.Error(t, state.validate("forged"))
+	assert.Error(t, state.validate("state-2"))
+
+	// Expired
+	state.issue("state-3")
+	state.expires = time.Now().Add(-time.Second)
+	assert.Error(t, state.validate("state-3"))
+}
+
+func TestHandleOAuth2Callback(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","refresh_token":"refresh","expires_in":28800}`))
+	}))
+	defer tokenServer.Close()
+	oauthCfg = &oauth2.Config{ClientID: "test-client-id", Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}}
+
+	callback := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleOAuth2Callback(rec, httptest.NewRequest("GET", "/callback?"+query, nil))
+		return rec
+	}
+
+	// Successful callback, a repeated one is rejected and does not override the result
+	state := oauthState.issue("valid-state")
+	assert.Equal(t, http.StatusOK, callback("code=abc123&state="+state).Code)
+	assert.Equal(t, http.StatusBadRequest, callback("code=abc123&state="+state).Code)
+	result := <-authResultCh
+	assert.NoError(t, result.err)
+	assert.Equal(t, "access", result.token.AccessToken)
+
+	// Mismatching state fails the flow
+	oauthState.issue("valid-state")
+	assert.Equal(t, http.StatusBadRequest, callback("code=abc123&state=forged").Code)
+	result = <-authResultCh
+	assert.Error(t, result.err)
+
+	// Denied authorization fails the flow
+	state = oauthState.issue("valid-state")
+	assert.Equal(t, http.StatusBadRequest, callback("error=access_denied&state="+state).Code)
+	result = <-authResultCh
+	assert.Error(t, result.err)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// Routes the requests of the shared HTTP client, sent to api.fitbit.com, to the handler
+func stubFitbitAPI(t *testing.T, handler http.Handler) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	target, _ := url.Parse(server.URL)
+	transport := httpClient.Transport
+	httpClient.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		r = r.Clone(r.Context())
+		r.URL.Scheme = target.Scheme
+		r.URL.Host = target.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	t.Cleanup(func() { httpClient.Transport = transport })
+}
+
+const testActivityTcx = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase><Activities><Activity Sport="Other"><Id>2024-09-07T10:00:00.000+02:00</Id><Creator/></Activity></Activities></TrainingCenterDatabase>`
+
+func TestFetchActivityDataAll(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/user/-/activities/date/2024-09-07.json":
+			w.Write([]byte(`{"activities":[
+				{"activityParentName":"Treadmill","logId":1,"duration":600000,"startDate":"2024-09-07","startTime":"10:00"},
+				{"activityParentName":"Weights","logId":2,"duration":1200000,"startDate":"2024-09-07","startTime":"18:00"}]}`))
+		case "/1/user/-/activities/1.tcx", "/1/user/-/activities/2.tcx":
+			w.Write([]byte(testActivityTcx))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+
+	assert.NoError(t, fetchActivityData([]string{"2024-09-07"}, exportOptions{all: true}))
+
+	assert.FileExists(t, filepath.Join(outputDir, "Treadmill-1.tcx"))
+	assert.FileExists(t, filepath.Join(outputDir, "Weights-2.tcx"))
+}
+
+func TestFetchActivityRange(t *testing.T) {
+	var requested []string
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/user/-/activities/date/2024-09-07.json":
+			w.Write([]byte(`{"activities":[{"activityParentName":"Treadmill","logId":1,"duration":600000}]}`))
+		case "/1/user/-/activities/1.tcx":
+			w.Write([]byte(testActivityTcx))
+		default:
+			w.Write([]byte(`{"activities":[]}`))
+		}
+		requested = append(requested, r.URL.Path)
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+
+	start, end, err := parseDateRange("2024-08-31", "2024-09-07", time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, fetchActivityRange(start, end, exportOptions{all: true}))
+
+	assert.Len(t, requested, 9) // 8 days and one activity
+	assert.Equal(t, "/1/user/-/activities/date/2024-08-31.json", requested[0])
+	assert.FileExists(t, filepath.Join(outputDir, "Treadmill-1.tcx"))
+}
+
+func TestFetchActivityRangeFromList(t *testing.T) {
+	var requested []string
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/user/-/activities/list.json":
+			w.Write([]byte(`{"activities":[
+				{"logId":1,"activityName":"Treadmill","duration":600000,"startTime":"2024-09-07T10:00:00.000+02:00"},
+				{"logId":2,"activityName":"Weights","duration":1200000,"startTime":"2024-09-09T18:00:00.000+02:00"}],
+				"pagination":{"next":""}}`))
+		case "/1/user/-/activities/1.tcx":
+			w.Write([]byte(testActivityTcx))
+		default:
+			http.NotFound(w, r)
+		}
+		requested = append(requested, r.URL.Path)
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() {
+		outputDir = ""
+		activityLogCache.days = map[string]map[int64]data.ActivityLog{}
+	}()
+
+	start, end, err := parseDateRange("2024-08-31", "2024-09-07", time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, fetchActivityRange(start, end, exportOptions{all: true, fileTemplate: "{date}-{sport}", fromList: true}))
+
+	assert.Equal(t, []string{"/1/user/-/activities/list.json", "/1/user/-/activities/1.tcx"}, requested)
+	assert.FileExists(t, filepath.Join(outputDir, "2024-09-07-Treadmill.tcx"))
+}
+
+func TestFilterActivities(t *testing.T) {
+	activities := []data.Activity{
+		{ActivityParentName: "Swim", Name: "Swim", LogID: 1},
+		{ActivityID: 20047, ActivityParentID: 20047, ActivityParentName: "Laufband", Name: "Laufband", LogID: 2},
+		{ActivityParentName: "Weights", Name: "Weights", LogID: 3},
+		{ActivityParentName: "Walk", Name: "Walk", LogID: 4},
+	}
+	logIDs := func(activities []data.Activity) []int64 {
+		var ids []int64
+		for _, activity := range activities {
+			ids = append(ids, activity.LogID)
+		}
+		return ids
+	}
+
+	testCases := []struct {
+		testName       string
+		opts           exportOptions
+		expectedLogIDs []int64
+	}{
+		{testName: "SUCCESS - no filter", opts: exportOptions{}, expectedLogIDs: []int64{1, 2, 3, 4}},
+		{testName: "SUCCESS - types", opts: exportOptions{types: []string{"Swim", "weights"}}, expectedLogIDs: []int64{1, 3}},
+		{testName: "SUCCESS - excluded types", opts: exportOptions{excludeTypes: []string{"Walk"}}, expectedLogIDs: []int64{1, 2, 3}},
+		{testName: "SUCCESS - exclusion wins", opts: exportOptions{types: []string{"Swim", "Walk"}, excludeTypes: []string{"Walk"}}, expectedLogIDs: []int64{1}},
+		{testName: "SUCCESS - activity ID", opts: exportOptions{types: []string{"20047"}}, expectedLogIDs: []int64{2}},
+		{testName: "SUCCESS - no match", opts: exportOptions{types: []string{"Yoga"}}, expectedLogIDs: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedLogIDs, logIDs(filterActivities(activities, tc.opts)))
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"Swim", "Treadmill", "Weights"}, splitList("Swim, Treadmill,,Weights "))
+	assert.Nil(t, splitList(""))
+}
+
+func TestActivityFileName(t *testing.T) {
+	activity := data.Activity{ActivityParentName: "Swim", LogID: 12345, StartDate: "2024-09-07", StartTime: "18:30"}
+
+	testCases := []struct {
+		testName         string
+		template         string
+		expectedFileName string
+	}{
+		{testName: "SUCCESS - default", template: "", expectedFileName: "Swim-12345"},
+		{testName: "SUCCESS - all placeholders", template: "{date}_{start_time}_{sport}_{logid}", expectedFileName: "2024-09-07_18-30_Swim_12345"},
+		{testName: "SUCCESS - subdirectory", template: "{date}/{sport}", expectedFileName: "2024-09-07/Swim"},
+		{testName: "SUCCESS - extension", template: "{logid}.tcx", expectedFileName: "12345"},
+		{testName: "SUCCESS - date parts", template: "{year}/{month}/{day}-{sport}", expectedFileName: "2024/09/07-Swim"},
+		{testName: "SUCCESS - directory template", template: "{year}/{month}/{sport}/", expectedFileName: "2024/09/Swim/Swim-12345"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedFileName, activityFileName(tc.template, activity))
+		})
+	}
+
+	// Values cannot add directories
+	assert.Equal(t, "Bike_Cycling-1", activityFileName("", data.Activity{ActivityParentName: "Bike/Cycling", LogID: 1}))
+}
+
+func TestValidateFileTemplate(t *testing.T) {
+	assert.NoError(t, validateFileTemplate(defaultFileTemplate))
+	assert.NoError(t, validateFileTemplate("{date}/{sport}-{start_time}"))
+	assert.NoError(t, validateFileTemplate("{year}/{month}/{sport}/"))
+	assert.Error(t, validateFileTemplate("{sport}-{id}"))
+	assert.Error(t, validateFileTemplate(""))
+}
+
+func TestResolveConflict(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "Swim-1.tcx")
+	assert.NoError(t, os.WriteFile(existing, []byte("edited"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Swim-1-1.tcx"), []byte("uploaded"), 0644))
+	missing := filepath.Join(dir, "Swim-2.tcx")
+	// The longest file name, with the number of a renamed export it is too long
+	longest := filepath.Join(dir, strings.Repeat("S", 251)+".tcx")
+	assert.NoError(t, os.WriteFile(longest, []byte("edited"), 0644))
+
+	testCases := []struct {
+		testName         string
+		fileName         string
+		policy           conflictPolicy
+		expectedFileName string
+		expectedSkip     bool
+		expectedErr      bool
+	}{
+		{testName: "SUCCESS - new file", fileName: missing, policy: conflictSkip, expectedFileName: missing},
+		{testName: "SUCCESS - overwrite", fileName: existing, policy: conflictOverwrite, expectedFileName: existing},
+		{testName: "SUCCESS - skip", fileName: existing, policy: conflictSkip, expectedFileName: existing, expectedSkip: true},
+		{testName: "SUCCESS - rename", fileName: existing, policy: conflictRename, expectedFileName: filepath.Join(dir, "Swim-1-2.tcx")},
+		{testName: "FAILURE - invalid file name", fileName: filepath.Join(dir, "Swim\x00.tcx"), policy: conflictSkip, expectedErr: true},
+		{testName: "FAILURE - renamed file name too long", fileName: longest, policy: conflictRename, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			fileName, skip, err := resolveConflict(tc.fileName, tc.policy)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedFileName, fileName)
+				assert.Equal(t, tc.expectedSkip, skip)
+			}
+		})
+	}
+}
+
+func TestNewConflictPolicy(t *testing.T) {
+	policy, err := newConflictPolicy(false, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, conflictSkip, policy)
+	policy, err = newConflictPolicy(false, true, false)
+	assert.NoError(t, err)
+	assert.Equal(t, conflictSkip, policy)
+	policy, err = newConflictPolicy(true, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, conflictOverwrite, policy)
+	_, err = newConflictPolicy(true, false, true)
+	assert.Error(t, err)
+}
+
+func TestExportActivitiesSkipExisting(t *testing.T) {
+	downloads := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write([]byte(testActivityTcx))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, "Treadmill-1.tcx"), []byte("edited"), 0644))
+	activities := []data.Activity{{ActivityParentName: "Treadmill", LogID: 1}, {ActivityParentName: "Weights", LogID: 2}}
+
+	assert.NoError(t, exportActivities(activities, exportOptions{onConflict: conflictSkip}))
+	assert.Equal(t, 1, downloads)
+	byteValue, _ := os.ReadFile(filepath.Join(outputDir, "Treadmill-1.tcx"))
+	assert.Equal(t, "edited", string(byteValue))
+
+	// By default existing files are skipped too, running the export again succeeds without downloading them
+	assert.NoError(t, exportActivities(activities, exportOptions{}))
+	assert.Equal(t, 1, downloads)
+	byteValue, _ = os.ReadFile(filepath.Join(outputDir, "Treadmill-1.tcx"))
+	assert.Equal(t, "edited", string(byteValue))
+}
+
+func TestExportActivityStdout(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testActivityTcx))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+	var stdout bytes.Buffer
+
+	activities := []data.Activity{{ActivityParentName: "Treadmill", LogID: 1, Duration: 600000}}
+	assert.NoError(t, exportActivities(activities, exportOptions{fileTemplate: defaultFileTemplate, stdout: &stdout}))
+
+	assert.Contains(t, stdout.String(), "<Name>Fitbit</Name>")
+	assert.NoFileExists(t, filepath.Join(outputDir, "Treadmill-1.tcx"))
+}
+
+func TestPrintActivityChoices(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, printActivityChoices(&out, []data.Activity{
+		{Name: "Swim", StartDate: "2024-09-07", StartTime: "07:00", Duration: 1800000, Distance: 1.5, Calories: 300},
+		{Name: "Outdoor Bike", StartDate: "2024-09-07", StartTime: "18:30", Duration: 3600000, Distance: 25, Calories: 700, HasActiveZoneMinutes: true},
+	}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "#  SPORT         START             DURATION  DISTANCE  CALORIES  HR", lines[0])
+	assert.Equal(t, "1  Swim          2024-09-07 07:00  30m0s     1.50      300       false", lines[1])
+	assert.Equal(t, "2  Outdoor Bike  2024-09-07 18:30  1h0m0s    25.00     700       true", lines[2])
+}
+
+func TestParseSelection(t *testing.T) {
+	testCases := []struct {
+		testName string
+		input    string
+		expected []int
+		wantErr  bool
+	}{
+		{"SUCCESS - Single number", "2\n", []int{2}, false},
+		{"SUCCESS - List and range", "1,3,5-7", []int{1, 3, 5, 6, 7}, false},
+		{"SUCCESS - Spaces and duplicates", " 3 , 1-3 ", []int{3, 1, 2}, false},
+		{"FAILURE - Empty", "", nil, true},
+		{"FAILURE - Out of range", "1,8", nil, true},
+		{"FAILURE - Zero", "0", nil, true},
+		{"FAILURE - Reversed range", "5-3", nil, true},
+		{"FAILURE - Not a number", "a-b", nil, true},
+		{"FAILURE - Empty item", "1,,2", nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			choices, err := parseSelection(tc.input, 7)
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.expected, choices)
+		})
+	}
+}
+
+func TestFetchActivityDataSelect(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/user/-/activities/date/2024-09-07.json":
+			w.Write([]byte(`{"activities":[
+				{"activityParentName":"Treadmill","logId":1,"startDate":"2024-09-07","startTime":"10:00"},
+				{"activityParentName":"Weights","logId":2,"startDate":"2024-09-07","startTime":"12:00"},
+				{"activityParentName":"Swim","logId":3,"startDate":"2024-09-07","startTime":"18:00"}]}`))
+		default:
+			w.Write([]byte(testActivityTcx))
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+	console = io.Discard
+	defer func() { console = os.Stdout }()
+
+	assert.NoError(t, fetchActivityData([]string{"2024-09-07"}, exportOptions{fileTemplate: defaultFileTemplate, selection: "1,3"}))
+
+	assert.FileExists(t, filepath.Join(outputDir, "Treadmill-1.tcx"))
+	assert.NoFileExists(t, filepath.Join(outputDir, "Weights-2.tcx"))
+	assert.FileExists(t, filepath.Join(outputDir, "Swim-3.tcx"))
+}
+
+func TestInjectActivityTcxSwimLengths(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		lengths       int
+		expectedLaps  int
+		triggerMethod string
+	}{
+		{"SUCCESS - Lap per length", 4, 4, "Distance"},
+		{"SUCCESS - Single lap without lengths", 0, 1, "Manual"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			xmlDoc := etree.NewDocument()
+			assert.NoError(t, xmlDoc.ReadFromString(testActivityTcx))
+
+			_, err := injectActivityTcx(xmlDoc, data.Activity{ActivityParentID: activityTypeSwim, ActivityParentName: "Schwimmen"}, 8*time.Minute, 100, 40, tc.lengths, nil)
+			assert.NoError(t, err)
+
+			laps := xmlDoc.FindElements("//Lap")
+			assert.Len(t, laps, tc.expectedLaps)
+			for _, lap := range laps {
+				assert.Equal(t, tc.triggerMethod, lap.SelectElement("TriggerMethod").Text())
+				assert.Equal(t, strconv.FormatFloat(100/float64(tc.expectedLaps), 'f', -1, 64), lap.SelectElement("DistanceMeters").Text())
+				assert.Len(t, lap.FindElements("Track/Trackpoint"), 2)
+			}
+			assert.Equal(t, "2024-09-07T08:00:00Z", laps[0].SelectAttr("StartTime").Value)
+		})
+	}
+}
+
+func TestInjectActivityTcxSummaryLap(t *testing.T) {
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(testActivityTcx))
+
+	_, err := injectActivityTcx(xmlDoc, data.Activity{ActivityParentID: 52001, ActivityParentName: "Yoga"}, 45*time.Minute, 0, 120, 0, nil)
+	assert.NoError(t, err)
+
+	activity := xmlDoc.FindElement("//Activity")
+	assert.Equal(t, "Other", activity.SelectAttrValue("Sport", ""))
+	laps := activity.SelectElements("Lap")
+	assert.Len(t, laps, 1)
+	assert.Less(t, laps[0].Index(), activity.SelectElement("Creator").Index())
+	assert.Equal(t, "2700", laps[0].SelectElement("TotalTimeSeconds").Text())
+	assert.Equal(t, "120", laps[0].SelectElement("Calories").Text())
+	assert.Equal(t, "Manual", laps[0].SelectElement("TriggerMethod").Text())
+	assert.Equal(t, "Fitbit", activity.FindElement("Creator/Name").Text())
+}
+
+func TestInjectActivityTcxUnexpectedShape(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		document      string
+		expectedError string
+	}{
+		{"FAILURE - No activities", `<TrainingCenterDatabase/>`, "TCX has no activity with creator"},
+		{"FAILURE - No creator", `<TrainingCenterDatabase><Activities><Activity><Id>2024-09-07T10:00:00Z</Id></Activity></Activities></TrainingCenterDatabase>`, "TCX has no activity with creator"},
+		{"FAILURE - No Id", `<TrainingCenterDatabase><Activities><Activity><Creator/></Activity></Activities></TrainingCenterDatabase>`, "TCX activity has no Id"},
+		{"FAILURE - Invalid lap", `<TrainingCenterDatabase><Activities><Activity><Lap><TotalTimeSeconds>long</TotalTimeSeconds></Lap><Creator/></Activity></Activities></TrainingCenterDatabase>`, "failed to parse TCX"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			xmlDoc := etree.NewDocument()
+			assert.NoError(t, xmlDoc.ReadFromString(tc.document))
+
+			_, err := injectActivityTcx(xmlDoc, data.Activity{ActivityParentID: 52001, ActivityParentName: "Yoga"}, 45*time.Minute, 0, 120, 0, nil)
+			assert.ErrorContains(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestGetActivityTcxPartial(t *testing.T) {
+	const lapOnlyTcx = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase><Activities><Activity Sport="Other"><Id>2024-09-07T10:00:00.000+02:00</Id>` +
+		`<Lap StartTime="2024-09-07T10:00:00.000+02:00"><TotalTimeSeconds>600</TotalTimeSeconds><Calories>80</Calories></Lap><Creator/></Activity></Activities></TrainingCenterDatabase>`
+	partialTcx := strings.Replace(lapOnlyTcx, "</Lap>", "<Track><Trackpoint><Time>2024-09-07T10:00:00.000+02:00</Time></Trackpoint></Track></Lap>", 1)
+	testCases := []struct {
+		testName      string
+		partial       bool
+		expectedQuery string
+		expectedTrack bool
+	}{
+		{"SUCCESS - Partial TCX with track points", true, "includePartialTCX=true", true},
+		{"SUCCESS - Full GPS tracks only, laps without track", false, "includePartialTCX=false", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/1/user/-/activities/12345.tcx", r.URL.Path)
+				assert.Equal(t, tc.expectedQuery, r.URL.RawQuery)
+				if r.URL.Query().Get("includePartialTCX") == "true" {
+					w.Write([]byte(partialTcx))
+					return
+				}
+				w.Write([]byte(lapOnlyTcx))
+			}))
+			token = &oauth2.Token{AccessToken: "access"}
+
+			xmlDoc, err := getActivityTcx(12345, tc.partial)
+			assert.NoError(t, err)
+			assert.False(t, missingTcx(xmlDoc, err))
+			assert.Equal(t, tc.expectedTrack, xmlDoc.FindElement("//Trackpoint") != nil)
+
+			// Both shapes keep their laps
+			_, err = injectActivityTcx(xmlDoc, data.Activity{ActivityID: activityTypeTreadmill, ActivityParentName: "Treadmill"}, 10*time.Minute, 0, 80, 0, nil)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, xmlDoc.FindElements("//Lap"))
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Name of the manifest of the exported files, in the output directory
+const manifestFile = "manifest.json"
+
+// Index of the exported files, updated after every batch export, so sync tools can verify them and detect changes
+type manifest struct {
+	Updated string          `json:"updated"` // RFC 3339 time of the last batch
+	Files   []manifestEntry `json:"files"`   // Sorted by date and file
+}
+
+type manifestEntry struct {
+	File   string `json:"file"` // Relative to the output directory, with forward slashes
+	LogID  int64  `json:"logId"`
+	Sport  string `json:"sport"`
+	Date   string `json:"date"` // YYYY-MM-DD
+	Size   int64  `json:"size"` // Bytes
+	SHA256 string `json:"sha256"`
+}
+
+// Adds the exported files of the batch to the manifest of the directory, replacing the earlier entries of
+// their activities. The files are read back, so the checksums match what is on disk
+func updateManifest(dir string, activities []data.Activity, exported map[int64]string) error {
+	fileName := filepath.Join(dir, manifestFile)
+	var m manifest
+	byteValue, err := os.ReadFile(fileName)
+	if err == nil {
+		if err := json.Unmarshal(byteValue, &m); err != nil {
+			return fmt.Errorf("failed to unmarshal manifest %s: %s", fileName, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read manifest: %s", err)
+	}
+
+	entries := map[int64]manifestEntry{}
+	for _, entry := range m.Files {
+		entries[entry.LogID] = entry
+	}
+	for _, activity := range activities {
+		exportedFile, ok := exported[activity.LogID]
+		if !ok {
+			continue
+		}
+		content, err := os.ReadFile(exportedFile)
+		if err != nil {
+			return fmt.Errorf("failed to read exported file: %s", err)
+		}
+		relative := exportedFile
+		if rel, err := filepath.Rel(filepath.Join(dir, "."), exportedFile); err == nil {
+			relative = rel
+		}
+		entries[activity.LogID] = newManifestEntry(filepath.ToSlash(relative), content, activity)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	m.Updated = time.Now().Format(time.RFC3339)
+	m.Files = m.Files[:0]
+	for _, entry := range entries {
+		m.Files = append(m.Files, entry)
+	}
+	sortManifest(m.Files)
+
+	byteValue, err = json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %s", err)
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return fmt.Errorf("failed to create directory: %s", err)
+		}
+	}
+	// Replace the manifest at once, a sync tool must not read a truncated file
+	tmpFile := fileName + ".tmp"
+	if err := os.WriteFile(tmpFile, byteValue, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %s", err)
+	}
+	return os.Rename(tmpFile, fileName)
+}
+
+// Describes the exported file of the activity, with its size and SHA-256 checksum
+func newManifestEntry(file string, content []byte, activity data.Activity) manifestEntry {
+	sum := sha256.Sum256(content)
+	return manifestEntry{
+		File:   file,
+		LogID:  activity.LogID,
+		Sport:  activity.ActivityParentName,
+		Date:   activity.StartDate,
+		Size:   int64(len(content)),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+}
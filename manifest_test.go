@@ -0,0 +1,62 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func readManifest(t *testing.T) manifest {
+	var m manifest
+	byteValue, err := os.ReadFile(filepath.Join(outputDir, manifestFile))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(byteValue, &m))
+	return m
+}
+
+func TestUpdateManifest(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1/user/-/activities/3.tcx" {
+			http.Error(w, `{"errors":[{"errorType":"system"}]}`, http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(testActivityTcx))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	stubSleep(t) // The server errors are retried
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+	opts := exportOptions{fileTemplate: "{date}/{sport}-{logid}", batch: "2024-09-07"}
+
+	err := exportActivities([]data.Activity{
+		{ActivityParentName: "Weights", LogID: 2, StartDate: "2024-09-07"},
+		{ActivityParentName: "Swim", LogID: 1, StartDate: "2024-09-06"},
+		{ActivityParentName: "Run", LogID: 3, StartDate: "2024-09-07"}, // server error
+	}, opts)
+	assert.Equal(t, exitPartial, exitCode(err))
+
+	m := readManifest(t)
+	assert.NotEmpty(t, m.Updated)
+	assert.Len(t, m.Files, 2)
+	assert.Equal(t, "2024-09-06/Swim-1.tcx", m.Files[0].File)
+	assert.Equal(t, "2024-09-07/Weights-2.tcx", m.Files[1].File)
+	byteValue, _ := os.ReadFile(filepath.Join(outputDir, "2024-09-07", "Weights-2.tcx"))
+	sum := sha256.Sum256(byteValue)
+	assert.Equal(t, manifestEntry{File: "2024-09-07/Weights-2.tcx", LogID: 2, Sport: "Weights", Date: "2024-09-07",
+		Size: int64(len(byteValue)), SHA256: hex.EncodeToString(sum[:])}, m.Files[1])
+
+	// A later batch adds its files to the manifest
+	opts.batch = "2024-09-08"
+	assert.NoError(t, exportActivities([]data.Activity{{ActivityParentName: "Swim", LogID: 4, StartDate: "2024-09-08"}}, opts))
+	m = readManifest(t)
+	assert.Len(t, m.Files, 3)
+	assert.Equal(t, int64(4), m.Files[2].LogID)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"errors"
+	"net/http"
+
+	"github.com/beevik/etree"
+)
+
+// Namespace of the TCX documents
+const tcxNamespace = "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+
+// Tells whether the TCX download gave no activity, as for the manually logged activities (e.g. "Yoga 45 min"),
+// whose TCX is empty or missing
+func missingTcx(xmlDoc *etree.Document, err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.status == http.StatusNotFound
+	}
+	return err == nil && xmlDoc.FindElement("/TrainingCenterDatabase/Activities/Activity") == nil
+}
+
+// Creates the TCX of an activity without one, from its start: an activity with its Id and creator. Its lap,
+// with the duration, distance and calories of the summary, is added by injectActivityTcx like the laps of a swim
+func newActivityTcx(activity data.Activity) (*etree.Document, error) {
+	start, _, err := activityWindow(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	root := doc.CreateElement("TrainingCenterDatabase")
+	root.CreateAttr("xmlns", tcxNamespace)
+	activityElement := root.CreateElement("Activities").CreateElement("Activity")
+	activityElement.CreateAttr("Sport", "Other")
+	activityElement.CreateElement("Id").SetText(start.Format("2006-01-02T15:04:05.000-07:00"))
+	activityElement.CreateElement("Creator")
+	return doc, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestMissingTcx(t *testing.T) {
+	withActivity := etree.NewDocument()
+	assert.NoError(t, withActivity.ReadFromString(testActivityTcx))
+	withoutActivity := etree.NewDocument()
+	assert.NoError(t, withoutActivity.ReadFromString(`<TrainingCenterDatabase><Activities/></TrainingCenterDatabase>`))
+
+	testCases := []struct {
+		testName string
+		xmlDoc   *etree.Document
+		err      error
+		expected bool
+	}{
+		{"SUCCESS - TCX with activity", withActivity, nil, false},
+		{"SUCCESS - TCX without activity", withoutActivity, nil, true},
+		{"SUCCESS - Empty TCX", etree.NewDocument(), nil, true},
+		{"SUCCESS - TCX not found", nil, &apiError{status: http.StatusNotFound}, true},
+		{"SUCCESS - Other API error", nil, &apiError{status: http.StatusInternalServerError}, false},
+		{"SUCCESS - Other error", nil, errors.New("failed to parse XML"), false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, missingTcx(tc.xmlDoc, tc.err))
+		})
+	}
+}
+
+func TestNewActivityTcx(t *testing.T) {
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+
+	xmlDoc, err := newActivityTcx(data.Activity{LogID: 1, StartDate: "2024-09-07", StartTime: "10:00", Duration: 2700000})
+	assert.NoError(t, err)
+	assert.Equal(t, tcxNamespace, xmlDoc.Root().SelectAttrValue("xmlns", ""))
+	assert.Equal(t, "2024-09-07T10:00:00.000+02:00", xmlDoc.FindElement("//Activity/Id").Text())
+	assert.NotNil(t, xmlDoc.FindElement("//Activity/Creator"))
+
+	_, err = newActivityTcx(data.Activity{LogID: 2})
+	assert.Error(t, err)
+}
+
+func TestExportManualActivity(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/user/-/activities/1.tcx":
+			// Empty TCX
+		case "/1/user/-/activities/2.tcx":
+			http.Error(w, `{"errors":[{"errorType":"not_found","message":"The resource does not exist."}]}`, http.StatusNotFound)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+
+	for _, activity := range []data.Activity{
+		{ActivityParentName: "Yoga", LogID: 1, StartDate: "2024-09-07", StartTime: "07:00", Duration: 2700000, Calories: 120},
+		{ActivityParentName: "Weights", LogID: 2, StartDate: "2024-09-07", StartTime: "18:00", Duration: 1800000, Calories: 200},
+	} {
+		fileName, ok := exportActivity(activity, exportOptions{fileTemplate: defaultFileTemplate}, newExportProgress(1))
+		assert.True(t, ok)
+		tcx, err := os.ReadFile(fileName)
+		assert.NoError(t, err)
+		xmlDoc := etree.NewDocument()
+		assert.NoError(t, xmlDoc.ReadFromBytes(tcx))
+		assert.Len(t, xmlDoc.FindElements("//Lap"), 1)
+		assert.Equal(t, filepath.Join(outputDir, fmt.Sprintf("%s-%d.tcx", activity.ActivityParentName, activity.LogID)), fileName)
+	}
+}
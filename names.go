@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/beevik/etree"
+)
+
+// Names given to activities with the edit command, by log ID, nil when not loaded. The Fitbit Web API has no
+// endpoint to update an activity log, so the names are kept locally and applied when exporting
+var activityNames map[int64]string
+
+// Activity to rename, given to the edit command, e.g. edit --log-id 12345 --name "Morning intervals"
+type activityRename struct {
+	logID int64
+	name  string // Empty to remove the name given before
+}
+
+// Returns the location of the activity names, ~/.config/fitbittcx/names.json
+func activityNamesFile() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %s", err)
+	}
+	return filepath.Join(configDir, "fitbittcx", "names.json"), nil
+}
+
+// Parses the flags following the edit command
+func parseEditArgs(args []string) (activityRename, error) {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	logID := fs.Int64("log-id", 0, "log ID of the activity, as shown by list --json")
+	name := fs.String("name", "", "name of the activity in the exported TCX, empty to remove it")
+	if err := fs.Parse(args); err != nil {
+		return activityRename{}, fmt.Errorf("edit: %s", err)
+	}
+	if *logID <= 0 || fs.NArg() != 0 {
+		return activityRename{}, fmt.Errorf("unknown edit command, use: edit --log-id ID --name NAME")
+	}
+	return activityRename{logID: *logID, name: *name}, nil
+}
+
+// Reads the activity names, a missing file has none
+func loadActivityNames(fileName string) (map[int64]string, error) {
+	names := map[int64]string{}
+	byteValue, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return names, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read activity names: %s", err)
+	}
+	if err := json.Unmarshal(byteValue, &names); err != nil {
+		return nil, fmt.Errorf("failed to parse activity names %s: %s", fileName, err)
+	}
+	return names, nil
+}
+
+// Saves the name of the activity, or removes it when empty
+func renameActivity(out io.Writer, fileName string, rename activityRename) error {
+	names, err := loadActivityNames(fileName)
+	if err != nil {
+		return err
+	}
+	if rename.name == "" {
+		delete(names, rename.logID)
+	} else {
+		names[rename.logID] = rename.name
+	}
+
+	byteValue, err := json.MarshalIndent(names, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal activity names: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %s", err)
+	}
+	if err := os.WriteFile(fileName, byteValue, 0600); err != nil {
+		return fmt.Errorf("failed to write activity names: %s", err)
+	}
+
+	if rename.name == "" {
+		fmt.Fprintf(out, "Activity %d exports with its Fitbit name\n", rename.logID)
+	} else {
+		fmt.Fprintf(out, "Activity %d exports as %q\n", rename.logID, rename.name)
+	}
+	return nil
+}
+
+// Writes the name given to the activity into the notes of its TCX, which training platforms show as its title
+// or description. Returns the name, empty when the activity keeps its Fitbit name
+func addActivityName(xmlDoc *etree.Document, logID int64) string {
+	name := activityNames[logID]
+	if name != "" {
+		addActivityNotes(xmlDoc, name)
+	}
+	return name
+}
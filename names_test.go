@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEditArgs(t *testing.T) {
+	testCases := []struct {
+		testName string
+		args     []string
+		expected activityRename
+		err      bool
+	}{
+		{"SUCCESS - Rename", []string{"--log-id", "12345", "--name", "Morning intervals"}, activityRename{12345, "Morning intervals"}, false},
+		{"SUCCESS - Remove the name", []string{"--log-id", "12345"}, activityRename{12345, ""}, false},
+		{"FAILURE - Without log ID", []string{"--name", "Morning intervals"}, activityRename{}, true},
+		{"FAILURE - Invalid log ID", []string{"--log-id", "abc"}, activityRename{}, true},
+		{"FAILURE - Extra argument", []string{"--log-id", "12345", "2024-09-07"}, activityRename{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			rename, err := parseEditArgs(tc.args)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.expected, rename)
+		})
+	}
+}
+
+func TestRenameActivity(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "fitbittcx", "names.json")
+	var out bytes.Buffer
+
+	names, err := loadActivityNames(fileName)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+
+	assert.NoError(t, renameActivity(&out, fileName, activityRename{1, "Morning intervals"}))
+	assert.NoError(t, renameActivity(&out, fileName, activityRename{2, "Hill repeats"}))
+	assert.NoError(t, renameActivity(&out, fileName, activityRename{2, ""}))
+	assert.Contains(t, out.String(), `Activity 1 exports as "Morning intervals"`)
+	assert.Contains(t, out.String(), "Activity 2 exports with its Fitbit name")
+
+	names, err = loadActivityNames(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: "Morning intervals"}, names)
+}
+
+func TestAddActivityName(t *testing.T) {
+	activityNames = map[int64]string{1: "Morning intervals"}
+	defer func() { activityNames = nil }()
+
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(testActivityTcx))
+	assert.Equal(t, "Morning intervals", addActivityName(xmlDoc, 1))
+	assert.Equal(t, "Morning intervals", xmlDoc.FindElement("//Activity/Notes").Text())
+
+	xmlDoc = etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(testActivityTcx))
+	assert.Equal(t, "", addActivityName(xmlDoc, 2))
+	assert.Nil(t, xmlDoc.FindElement("//Activity/Notes"))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Runs the notification command, replaced in tests
+var execCommand = exec.Command
+
+// Shows a desktop notification with the result of the export: notify-send on Linux, osascript on macOS,
+// a toast on Windows. A missing notifier is only logged, the export itself succeeded
+func notifyExportFinished(written int, skipped int, failed int, dir string) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	message := fmt.Sprintf("Exported %d activities to %s", written, dir)
+	if skipped > 0 {
+		message += fmt.Sprintf(", %d skipped", skipped)
+	}
+	if failed > 0 {
+		message += fmt.Sprintf(", %d failed", failed)
+	}
+
+	name, args := notificationCommand(runtime.GOOS, "Fitbit export finished", message)
+	if out, err := execCommand(name, args...).CombinedOutput(); err != nil {
+		slog.Warn("Failed to show desktop notification", "command", name, "err", err, "output", strings.TrimSpace(string(out)))
+	}
+}
+
+// Returns the command showing a desktop notification on the operating system
+func notificationCommand(goos string, title string, message string) (string, []string) {
+	switch goos {
+	case "darwin":
+		return "osascript", []string{"-e", fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))}
+	case "windows":
+		script := `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode(` + powerShellString(title) + `)) > $null
+$text.Item(1).AppendChild($template.CreateTextNode(` + powerShellString(message) + `)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('FitbitNonLocTcx').Show([Windows.UI.Notifications.ToastNotification]::new($template))`
+		return "powershell", []string{"-NoProfile", "-NonInteractive", "-Command", script}
+	default:
+		return "notify-send", []string{"--app-name=FitbitNonLocTcx", title, message}
+	}
+}
+
+// Quotes the text as an AppleScript string literal
+func appleScriptString(text string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
+
+// Quotes the text as a PowerShell single-quoted string literal
+func powerShellString(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationCommand(t *testing.T) {
+	name, args := notificationCommand("linux", "Fitbit export finished", "Exported 3 activities to /tcx")
+	assert.Equal(t, "notify-send", name)
+	assert.Equal(t, []string{"--app-name=FitbitNonLocTcx", "Fitbit export finished", "Exported 3 activities to /tcx"}, args)
+
+	name, args = notificationCommand("darwin", "Fitbit export finished", `Exported 3 activities to /tcx/"a"`)
+	assert.Equal(t, "osascript", name)
+	assert.Equal(t, []string{"-e", `display notification "Exported 3 activities to /tcx/\"a\"" with title "Fitbit export finished"`}, args)
+
+	name, args = notificationCommand("windows", "Fitbit export finished", `Exported 3 activities to C:\Users\it's me`)
+	assert.Equal(t, "powershell", name)
+	assert.Contains(t, args[len(args)-1], `CreateTextNode('Exported 3 activities to C:\Users\it''s me')`)
+}
+
+func TestNotifyExportFinished(t *testing.T) {
+	var gotName string
+	var gotArgs []string
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		gotName, gotArgs = name, args
+		return exec.Command("true")
+	}
+	defer func() { execCommand = exec.Command }()
+
+	notifyExportFinished(3, 1, 2, "/tcx")
+	assert.NotEmpty(t, gotName)
+	assert.Contains(t, gotArgs[len(gotArgs)-1], "Exported 3 activities to /tcx, 1 skipped, 2 failed")
+}
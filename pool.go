@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const metersPerYard = 0.9144
+
+// Parses the --pool-length value, the length of the pool in meters or yards, e.g. 25m, 33.33m or 25yd, to meters.
+// 0 when empty
+func parsePoolLength(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	unit := 1.0
+	number, ok := strings.CutSuffix(value, "yd")
+	if ok {
+		unit = metersPerYard
+	} else {
+		number, ok = strings.CutSuffix(value, "m")
+	}
+	length, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil || length <= 0 || math.IsInf(length, 0) {
+		return 0, fmt.Errorf("invalid --pool-length %q, use the length of the pool in meters or yards, e.g. 25m, 33.33m or 25yd", value)
+	}
+	return length * unit, nil
+}
+
+// Returns the pool lengths and the distance in meters of a swim in the pool of the length. The lengths are those of
+// the activity log or, when not logged, the distance of the summary in pool lengths; the distance is that of the
+// lengths, correcting a summary distance in the wrong unit, e.g. yards taken for meters. Without a pool length the
+// logged lengths and the summary distance are kept
+func poolSwim(loggedLengths int, distMeters float64, poolMeters float64) (int, float64) {
+	if poolMeters <= 0 {
+		return loggedLengths, distMeters
+	}
+	lengths := loggedLengths
+	if lengths <= 0 {
+		lengths = int(math.Round(distMeters / poolMeters))
+	}
+	if lengths <= 0 {
+		return 0, distMeters
+	}
+	return lengths, float64(lengths) * poolMeters
+}
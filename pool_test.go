@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePoolLength(t *testing.T) {
+	testCases := []struct {
+		testName       string
+		value          string
+		expectedMeters float64
+		expectedError  string
+	}{
+		{"SUCCESS - None", "", 0, ""},
+		{"SUCCESS - Meters", "25m", 25, ""},
+		{"SUCCESS - Fraction of meters", "33.33m", 33.33, ""},
+		{"SUCCESS - Yards", "25yd", 22.86, ""},
+		{"FAILURE - No unit", "25", 0, `invalid --pool-length "25"`},
+		{"FAILURE - Unknown unit", "25ft", 0, `invalid --pool-length "25ft"`},
+		{"FAILURE - Zero", "0m", 0, `invalid --pool-length "0m"`},
+		{"FAILURE - Negative", "-25m", 0, `invalid --pool-length "-25m"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			meters, err := parsePoolLength(tc.value)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tc.expectedMeters, meters, 1e-9)
+		})
+	}
+}
+
+func TestPoolSwim(t *testing.T) {
+	testCases := []struct {
+		testName         string
+		loggedLengths    int
+		distMeters       float64
+		poolMeters       float64
+		expectedLengths  int
+		expectedDistance float64
+	}{
+		{"SUCCESS - Without pool length", 20, 500, 0, 20, 500},
+		{"SUCCESS - Distance of the logged lengths", 20, 500, 22.86, 20, 457.2},
+		{"SUCCESS - Lengths of the distance", 0, 500, 33.33, 15, 499.95},
+		{"SUCCESS - Shorter than a length", 0, 10, 25, 0, 10},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			lengths, distance := poolSwim(tc.loggedLengths, tc.distMeters, tc.poolMeters)
+			assert.Equal(t, tc.expectedLengths, lengths)
+			assert.InDelta(t, tc.expectedDistance, distance, 1e-9)
+		})
+	}
+}
+
+func TestExportPoolLength(t *testing.T) {
+	startMockFitbitServer(t)
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+
+	// The demo swim is 20 lengths, logged as 0.5 km
+	assert.NoError(t, fetchActivityData([]string{"2024-09-07"}, exportOptions{selection: "3", poolMeters: 25 * metersPerYard}))
+
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromFile(filepath.Join(outputDir, "Swim-202409073.tcx")))
+	laps := xmlDoc.FindElements("//Lap")
+	assert.Len(t, laps, 20)
+	assert.Equal(t, "22.86", laps[0].SelectElement("DistanceMeters").Text())
+	assert.Equal(t, "457.2", laps[19].FindElements("Track/Trackpoint")[1].SelectElement("DistanceMeters").Text())
+}
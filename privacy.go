@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/beevik/etree"
+)
+
+// Mean radius of the Earth in meters
+const earthRadiusMeters = 6371008.8
+
+// Radius of the privacy zones configured without one, in meters
+const defaultPrivacyRadius = 200
+
+// Circle around a place to keep private, e.g. home or work, of the privacy-zones section of config.yaml:
+//
+//	privacy-zones:
+//	  home: {latitude: 47.4979, longitude: 19.0402, radius: 300}
+type privacyZone struct {
+	name      string
+	latitude  float64
+	longitude float64
+	radius    float64 // Meters
+}
+
+// Removes the positions of the track points, keeping their time, distance and heart rate, so the activity can be
+// shared without its route. Tells whether the TCX had positions
+func stripPositions(xmlDoc *etree.Document) bool {
+	stripped := false
+	for _, position := range xmlDoc.FindElements("//Trackpoint/Position") {
+		position.Parent().RemoveChild(position)
+		stripped = true
+	}
+	return stripped
+}
+
+// Removes the positions of the track points inside the privacy zones, keeping their time, distance and heart rate,
+// so the route ends at the last track point before a zone and starts again at the first one after it. Tells
+// whether a position was removed
+func hidePrivacyZones(xmlDoc *etree.Document, zones []privacyZone) bool {
+	hidden := false
+	for _, position := range xmlDoc.FindElements("//Trackpoint/Position") {
+		latitudeElement, longitudeElement := position.SelectElement("LatitudeDegrees"), position.SelectElement("LongitudeDegrees")
+		if latitudeElement == nil || longitudeElement == nil {
+			continue
+		}
+		latitude, err := strconv.ParseFloat(latitudeElement.Text(), 64)
+		if err != nil {
+			continue
+		}
+		longitude, err := strconv.ParseFloat(longitudeElement.Text(), 64)
+		if err != nil {
+			continue
+		}
+		for _, zone := range zones {
+			if greatCircleMeters(latitude, longitude, zone.latitude, zone.longitude) <= zone.radius {
+				position.Parent().RemoveChild(position)
+				hidden = true
+				break
+			}
+		}
+	}
+	return hidden
+}
+
+// Parses a privacy zone of config.yaml, its latitude and longitude in degrees and its radius in meters, 200 when
+// not given
+func parsePrivacyZone(name string, value interface{}) (privacyZone, error) {
+	fields, ok := stringKeys(value)
+	if !ok {
+		return privacyZone{}, fmt.Errorf("privacy zone %s must have a latitude, a longitude and a radius", name)
+	}
+	zone := privacyZone{name: name, latitude: math.NaN(), longitude: math.NaN(), radius: defaultPrivacyRadius}
+	for key, value := range fields {
+		number, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return privacyZone{}, fmt.Errorf("invalid %s %q of privacy zone %s, use a number", key, fmt.Sprint(value), name)
+		}
+		switch key {
+		case "latitude":
+			zone.latitude = number
+		case "longitude":
+			zone.longitude = number
+		case "radius":
+			zone.radius = number
+		default:
+			return privacyZone{}, fmt.Errorf("unknown key %q of privacy zone %s, use latitude, longitude and radius", key, name)
+		}
+	}
+	if !(zone.latitude >= -90 && zone.latitude <= 90) || !(zone.longitude >= -180 && zone.longitude <= 180) {
+		return privacyZone{}, fmt.Errorf("privacy zone %s needs a latitude between -90 and 90 and a longitude between -180 and 180", name)
+	}
+	if !(zone.radius > 0) || math.IsInf(zone.radius, 0) {
+		return privacyZone{}, fmt.Errorf("invalid radius of privacy zone %s, use the meters around the place", name)
+	}
+	return zone, nil
+}
+
+// Distance between two positions in meters, along the surface of the Earth
+func greatCircleMeters(latitude1 float64, longitude1 float64, latitude2 float64, longitude2 float64) float64 {
+	toRadians := math.Pi / 180
+	dLatitude := (latitude2 - latitude1) * toRadians
+	dLongitude := (longitude2 - longitude1) * toRadians
+	a := math.Pow(math.Sin(dLatitude/2), 2) +
+		math.Cos(latitude1*toRadians)*math.Cos(latitude2*toRadians)*math.Pow(math.Sin(dLongitude/2), 2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(min(a, 1)))
+}
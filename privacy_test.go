@@ -0,0 +1,122 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripPositions(t *testing.T) {
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Running"><Lap><Track>
+		<Trackpoint><Time>2024-09-07T08:00:00Z</Time><Position><LatitudeDegrees>47.527</LatitudeDegrees><LongitudeDegrees>19.045</LongitudeDegrees></Position><AltitudeMeters>110</AltitudeMeters><DistanceMeters>0</DistanceMeters><HeartRateBpm><Value>120</Value></HeartRateBpm></Trackpoint>
+		<Trackpoint><Time>2024-09-07T08:00:05Z</Time><DistanceMeters>14.2</DistanceMeters></Trackpoint>
+		</Track></Lap></Activity></Activities></TrainingCenterDatabase>`))
+
+	assert.True(t, stripPositions(xmlDoc))
+
+	assert.Nil(t, xmlDoc.FindElement("//Position"))
+	trackpoint := xmlDoc.FindElement("//Trackpoint")
+	assert.Equal(t, "2024-09-07T08:00:00Z", trackpoint.SelectElement("Time").Text())
+	assert.Equal(t, "110", trackpoint.SelectElement("AltitudeMeters").Text())
+	assert.Equal(t, "0", trackpoint.SelectElement("DistanceMeters").Text())
+	assert.Equal(t, "120", trackpoint.FindElement("HeartRateBpm/Value").Text())
+	assert.False(t, stripPositions(xmlDoc))
+}
+
+func TestExportStripGPS(t *testing.T) {
+	startMockFitbitServer(t)
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+
+	assert.NoError(t, fetchActivityData([]string{"2024-09-07"}, exportOptions{selection: "1", stripGPS: true}))
+
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromFile(filepath.Join(outputDir, "Run-202409071.tcx")))
+	assert.NotEmpty(t, xmlDoc.FindElements("//Trackpoint"))
+	assert.Nil(t, xmlDoc.FindElement("//Position"))
+	assert.NotNil(t, xmlDoc.FindElement("//Trackpoint/DistanceMeters"))
+}
+
+func TestHidePrivacyZones(t *testing.T) {
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Running"><Lap><Track>
+		<Trackpoint><Time>2024-09-07T08:00:00Z</Time><Position><LatitudeDegrees>47.4979</LatitudeDegrees><LongitudeDegrees>19.0402</LongitudeDegrees></Position><DistanceMeters>0</DistanceMeters><HeartRateBpm><Value>110</Value></HeartRateBpm></Trackpoint>
+		<Trackpoint><Time>2024-09-07T08:01:00Z</Time><Position><LatitudeDegrees>47.4996</LatitudeDegrees><LongitudeDegrees>19.0402</LongitudeDegrees></Position><DistanceMeters>189</DistanceMeters></Trackpoint>
+		<Trackpoint><Time>2024-09-07T08:02:00Z</Time><Position><LatitudeDegrees>47.5001</LatitudeDegrees><LongitudeDegrees>19.0402</LongitudeDegrees></Position><DistanceMeters>245</DistanceMeters></Trackpoint>
+		<Trackpoint><Time>2024-09-07T08:03:00Z</Time><DistanceMeters>300</DistanceMeters></Trackpoint>
+		</Track></Lap></Activity></Activities></TrainingCenterDatabase>`))
+	zones := []privacyZone{{name: "home", latitude: 47.4979, longitude: 19.0402, radius: 200}}
+
+	assert.True(t, hidePrivacyZones(xmlDoc, zones))
+
+	trackpoints := xmlDoc.FindElements("//Trackpoint")
+	assert.Nil(t, trackpoints[0].SelectElement("Position"))
+	assert.Equal(t, "0", trackpoints[0].SelectElement("DistanceMeters").Text())
+	assert.Equal(t, "110", trackpoints[0].FindElement("HeartRateBpm/Value").Text())
+	assert.Nil(t, trackpoints[1].SelectElement("Position"))
+	assert.Equal(t, "47.5001", trackpoints[2].FindElement("Position/LatitudeDegrees").Text())
+	assert.False(t, hidePrivacyZones(xmlDoc, zones))
+}
+
+func TestParsePrivacyZone(t *testing.T) {
+	testCases := []struct {
+		testName string
+		value    interface{}
+		expected privacyZone
+		err      bool
+	}{
+		{"SUCCESS - Default radius", map[string]interface{}{"latitude": 47.4979, "longitude": 19.0402}, privacyZone{name: "home", latitude: 47.4979, longitude: 19.0402, radius: 200}, false},
+		{"SUCCESS - Radius", map[string]interface{}{"latitude": -33.8688, "longitude": 151, "radius": 500}, privacyZone{name: "home", latitude: -33.8688, longitude: 151, radius: 500}, false},
+		{"FAILURE - Not a mapping", "47.4979,19.0402", privacyZone{}, true},
+		{"FAILURE - Without longitude", map[string]interface{}{"latitude": 47.4979}, privacyZone{}, true},
+		{"FAILURE - Latitude out of range", map[string]interface{}{"latitude": 95, "longitude": 19.0402}, privacyZone{}, true},
+		{"FAILURE - Not a number", map[string]interface{}{"latitude": "north", "longitude": 19.0402}, privacyZone{}, true},
+		{"FAILURE - Negative radius", map[string]interface{}{"latitude": 47.4979, "longitude": 19.0402, "radius": -1}, privacyZone{}, true},
+		{"FAILURE - Unknown key", map[string]interface{}{"lat": 47.4979, "longitude": 19.0402}, privacyZone{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			zone, err := parsePrivacyZone("home", tc.value)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, zone)
+		})
+	}
+}
+
+func TestGreatCircleMeters(t *testing.T) {
+	// A minute of latitude is a nautical mile
+	assert.InDelta(t, 1853, greatCircleMeters(47, 19, 47+1.0/60, 19), 1)
+	assert.InDelta(t, 0, greatCircleMeters(47.4979, 19.0402, 47.4979, 19.0402), 1e-9)
+}
+
+func TestExportPrivacyZones(t *testing.T) {
+	startMockFitbitServer(t)
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+	// Around the start of the loop of the demo run
+	config = &fileConfig{privacyZones: []privacyZone{{name: "home", latitude: 47.5270, longitude: 19.0498, radius: 100}}}
+	defer func() { config = nil }()
+
+	assert.NoError(t, fetchActivityData([]string{"2024-09-07"}, exportOptions{selection: "1"}))
+
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromFile(filepath.Join(outputDir, "Run-202409071.tcx")))
+	trackpoints := xmlDoc.FindElements("//Trackpoint")
+	positions := xmlDoc.FindElements("//Trackpoint/Position")
+	assert.Nil(t, trackpoints[0].SelectElement("Position"))
+	assert.NotEmpty(t, positions)
+	assert.Less(t, len(positions), len(trackpoints))
+	for _, position := range positions {
+		latitude, _ := strconv.ParseFloat(position.SelectElement("LatitudeDegrees").Text(), 64)
+		longitude, _ := strconv.ParseFloat(position.SelectElement("LongitudeDegrees").Text(), 64)
+		assert.Greater(t, greatCircleMeters(latitude, longitude, 47.5270, 19.0498), 100.0)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+)
+
+// Unit system of the distances requested from the Fitbit API
+type unitSystem string
+
+const (
+	unitsMetric   unitSystem = "metric"   // Kilometers
+	unitsImperial unitSystem = "imperial" // Miles
+)
+
+const (
+	metersPerMile = 1609.344
+	metersPerFoot = 0.3048
+)
+
+// Unit system of the API requests, sent as Accept-Language, so the distances are in the units the export converts from
+var apiUnits = unitsMetric
+
+// Gets the Fitbit profile of the user
+func fetchProfile() (data.ProfileUser, error) {
+	body, err := apiGet(userURL("profile.json"))
+	if err != nil {
+		return data.ProfileUser{}, fmt.Errorf("failed to fetch profile: %w", err)
+	}
+	var profile data.Profile
+	if err := json.Unmarshal(body, &profile); err != nil {
+		return data.ProfileUser{}, fmt.Errorf("failed to unmarshal profile: %s", err)
+	}
+	return profile.User, nil
+}
+
+// Parses the --units flag, "auto" (empty unit system) takes the units of the profile
+func parseUnits(units string) (unitSystem, error) {
+	switch units {
+	case "auto":
+		return "", nil
+	case string(unitsMetric), string(unitsImperial):
+		return unitSystem(units), nil
+	default:
+		return "", fmt.Errorf("invalid units %q, use auto, metric or imperial", units)
+	}
+}
+
+// Returns the unit system set in the profile
+func profileUnits(user data.ProfileUser) unitSystem {
+	if user.DistanceUnit == "en_US" {
+		return unitsImperial
+	}
+	return unitsMetric
+}
+
+// Accept-Language header selecting the unit system of the API responses, the API defaults to metric
+func acceptLanguage(units unitSystem) string {
+	if units == unitsImperial {
+		return "en_US"
+	}
+	return ""
+}
+
+// Converts a distance of the API response to meters
+func distanceMeters(distance float64, units unitSystem) float64 {
+	if units == unitsImperial {
+		return distance * metersPerMile
+	}
+	return distance * 1000.0
+}
+
+// Converts an elevation of the API response, in meters or in feet, to meters
+func elevationMeters(elevation float64, units unitSystem) float64 {
+	if units == unitsImperial {
+		return elevation * metersPerFoot
+	}
+	return elevation
+}
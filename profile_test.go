@@ -0,0 +1,67 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestFetchProfile(t *testing.T) {
+	var language, locale string
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		language = r.Header.Get("Accept-Language")
+		locale = r.Header.Get("Accept-Locale")
+		w.Write([]byte(`{"user":{"encodedId":"ABC123","timezone":"Europe/Budapest","distanceUnit":"en_US"}}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	apiUnits = unitsImperial
+	defer func() { apiUnits = unitsMetric }()
+
+	user, err := fetchProfile()
+	assert.NoError(t, err)
+	assert.Equal(t, "ABC123", user.EncodedID)
+	assert.Equal(t, "Europe/Budapest", user.Timezone)
+	assert.Equal(t, unitsImperial, profileUnits(user))
+	assert.Equal(t, "en_US", language)
+	assert.Equal(t, "en_US", locale)
+}
+
+func TestParseUnits(t *testing.T) {
+	testCases := []struct {
+		testName string
+		input    string
+		expected unitSystem
+		wantErr  bool
+	}{
+		{"SUCCESS - Auto", "auto", "", false},
+		{"SUCCESS - Metric", "metric", unitsMetric, false},
+		{"SUCCESS - Imperial", "imperial", unitsImperial, false},
+		{"FAILURE - Unknown units", "nautical", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			units, err := parseUnits(tc.input)
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.expected, units)
+		})
+	}
+}
+
+func TestProfileUnits(t *testing.T) {
+	assert.Equal(t, unitsImperial, profileUnits(data.ProfileUser{DistanceUnit: "en_US"}))
+	assert.Equal(t, unitsMetric, profileUnits(data.ProfileUser{DistanceUnit: "METRIC"}))
+	assert.Equal(t, unitsMetric, profileUnits(data.ProfileUser{}))
+}
+
+func TestDistanceMeters(t *testing.T) {
+	assert.InDelta(t, 5000.0, distanceMeters(5, unitsMetric), 1e-9)
+	assert.InDelta(t, 1609.344, distanceMeters(1, unitsImperial), 1e-9)
+}
+
+func TestElevationMeters(t *testing.T) {
+	assert.InDelta(t, 12.5, elevationMeters(12.5, unitsMetric), 1e-9)
+	assert.InDelta(t, 3.048, elevationMeters(10, unitsImperial), 1e-9)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Stream of the --json-progress events, disabled when nil
+var progressEvents io.Writer
+
+// Event of the machine-readable progress, one JSON object per line
+type progressEvent struct {
+	Time     string `json:"time"`               // RFC 3339
+	Event    string `json:"event"`              // started, downloaded, transformed, written, skipped, failed or finished
+	LogID    int64  `json:"logId,omitempty"`    // Activity of the event, not set for finished
+	Activity string `json:"activity,omitempty"` // e.g. "Swim 2024-09-07 10:00"
+	File     string `json:"file,omitempty"`     // Written or skipped file
+	Error    string `json:"error,omitempty"`    // Reason of the failure
+	Done     int    `json:"done"`               // Finished activities, written, skipped or failed
+	Total    int    `json:"total"`
+}
+
+// Progress of a batch export, counting the activities per stage. On a terminal it is a progress bar redrawn
+// in place, otherwise each finished activity is logged with the counters
+type exportProgress struct {
+	mu          sync.Mutex // Concurrent exports report their stages
+	out         io.Writer
+	tty         bool // Redraw the progress bar in place
+	disabled    bool // --quiet, only failures are logged
+	total       int
+	downloaded  int
+	transformed int
+	written     int
+	failed      int
+	skipped     int
+	lastErr     error         // Error of the last failed activity
+	current     string        // Activity being exported
+	events      *json.Encoder // JSON events of each stage, see progressEvent
+}
+
+// Creates the progress of exporting total activities, drawn on stderr
+func newExportProgress(total int) *exportProgress {
+	p := &exportProgress{
+		out:      os.Stderr,
+		tty:      term.IsTerminal(int(os.Stderr.Fd())),
+		disabled: !slog.Default().Enabled(context.Background(), slog.LevelInfo),
+		total:    total,
+	}
+	if progressEvents != nil {
+		p.events = json.NewEncoder(progressEvents)
+	}
+	return p
+}
+
+// Starts exporting the next activity
+func (p *exportProgress) start(activity data.Activity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = activityLabel(activity)
+	p.emit(progressEvent{Event: "started", LogID: activity.LogID, Activity: p.current})
+	p.render()
+}
+
+func (p *exportProgress) downloadDone(activity data.Activity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.downloaded++
+	p.emit(progressEvent{Event: "downloaded", LogID: activity.LogID, Activity: activityLabel(activity)})
+	p.render()
+}
+
+func (p *exportProgress) transformDone(activity data.Activity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transformed++
+	p.emit(progressEvent{Event: "transformed", LogID: activity.LogID, Activity: activityLabel(activity)})
+	p.render()
+}
+
+func (p *exportProgress) writeDone(activity data.Activity, fileName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.written++
+	p.emit(progressEvent{Event: "written", LogID: activity.LogID, Activity: activityLabel(activity), File: fileName})
+	p.clear()
+	slog.Debug("Data saved", "file", fileName)
+	p.finished()
+}
+
+func (p *exportProgress) skip(activity data.Activity, fileName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.skipped++
+	p.emit(progressEvent{Event: "skipped", LogID: activity.LogID, Activity: activityLabel(activity), File: fileName})
+	p.clear()
+	slog.Debug("Skipped, file exists", "file", fileName)
+	p.finished()
+}
+
+func (p *exportProgress) fail(activity data.Activity, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failed++
+	p.lastErr = err
+	p.emit(progressEvent{Event: "failed", LogID: activity.LogID, Activity: activityLabel(activity), Error: err.Error()})
+	p.clear()
+	slog.Error("Failed to export activity", "activity", activityLabel(activity), "err", err)
+	p.finished()
+}
+
+// Number of finished activities, written, skipped or failed
+func (p *exportProgress) done() int {
+	return p.written + p.skipped + p.failed
+}
+
+// Ends the progress bar and logs the summary of the batch
+func (p *exportProgress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit(progressEvent{Event: "finished"})
+	p.clear()
+	slog.Info("Export finished", "activities", p.total, "written", p.written, "skipped", p.skipped, "failed", p.failed)
+}
+
+// Reports a finished activity
+func (p *exportProgress) finished() {
+	if p.tty {
+		p.render()
+		return
+	}
+	if !p.disabled {
+		slog.Info("Progress", "done", fmt.Sprintf("%d/%d", p.done(), p.total), "downloaded", p.downloaded,
+			"transformed", p.transformed, "written", p.written, "skipped", p.skipped, "failed", p.failed)
+	}
+}
+
+// Redraws the progress bar on the terminal
+func (p *exportProgress) render() {
+	if !p.tty || p.disabled {
+		return
+	}
+	const width = 20
+	filled := width
+	if p.total > 0 {
+		filled = width * p.done() / p.total
+	}
+	fmt.Fprintf(p.out, "\r\033[K[%s%s] %d/%d  downloaded %d  transformed %d  written %d  skipped %d  failed %d  %s",
+		strings.Repeat("=", filled), strings.Repeat(" ", width-filled), p.done(), p.total,
+		p.downloaded, p.transformed, p.written, p.skipped, p.failed, p.current)
+}
+
+// Erases the progress bar, so a log line can be written
+func (p *exportProgress) clear() {
+	if p.tty && !p.disabled {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+}
+
+// Writes the event to the --json-progress stream, with the current counters
+func (p *exportProgress) emit(event progressEvent) {
+	if p.events == nil {
+		return
+	}
+	event.Time = time.Now().Format(time.RFC3339)
+	event.Done, event.Total = p.done(), p.total
+	if err := p.events.Encode(event); err != nil {
+		slog.Warn("Failed to write progress event", "err", err)
+		p.events = nil
+	}
+}
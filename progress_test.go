@@ -0,0 +1,153 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestExportProgressTerminal(t *testing.T) {
+	var out bytes.Buffer
+	progress := &exportProgress{out: &out, tty: true, total: 2}
+	swim := data.Activity{ActivityParentName: "Swim", StartDate: "2024-09-07", StartTime: "10:00", LogID: 1}
+	run := data.Activity{ActivityParentName: "Run", StartDate: "2024-09-07", StartTime: "18:00", LogID: 2}
+
+	progress.start(swim)
+	progress.downloadDone(swim)
+	progress.transformDone(swim)
+	progress.writeDone(swim, "Swim-1.tcx")
+	assert.Contains(t, out.String(), "[==========          ] 1/2  downloaded 1  transformed 1  written 1  skipped 0  failed 0  Swim 2024-09-07 10:00")
+
+	progress.start(run)
+	progress.fail(run, errors.New("request failed with status 500"))
+	assert.Contains(t, out.String(), "[====================] 2/2  downloaded 1  transformed 1  written 1  skipped 0  failed 1  Run 2024-09-07 18:00")
+	assert.Equal(t, 2, progress.done())
+
+	// Quiet runs draw no progress bar
+	out.Reset()
+	progress = &exportProgress{out: &out, tty: true, disabled: true, total: 1}
+	progress.start(swim)
+	progress.downloadDone(swim)
+	assert.Empty(t, out.String())
+}
+
+func TestExportProgressEvents(t *testing.T) {
+	var events bytes.Buffer
+	progressEvents = &events
+	defer func() { progressEvents = nil }()
+	progress := newExportProgress(2)
+	swim := data.Activity{ActivityParentName: "Swim", StartDate: "2024-09-07", StartTime: "10:00", LogID: 1}
+	run := data.Activity{ActivityParentName: "Run", StartDate: "2024-09-07", StartTime: "18:00", LogID: 2}
+
+	progress.start(swim)
+	progress.downloadDone(swim)
+	progress.transformDone(swim)
+	progress.writeDone(swim, "Swim-1.tcx")
+	progress.start(run)
+	progress.fail(run, errors.New("request failed with status 500"))
+	progress.finish()
+
+	var got []progressEvent
+	decoder := json.NewDecoder(&events)
+	for decoder.More() {
+		var event progressEvent
+		assert.NoError(t, decoder.Decode(&event))
+		assert.NotEmpty(t, event.Time)
+		event.Time = ""
+		got = append(got, event)
+	}
+	assert.Equal(t, []progressEvent{
+		{Event: "started", LogID: 1, Activity: "Swim 2024-09-07 10:00", Done: 0, Total: 2},
+		{Event: "downloaded", LogID: 1, Activity: "Swim 2024-09-07 10:00", Done: 0, Total: 2},
+		{Event: "transformed", LogID: 1, Activity: "Swim 2024-09-07 10:00", Done: 0, Total: 2},
+		{Event: "written", LogID: 1, Activity: "Swim 2024-09-07 10:00", File: "Swim-1.tcx", Done: 1, Total: 2},
+		{Event: "started", LogID: 2, Activity: "Run 2024-09-07 18:00", Done: 1, Total: 2},
+		{Event: "failed", LogID: 2, Activity: "Run 2024-09-07 18:00", Error: "request failed with status 500", Done: 2, Total: 2},
+		{Event: "finished", Done: 2, Total: 2},
+	}, got)
+}
+
+func TestExportActivitiesContinuesOnFailure(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/user/-/activities/1.tcx", "/1/user/-/activities/3.tcx":
+			w.Write([]byte(testActivityTcx))
+		case "/1/user/-/activities/2.tcx":
+			w.Write([]byte(`<TrainingCenterDatabase/>`))
+		default:
+			http.Error(w, `{"errors":[{"errorType":"system"}]}`, http.StatusInternalServerError)
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	stubSleep(t) // The server errors are retried
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+
+	err := exportActivities([]data.Activity{
+		{ActivityParentName: "Treadmill", LogID: 1},
+		{ActivityParentName: "Weights", LogID: 2}, // TCX without activity
+		{ActivityParentName: "Weights", LogID: 3},
+		{ActivityParentName: "Weights", LogID: 4}, // server error
+	}, exportOptions{})
+	assert.Equal(t, exitPartial, exitCode(err))
+
+	assert.FileExists(t, filepath.Join(outputDir, "Treadmill-1.tcx"))
+	assert.NoFileExists(t, filepath.Join(outputDir, "Weights-2.tcx"))
+	assert.FileExists(t, filepath.Join(outputDir, "Weights-3.tcx"))
+}
+
+func TestExportActivitiesAllFailed(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":[{"errorType":"system","message":"Too Many Requests"}]}`, http.StatusTooManyRequests)
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+
+	err := exportActivities([]data.Activity{{ActivityParentName: "Swim", LogID: 1}}, exportOptions{})
+	assert.Error(t, err)
+	assert.Equal(t, exitRateLimited, exitCode(err))
+
+	assert.NoError(t, exportActivities(nil, exportOptions{}))
+}
+
+func TestExportActivitiesConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Write([]byte(testActivityTcx))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+
+	var activities []data.Activity
+	for i := int64(1); i <= 6; i++ {
+		activities = append(activities, data.Activity{ActivityParentName: "Swim", StartDate: "2024-09-07", LogID: i})
+	}
+	// Every activity has the same name, renaming must give each its own file
+	opts := exportOptions{fileTemplate: "{sport}-{date}", onConflict: conflictRename, concurrency: 3}
+	assert.NoError(t, exportActivities(activities, opts))
+
+	assert.LessOrEqual(t, maxInFlight, 3)
+	assert.Greater(t, maxInFlight, 1)
+	files, _ := filepath.Glob(filepath.Join(outputDir, "Swim-2024-09-07*.tcx"))
+	assert.Len(t, files, 6)
+}
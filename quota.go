@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Prints the quota of the Fitbit API rate limit, as a table or as JSON, to tell whether a big export fits in the
+// current hour. The quota comes from the last response, or from a profile request when there was none
+func printQuota(out io.Writer, jsonOutput bool) error {
+	quota, ok := rateLimit.quota()
+	if !ok {
+		if _, err := apiGet(userURL("profile.json")); err != nil {
+			return fmt.Errorf("failed to fetch the rate limit: %w", err)
+		}
+		if quota, ok = rateLimit.quota(); !ok {
+			return fmt.Errorf("the response has no rate limit headers")
+		}
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(quota)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Limit:\t%d requests per hour\n", quota.Limit)
+	fmt.Fprintf(w, "Remaining:\t%d\n", quota.Remaining)
+	fmt.Fprintf(w, "Resets in:\t%s (at %s)\n", time.Until(quota.ResetAt).Round(time.Second), quota.ResetAt.Format(time.TimeOnly))
+	return w.Flush()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestPrintQuota(t *testing.T) {
+	requests := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/1/user/-/profile.json" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		w.Header().Set("Fitbit-Rate-Limit-Limit", "150")
+		w.Header().Set("Fitbit-Rate-Limit-Remaining", "137")
+		w.Header().Set("Fitbit-Rate-Limit-Reset", "2530")
+		w.Write([]byte(`{"user":{}}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	stubSleep(t)
+
+	var out bytes.Buffer
+	assert.NoError(t, printQuota(&out, false))
+	assert.Contains(t, out.String(), "Limit:      150 requests per hour\n")
+	assert.Contains(t, out.String(), "Remaining:  137\n")
+	assert.Contains(t, out.String(), "Resets in:  42m")
+
+	// The quota of the last response, without another request
+	out.Reset()
+	assert.NoError(t, printQuota(&out, true))
+	var quota apiQuota
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &quota))
+	assert.Equal(t, 150, quota.Limit)
+	assert.Equal(t, 137, quota.Remaining)
+	assert.WithinDuration(t, time.Now().Add(2530*time.Second), quota.ResetAt, 5*time.Second)
+	assert.Equal(t, 1, requests)
+}
+
+func TestPrintQuotaWithoutHeaders(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"user":{}}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	stubSleep(t)
+
+	assert.ErrorContains(t, printQuota(&bytes.Buffer{}, false), "no rate limit headers")
+}
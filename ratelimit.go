@@ -0,0 +1,114 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Pauses the requests, replaced in tests
+var sleep = time.Sleep
+
+// Rate limit of the Fitbit API (150 requests per hour), tracked from the Fitbit-Rate-Limit-* and Retry-After
+// headers of the responses. When the quota is used up, every request waits until it resets
+type rateLimiter struct {
+	mu          sync.Mutex
+	maxWait     time.Duration // Longest pause until the limit resets, the request fails instead of a longer one
+	pausedUntil time.Time     // Requests wait until then, the quota is used up
+	announced   time.Time     // Pause already logged, concurrent exports only log it once
+	last        apiQuota      // Quota of the last response with the rate limit headers
+}
+
+// Quota of the rate limit, as given by the Fitbit-Rate-Limit-* headers
+type apiQuota struct {
+	Limit     int       `json:"limit"`     // Requests per hour
+	Remaining int       `json:"remaining"` // Requests left until the reset
+	ResetAt   time.Time `json:"resetAt"`
+}
+
+var rateLimit = rateLimiter{maxWait: time.Hour}
+
+// Records the quota of the response headers. A used up quota, or a rejected request, pauses the next
+// requests until the limit resets
+func (l *rateLimiter) update(header http.Header, status int) {
+	reset, hasReset := headerSeconds(header, "Fitbit-Rate-Limit-Reset")
+	remaining, err := strconv.Atoi(header.Get("Fitbit-Rate-Limit-Remaining"))
+	if err == nil {
+		slog.Debug("API rate limit", "limit", header.Get("Fitbit-Rate-Limit-Limit"), "remaining", remaining, "reset", reset)
+		limit, _ := strconv.Atoi(header.Get("Fitbit-Rate-Limit-Limit"))
+		l.mu.Lock()
+		l.last = apiQuota{Limit: limit, Remaining: remaining, ResetAt: time.Now().Add(reset)}
+		l.mu.Unlock()
+	}
+
+	var pause time.Duration
+	if status == http.StatusTooManyRequests {
+		if retryAfter, ok := headerSeconds(header, "Retry-After"); ok {
+			pause = retryAfter
+		} else if hasReset {
+			pause = reset
+		}
+	} else if err == nil && remaining == 0 && hasReset {
+		pause = reset
+	}
+	if pause <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(pause); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Waits until the rate limit resets, when the quota is used up and the pause is not longer than maxWait.
+// Tells whether it waited
+func (l *rateLimiter) wait() bool {
+	l.mu.Lock()
+	until := l.pausedUntil
+	pause := time.Until(until)
+	if pause <= 0 || pause > l.maxWait {
+		l.mu.Unlock()
+		return false
+	}
+	if !l.announced.Equal(until) {
+		l.announced = until
+		slog.Warn("Fitbit API rate limit used up, pausing until it resets", "until", until.Format(time.TimeOnly), "wait", pause.Round(time.Second))
+	}
+	l.mu.Unlock()
+
+	sleep(pause)
+	return true
+}
+
+// Time until the rate limit resets, 0 when it is not used up
+func (l *rateLimiter) resetIn() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return max(time.Until(l.pausedUntil), 0)
+}
+
+// Quota of the last response with the rate limit headers, false before any
+func (l *rateLimiter) quota() (apiQuota, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last, !l.last.ResetAt.IsZero()
+}
+
+// Parses a header given in seconds, e.g. "Retry-After: 120". Retry-After may be a date too
+func headerSeconds(header http.Header, name string) (time.Duration, bool) {
+	value := header.Get(name)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
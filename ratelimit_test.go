@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// Records the pauses instead of sleeping, and resets the rate limit after the test
+func stubSleep(t *testing.T) *[]time.Duration {
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	t.Cleanup(func() {
+		sleep = time.Sleep
+		rateLimit = rateLimiter{maxWait: time.Hour}
+	})
+	return &slept
+}
+
+func TestAPIGetRateLimited(t *testing.T) {
+	requests := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, `{"errors":[{"errorType":"system","message":"Too Many Requests"}]}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Fitbit-Rate-Limit-Limit", "150")
+		w.Header().Set("Fitbit-Rate-Limit-Remaining", "149")
+		w.Header().Set("Fitbit-Rate-Limit-Reset", "3599")
+		w.Write([]byte(`{"activities":[]}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	slept := stubSleep(t)
+
+	body, err := apiGet("https://api.fitbit.com/1/user/-/activities/date/2024-09-07.json")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"activities":[]}`, string(body))
+	assert.Equal(t, 2, requests)
+	assert.Len(t, *slept, 1)
+	assert.InDelta(t, 30*time.Second, (*slept)[0], float64(time.Second))
+}
+
+func TestAPIGetRateLimitWaitTooLong(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Fitbit-Rate-Limit-Remaining", "0")
+		w.Header().Set("Fitbit-Rate-Limit-Reset", "1800")
+		http.Error(w, `{"errors":[{"errorType":"system","message":"Too Many Requests"}]}`, http.StatusTooManyRequests)
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	slept := stubSleep(t)
+	rateLimit.maxWait = time.Minute
+
+	_, err := apiGet("https://api.fitbit.com/1/user/-/activities/date/2024-09-07.json")
+	var apiErr *apiError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.InDelta(t, 30*time.Minute, apiErr.resetIn, float64(time.Second))
+	assert.Contains(t, err.Error(), "rate limit resets in")
+	assert.Equal(t, exitRateLimited, exitCode(err))
+	assert.Empty(t, *slept)
+}
+
+func TestRateLimiterUpdate(t *testing.T) {
+	testCases := []struct {
+		testName string
+		header   http.Header
+		status   int
+		expected time.Duration
+	}{
+		{"SUCCESS - Quota left", http.Header{"Fitbit-Rate-Limit-Remaining": {"10"}, "Fitbit-Rate-Limit-Reset": {"600"}}, http.StatusOK, 0},
+		{"SUCCESS - Quota used up", http.Header{"Fitbit-Rate-Limit-Remaining": {"0"}, "Fitbit-Rate-Limit-Reset": {"600"}}, http.StatusOK, 10 * time.Minute},
+		{"SUCCESS - Retry-After of a rejected request", http.Header{"Retry-After": {"120"}, "Fitbit-Rate-Limit-Reset": {"600"}}, http.StatusTooManyRequests, 2 * time.Minute},
+		{"SUCCESS - Reset of a rejected request", http.Header{"Fitbit-Rate-Limit-Reset": {"600"}}, http.StatusTooManyRequests, 10 * time.Minute},
+		{"SUCCESS - Rejected request without headers", http.Header{}, http.StatusTooManyRequests, 0},
+		{"SUCCESS - Invalid header", http.Header{"Retry-After": {"soon"}}, http.StatusTooManyRequests, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			stubSleep(t)
+			rateLimit.update(tc.header, tc.status)
+			assert.InDelta(t, tc.expected, rateLimit.resetIn(), float64(time.Second))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Copies of the raw responses of the API requests (activity lists, TCX files, intraday data, ...), replayed by
+// --offline to export again without the API, e.g. to try out TCX transformations without using the rate limit
+type rawCache struct {
+	dir     string // Responses are not saved when empty
+	offline bool   // Answer the requests from the copies only
+}
+
+// Raw responses of the API requests, set up once the Fitbit user is known
+var rawResponses rawCache
+
+// Returns the location of the raw responses of the Fitbit user, ~/.cache/fitbittcx/raw/<user ID>
+func rawCacheDir(userID string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %s", err)
+	}
+	if userID == "" {
+		userID = "default"
+	}
+	return filepath.Join(cacheDir, "fitbittcx", "raw", userID), nil
+}
+
+// File of the response of the URL, by its path, e.g. 1/user/-/activities/12345.tcx for the TCX of the activity
+// with log ID 12345, or 1/user/-/activities/date/2024-09-07.json for the activities of the day. The query is
+// escaped into the name
+func (c rawCache) file(apiURL string) (string, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid API URL %q: %s", apiURL, err)
+	}
+	// Colons, e.g. of the intraday time ranges, are invalid in Windows file names
+	name := strings.ReplaceAll(strings.TrimPrefix(u.Path, "/"), ":", "-")
+	if u.RawQuery != "" {
+		name += "@" + url.QueryEscape(u.RawQuery)
+	}
+	if name == "" || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid API URL %q", apiURL)
+	}
+	return filepath.Join(c.dir, filepath.FromSlash(name)), nil
+}
+
+// Saves the response of the URL. A failure is only logged, the response is missing offline
+func (c rawCache) save(apiURL string, body []byte) {
+	if c.dir == "" || c.offline {
+		return
+	}
+	fileName, err := c.file(apiURL)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(fileName), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(fileName, body, 0600)
+	}
+	if err != nil {
+		slog.Warn("Failed to save the raw response", "url", apiURL, "err", err)
+	}
+}
+
+// Gets the saved response of the URL
+func (c rawCache) load(apiURL string) ([]byte, error) {
+	fileName, err := c.file(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no saved response of %s to export offline, export it online first", apiURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved response: %s", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestRawCacheFile(t *testing.T) {
+	testCases := []struct {
+		testName string
+		url      string
+		expected string
+		wantErr  bool
+	}{
+		{"SUCCESS - TCX", "https://api.fitbit.com/1/user/-/activities/12345.tcx?includePartialTCX=true", "1/user/-/activities/12345.tcx@includePartialTCX%3Dtrue", false},
+		{"SUCCESS - Daily activity summary", "https://api.fitbit.com/1/user/-/activities/date/2024-09-07.json", "1/user/-/activities/date/2024-09-07.json", false},
+		{"SUCCESS - Intraday time range", "http://localhost:9000/1/user/-/activities/steps/date/2024-09-07/1d/1min/time/10:00/10:30.json", "1/user/-/activities/steps/date/2024-09-07/1d/1min/time/10-00/10-30.json", false},
+		{"FAILURE - Outside of the cache", "https://api.fitbit.com/1/../../token.json", "", true},
+		{"FAILURE - Without path", "https://api.fitbit.com", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			fileName, err := rawCache{dir: "raw"}.file(tc.url)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join("raw", filepath.FromSlash(tc.expected)), fileName)
+		})
+	}
+}
+
+func TestAPIGetOffline(t *testing.T) {
+	requests := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(testActivityTcx))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	rawResponses = rawCache{dir: t.TempDir()}
+	defer func() { rawResponses = rawCache{} }()
+
+	// Saved online, replayed offline
+	tcxURL := userURL("activities/12345.tcx?includePartialTCX=true")
+	_, err := apiGet(tcxURL)
+	assert.NoError(t, err)
+	rawResponses.offline = true
+	body, err := apiGet(tcxURL)
+	assert.NoError(t, err)
+	assert.Equal(t, testActivityTcx, string(body))
+	assert.Equal(t, 1, requests)
+
+	_, err = apiGet(userURL("activities/67890.tcx?includePartialTCX=true"))
+	assert.ErrorContains(t, err, "export it online first")
+	_, err = apiPost(userURL("activities.json"), url.Values{"activityId": {"90009"}})
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+}
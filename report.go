@@ -0,0 +1,141 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Longest date range of a single request of the daily activity time series
+const activitySeriesMaxDays = 1095
+
+// Activity minutes of the active minutes report, by intensity
+var activityMinutesResources = []string{"minutesVeryActive", "minutesFairlyActive", "minutesLightlyActive"}
+
+// Week of the active minutes report, the totals of its days in the date range
+type weeklyActiveMinutes struct {
+	Week          string `json:"week"`  // ISO week, e.g. "2024-W36"
+	Start         string `json:"start"` // First day of the week in the date range
+	End           string `json:"end"`   // Last day of the week in the date range
+	ActiveZone    int    `json:"activeZoneMinutes"`
+	FatBurn       int    `json:"fatBurnActiveZoneMinutes"`
+	Cardio        int    `json:"cardioActiveZoneMinutes"`
+	Peak          int    `json:"peakActiveZoneMinutes"`
+	VeryActive    int    `json:"veryActiveMinutes"`
+	FairlyActive  int    `json:"fairlyActiveMinutes"`
+	LightlyActive int    `json:"lightlyActiveMinutes"`
+}
+
+// Parses the report command, e.g. report azm --markdown 2024-09-07. Returns whether the report is a Markdown
+// table and the remaining date arguments
+func parseReportArgs(args []string) (bool, []string, error) {
+	if len(args) == 0 || args[0] != "azm" {
+		return false, nil, fmt.Errorf("unknown report, use: report azm [--markdown]")
+	}
+	fs := flag.NewFlagSet("report azm", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	markdown := fs.Bool("markdown", false, "write a Markdown table instead of CSV")
+	if err := fs.Parse(args[1:]); err != nil {
+		return false, nil, fmt.Errorf("report azm: %s", err)
+	}
+	return *markdown, fs.Args(), nil
+}
+
+// Writes the Active Zone Minutes and the activity minutes of the date range by ISO week, as CSV, as a Markdown
+// table or as JSON. The weeks at the ends of the range only count its days
+func reportActiveMinutes(out io.Writer, start time.Time, end time.Time, markdown bool, jsonOutput bool) error {
+	weeks := []*weeklyActiveMinutes{}
+	byDate := map[string]*weeklyActiveMinutes{}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		year, number := day.ISOWeek()
+		week := fmt.Sprintf("%d-W%02d", year, number)
+		if len(weeks) == 0 || weeks[len(weeks)-1].Week != week {
+			weeks = append(weeks, &weeklyActiveMinutes{Week: week, Start: day.Format(dateLayout)})
+		}
+		weeks[len(weeks)-1].End = day.Format(dateLayout)
+		byDate[day.Format(dateLayout)] = weeks[len(weeks)-1]
+	}
+
+	err := forDateChunks(start, end, activitySeriesMaxDays, func(chunkStart time.Time, chunkEnd time.Time) error {
+		dates := chunkStart.Format(dateLayout) + "/" + chunkEnd.Format(dateLayout)
+		body, err := apiGet(userURL("activities/active-zone-minutes/date/" + dates + ".json"))
+		if err != nil {
+			return fmt.Errorf("failed to fetch Active Zone Minutes from %s to %s: %w", chunkStart.Format(dateLayout), chunkEnd.Format(dateLayout), err)
+		}
+		var series data.ActiveZoneMinutesSeries
+		if err := json.Unmarshal(body, &series); err != nil {
+			return fmt.Errorf("failed to unmarshal Active Zone Minutes: %s", err)
+		}
+		for _, day := range series.Days {
+			if week := byDate[day.DateTime]; week != nil {
+				week.ActiveZone += day.Value.ActiveZoneMinutes
+				week.FatBurn += day.Value.FatBurnActiveZoneMinutes
+				week.Cardio += day.Value.CardioActiveZoneMinutes
+				week.Peak += day.Value.PeakActiveZoneMinutes
+			}
+		}
+
+		for _, resource := range activityMinutesResources {
+			body, err := apiGet(userURL("activities/" + resource + "/date/" + dates + ".json"))
+			if err != nil {
+				return fmt.Errorf("failed to fetch %s from %s to %s: %w", resource, chunkStart.Format(dateLayout), chunkEnd.Format(dateLayout), err)
+			}
+			var series map[string][]data.ActivitySeriesDay
+			if err := json.Unmarshal(body, &series); err != nil {
+				return fmt.Errorf("failed to unmarshal %s: %s", resource, err)
+			}
+			for _, day := range series["activities-"+resource] {
+				week := byDate[day.DateTime]
+				minutes, err := strconv.Atoi(day.Value)
+				if week == nil || err != nil {
+					continue
+				}
+				switch resource {
+				case "minutesVeryActive":
+					week.VeryActive += minutes
+				case "minutesFairlyActive":
+					week.FairlyActive += minutes
+				case "minutesLightlyActive":
+					week.LightlyActive += minutes
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	header := []string{"week", "start", "end", "active_zone_minutes", "fat_burn", "cardio", "peak", "very_active", "fairly_active", "lightly_active"}
+	var rows [][]string
+	for _, week := range weeks {
+		rows = append(rows, []string{week.Week, week.Start, week.End, strconv.Itoa(week.ActiveZone), strconv.Itoa(week.FatBurn), strconv.Itoa(week.Cardio),
+			strconv.Itoa(week.Peak), strconv.Itoa(week.VeryActive), strconv.Itoa(week.FairlyActive), strconv.Itoa(week.LightlyActive)})
+	}
+	if markdown && !jsonOutput {
+		return writeMarkdownTable(out, header, rows, 3)
+	}
+	return writeHealthRecords(out, jsonOutput, weeks, header, rows)
+}
+
+// Writes the rows as a Markdown table with the header, the columns after the text columns, the numbers, right aligned
+func writeMarkdownTable(out io.Writer, header []string, rows [][]string, textColumns int) error {
+	alignment := make([]string, len(header))
+	for i := range alignment {
+		alignment[i] = "---"
+		if i >= textColumns {
+			alignment[i] = "---:"
+		}
+	}
+	var table strings.Builder
+	for _, row := range append([][]string{header, alignment}, rows...) {
+		table.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+	_, err := io.WriteString(out, table.String())
+	return err
+}
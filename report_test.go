@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// Serves the Active Zone Minutes and activity minutes of 2024-09-01 (Sunday, 2024-W35) to 2024-09-09 (Monday, 2024-W37)
+func stubActiveMinutesAPI(t *testing.T) {
+	responses := map[string]string{
+		"/1/user/-/activities/active-zone-minutes/date/2024-09-01/2024-09-09.json": `{"activities-active-zone-minutes":[
+			{"dateTime":"2024-09-01","value":{"activeZoneMinutes":30,"fatBurnActiveZoneMinutes":10,"cardioActiveZoneMinutes":20}},
+			{"dateTime":"2024-09-02","value":{"activeZoneMinutes":12,"fatBurnActiveZoneMinutes":12}},
+			{"dateTime":"2024-09-07","value":{"activeZoneMinutes":50,"fatBurnActiveZoneMinutes":6,"cardioActiveZoneMinutes":30,"peakActiveZoneMinutes":14}}]}`,
+		"/1/user/-/activities/minutesVeryActive/date/2024-09-01/2024-09-09.json": `{"activities-minutesVeryActive":[
+			{"dateTime":"2024-09-01","value":"25"},{"dateTime":"2024-09-02","value":"5"},{"dateTime":"2024-09-07","value":"40"},{"dateTime":"2024-09-09","value":"1"}]}`,
+		"/1/user/-/activities/minutesFairlyActive/date/2024-09-01/2024-09-09.json": `{"activities-minutesFairlyActive":[
+			{"dateTime":"2024-09-01","value":"10"},{"dateTime":"2024-09-07","value":"8"}]}`,
+		"/1/user/-/activities/minutesLightlyActive/date/2024-09-01/2024-09-09.json": `{"activities-minutesLightlyActive":[
+			{"dateTime":"2024-09-01","value":"120"},{"dateTime":"2024-09-02","value":"200"},{"dateTime":"2024-09-09","value":"90"}]}`,
+	}
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !assert.True(t, ok, r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+}
+
+func TestReportActiveMinutes(t *testing.T) {
+	stubActiveMinutesAPI(t)
+	start := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 9, 9, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	assert.NoError(t, reportActiveMinutes(&out, start, end, false, false))
+	assert.Equal(t, "week,start,end,active_zone_minutes,fat_burn,cardio,peak,very_active,fairly_active,lightly_active\n"+
+		"2024-W35,2024-09-01,2024-09-01,30,10,20,0,25,10,120\n"+
+		"2024-W36,2024-09-02,2024-09-08,62,18,30,14,45,8,200\n"+
+		"2024-W37,2024-09-09,2024-09-09,0,0,0,0,1,0,90\n", out.String())
+
+	// Markdown
+	out.Reset()
+	assert.NoError(t, reportActiveMinutes(&out, start, end, true, false))
+	assert.Equal(t, "| week | start | end | active_zone_minutes | fat_burn | cardio | peak | very_active | fairly_active | lightly_active |\n"+
+		"| --- | --- | --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: |\n"+
+		"| 2024-W35 | 2024-09-01 | 2024-09-01 | 30 | 10 | 20 | 0 | 25 | 10 | 120 |\n"+
+		"| 2024-W36 | 2024-09-02 | 2024-09-08 | 62 | 18 | 30 | 14 | 45 | 8 | 200 |\n"+
+		"| 2024-W37 | 2024-09-09 | 2024-09-09 | 0 | 0 | 0 | 0 | 1 | 0 | 90 |\n", out.String())
+}
+
+func TestReportActiveMinutesJSON(t *testing.T) {
+	stubActiveMinutesAPI(t)
+	start := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 9, 9, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	assert.NoError(t, reportActiveMinutes(&out, start, end, true, true))
+	assert.JSONEq(t, `[
+		{"week":"2024-W35","start":"2024-09-01","end":"2024-09-01","activeZoneMinutes":30,"fatBurnActiveZoneMinutes":10,"cardioActiveZoneMinutes":20,"peakActiveZoneMinutes":0,"veryActiveMinutes":25,"fairlyActiveMinutes":10,"lightlyActiveMinutes":120},
+		{"week":"2024-W36","start":"2024-09-02","end":"2024-09-08","activeZoneMinutes":62,"fatBurnActiveZoneMinutes":18,"cardioActiveZoneMinutes":30,"peakActiveZoneMinutes":14,"veryActiveMinutes":45,"fairlyActiveMinutes":8,"lightlyActiveMinutes":200},
+		{"week":"2024-W37","start":"2024-09-09","end":"2024-09-09","activeZoneMinutes":0,"fatBurnActiveZoneMinutes":0,"cardioActiveZoneMinutes":0,"peakActiveZoneMinutes":0,"veryActiveMinutes":1,"fairlyActiveMinutes":0,"lightlyActiveMinutes":90}]`, out.String())
+}
+
+func TestParseReportArgs(t *testing.T) {
+	testCases := []struct {
+		testName         string
+		args             []string
+		expectedMarkdown bool
+		expectedRest     []string
+		expectedError    string
+	}{
+		{"SUCCESS - Date range", []string{"azm"}, false, []string{}, ""},
+		{"SUCCESS - Markdown of a date", []string{"azm", "--markdown", "2024-09-07"}, true, []string{"2024-09-07"}, ""},
+		{"FAILURE - No report", []string{}, false, nil, "unknown report"},
+		{"FAILURE - Unknown report", []string{"steps"}, false, nil, "unknown report"},
+		{"FAILURE - Unknown flag", []string{"azm", "--html"}, false, nil, "report azm: flag provided but not defined: -html"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			markdown, rest, err := parseReportArgs(tc.args)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedMarkdown, markdown)
+			assert.Equal(t, tc.expectedRest, rest)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Name of the state file of a batch export, in the output directory
+const resumeStateFile = ".fitbittcx-resume.json"
+
+// Progress of a batch export, saved after every finished activity, so an interrupted batch can be
+// continued with --resume. It is removed when the batch finishes without failures
+type resumeState struct {
+	Batch    string           `json:"batch"` // Identifies the batch: dates, filters and file name template
+	Done     map[int64]string `json:"done"`  // Log ID of the finished activities and their file
+	fileName string
+}
+
+// Opens the state of the batch. With resume the saved state is continued, unless it belongs to another batch
+func loadResumeState(dir string, batch string, resume bool) (*resumeState, error) {
+	state := &resumeState{Batch: batch, Done: map[int64]string{}, fileName: filepath.Join(dir, resumeStateFile)}
+	if !resume {
+		return state, nil
+	}
+
+	byteValue, err := os.ReadFile(state.fileName)
+	if os.IsNotExist(err) {
+		slog.Info("Nothing to resume, starting the batch", "state", state.fileName)
+		return state, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read resume state: %s", err)
+	}
+	var saved resumeState
+	if err := json.Unmarshal(byteValue, &saved); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal resume state %s: %s", state.fileName, err)
+	}
+	if saved.Batch != batch {
+		slog.Warn("The saved state is of another batch, starting the batch", "saved", saved.Batch, "batch", batch)
+		return state, nil
+	}
+	if saved.Done != nil {
+		state.Done = saved.Done
+	}
+	slog.Info("Resuming batch", "done", len(state.Done))
+	return state, nil
+}
+
+// Tells whether the activity was finished by a previous run of the batch
+func (s *resumeState) isDone(logID int64) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.Done[logID]
+	return ok
+}
+
+// Records the finished activity
+func (s *resumeState) markDone(logID int64, fileName string) error {
+	if s == nil {
+		return nil
+	}
+	s.Done[logID] = fileName
+	byteValue, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal resume state: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.fileName), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory: %s", err)
+	}
+	// Replace the state at once, an interruption must not leave a truncated file
+	tmpFile := s.fileName + ".tmp"
+	if err := os.WriteFile(tmpFile, byteValue, 0644); err != nil {
+		return fmt.Errorf("failed to write resume state: %s", err)
+	}
+	return os.Rename(tmpFile, s.fileName)
+}
+
+// Removes the state of a finished batch
+func (s *resumeState) remove() {
+	if s == nil {
+		return
+	}
+	if err := os.Remove(s.fileName); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove resume state", "err", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestResumeState(t *testing.T) {
+	dir := t.TempDir()
+
+	state, err := loadResumeState(dir, "2024-09-01..2024-09-30", false)
+	assert.NoError(t, err)
+	assert.False(t, state.isDone(1))
+	assert.NoError(t, state.markDone(1, "Swim-1.tcx"))
+
+	// Resuming the same batch continues its state
+	resumed, err := loadResumeState(dir, "2024-09-01..2024-09-30", true)
+	assert.NoError(t, err)
+	assert.True(t, resumed.isDone(1))
+	assert.False(t, resumed.isDone(2))
+
+	// Another batch starts over
+	other, err := loadResumeState(dir, "2024-10-01..2024-10-31", true)
+	assert.NoError(t, err)
+	assert.False(t, other.isDone(1))
+
+	// Without --resume the batch starts over too
+	fresh, err := loadResumeState(dir, "2024-09-01..2024-09-30", false)
+	assert.NoError(t, err)
+	assert.False(t, fresh.isDone(1))
+
+	resumed.remove()
+	assert.NoFileExists(t, filepath.Join(dir, resumeStateFile))
+
+	var none *resumeState
+	assert.False(t, none.isDone(1))
+	assert.NoError(t, none.markDone(1, "Swim-1.tcx"))
+}
+
+func TestExportActivitiesResume(t *testing.T) {
+	failing := true
+	var downloaded []string
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing && r.URL.Path == "/1/user/-/activities/2.tcx" {
+			http.Error(w, `{"errors":[{"errorType":"system"}]}`, http.StatusTooManyRequests)
+			return
+		}
+		downloaded = append(downloaded, r.URL.Path)
+		w.Write([]byte(testActivityTcx))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+	activities := []data.Activity{{ActivityParentName: "Treadmill", LogID: 1}, {ActivityParentName: "Weights", LogID: 2}}
+	opts := exportOptions{batch: "2024-09-07"}
+
+	err := exportActivities(activities, opts)
+	assert.Equal(t, exitPartial, exitCode(err))
+	assert.FileExists(t, filepath.Join(outputDir, resumeStateFile))
+
+	// The resumed batch only downloads the activity that failed, then removes its state
+	failing = false
+	downloaded = nil
+	opts.resume = true
+	opts.onConflict = conflictSkip
+	assert.NoError(t, exportActivities(activities, opts))
+	assert.Equal(t, []string{"/1/user/-/activities/2.tcx"}, downloaded)
+	assert.FileExists(t, filepath.Join(outputDir, "Weights-2.tcx"))
+	_, err = os.Stat(filepath.Join(outputDir, resumeStateFile))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Retries of the GET requests failing transiently, on a network error or a 5xx response of the Fitbit API.
+// The other requests change data at Fitbit, they are not sent again
+type retryPolicy struct {
+	count    int           // Retries of a request after its first try, 0 to fail at once
+	backoff  time.Duration // Pause before the first retry, doubled before each next one
+	maxPause time.Duration // Longest pause before a retry
+}
+
+var apiRetry = retryPolicy{count: 3, backoff: time.Second, maxPause: 30 * time.Second}
+
+// Pause before the nth retry (1 for the first), the exponential backoff with jitter: a random duration between
+// its half and the full backoff, so parallel requests failing together do not retry together
+func (p retryPolicy) pause(n int) time.Duration {
+	backoff := p.maxPause
+	if shift := n - 1; shift < 30 && p.backoff<<shift < p.maxPause {
+		backoff = p.backoff << shift
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// Tells whether the request is worth retrying: a GET request which failed on the network or got a 5xx response
+func transientFailure(method string, status int, err error) bool {
+	if method != http.MethodGet {
+		return false
+	}
+	if err != nil {
+		var netErr net.Error
+		return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestAPIGetRetriesServerErrors(t *testing.T) {
+	requests := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			http.Error(w, `{"errors":[{"errorType":"system"}]}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"activities":[]}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	slept := stubSleep(t)
+
+	body, err := apiGet("https://api.fitbit.com/1/user/-/activities/date/2024-09-07.json")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"activities":[]}`, string(body))
+	assert.Equal(t, 3, requests)
+	assert.Len(t, *slept, 2)
+	assert.InDelta(t, 750*time.Millisecond, (*slept)[0], float64(250*time.Millisecond))
+	assert.InDelta(t, 1500*time.Millisecond, (*slept)[1], float64(500*time.Millisecond))
+}
+
+func TestAPIGetRetriesGiveUp(t *testing.T) {
+	requests := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, `{"errors":[{"errorType":"system"}]}`, http.StatusInternalServerError)
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	slept := stubSleep(t)
+
+	_, err := apiGet("https://api.fitbit.com/1/user/-/activities/date/2024-09-07.json")
+	var apiErr *apiError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusInternalServerError, apiErr.status)
+	assert.Equal(t, apiRetry.count+1, requests)
+	assert.Len(t, *slept, apiRetry.count)
+}
+
+func TestAPIPostNotRetried(t *testing.T) {
+	requests := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, `{"errors":[{"errorType":"system"}]}`, http.StatusBadGateway)
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	slept := stubSleep(t)
+
+	_, err := apiPost("https://api.fitbit.com/1/user/-/activities.json", url.Values{"activityId": {"90013"}})
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Empty(t, *slept)
+}
+
+func TestAPIGetRetriesNetworkErrors(t *testing.T) {
+	requests := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// Drop the connection without a response
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{"activities":[]}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	slept := stubSleep(t)
+
+	body, err := apiGet("https://api.fitbit.com/1/user/-/activities/date/2024-09-07.json")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"activities":[]}`, string(body))
+	assert.Equal(t, 2, requests)
+	assert.Len(t, *slept, 1)
+}
+
+func TestRetryPolicyPause(t *testing.T) {
+	policy := retryPolicy{count: 10, backoff: time.Second, maxPause: 30 * time.Second}
+	testCases := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 16 * time.Second},
+		{6, 30 * time.Second},
+		{64, 30 * time.Second},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("SUCCESS - Retry %d", tc.retry), func(t *testing.T) {
+			for range 20 {
+				pause := policy.pause(tc.retry)
+				assert.GreaterOrEqual(t, pause, tc.max/2)
+				assert.LessOrEqual(t, pause, tc.max)
+			}
+		})
+	}
+}
+
+func TestTransientFailure(t *testing.T) {
+	testCases := []struct {
+		testName string
+		method   string
+		status   int
+		err      error
+		expected bool
+	}{
+		{"SUCCESS - Server error", http.MethodGet, http.StatusInternalServerError, nil, true},
+		{"SUCCESS - Gateway timeout", http.MethodGet, http.StatusGatewayTimeout, nil, true},
+		{"SUCCESS - Network error", http.MethodGet, 0, fmt.Errorf("failed to send request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), true},
+		{"SUCCESS - Truncated body", http.MethodGet, 0, fmt.Errorf("failed to read response body: %w", io.ErrUnexpectedEOF), true},
+		{"SUCCESS - Not found", http.MethodGet, http.StatusNotFound, nil, false},
+		{"SUCCESS - Success", http.MethodGet, http.StatusOK, nil, false},
+		{"SUCCESS - Invalid request", http.MethodGet, 0, errors.New("failed to create request"), false},
+		{"SUCCESS - Server error of a POST", http.MethodPost, http.StatusInternalServerError, nil, false},
+		{"SUCCESS - Server error of a DELETE", http.MethodDelete, http.StatusServiceUnavailable, nil, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, transientFailure(tc.method, tc.status, tc.err))
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Arguments of the search command
+type searchOptions struct {
+	query string // Text to find in the name or description of the activities, case-insensitively
+	since string // First date to search, YYYY-MM-DD or a relative date
+	until string // Last date to search, YYYY-MM-DD or a relative date
+}
+
+// Parses the flags following the search command, e.g. search --query swim --since 2024-01-01
+func parseSearchArgs(args []string) (searchOptions, error) {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var opts searchOptions
+	fs.StringVar(&opts.query, "query", "", "text to find in the name or description of the activities")
+	fs.StringVar(&opts.since, "since", "-365d", "first date to search (YYYY-MM-DD, today, yesterday or -<n>d)")
+	fs.StringVar(&opts.until, "until", "today", "last date to search (YYYY-MM-DD, today, yesterday or -<n>d)")
+	if err := fs.Parse(args); err != nil {
+		return searchOptions{}, fmt.Errorf("search: %s", err)
+	}
+	if fs.NArg() != 0 {
+		return searchOptions{}, fmt.Errorf("search: unexpected argument %q, use: search --query <text> [--since <date>] [--until <date>]", fs.Arg(0))
+	}
+	if strings.TrimSpace(opts.query) == "" {
+		return searchOptions{}, fmt.Errorf("search: --query is required")
+	}
+	return opts, nil
+}
+
+// Prints the activities of the date range whose name or description contains the query, as a table or as JSON
+func searchActivities(out io.Writer, query string, start time.Time, end time.Time, opts exportOptions, jsonOutput bool) error {
+	logs, err := getActivityLogs(start, end)
+	if err != nil {
+		return err
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var matching []data.ActivityLog
+	for _, log := range logs {
+		if strings.Contains(strings.ToLower(log.ActivityName), query) || strings.Contains(strings.ToLower(log.Description), query) {
+			matching = append(matching, log)
+		}
+	}
+	return printActivityLogs(out, matching, opts, jsonOutput)
+}
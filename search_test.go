@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchArgs(t *testing.T) {
+	testCases := []struct {
+		testName string
+		args     []string
+		expected searchOptions
+		wantErr  bool
+	}{
+		{"SUCCESS - Query and since", []string{"--query", "swim", "--since", "2024-01-01"}, searchOptions{query: "swim", since: "2024-01-01", until: "today"}, false},
+		{"SUCCESS - Defaults", []string{"--query=run"}, searchOptions{query: "run", since: "-365d", until: "today"}, false},
+		{"FAILURE - Missing query", []string{"--since", "2024-01-01"}, searchOptions{}, true},
+		{"FAILURE - Unknown flag", []string{"--query", "swim", "--from", "2024-01-01"}, searchOptions{}, true},
+		{"FAILURE - Extra argument", []string{"--query", "swim", "2024-01-01"}, searchOptions{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			opts, err := parseSearchArgs(tc.args)
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.expected, opts)
+		})
+	}
+}
+
+func TestSearchActivities(t *testing.T) {
+	stubActivityList(t)
+	start := time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 9, 8, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	assert.NoError(t, searchActivities(&out, "SWI", start, end, exportOptions{}, true))
+	var listed []listedActivity
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &listed))
+	assert.Len(t, listed, 1)
+	assert.Equal(t, int64(1), listed[0].LogID)
+
+	// The description is searched too
+	out.Reset()
+	assert.NoError(t, searchActivities(&out, "leg day", start, end, exportOptions{}, true))
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &listed))
+	assert.Len(t, listed, 1)
+	assert.Equal(t, int64(3), listed[0].LogID)
+
+	out.Reset()
+	assert.NoError(t, searchActivities(&out, "yoga", start, end, exportOptions{}, true))
+	assert.Equal(t, "[]\n", out.String())
+}
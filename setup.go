@@ -0,0 +1,132 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var (
+	defaultScopes = []string{"activity", "heartrate", "location", "profile"} // only request what is really needed
+	knownScopes   = []string{"activity", "cardio_fitness", "electrocardiogram", "heartrate", "location", "nutrition", "oxygen_saturation", "profile", "respiratory_rate", "settings", "sleep", "social", "temperature", "weight"}
+)
+
+// Asks for the client ID, secret, redirect URL and scopes, validates them and writes the credentials file
+func runInit(in io.Reader, out io.Writer, fileName string) error {
+	reader := bufio.NewReader(in)
+
+	if _, err := os.Stat(fileName); err == nil {
+		overwrite, err := prompt(reader, out, fileName+" already exists, overwrite it? [y/N]", "n")
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(overwrite, "y") && !strings.EqualFold(overwrite, "yes") {
+			return fmt.Errorf("aborted, %s left unchanged", fileName)
+		}
+	}
+
+	fmt.Fprintln(out, "Register an app at https://dev.fitbit.com/apps/new to obtain the OAuth 2.0 Client ID.")
+	var apiCred data.Credentials
+	var err error
+	for apiCred.CId == "" {
+		if apiCred.CId, err = prompt(reader, out, "OAuth 2.0 Client ID", ""); err != nil {
+			return err
+		}
+	}
+	if apiCred.CSecret, err = prompt(reader, out, "Client Secret (only for Server applications, leave empty otherwise)", ""); err != nil {
+		return err
+	}
+	for {
+		if apiCred.RedirectURL, err = prompt(reader, out, "Redirect URL", "http://localhost:8080/callback"); err != nil {
+			return err
+		}
+		if err = validateRedirectURL(apiCred.RedirectURL); err == nil {
+			break
+		}
+		fmt.Fprintln(out, "Invalid redirect URL:", err)
+	}
+	for {
+		scopes, err := prompt(reader, out, "Scopes, separated by spaces ("+strings.Join(knownScopes, " ")+")", strings.Join(defaultScopes, " "))
+		if err != nil {
+			return err
+		}
+		if apiCred.Scopes, err = parseScopes(scopes); err == nil {
+			break
+		}
+		fmt.Fprintln(out, "Invalid scopes:", err)
+	}
+
+	byteValue, err := json.MarshalIndent(apiCred, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials: %s", err)
+	}
+	if err := os.WriteFile(fileName, append(byteValue, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %s", fileName, err)
+	}
+	fmt.Fprintln(out, "Credentials saved to", fileName)
+	return nil
+}
+
+// Prints the question and reads the answer, returning the default value for an empty answer
+func prompt(reader *bufio.Reader, out io.Writer, question string, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		fmt.Fprintf(out, "%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Fprintf(out, "%s: ", question)
+	}
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", fmt.Errorf("failed to read input: %s", err)
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return defaultValue, nil
+	}
+	return answer, nil
+}
+
+// Checks that the redirect URL is an absolute http(s) URL and its port can be listened on
+func validateRedirectURL(redirectURL string) error {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("the scheme must be http or https")
+	}
+	listenAddr, _, err := callbackAddr(redirectURL)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("the port is not available: %s", err)
+	}
+	return listener.Close()
+}
+
+// Splits the space or comma separated scopes and checks that they are known Fitbit scopes
+func parseScopes(scopes string) ([]string, error) {
+	fields := strings.FieldsFunc(scopes, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range fields {
+		known := false
+		for _, k := range knownScopes {
+			if scope == k {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return fields, nil
+}
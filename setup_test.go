@@ -0,0 +1,71 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunInit(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "credentials.json")
+
+	// Invalid answers are asked again, empty answers take the default
+	input := strings.Join([]string{
+		"",                            // empty client ID, asked again
+		"test-client-id",              // client ID
+		"",                            // no secret
+		"ftp://localhost/callback",    // invalid redirect URL, asked again
+		"http://localhost:0/callback", // redirect URL
+		"activity steps",              // unknown scope, asked again
+		"activity,heartrate sleep",    // scopes
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	assert.NoError(t, runInit(strings.NewReader(input), &out, fileName))
+
+	byteValue, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	var apiCred data.Credentials
+	assert.NoError(t, json.Unmarshal(byteValue, &apiCred))
+	assert.Equal(t, "test-client-id", apiCred.CId)
+	assert.Equal(t, "", apiCred.CSecret)
+	assert.Equal(t, "http://localhost:0/callback", apiCred.RedirectURL)
+	assert.Equal(t, []string{"activity", "heartrate", "sleep"}, apiCred.Scopes)
+
+	// The written file is a valid credentials file
+	_, oauthCfg, err := readCredFile(bytes.NewReader(byteValue), "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"activity", "heartrate", "sleep"}, oauthCfg.Scopes)
+
+	// Existing file is not overwritten without confirmation
+	assert.Error(t, runInit(strings.NewReader("n\n"), &out, fileName))
+}
+
+func TestValidateRedirectURL(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	_, busyPort, _ := net.SplitHostPort(listener.Addr().String())
+
+	assert.NoError(t, validateRedirectURL("http://localhost:0/callback"))
+	assert.Error(t, validateRedirectURL("localhost:8080/callback"))
+	assert.Error(t, validateRedirectURL("http:///callback"))
+	assert.Error(t, validateRedirectURL("http://127.0.0.1:"+busyPort+"/callback"))
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := parseScopes("activity heartrate, location")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"activity", "heartrate", "location"}, scopes)
+
+	_, err = parseScopes(" ")
+	assert.Error(t, err)
+	_, err = parseScopes("activity steps")
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Returns the sidecar of the exported file, e.g. "Swim-12345.json" for "Swim-12345.tcx"
+func sidecarFileName(tcxFileName string) string {
+	return strings.TrimSuffix(tcxFileName, ".tcx") + ".json"
+}
+
+// Gets the full summary of the activity, the entry of the activity log list, which unlike the daily summary
+// has the heart rate zones, Active Zone Minutes and the source device. Falls back to the daily summary
+// when the list does not have the activity. The extra fields are added to it, e.g. the intraday Active Zone Minutes
+func activitySummary(activity data.Activity, extra map[string]any) ([]byte, error) {
+	log, ok, err := activityLog(activity)
+	if err != nil {
+		return nil, err
+	}
+	summary := log.Raw
+	if !ok || len(summary) == 0 {
+		if summary, err = json.Marshal(activity); err != nil {
+			return nil, fmt.Errorf("failed to marshal activity summary: %s", err)
+		}
+	}
+	if len(extra) > 0 {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(summary, &fields); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal activity summary: %s", err)
+		}
+		for name, value := range extra {
+			if fields[name], err = json.Marshal(value); err != nil {
+				return nil, fmt.Errorf("failed to marshal %s: %s", name, err)
+			}
+		}
+		if summary, err = json.Marshal(fields); err != nil {
+			return nil, fmt.Errorf("failed to marshal activity summary: %s", err)
+		}
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, summary, "", "\t"); err != nil {
+		return nil, fmt.Errorf("failed to indent activity summary: %s", err)
+	}
+	return indented.Bytes(), nil
+}
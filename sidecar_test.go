@@ -0,0 +1,76 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestExportActivitiesSidecar(t *testing.T) {
+	listRequests := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/user/-/activities/list.json":
+			listRequests++
+			w.Write([]byte(`{"activities":[
+				{"logId":1,"activityName":"Swim","calories":300,"startTime":"2024-09-07T07:00:00.000+02:00",
+					"heartRateZones":[{"name":"Cardio","minutes":12}],"activeZoneMinutes":{"totalMinutes":20},"source":{"name":"Charge 6"}}],
+				"pagination":{"next":""}}`))
+		default:
+			w.Write([]byte(testActivityTcx))
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	outputDir = t.TempDir()
+	defer func() { outputDir = "" }()
+	activityLogCache.days = map[string]map[int64]data.ActivityLog{}
+
+	activities := []data.Activity{
+		{ActivityParentName: "Swim", LogID: 1, StartDate: "2024-09-07"},
+		{ActivityParentName: "Weights", LogID: 2, StartDate: "2024-09-07", Calories: 150}, // not in the list
+	}
+	assert.NoError(t, exportActivities(activities, exportOptions{fileTemplate: defaultFileTemplate, sidecar: true}))
+	assert.Equal(t, 1, listRequests)
+
+	var summary map[string]any
+	byteValue, err := os.ReadFile(filepath.Join(outputDir, "Swim-1.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(byteValue, &summary))
+	assert.Equal(t, map[string]any{"name": "Charge 6"}, summary["source"])
+	assert.Contains(t, summary, "heartRateZones")
+
+	// Falls back to the daily summary
+	byteValue, err = os.ReadFile(filepath.Join(outputDir, "Weights-2.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(byteValue, &summary))
+	assert.Equal(t, float64(150), summary["calories"])
+}
+
+func TestSidecarFileName(t *testing.T) {
+	assert.Equal(t, filepath.Join("2024", "Swim-1.json"), sidecarFileName(filepath.Join("2024", "Swim-1.tcx")))
+}
+
+func TestActivitySummaryActiveZoneMinutes(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"activities":[{"logId":1,"activityName":"Run","startTime":"2024-09-07T10:00:00.000+02:00","activeZoneMinutes":{"totalMinutes":2}}],"pagination":{"next":""}}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	activityLogCache.days = map[string]map[int64]data.ActivityLog{}
+	defer func() { activityLogCache.days = map[string]map[int64]data.ActivityLog{} }()
+
+	var minutes []data.ActiveZoneMinutesMinute
+	assert.NoError(t, json.Unmarshal([]byte(`[{"minute":"2024-09-07T10:05:00","value":{"activeZoneMinutes":2,"cardioActiveZoneMinutes":2}}]`), &minutes))
+	byteValue, err := activitySummary(data.Activity{LogID: 1, StartDate: "2024-09-07"}, map[string]any{"activeZoneMinutesIntraday": minutes})
+	assert.NoError(t, err)
+
+	var summary map[string]any
+	assert.NoError(t, json.Unmarshal(byteValue, &summary))
+	assert.Equal(t, "Run", summary["activityName"])
+	assert.Len(t, summary["activeZoneMinutesIntraday"], 1)
+}
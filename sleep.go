@@ -0,0 +1,90 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Longest date range of a single sleep log request
+const sleepMaxDays = 100
+
+// Period of a sleep stage of a sleep log, as exported with intraday
+type sleepStage struct {
+	LogID    int64  `json:"logId"`
+	DateTime string `json:"dateTime"`
+	Level    string `json:"level"`
+	Seconds  int    `json:"seconds"`
+}
+
+// Levels of the sleep summary CSV, stages and classic
+var sleepLevels = []string{"deep", "light", "rem", "wake", "asleep", "restless", "awake"}
+
+// Writes the sleep logs of the date range as CSV or as JSON: the summary of each sleep, with the minutes per stage,
+// or with intraday, each period of the stages. The JSON summary has the logs as received, stages included.
+// Fitbit assigns a sleep to the day it ends on
+func exportSleep(out io.Writer, start time.Time, end time.Time, intraday bool, jsonOutput bool) error {
+	logs := []data.SleepLog{}
+	err := forDateChunks(start, end, sleepMaxDays, func(chunkStart time.Time, chunkEnd time.Time) error {
+		body, err := apiGet(userURL("sleep/date/" + chunkStart.Format(dateLayout) + "/" + chunkEnd.Format(dateLayout) + ".json"))
+		if err != nil {
+			return fmt.Errorf("failed to fetch sleep from %s to %s: %w", chunkStart.Format(dateLayout), chunkEnd.Format(dateLayout), err)
+		}
+		var chunk data.SleepLogs
+		if err := json.Unmarshal(body, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal sleep: %s", err)
+		}
+		var raw struct {
+			Sleep []json.RawMessage `json:"sleep"`
+		}
+		if err := json.Unmarshal(body, &raw); err == nil && len(raw.Sleep) == len(chunk.Sleep) {
+			for i := range chunk.Sleep {
+				chunk.Sleep[i].Raw = raw.Sleep[i]
+			}
+		}
+		logs = append(logs, chunk.Sleep...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The API lists the latest first
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].StartTime < logs[j].StartTime })
+
+	if intraday {
+		stages := []sleepStage{}
+		var rows [][]string
+		for _, log := range logs {
+			for _, stage := range log.Levels.Data {
+				stages = append(stages, sleepStage{LogID: log.LogID, DateTime: stage.DateTime, Level: stage.Level, Seconds: stage.Seconds})
+				rows = append(rows, []string{strconv.FormatInt(log.LogID, 10), stage.DateTime, stage.Level, strconv.Itoa(stage.Seconds)})
+			}
+		}
+		return writeHealthRecords(out, jsonOutput, stages, []string{"log_id", "time", "level", "seconds"}, rows)
+	}
+
+	records := []json.RawMessage{}
+	var rows [][]string
+	for _, log := range logs {
+		records = append(records, log.Raw)
+		row := []string{log.DateOfSleep, log.StartTime, log.EndTime, strconv.FormatBool(log.IsMainSleep), log.Type,
+			strconv.Itoa(log.MinutesAsleep), strconv.Itoa(log.MinutesAwake), strconv.Itoa(log.TimeInBed), strconv.Itoa(log.Efficiency)}
+		for _, level := range sleepLevels {
+			minutes := ""
+			if summary, ok := log.Levels.Summary[level]; ok {
+				minutes = strconv.Itoa(summary.Minutes)
+			}
+			row = append(row, minutes)
+		}
+		rows = append(rows, row)
+	}
+	header := []string{"date", "start", "end", "main_sleep", "type", "minutes_asleep", "minutes_awake", "time_in_bed", "efficiency"}
+	for _, level := range sleepLevels {
+		header = append(header, level+"_minutes")
+	}
+	return writeHealthRecords(out, jsonOutput, records, header, rows)
+}
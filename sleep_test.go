@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// Serves a night with stages and a classic nap, the latest first
+func stubSleepLogs(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1.2/user/-/sleep/date/2024-09-07/2024-09-07.json", r.URL.Path)
+		w.Write([]byte(`{"sleep":[
+			{"logId":2,"dateOfSleep":"2024-09-07","startTime":"2024-09-07T14:00:00.000","endTime":"2024-09-07T14:40:00.000","isMainSleep":false,"type":"classic",
+				"efficiency":95,"minutesAsleep":38,"minutesAwake":2,"timeInBed":40,"levels":{"summary":{"asleep":{"minutes":38},"awake":{"minutes":2}},"data":[]}},
+			{"logId":1,"dateOfSleep":"2024-09-07","startTime":"2024-09-06T23:10:00.000","endTime":"2024-09-07T06:40:00.000","isMainSleep":true,"type":"stages",
+				"efficiency":92,"minutesAsleep":410,"minutesAwake":40,"timeInBed":450,"infoCode":0,
+				"levels":{"summary":{"deep":{"minutes":80},"light":{"minutes":230},"rem":{"minutes":100},"wake":{"minutes":40}},
+				"data":[{"dateTime":"2024-09-06T23:10:00.000","level":"wake","seconds":300},{"dateTime":"2024-09-06T23:15:00.000","level":"light","seconds":1800}]}}]}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+}
+
+func TestExportSleep(t *testing.T) {
+	stubSleepLogs(t)
+	day := time.Date(2024, 9, 7, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	assert.NoError(t, exportSleep(&out, day, day, false, false))
+	assert.Equal(t, "date,start,end,main_sleep,type,minutes_asleep,minutes_awake,time_in_bed,efficiency,deep_minutes,light_minutes,rem_minutes,wake_minutes,asleep_minutes,restless_minutes,awake_minutes\n"+
+		"2024-09-07,2024-09-06T23:10:00.000,2024-09-07T06:40:00.000,true,stages,410,40,450,92,80,230,100,40,,,\n"+
+		"2024-09-07,2024-09-07T14:00:00.000,2024-09-07T14:40:00.000,false,classic,38,2,40,95,,,,,38,,2\n", out.String())
+
+	// The JSON has the logs as received
+	out.Reset()
+	assert.NoError(t, exportSleep(&out, day, day, false, true))
+	var logs []map[string]any
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &logs))
+	assert.Len(t, logs, 2)
+	assert.Equal(t, float64(0), logs[0]["infoCode"])
+}
+
+func TestExportSleepStages(t *testing.T) {
+	stubSleepLogs(t)
+	day := time.Date(2024, 9, 7, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	assert.NoError(t, exportSleep(&out, day, day, true, false))
+	assert.Equal(t, "log_id,time,level,seconds\n1,2024-09-06T23:10:00.000,wake,300\n1,2024-09-06T23:15:00.000,light,1800\n", out.String())
+}
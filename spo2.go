@@ -0,0 +1,62 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Longest date range of a single SpO2 request
+const spo2MaxDays = 30
+
+// Writes the SpO2 (blood oxygen saturation) of the date range as CSV or as JSON: the daily average, minimum and
+// maximum, or with intraday, every reading. Fitbit assigns the readings of a night to the day it ends on
+func exportSpO2(out io.Writer, start time.Time, end time.Time, intraday bool, jsonOutput bool) error {
+	summaries := []data.SpO2Summary{}
+	readings := []data.SpO2Reading{}
+	err := forDateChunks(start, end, spo2MaxDays, func(chunkStart time.Time, chunkEnd time.Time) error {
+		url := userURL("spo2/date/" + chunkStart.Format(dateLayout) + "/" + chunkEnd.Format(dateLayout))
+		if intraday {
+			url += "/all"
+		}
+		body, err := apiGet(url + ".json")
+		if err != nil {
+			return fmt.Errorf("failed to fetch SpO2 from %s to %s: %w", chunkStart.Format(dateLayout), chunkEnd.Format(dateLayout), err)
+		}
+
+		if !intraday {
+			var chunk []data.SpO2Summary
+			if err := json.Unmarshal(body, &chunk); err != nil {
+				return fmt.Errorf("failed to unmarshal SpO2: %s", err)
+			}
+			summaries = append(summaries, chunk...)
+			return nil
+		}
+		var days []data.SpO2Intraday
+		if err := json.Unmarshal(body, &days); err != nil {
+			return fmt.Errorf("failed to unmarshal SpO2: %s", err)
+		}
+		for _, day := range days {
+			readings = append(readings, day.Minutes...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if intraday {
+		var rows [][]string
+		for _, reading := range readings {
+			rows = append(rows, []string{reading.Minute, formatHealthValue(reading.Value)})
+		}
+		return writeHealthRecords(out, jsonOutput, readings, []string{"time", "spo2"}, rows)
+	}
+	var rows [][]string
+	for _, summary := range summaries {
+		rows = append(rows, []string{summary.DateTime, formatHealthValue(summary.Value.Avg), formatHealthValue(summary.Value.Min), formatHealthValue(summary.Value.Max)})
+	}
+	return writeHealthRecords(out, jsonOutput, summaries, []string{"date", "avg", "min", "max"}, rows)
+}
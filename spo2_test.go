@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestExportSpO2Summary(t *testing.T) {
+	var requested []string
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Path == "/1/user/-/spo2/date/2024-08-01/2024-08-30.json" {
+			w.Write([]byte(`[{"dateTime":"2024-08-01","value":{"avg":95.7,"min":94.1,"max":97.9}}]`))
+			return
+		}
+		w.Write([]byte(`[{"dateTime":"2024-09-14","value":{"avg":96,"min":93,"max":99}}]`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	var out bytes.Buffer
+	start := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 9, 14, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, exportSpO2(&out, start, end, false, false))
+
+	assert.Equal(t, []string{"/1/user/-/spo2/date/2024-08-01/2024-08-30.json", "/1/user/-/spo2/date/2024-08-31/2024-09-14.json"}, requested)
+	assert.Equal(t, "date,avg,min,max\n2024-08-01,95.7,94.1,97.9\n2024-09-14,96,93,99\n", out.String())
+}
+
+func TestExportSpO2IntradayJSON(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1/user/-/spo2/date/2024-09-07/2024-09-07/all.json", r.URL.Path)
+		w.Write([]byte(`[{"dateTime":"2024-09-07","minutes":[{"value":95.7,"minute":"2024-09-07T03:12:00"},{"value":96.1,"minute":"2024-09-07T03:13:00"}]}]`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	var out bytes.Buffer
+	day := time.Date(2024, 9, 7, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, exportSpO2(&out, day, day, true, true))
+	assert.JSONEq(t, `[{"minute":"2024-09-07T03:12:00","value":95.7},{"minute":"2024-09-07T03:13:00","value":96.1}]`, out.String())
+
+	// CSV
+	out.Reset()
+	assert.NoError(t, exportSpO2(&out, day, day, true, false))
+	assert.Equal(t, "time,spo2\n2024-09-07T03:12:00,95.7\n2024-09-07T03:13:00,96.1\n", out.String())
+}
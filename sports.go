@@ -0,0 +1,118 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Transformations of the export, applied to the activity types whose sport mapping lists them
+const (
+	recipePoolLengths   = "pool-lengths"   // A lap per pool length, from the swim lengths of the activity log
+	recipeCadence       = "cadence"        // Run cadence from the steps, with --cadence
+	recipeDistanceCurve = "distance-curve" // Distance of the track points from the distance per minute, with --distance-curve
+	recipeFitbitCreator = "fitbit-creator" // Fitbit as the creator of the TCX when the recording device is unknown
+)
+
+var sportRecipes = []string{recipePoolLengths, recipeCadence, recipeDistanceCurve, recipeFitbitCreator}
+
+// TCX sport and transformations of an activity type. An empty sport keeps the sport of the catalog
+type sportMapping struct {
+	sport   string
+	recipes []string
+}
+
+// Built-in sport mappings by activity ID, the sports section of config.yaml overrides them:
+//
+//	sports:
+//	  Treadmill: Running
+//	  "90025": {sport: Other, recipes: [pool-lengths]}
+//
+// The indoor activity types get a sport of the TCX schema whatever their catalog category, e.g. Yoga is in
+// Sports and Workouts, and Fitbit as the creator, as Fitbit writes their TCX without a device
+var defaultSportMappings = map[int]sportMapping{
+	activityTypeSwim:          {sport: "Swim", recipes: []string{recipePoolLengths}},
+	activityTypeTreadmill:     {recipes: []string{recipeCadence, recipeDistanceCurve, recipeFitbitCreator}},
+	activityTypeRun:           {recipes: []string{recipeCadence}},
+	activityTypeWalk:          {recipes: []string{recipeCadence}},
+	activityTypeWeights:       {recipes: []string{recipeFitbitCreator}},
+	activityTypeSpinning:      {sport: "Biking", recipes: []string{recipeFitbitCreator}},
+	activityTypeElliptical:    {sport: "Other", recipes: []string{recipeFitbitCreator}},
+	activityTypeStairclimber:  {sport: "Other", recipes: []string{recipeFitbitCreator}},
+	activityTypeRowingMachine: {sport: "Other", recipes: []string{recipeFitbitCreator}},
+	activityTypeYoga:          {sport: "Other", recipes: []string{recipeFitbitCreator}},
+	activityTypeWorkout:       {sport: "Other", recipes: []string{recipeFitbitCreator}},
+}
+
+// Tells whether the transformation applies to the activity type
+func (m sportMapping) has(recipe string) bool {
+	return slices.Contains(m.recipes, recipe)
+}
+
+// Parses a sport mapping of config.yaml, either the sport alone or the sport and the recipes:
+//
+//	Spinning: Biking
+//	Open Water Swim: {sport: Other, recipes: [pool-lengths]}
+func parseSportMapping(name string, value interface{}) (sportMapping, error) {
+	fields, ok := stringKeys(value)
+	if !ok {
+		fields = map[string]interface{}{"sport": value}
+	}
+	var mapping sportMapping
+	for key, value := range fields {
+		switch key {
+		case "sport":
+			// The Sport of the TCX schema is case-sensitive, the sport is written as spelled in tcxSports
+			sport, ok := findFold(tcxSports, fmt.Sprint(value))
+			if !ok {
+				return sportMapping{}, fmt.Errorf("invalid sport %q of %s, use %s", fmt.Sprint(value), name, strings.Join(tcxSports, ", "))
+			}
+			mapping.sport = sport
+		case "recipes":
+			recipes, ok := value.([]interface{})
+			if !ok {
+				return sportMapping{}, fmt.Errorf("recipes of %s must be a list", name)
+			}
+			mapping.recipes = []string{}
+			for _, recipe := range recipes {
+				recipe := fmt.Sprint(recipe)
+				if !slices.Contains(sportRecipes, recipe) {
+					return sportMapping{}, fmt.Errorf("unknown recipe %q of %s, use %s", recipe, name, strings.Join(sportRecipes, ", "))
+				}
+				mapping.recipes = append(mapping.recipes, recipe)
+			}
+		default:
+			return sportMapping{}, fmt.Errorf("unknown key %q of %s, use sport and recipes", key, name)
+		}
+	}
+	return mapping, nil
+}
+
+// Returns the sport mapping of the activity: the built-in mapping of its activity type or of its parent type,
+// overridden by the mapping configured for its activity ID, parent ID or parent
+// name. Configured recipes replace the built-in ones, an empty list drops them
+func (cfg *fileConfig) sportMapping(activity data.Activity) sportMapping {
+	mapping, ok := defaultSportMappings[activity.ActivityID]
+	if !ok {
+		mapping = defaultSportMappings[activity.ActivityParentID]
+	}
+	if cfg == nil {
+		return mapping
+	}
+	for _, key := range []string{strconv.Itoa(activity.ActivityID), strconv.Itoa(activity.ActivityParentID), strings.ToLower(activity.ActivityParentName)} {
+		configured, ok := cfg.sports[key]
+		if !ok || key == "0" || key == "" {
+			continue
+		}
+		if configured.sport != "" {
+			mapping.sport = configured.sport
+		}
+		if configured.recipes != nil {
+			mapping.recipes = configured.recipes
+		}
+		break
+	}
+	return mapping
+}
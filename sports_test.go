@@ -0,0 +1,109 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSportMapping(t *testing.T) {
+	testCases := []struct {
+		testName        string
+		value           interface{}
+		expectedMapping sportMapping
+		expectedError   string
+	}{
+		{"SUCCESS - Sport", "Running", sportMapping{sport: "Running"}, ""},
+		{"SUCCESS - Sport as spelled in the schema", "biking", sportMapping{sport: "Biking"}, ""},
+		{"SUCCESS - Sport and recipes", map[string]interface{}{"sport": "Other", "recipes": []interface{}{"pool-lengths"}},
+			sportMapping{sport: "Other", recipes: []string{recipePoolLengths}}, ""},
+		{"SUCCESS - No recipe", map[string]interface{}{"recipes": []interface{}{}}, sportMapping{recipes: []string{}}, ""},
+		{"FAILURE - Unknown sport", "Swimming", sportMapping{}, `invalid sport "Swimming" of Pool`},
+		{"FAILURE - Built-in sport outside the schema", "Swim", sportMapping{}, `invalid sport "Swim" of Pool`},
+		{"FAILURE - Unknown recipe", map[string]interface{}{"recipes": []interface{}{"laps"}}, sportMapping{}, `unknown recipe "laps" of Pool`},
+		{"FAILURE - Recipes not a list", map[string]interface{}{"recipes": "cadence"}, sportMapping{}, "recipes of Pool must be a list"},
+		{"FAILURE - Unknown key", map[string]interface{}{"name": "Swim"}, sportMapping{}, `unknown key "name" of Pool`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			mapping, err := parseSportMapping("Pool", tc.value)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedMapping, mapping)
+		})
+	}
+}
+
+func TestSportMapping(t *testing.T) {
+	cfg := &fileConfig{sports: map[string]sportMapping{
+		"treadmill": {sport: "Running"},
+		"90025":     {sport: "Other", recipes: []string{recipePoolLengths}},
+		"2030":      {recipes: []string{}},
+	}}
+	testCases := []struct {
+		testName        string
+		cfg             *fileConfig
+		activity        data.Activity
+		expectedMapping sportMapping
+	}{
+		{"SUCCESS - Built-in", nil, data.Activity{ActivityID: 90024, ActivityParentID: 90024, ActivityParentName: "Swim"},
+			sportMapping{sport: "Swim", recipes: []string{recipePoolLengths}}},
+		{"SUCCESS - Built-in of the parent type", nil, data.Activity{ActivityID: 12345, ActivityParentID: 90009},
+			sportMapping{recipes: []string{recipeCadence}}},
+		{"SUCCESS - Indoor", nil, data.Activity{ActivityID: 55001, ActivityParentID: 55001, ActivityParentName: "Spinning"},
+			sportMapping{sport: "Biking", recipes: []string{recipeFitbitCreator}}},
+		{"SUCCESS - Indoor whatever the name", nil, data.Activity{ActivityID: 52001, ActivityParentID: 52001, ActivityParentName: "Jóga"},
+			sportMapping{sport: "Other", recipes: []string{recipeFitbitCreator}}},
+		{"SUCCESS - Stairclimber", nil, data.Activity{ActivityID: 20048, ActivityParentID: 20048, ActivityParentName: "Stairclimber"},
+			sportMapping{sport: "Other", recipes: []string{recipeFitbitCreator}}},
+		{"SUCCESS - Rowing machine of the parent type", nil, data.Activity{ActivityID: 1, ActivityParentID: 20050, ActivityParentName: "Rowing Machine"},
+			sportMapping{sport: "Other", recipes: []string{recipeFitbitCreator}}},
+		{"SUCCESS - None", nil, data.Activity{ActivityID: 15000, ActivityParentID: 15000, ActivityParentName: "Yoga"}, sportMapping{}},
+		{"SUCCESS - Configured sport keeps the built-in recipes", cfg, data.Activity{ActivityID: 20047, ActivityParentName: "Treadmill"},
+			sportMapping{sport: "Running", recipes: []string{recipeCadence, recipeDistanceCurve, recipeFitbitCreator}}},
+		{"SUCCESS - Configured by ID", cfg, data.Activity{ActivityID: 90025, ActivityParentID: 90025, ActivityParentName: "Open Water Swim"},
+			sportMapping{sport: "Other", recipes: []string{recipePoolLengths}}},
+		{"SUCCESS - Configured without recipes", cfg, data.Activity{ActivityID: 2030, ActivityParentID: 2030},
+			sportMapping{recipes: []string{}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedMapping, tc.cfg.sportMapping(tc.activity))
+		})
+	}
+}
+
+func TestInjectActivityTcxConfiguredSwim(t *testing.T) {
+	config = &fileConfig{sports: map[string]sportMapping{"open water swim": {sport: "Other", recipes: []string{recipePoolLengths}}}}
+	defer func() { config = nil }()
+
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(testActivityTcx))
+	activity := data.Activity{ActivityID: 90025, ActivityParentID: 90025, ActivityParentName: "Open Water Swim"}
+	_, err := injectActivityTcx(xmlDoc, activity, 10*time.Minute, 500, 100, 4, nil)
+	assert.NoError(t, err)
+
+	root := xmlDoc.FindElement("/TrainingCenterDatabase/Activities/Activity")
+	assert.Equal(t, "Other", root.SelectAttrValue("Sport", ""))
+	assert.Len(t, root.SelectElements("Lap"), 4)
+}
+
+func TestInjectActivityTcxIndoor(t *testing.T) {
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Biking"><Id>2024-09-07T10:00:00.000+02:00</Id>
+		<Lap StartTime="2024-09-07T10:00:00.000+02:00"><TotalTimeSeconds>1200</TotalTimeSeconds></Lap><Creator/></Activity></Activities></TrainingCenterDatabase>`))
+	activity := data.Activity{ActivityID: 90017, ActivityParentID: 90017, ActivityParentName: "Elliptical"}
+	_, err := injectActivityTcx(xmlDoc, activity, 20*time.Minute, 0, 150, 0, nil)
+	assert.NoError(t, err)
+
+	root := xmlDoc.FindElement("/TrainingCenterDatabase/Activities/Activity")
+	assert.Equal(t, "Other", root.SelectAttrValue("Sport", ""))
+	assert.Len(t, root.SelectElements("Lap"), 1)
+	assert.Equal(t, "Fitbit", root.FindElement("Creator/Name").Text())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Lifetime statistic as printed by the stats command, the JSON output is meant for dashboards
+type lifetimeStat struct {
+	Name     string  `json:"name"`
+	Unit     string  `json:"unit,omitempty"`
+	Total    float64 `json:"total"`
+	Best     float64 `json:"best"`
+	BestDate string  `json:"bestDate,omitempty"`
+}
+
+// Prints the lifetime totals and the best days of the distance, steps and floors, as a table or as JSON.
+// The totals include the manually logged activities
+func printLifetimeStats(out io.Writer, jsonOutput bool) error {
+	body, err := apiGet(userURL("activities.json"))
+	if err != nil {
+		return fmt.Errorf("failed to fetch lifetime statistics: %w", err)
+	}
+	var lifetime data.LifetimeStats
+	if err := json.Unmarshal(body, &lifetime); err != nil {
+		return fmt.Errorf("failed to unmarshal lifetime statistics: %s", err)
+	}
+
+	distanceUnit := "km"
+	if apiUnits == unitsImperial {
+		distanceUnit = "mi"
+	}
+	stats := []lifetimeStat{
+		{"distance", distanceUnit, lifetime.Lifetime.Total.Distance, lifetime.Best.Total.Distance.Value, lifetime.Best.Total.Distance.Date},
+		{"steps", "", lifetime.Lifetime.Total.Steps, lifetime.Best.Total.Steps.Value, lifetime.Best.Total.Steps.Date},
+		{"floors", "", lifetime.Lifetime.Total.Floors, lifetime.Best.Total.Floors.Value, lifetime.Best.Total.Floors.Date},
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(stats)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STAT\tTOTAL\tBEST\tBEST DAY")
+	for _, stat := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", stat.Name, formatStat(stat.Total, stat.Unit), formatStat(stat.Best, stat.Unit), stat.BestDate)
+	}
+	return w.Flush()
+}
+
+// Formats a statistic, distances with two decimals and their unit, counts as integers
+func formatStat(value float64, unit string) string {
+	if unit == "" {
+		return fmt.Sprintf("%.0f", value)
+	}
+	return fmt.Sprintf("%.2f %s", value, unit)
+}
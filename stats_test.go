@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestPrintLifetimeStats(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1/user/-/activities.json", r.URL.Path)
+		w.Write([]byte(`{"best":{"total":{"distance":{"date":"2024-05-12","value":42.195},"floors":{"date":"2022-01-01","value":120},"steps":{"date":"2023-10-01","value":45678}}},
+			"lifetime":{"total":{"activeScore":-1,"caloriesOut":-1,"distance":2345.6,"floors":1234,"steps":3456789}}}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	var out bytes.Buffer
+	assert.NoError(t, printLifetimeStats(&out, false))
+	assert.Contains(t, out.String(), "STAT")
+	assert.Contains(t, out.String(), "2345.60 km")
+	assert.Contains(t, out.String(), "42.20 km")
+	assert.Contains(t, out.String(), "3456789")
+	assert.Contains(t, out.String(), "2023-10-01")
+
+	out.Reset()
+	assert.NoError(t, printLifetimeStats(&out, true))
+	var stats []lifetimeStat
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &stats))
+	assert.Equal(t, lifetimeStat{Name: "floors", Total: 1234, Best: 120, BestDate: "2022-01-01"}, stats[2])
+}
+
+func TestFormatStat(t *testing.T) {
+	assert.Equal(t, "12.35 mi", formatStat(12.345, "mi"))
+	assert.Equal(t, "45678", formatStat(45678, ""))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// Subcommand of the subscriptions command, e.g. subscriptions add fitbittcx-1
+type subscriptionCommand struct {
+	action string // list, add or delete
+	id     string // Subscription ID, chosen when adding
+}
+
+// Options of the serve command, the subscriber endpoint notified by Fitbit
+type serveOptions struct {
+	addr   string // Listen address, e.g. ":8090"
+	verify string // Verification code of the subscriber, shown in the settings of the app at dev.fitbit.com
+}
+
+// Parses the arguments following the subscriptions command: list, add ID or delete ID
+func parseSubscriptionArgs(args []string) (subscriptionCommand, error) {
+	usage := fmt.Errorf("unknown subscriptions command, use: subscriptions list|add ID|delete ID")
+	if len(args) == 0 {
+		return subscriptionCommand{}, usage
+	}
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		return subscriptionCommand{action: "list"}, nil
+	case (args[0] == "add" || args[0] == "delete") && len(args) == 2 && args[1] != "":
+		if url.PathEscape(args[1]) != args[1] {
+			return subscriptionCommand{}, fmt.Errorf("invalid subscription ID %q, use letters, digits and dashes", args[1])
+		}
+		return subscriptionCommand{action: args[0], id: args[1]}, nil
+	}
+	return subscriptionCommand{}, usage
+}
+
+// Lists, adds or deletes the subscriptions to the activities of the user. Fitbit notifies the subscriber
+// endpoint of the app, configured at dev.fitbit.com, when an activity syncs
+func manageSubscriptions(out io.Writer, cmd subscriptionCommand) error {
+	subscriptionsURL := userURL("activities/apiSubscriptions")
+	switch cmd.action {
+	case "add":
+		if _, err := apiPost(subscriptionsURL+"/"+cmd.id+".json", url.Values{}); err != nil {
+			return fmt.Errorf("failed to add subscription %s: %w", cmd.id, err)
+		}
+		fmt.Fprintf(out, "Subscribed to the activities as %s\n", cmd.id)
+		return nil
+	case "delete":
+		if _, err := apiDelete(subscriptionsURL + "/" + cmd.id + ".json"); err != nil {
+			return fmt.Errorf("failed to delete subscription %s: %w", cmd.id, err)
+		}
+		fmt.Fprintf(out, "Deleted subscription %s\n", cmd.id)
+		return nil
+	}
+
+	body, err := apiGet(subscriptionsURL + ".json")
+	if err != nil {
+		return fmt.Errorf("failed to fetch subscriptions: %w", err)
+	}
+	var subscriptions data.Subscriptions
+	if err := json.Unmarshal(body, &subscriptions); err != nil {
+		return fmt.Errorf("failed to unmarshal subscriptions: %s", err)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCOLLECTION\tSUBSCRIBER")
+	for _, subscription := range subscriptions.APISubscriptions {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", subscription.SubscriptionID, subscription.CollectionType, subscription.SubscriberID)
+	}
+	return w.Flush()
+}
+
+// Parses the flags following the serve command, e.g. serve --addr :8090 --verify CODE
+func parseServeArgs(args []string) (serveOptions, error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	addr := fs.String("addr", ":8090", "listen address of the subscriber endpoint")
+	verify := fs.String("verify", os.Getenv("FITBIT_SUBSCRIBER_VERIFY"), "verification code of the subscriber")
+	if err := fs.Parse(args); err != nil {
+		return serveOptions{}, fmt.Errorf("serve: %s", err)
+	}
+	if fs.NArg() != 0 {
+		return serveOptions{}, fmt.Errorf("serve takes no dates, it exports the days Fitbit notifies")
+	}
+	if *verify == "" {
+		return serveOptions{}, fmt.Errorf("serve needs the verification code of the subscriber, give --verify or FITBIT_SUBSCRIBER_VERIFY")
+	}
+	return serveOptions{addr: *addr, verify: *verify}, nil
+}
+
+// Handles the requests of Fitbit to the subscriber endpoint: the verification of the endpoint, a GET with the
+// verification code, and the notifications, POSTs signed with the client secret. The dates of the changed activities
+// are passed to notify, which must not block, as Fitbit expects the answer within 5 seconds
+func subscriberHandler(verify string, clientSecret string, notify func(date string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			// Fitbit checks that a wrong code is rejected too
+			if code := r.URL.Query().Get("verify"); code != "" && subtle.ConstantTimeCompare([]byte(code), []byte(verify)) == 1 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			http.NotFound(w, r)
+		case http.MethodPost:
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				http.Error(w, "failed to read notification", http.StatusBadRequest)
+				return
+			}
+			if !validSignature(body, r.Header.Get("X-Fitbit-Signature"), clientSecret) {
+				slog.Warn("Rejected notification with invalid signature", "remote", r.RemoteAddr)
+				http.NotFound(w, r)
+				return
+			}
+			var notifications []data.SubscriptionNotification
+			if err := json.Unmarshal(body, &notifications); err != nil {
+				http.Error(w, "invalid notification", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			for _, notification := range notifications {
+				if notification.CollectionType != "activities" {
+					continue
+				}
+				if _, err := time.Parse(dateLayout, notification.Date); err != nil {
+					slog.Warn("Ignoring notification with invalid date", "date", notification.Date)
+					continue
+				}
+				slog.Info("Activities changed", "date", notification.Date, "subscription", notification.SubscriptionID)
+				notify(notification.Date)
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// Checks the X-Fitbit-Signature of a notification: the base64 encoded HMAC-SHA1 of the body, keyed with the
+// client secret followed by "&"
+func validSignature(body []byte, signature string, clientSecret string) bool {
+	expected, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, []byte(clientSecret+"&"))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// Serves the subscriber endpoint until it fails, exporting all activities of the days Fitbit notifies, one
+// day at a time. The already exported activities are skipped, unless the conflict policy says otherwise
+func serveSubscriber(serve serveOptions, clientSecret string, opts exportOptions) error {
+	if clientSecret == "" {
+		return withExitCode(exitUsage, fmt.Errorf("serve needs the clientSecret in credentials.json to verify the notifications"))
+	}
+	opts.all = true
+
+	dates := make(chan string, 100)
+	go func() {
+		for date := range dates {
+			if err := fetchActivityData([]string{date}, opts); err != nil {
+				slog.Error("Export of the notified day failed", "date", date, "err", err)
+			}
+		}
+	}()
+	handler := subscriberHandler(serve.verify, clientSecret, func(date string) {
+		select {
+		case dates <- date:
+		default:
+			slog.Warn("Too many notifications, skipping the day", "date", date)
+		}
+	})
+
+	slog.Info("Waiting for the notifications of Fitbit", "addr", serve.addr)
+	server := &http.Server{Addr: serve.addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	return server.ListenAndServe()
+}
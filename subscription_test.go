@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestParseSubscriptionArgs(t *testing.T) {
+	testCases := []struct {
+		testName string
+		args     []string
+		expected subscriptionCommand
+		err      bool
+	}{
+		{"SUCCESS - List", []string{"list"}, subscriptionCommand{action: "list"}, false},
+		{"SUCCESS - Add", []string{"add", "fitbittcx-1"}, subscriptionCommand{action: "add", id: "fitbittcx-1"}, false},
+		{"SUCCESS - Delete", []string{"delete", "fitbittcx-1"}, subscriptionCommand{action: "delete", id: "fitbittcx-1"}, false},
+		{"FAILURE - No subcommand", nil, subscriptionCommand{}, true},
+		{"FAILURE - Add without ID", []string{"add"}, subscriptionCommand{}, true},
+		{"FAILURE - Invalid ID", []string{"delete", "../1"}, subscriptionCommand{}, true},
+		{"FAILURE - Unknown subcommand", []string{"update", "1"}, subscriptionCommand{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			cmd, err := parseSubscriptionArgs(tc.args)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.expected, cmd)
+		})
+	}
+}
+
+func TestManageSubscriptions(t *testing.T) {
+	var requests []string
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"collectionType":"activities","ownerId":"ABC123","ownerType":"user","subscriberId":"1","subscriptionId":"fitbittcx-1"}`))
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Write([]byte(`{"apiSubscriptions":[{"collectionType":"activities","ownerId":"ABC123","ownerType":"user","subscriberId":"1","subscriptionId":"fitbittcx-1"}]}`))
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	var out bytes.Buffer
+	assert.NoError(t, manageSubscriptions(&out, subscriptionCommand{action: "add", id: "fitbittcx-1"}))
+	assert.NoError(t, manageSubscriptions(&out, subscriptionCommand{action: "list"}))
+	assert.NoError(t, manageSubscriptions(&out, subscriptionCommand{action: "delete", id: "fitbittcx-1"}))
+	assert.Equal(t, []string{
+		"POST /1/user/-/activities/apiSubscriptions/fitbittcx-1.json",
+		"GET /1/user/-/activities/apiSubscriptions.json",
+		"DELETE /1/user/-/activities/apiSubscriptions/fitbittcx-1.json",
+	}, requests)
+	assert.Contains(t, out.String(), "Subscribed to the activities as fitbittcx-1")
+	assert.Contains(t, out.String(), "activities")
+	assert.Contains(t, out.String(), "Deleted subscription fitbittcx-1")
+}
+
+func TestParseServeArgs(t *testing.T) {
+	t.Setenv("FITBIT_SUBSCRIBER_VERIFY", "")
+	serve, err := parseServeArgs([]string{"--verify", "code"})
+	assert.NoError(t, err)
+	assert.Equal(t, serveOptions{addr: ":8090", verify: "code"}, serve)
+
+	_, err = parseServeArgs(nil)
+	assert.Error(t, err)
+	_, err = parseServeArgs([]string{"--verify", "code", "2024-09-07"})
+	assert.Error(t, err)
+
+	t.Setenv("FITBIT_SUBSCRIBER_VERIFY", "env-code")
+	serve, err = parseServeArgs([]string{"--addr", "127.0.0.1:9000"})
+	assert.NoError(t, err)
+	assert.Equal(t, serveOptions{addr: "127.0.0.1:9000", verify: "env-code"}, serve)
+}
+
+func TestSubscriberHandler(t *testing.T) {
+	sign := func(body string) string {
+		mac := hmac.New(sha1.New, []byte("secret&"))
+		mac.Write([]byte(body))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	notification := `[{"collectionType":"activities","date":"2024-09-07","ownerId":"ABC123","ownerType":"user","subscriptionId":"fitbittcx-1"},
+		{"collectionType":"sleep","date":"2024-09-08","ownerId":"ABC123","ownerType":"user","subscriptionId":"fitbittcx-2"}]`
+
+	testCases := []struct {
+		testName      string
+		method        string
+		target        string
+		body          string
+		signature     string
+		expected      int
+		expectedDates []string
+	}{
+		{"SUCCESS - Verification", http.MethodGet, "/?verify=code", "", "", http.StatusNoContent, nil},
+		{"SUCCESS - Wrong verification code", http.MethodGet, "/?verify=wrong", "", "", http.StatusNotFound, nil},
+		{"SUCCESS - Notification", http.MethodPost, "/", notification, sign(notification), http.StatusNoContent, []string{"2024-09-07"}},
+		{"FAILURE - Invalid signature", http.MethodPost, "/", notification, sign("other"), http.StatusNotFound, nil},
+		{"FAILURE - Invalid notification", http.MethodPost, "/", "{", sign("{"), http.StatusBadRequest, nil},
+		{"FAILURE - Method", http.MethodPut, "/", "", "", http.StatusMethodNotAllowed, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			var dates []string
+			handler := subscriberHandler("code", "secret", func(date string) { dates = append(dates, date) })
+
+			r := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			r.Header.Set("X-Fitbit-Signature", tc.signature)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expected, w.Code)
+			assert.Equal(t, tc.expectedDates, dates)
+		})
+	}
+}
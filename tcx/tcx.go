@@ -0,0 +1,181 @@
+// Package tcx is a typed model of the Training Center Database (TCX) documents exported by Fitbit. The elements
+// the model does not know, e.g. the extensions, are kept as generic elements, so a parsed document is written
+// again without losing them
+package tcx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+type TrainingCenterDatabase struct {
+	XMLName    xml.Name    `xml:"TrainingCenterDatabase"`
+	Attrs      []xml.Attr  `xml:",any,attr"`
+	Activities *Activities `xml:"Activities"`
+	Extra      []Element   `xml:",any"`
+}
+
+type Activities struct {
+	Activity []Activity `xml:"Activity"`
+	Extra    []Element  `xml:",any"`
+}
+
+type Activity struct {
+	Sport      string      `xml:"Sport,attr,omitempty"`
+	Attrs      []xml.Attr  `xml:",any,attr"`
+	ID         string      `xml:"Id,omitempty"`
+	Laps       []Lap       `xml:"Lap"`
+	Notes      string      `xml:"Notes,omitempty"`
+	Training   *Element    `xml:"Training"`
+	Creator    *Creator    `xml:"Creator"`
+	Extensions *Extensions `xml:"Extensions"`
+	Extra      []Element   `xml:",any"`
+}
+
+type Lap struct {
+	StartTime           string      `xml:"StartTime,attr"`
+	Attrs               []xml.Attr  `xml:",any,attr"`
+	TotalTimeSeconds    float64     `xml:"TotalTimeSeconds"`
+	DistanceMeters      float64     `xml:"DistanceMeters"`
+	MaximumSpeed        *float64    `xml:"MaximumSpeed"`
+	Calories            int         `xml:"Calories"`
+	AverageHeartRateBpm *HeartRate  `xml:"AverageHeartRateBpm"`
+	MaximumHeartRateBpm *HeartRate  `xml:"MaximumHeartRateBpm"`
+	Intensity           string      `xml:"Intensity,omitempty"`
+	Cadence             *int        `xml:"Cadence"`
+	TriggerMethod       string      `xml:"TriggerMethod,omitempty"`
+	Tracks              []Track     `xml:"Track"`
+	Notes               string      `xml:"Notes,omitempty"`
+	Extensions          *Extensions `xml:"Extensions"`
+	Extra               []Element   `xml:",any"`
+}
+
+type Track struct {
+	Trackpoints []Trackpoint `xml:"Trackpoint"`
+}
+
+type Trackpoint struct {
+	Time           string      `xml:"Time"`
+	Position       *Position   `xml:"Position"`
+	AltitudeMeters *float64    `xml:"AltitudeMeters"`
+	DistanceMeters *float64    `xml:"DistanceMeters"`
+	HeartRateBpm   *HeartRate  `xml:"HeartRateBpm"`
+	Cadence        *int        `xml:"Cadence"`
+	SensorState    string      `xml:"SensorState,omitempty"`
+	Extensions     *Extensions `xml:"Extensions"`
+	Extra          []Element   `xml:",any"`
+}
+
+type Position struct {
+	LatitudeDegrees  float64 `xml:"LatitudeDegrees"`
+	LongitudeDegrees float64 `xml:"LongitudeDegrees"`
+}
+
+type HeartRate struct {
+	Value int `xml:"Value"`
+}
+
+type Creator struct {
+	Attrs     []xml.Attr `xml:",any,attr"`
+	Name      string     `xml:"Name,omitempty"`
+	UnitID    string     `xml:"UnitId,omitempty"`
+	ProductID string     `xml:"ProductID,omitempty"`
+	Version   *Version   `xml:"Version"`
+	Extra     []Element  `xml:",any"`
+}
+
+type Version struct {
+	VersionMajor int  `xml:"VersionMajor"`
+	VersionMinor int  `xml:"VersionMinor"`
+	BuildMajor   *int `xml:"BuildMajor"`
+	BuildMinor   *int `xml:"BuildMinor"`
+}
+
+type Extensions struct {
+	Elements []Element `xml:",any"`
+}
+
+// Element unknown to the model, with its name and attributes as written, e.g. "ns3:TPX"
+type Element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []Element  `xml:",any"`
+}
+
+// Reads the element with its name as written, without the namespace resolved by the decoder
+func (e *Element) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type element Element
+	if err := d.DecodeElement((*element)(e), &start); err != nil {
+		return err
+	}
+	e.XMLName.Space = ""
+	return nil
+}
+
+// Parses a TCX document
+func Parse(b []byte) (*TrainingCenterDatabase, error) {
+	var db TrainingCenterDatabase
+	if err := xml.NewTokenDecoder(prefixedNames{xml.NewDecoder(bytes.NewReader(b))}).Decode(&db); err != nil {
+		return nil, fmt.Errorf("failed to parse TCX: %s", err)
+	}
+	db.XMLName.Space = ""
+	return &db, nil
+}
+
+// Writes the TCX document, without the XML declaration
+func (db *TrainingCenterDatabase) Marshal() ([]byte, error) {
+	b, err := xml.Marshal(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write TCX: %s", err)
+	}
+	return b, nil
+}
+
+// Returns the first activity of the document, nil without activity
+func (db *TrainingCenterDatabase) FirstActivity() *Activity {
+	if db.Activities == nil || len(db.Activities.Activity) == 0 {
+		return nil
+	}
+	return &db.Activities.Activity[0]
+}
+
+// Reads the tokens with the namespace prefixes kept in the names, e.g. "ns3:TPX" and "xmlns:ns3", which
+// encoding/xml would otherwise write back with made up prefixes. Indentation is dropped
+type prefixedNames struct {
+	d *xml.Decoder
+}
+
+func (p prefixedNames) Token() (xml.Token, error) {
+	for {
+		token, err := p.d.RawToken()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			start := xml.StartElement{Name: prefixedName(t.Name), Attr: make([]xml.Attr, len(t.Attr))}
+			for i, attr := range t.Attr {
+				start.Attr[i] = xml.Attr{Name: prefixedName(attr.Name), Value: attr.Value}
+			}
+			return start, nil
+		case xml.EndElement:
+			return xml.EndElement{Name: prefixedName(t.Name)}, nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+		case xml.Comment, xml.ProcInst, xml.Directive:
+			continue
+		}
+		return xml.CopyToken(token), nil
+	}
+}
+
+func prefixedName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
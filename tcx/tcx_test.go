@@ -0,0 +1,98 @@
+package tcx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const fitbitTcx = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2" xmlns:ns3="http://www.garmin.com/xmlschemas/ActivityExtension/v2" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <Activities>
+    <Activity Sport="Running">
+      <Id>2024-09-07T10:00:00.000+02:00</Id>
+      <Lap StartTime="2024-09-07T10:00:00.000+02:00">
+        <TotalTimeSeconds>1800.0</TotalTimeSeconds>
+        <DistanceMeters>5000.5</DistanceMeters>
+        <Calories>300</Calories>
+        <Intensity>Active</Intensity>
+        <TriggerMethod>Manual</TriggerMethod>
+        <Track>
+          <Trackpoint>
+            <Time>2024-09-07T10:00:00.000+02:00</Time>
+            <Position><LatitudeDegrees>47.527</LatitudeDegrees><LongitudeDegrees>19.047</LongitudeDegrees></Position>
+            <HeartRateBpm><Value>120</Value></HeartRateBpm>
+            <Extensions><ns3:TPX><ns3:Speed>3.1</ns3:Speed></ns3:TPX></Extensions>
+          </Trackpoint>
+        </Track>
+      </Lap>
+      <Creator xsi:type="Device_t"><Name>Charge 6</Name></Creator>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+func TestParse(t *testing.T) {
+	db, err := Parse([]byte(fitbitTcx))
+	assert.NoError(t, err)
+
+	activity := db.FirstActivity()
+	if assert.NotNil(t, activity) {
+		assert.Equal(t, "Running", activity.Sport)
+		assert.Equal(t, "2024-09-07T10:00:00.000+02:00", activity.ID)
+		assert.Len(t, activity.Laps, 1)
+		assert.Equal(t, 1800.0, activity.Laps[0].TotalTimeSeconds)
+		assert.Equal(t, 300, activity.Laps[0].Calories)
+		trackpoint := activity.Laps[0].Tracks[0].Trackpoints[0]
+		assert.Equal(t, &Position{LatitudeDegrees: 47.527, LongitudeDegrees: 19.047}, trackpoint.Position)
+		assert.Equal(t, &HeartRate{Value: 120}, trackpoint.HeartRateBpm)
+		assert.Nil(t, trackpoint.DistanceMeters)
+		assert.Equal(t, "ns3:TPX", trackpoint.Extensions.Elements[0].XMLName.Local)
+		assert.Equal(t, "Charge 6", activity.Creator.Name)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	db, err := Parse([]byte(fitbitTcx))
+	assert.NoError(t, err)
+	db.FirstActivity().Sport = "Other"
+
+	// The namespaces, their prefixes and the unknown elements are kept
+	b, err := db.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2" `+
+		`xmlns:ns3="http://www.garmin.com/xmlschemas/ActivityExtension/v2" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">`+
+		`<Activities><Activity Sport="Other"><Id>2024-09-07T10:00:00.000+02:00</Id>`+
+		`<Lap StartTime="2024-09-07T10:00:00.000+02:00"><TotalTimeSeconds>1800</TotalTimeSeconds><DistanceMeters>5000.5</DistanceMeters>`+
+		`<Calories>300</Calories><Intensity>Active</Intensity><TriggerMethod>Manual</TriggerMethod>`+
+		`<Track><Trackpoint><Time>2024-09-07T10:00:00.000+02:00</Time>`+
+		`<Position><LatitudeDegrees>47.527</LatitudeDegrees><LongitudeDegrees>19.047</LongitudeDegrees></Position>`+
+		`<HeartRateBpm><Value>120</Value></HeartRateBpm><Extensions><ns3:TPX><ns3:Speed>3.1</ns3:Speed></ns3:TPX></Extensions>`+
+		`</Trackpoint></Track></Lap><Creator xsi:type="Device_t"><Name>Charge 6</Name></Creator></Activity></Activities></TrainingCenterDatabase>`, string(b))
+}
+
+func TestParseUnexpectedShape(t *testing.T) {
+	testCases := []struct {
+		testName         string
+		document         string
+		expectedActivity bool
+		expectedError    string
+	}{
+		{"SUCCESS - No activities", `<TrainingCenterDatabase/>`, false, ""},
+		{"SUCCESS - No activity", `<TrainingCenterDatabase><Activities/></TrainingCenterDatabase>`, false, ""},
+		{"SUCCESS - Activity without laps", `<TrainingCenterDatabase><Activities><Activity/></Activities></TrainingCenterDatabase>`, true, ""},
+		{"FAILURE - Not a number", `<TrainingCenterDatabase><Activities><Activity><Lap><Calories>many</Calories></Lap></Activity></Activities></TrainingCenterDatabase>`, false, "failed to parse TCX"},
+		{"FAILURE - Other document", `<gpx/>`, false, "failed to parse TCX"},
+		{"FAILURE - Malformed", `<TrainingCenterDatabase><Activities>`, false, "failed to parse TCX"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			db, err := Parse([]byte(tc.document))
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedActivity, db.FirstActivity() != nil)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Longest date range of a single skin temperature request
+const skinTemperatureMaxDays = 30
+
+// Skin temperature of a night
+type skinTemperature struct {
+	Date            string  `json:"date"`
+	NightlyRelative float64 `json:"nightlyRelative"`
+	LogType         string  `json:"logType"`
+}
+
+// Writes the nightly skin temperature of the date range, the deviation from the user's baseline in °C, as CSV or
+// as JSON. Fitbit has no intraday skin temperature. Devices without a temperature sensor have no data
+func exportSkinTemperature(out io.Writer, start time.Time, end time.Time, intraday bool, jsonOutput bool) error {
+	if intraday {
+		return withExitCode(exitUsage, fmt.Errorf("skin-temperature: Fitbit has no intraday skin temperature, only the nightly deviation"))
+	}
+
+	temperatures := []skinTemperature{}
+	err := forDateChunks(start, end, skinTemperatureMaxDays, func(chunkStart time.Time, chunkEnd time.Time) error {
+		body, err := apiGet(userURL("temp/skin/date/" + chunkStart.Format(dateLayout) + "/" + chunkEnd.Format(dateLayout) + ".json"))
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.status == http.StatusForbidden {
+			return fmt.Errorf("failed to fetch skin temperature, add the temperature scope to credentials.json: %w", err)
+		} else if err != nil {
+			return fmt.Errorf("failed to fetch skin temperature from %s to %s: %w", chunkStart.Format(dateLayout), chunkEnd.Format(dateLayout), err)
+		}
+		var chunk data.SkinTemperatures
+		if err := json.Unmarshal(body, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal skin temperature: %s", err)
+		}
+		for _, night := range chunk.TempSkin {
+			temperatures = append(temperatures, skinTemperature{Date: night.DateTime, NightlyRelative: night.Value.NightlyRelative, LogType: night.LogType})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(temperatures) == 0 {
+		slog.Info("No skin temperature in the date range, the device may not measure it", "from", start.Format(dateLayout), "to", end.Format(dateLayout))
+	}
+
+	var rows [][]string
+	for _, temperature := range temperatures {
+		rows = append(rows, []string{temperature.Date, formatHealthValue(temperature.NightlyRelative), temperature.LogType})
+	}
+	return writeHealthRecords(out, jsonOutput, temperatures, []string{"date", "nightly_relative", "log_type"}, rows)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestExportSkinTemperature(t *testing.T) {
+	testCases := []struct {
+		testName string
+		response string
+		status   int
+		intraday bool
+		expected string
+		wantErr  bool
+	}{
+		{"SUCCESS - Nightly deviation", `{"tempSkin":[{"dateTime":"2024-09-07","value":{"nightlyRelative":-0.31},"logType":"dedicated_temp_sensor"}]}`, http.StatusOK, false,
+			"date,nightly_relative,log_type\n2024-09-07,-0.31,dedicated_temp_sensor\n", false},
+		{"SUCCESS - Device without sensor", `{"tempSkin":[]}`, http.StatusOK, false, "date,nightly_relative,log_type\n", false},
+		{"FAILURE - Scope not granted", `{"errors":[{"errorType":"insufficient_scope"}]}`, http.StatusForbidden, false, "", true},
+		{"FAILURE - No intraday data", `{"tempSkin":[]}`, http.StatusOK, true, "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/1/user/-/temp/skin/date/2024-09-07/2024-09-07.json", r.URL.Path)
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.response))
+			}))
+			token = &oauth2.Token{AccessToken: "access"}
+			day := time.Date(2024, 9, 7, 0, 0, 0, 0, time.UTC)
+
+			var out bytes.Buffer
+			err := exportSkinTemperature(&out, day, day, tc.intraday, false)
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
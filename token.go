@@ -0,0 +1,458 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+const (
+	keychainService = "fitbittcx" // Service name of the token entries in the OS keychain
+)
+
+var tokenLockFile string // Advisory lock file serializing token reads and refreshes of concurrent invocations
+
+// Loads and stores the OAuth token between runs
+type tokenStore interface {
+	Load() (*oauth2.Token, error)
+	Save(tok *oauth2.Token) error
+}
+
+// Stores the token in a plain-text JSON file
+type fileTokenStore struct {
+	fileName string
+}
+
+func (s fileTokenStore) Load() (*oauth2.Token, error) {
+	return loadToken(s.fileName)
+}
+
+func (s fileTokenStore) Save(tok *oauth2.Token) error {
+	return saveToken(s.fileName, tok)
+}
+
+// Token store whose token can be deleted, once superseded by the token of the Fitbit user
+type tokenRemover interface {
+	Remove() error
+}
+
+func (s fileTokenStore) Remove() error {
+	return removeTokenFile(s.fileName)
+}
+
+// Stores the tokens keyed by the Fitbit user ID returned at authorization, in the token store of the user (e.g.
+// users/<user ID>/token.json), and remembers in users.json which user each profile is authorized as. So several
+// Fitbit users authorizing the same client keep independent tokens, and profiles authorized as the same user
+// share one. Tokens without a user ID are stored in the profile's own token store
+type userTokenStore struct {
+	dir          string                         // Token cache directory of users.json, e.g. ~/.config/fitbittcx
+	profile      string                         // Profile name, empty for the default profile
+	profileStore tokenStore                     // Token store of the profile, e.g. ~/.config/fitbittcx/token.json
+	userStore    func(userID string) tokenStore // Token store of a Fitbit user
+}
+
+func (s userTokenStore) Load() (*oauth2.Token, error) {
+	index, err := readUserIndex(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	if userID, ok := index[s.profileKey()]; ok {
+		return s.userStore(userID).Load()
+	}
+	return s.profileStore.Load()
+}
+
+func (s userTokenStore) Save(tok *oauth2.Token) error {
+	userID := tokenUserID(tok)
+	if userID == "" {
+		return s.profileStore.Save(tok)
+	}
+	if strings.ContainsAny(userID, `/\:.@`) {
+		return fmt.Errorf("invalid user ID %q", userID)
+	}
+	if err := s.userStore(userID).Save(tok); err != nil {
+		return err
+	}
+
+	index, err := readUserIndex(s.dir)
+	if err != nil {
+		return err
+	}
+	index[s.profileKey()] = userID
+	byteValue, err := json.MarshalIndent(index, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal user index: %s", err)
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create token cache directory: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, "users.json"), byteValue, 0600); err != nil {
+		return fmt.Errorf("failed to write user index: %s", err)
+	}
+	// The profile's token is superseded by the user's token
+	if remover, ok := s.profileStore.(tokenRemover); ok {
+		if err := remover.Remove(); err != nil {
+			slog.Warn("Failed to remove the superseded token of the profile", "err", err)
+		}
+	}
+	return nil
+}
+
+func (s userTokenStore) profileKey() string {
+	if s.profile == "" {
+		return "default"
+	}
+	return s.profile
+}
+
+// Reads the profile to Fitbit user ID mapping of the user token store
+func readUserIndex(dir string) (map[string]string, error) {
+	index := map[string]string{}
+	byteValue, err := os.ReadFile(filepath.Join(dir, "users.json"))
+	if os.IsNotExist(err) {
+		return index, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read user index: %s", err)
+	}
+	if err := json.Unmarshal(byteValue, &index); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user index: %s", err)
+	}
+	return index, nil
+}
+
+// Stores the token in the macOS Keychain / Windows Credential Manager / Secret Service on Linux
+type keychainTokenStore struct {
+	user string // Keychain account, the OAuth 2.0 Client ID
+}
+
+func (s keychainTokenStore) Load() (*oauth2.Token, error) {
+	secret, err := keyring.Get(keychainService, s.user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token from keychain: %s", err)
+	}
+	return unmarshalToken([]byte(secret))
+}
+
+func (s keychainTokenStore) Remove() error {
+	if err := keyring.Delete(keychainService, s.user); err != nil && err != keyring.ErrNotFound {
+		return fmt.Errorf("failed to delete token from keychain: %s", err)
+	}
+	return nil
+}
+
+func (s keychainTokenStore) Save(tok *oauth2.Token) error {
+	byteValue, err := marshalToken(tok)
+	if err != nil {
+		return err
+	}
+	if err := keyring.Set(keychainService, s.user, string(byteValue)); err != nil {
+		return fmt.Errorf("failed to write token to keychain: %s", err)
+	}
+	return nil
+}
+
+// Stores the token in an age encrypted file
+type encryptedTokenStore struct {
+	fileName string
+	crypter  *ageCrypter
+}
+
+func (s encryptedTokenStore) Load() (*oauth2.Token, error) {
+	ciphertext, err := os.ReadFile(s.fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token cache: %s", err)
+	}
+	byteValue, err := s.crypter.Decrypt(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt token cache: %s", err)
+	}
+	return unmarshalToken(byteValue)
+}
+
+func (s encryptedTokenStore) Remove() error {
+	return removeTokenFile(s.fileName)
+}
+
+func (s encryptedTokenStore) Save(tok *oauth2.Token) error {
+	byteValue, err := marshalToken(tok)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := s.crypter.Encrypt(byteValue)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt token: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.fileName), 0700); err != nil {
+		return fmt.Errorf("failed to create token cache directory: %s", err)
+	}
+	if err := os.WriteFile(s.fileName, ciphertext, 0600); err != nil {
+		return fmt.Errorf("failed to write token cache: %s", err)
+	}
+	return nil
+}
+
+// Creates the token store selected by the "tokenStore" setting of credentials.json, separate for every profile
+// and keyed by the Fitbit user: users/<user ID>/token.json(.age) files or "<Client ID>@<user ID>" keychain entries
+func newTokenStore(apiCred *data.Credentials, profile string, crypter *ageCrypter) (tokenStore, error) {
+	fileName, err := tokenCacheFile(profile)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(fileName)
+	userFile := func(userID string) string {
+		return filepath.Join(dir, "users", userID, "token.json")
+	}
+
+	store := userTokenStore{dir: dir, profile: profile}
+	switch apiCred.TokenStore {
+	case "", "file":
+		store.profileStore = fileTokenStore{fileName: fileName}
+		store.userStore = func(userID string) tokenStore {
+			return fileTokenStore{fileName: userFile(userID)}
+		}
+	case "encrypted":
+		store.profileStore = encryptedTokenStore{fileName: fileName + ".age", crypter: crypter}
+		store.userStore = func(userID string) tokenStore {
+			return encryptedTokenStore{fileName: userFile(userID) + ".age", crypter: crypter}
+		}
+	case "keychain":
+		user := apiCred.CId
+		if profile != "" {
+			user = apiCred.CId + "/" + profile
+		}
+		store.profileStore = keychainTokenStore{user: user}
+		store.userStore = func(userID string) tokenStore {
+			return keychainTokenStore{user: apiCred.CId + "@" + userID}
+		}
+	default:
+		return nil, fmt.Errorf("unknown token store %q, use \"file\", \"keychain\" or \"encrypted\"", apiCred.TokenStore)
+	}
+	return store, nil
+}
+
+// Returns the path of the token cache file, e.g. ~/.config/fitbittcx/token.json or token-<profile>.json
+func tokenCacheFile(profile string) (string, error) {
+	if strings.ContainsAny(profile, `/\:`) || strings.HasPrefix(profile, ".") {
+		return "", fmt.Errorf("invalid profile name %q", profile)
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %s", err)
+	}
+	fileName := "token.json"
+	if profile != "" {
+		fileName = "token-" + profile + ".json"
+	}
+	return filepath.Join(configDir, "fitbittcx", fileName), nil
+}
+
+// Reads a previously saved token (access + refresh + expiry) from the cache file
+func loadToken(fileName string) (*oauth2.Token, error) {
+	byteValue, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token cache: %s", err)
+	}
+	return unmarshalToken(byteValue)
+}
+
+// Cached token with the Fitbit user ID it was issued for
+type tokenRecord struct {
+	oauth2.Token
+	UserID string `json:"user_id,omitempty"`
+}
+
+// Returns the Fitbit user ID of the token, returned by the token endpoint next to the token
+func tokenUserID(tok *oauth2.Token) string {
+	if tok == nil {
+		return ""
+	}
+	userID, _ := tok.Extra("user_id").(string)
+	return userID
+}
+
+// Encodes the token with its user ID as JSON
+func marshalToken(tok *oauth2.Token) ([]byte, error) {
+	byteValue, err := json.MarshalIndent(tokenRecord{Token: *tok, UserID: tokenUserID(tok)}, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal token: %s", err)
+	}
+	return byteValue, nil
+}
+
+// Decodes a JSON encoded token, keeping its user ID
+func unmarshalToken(byteValue []byte) (*oauth2.Token, error) {
+	var rec tokenRecord
+	if err := json.Unmarshal(byteValue, &rec); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token cache: %s", err)
+	}
+	if rec.AccessToken == "" && rec.RefreshToken == "" {
+		return nil, fmt.Errorf("token cache contains no token")
+	}
+	tok := &rec.Token
+	if rec.UserID != "" {
+		tok = tok.WithExtra(map[string]interface{}{"user_id": rec.UserID})
+	}
+	return tok, nil
+}
+
+// Deletes a token cache file, a missing file is already deleted
+func removeTokenFile(fileName string) error {
+	if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete token cache: %s", err)
+	}
+	return nil
+}
+
+// Writes the token into the cache file, readable only by the current user
+func saveToken(fileName string, tok *oauth2.Token) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return fmt.Errorf("failed to create token cache directory: %s", err)
+	}
+
+	byteValue, err := marshalToken(tok)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fileName, byteValue, 0600); err != nil {
+		return fmt.Errorf("failed to write token cache: %s", err)
+	}
+	return nil
+}
+
+// Loads the cached token and refreshes it if it has expired
+func cachedToken(ctx context.Context, cfg *oauth2.Config, store tokenStore) (*oauth2.Token, error) {
+	tok, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// The token source only contacts the token endpoint when the access token has expired
+	tok, err = cfg.TokenSource(clientContext(ctx), tok).Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %s", err)
+	}
+	return tok, nil
+}
+
+// Prints whether a cached token exists, its expiry, and the scopes and user ID reported by the introspection endpoint
+func tokenStatus(ctx context.Context, store tokenStore, out io.Writer) error {
+	tok, err := store.Load()
+	if err != nil {
+		fmt.Fprintln(out, "Cached token: none ("+err.Error()+")")
+		return nil
+	}
+	fmt.Fprintln(out, "Cached token: found")
+	fmt.Fprintln(out, "Refresh token:", tok.RefreshToken != "")
+	if tok.Expiry.IsZero() {
+		fmt.Fprintln(out, "Expires: never")
+	} else if time.Now().After(tok.Expiry) {
+		fmt.Fprintln(out, "Expires:", tok.Expiry.Local().Format(time.RFC3339), "(expired, it is refreshed on the next run)")
+		return nil
+	} else {
+		fmt.Fprintln(out, "Expires:", tok.Expiry.Local().Format(time.RFC3339), "(in "+time.Until(tok.Expiry).Round(time.Second).String()+")")
+	}
+
+	info, err := introspectToken(ctx, apiURL("oauth2/introspect"), tok.AccessToken)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Active:", info.Active)
+	if info.Active {
+		fmt.Fprintln(out, "User ID:", info.UserID)
+		fmt.Fprintln(out, "Client ID:", info.ClientID)
+		fmt.Fprintln(out, "Scopes:", strings.Join(parseIntrospectScope(info.Scope), " "))
+	}
+	return nil
+}
+
+// Queries the introspection endpoint about the access token
+func introspectToken(ctx context.Context, endpoint string, accessToken string) (*data.TokenInfo, error) {
+	form := url.Values{"token": {accessToken}}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %s", err)
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect token: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token introspection failed: %s %s", resp.Status, string(body))
+	}
+
+	var info data.TokenInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %s", err)
+	}
+	return &info, nil
+}
+
+// Converts the introspection scope format "{ACTIVITY=READ, HEARTRATE=READ}" to the scope names used in the authorization URL
+func parseIntrospectScope(scope string) []string {
+	scopes := []string{}
+	for _, s := range strings.Split(strings.Trim(scope, "{}"), ",") {
+		name := strings.TrimSpace(strings.SplitN(s, "=", 2)[0])
+		if name != "" {
+			scopes = append(scopes, strings.ToLower(name))
+		}
+	}
+	return scopes
+}
+
+// Forces a refresh of the token, e.g. when the API rejected the access token before its expiry
+func refreshToken(ctx context.Context, cfg *oauth2.Config, tok *oauth2.Token) (*oauth2.Token, error) {
+	if tok == nil || tok.RefreshToken == "" {
+		return nil, fmt.Errorf("no refresh token")
+	}
+	expired := *tok
+	expired.Expiry = time.Now().Add(-time.Minute)
+	newTok, err := cfg.TokenSource(clientContext(ctx), &expired).Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %s", err)
+	}
+	return newTok, nil
+}
+
+// Runs fn while holding the advisory token lock, so concurrent invocations (e.g. a scheduled sync and a
+// manual run) do not refresh the token at the same time, invalidating each other's refresh token
+func withTokenLock(ctx context.Context, fn func() error) error {
+	if tokenLockFile == "" {
+		return fn()
+	}
+	if err := os.MkdirAll(filepath.Dir(tokenLockFile), 0700); err != nil {
+		return fmt.Errorf("failed to create token cache directory: %s", err)
+	}
+
+	lock := flock.New(tokenLockFile)
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	locked, err := lock.TryLockContext(ctx, 100*time.Millisecond)
+	if err != nil || !locked {
+		return fmt.Errorf("failed to lock token cache %s: %v", tokenLockFile, err)
+	}
+	defer lock.Unlock()
+
+	return fn()
+}
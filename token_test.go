@@ -0,0 +1,321 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+func TestSaveAndLoadToken(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "fitbittcx", "token.json")
+	expiry := time.Date(2024, 9, 7, 10, 0, 0, 0, time.UTC)
+	tok := &oauth2.Token{AccessToken: "access", TokenType: "Bearer", RefreshToken: "refresh", Expiry: expiry}
+
+	assert.NoError(t, saveToken(fileName, tok))
+
+	info, err := os.Stat(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := loadToken(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, tok.AccessToken, loaded.AccessToken)
+	assert.Equal(t, tok.RefreshToken, loaded.RefreshToken)
+	assert.True(t, tok.Expiry.Equal(loaded.Expiry))
+}
+
+func TestSaveAndLoadTokenUserID(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "token.json")
+	tok := (&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}).WithExtra(map[string]interface{}{"user_id": "ABC123"})
+
+	assert.NoError(t, saveToken(fileName, tok))
+	loaded, err := loadToken(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "ABC123", tokenUserID(loaded))
+	assert.Equal(t, "", tokenUserID(&oauth2.Token{AccessToken: "access"}))
+}
+
+func TestUserTokenStore(t *testing.T) {
+	dir := t.TempDir()
+	withUser := func(access string, userID string) *oauth2.Token {
+		return (&oauth2.Token{AccessToken: access, RefreshToken: "refresh"}).WithExtra(map[string]interface{}{"user_id": userID})
+	}
+	userStore := func(userID string) tokenStore {
+		return fileTokenStore{fileName: filepath.Join(dir, "users", userID, "token.json")}
+	}
+	parentFile := filepath.Join(dir, "token.json")
+	parent := userTokenStore{dir: dir, profileStore: fileTokenStore{fileName: parentFile}, userStore: userStore}
+	child := userTokenStore{dir: dir, profile: "child", profileStore: fileTokenStore{fileName: filepath.Join(dir, "token-child.json")}, userStore: userStore}
+	tablet := userTokenStore{dir: dir, profile: "tablet", profileStore: fileTokenStore{fileName: filepath.Join(dir, "token-tablet.json")}, userStore: userStore}
+
+	// Tokens without user ID stay in the profile's token file
+	assert.NoError(t, parent.Save(&oauth2.Token{AccessToken: "legacy"}))
+	loaded, err := parent.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy", loaded.AccessToken)
+
+	// Each user gets its own token, replacing the profile's token file
+	assert.NoError(t, parent.Save(withUser("parent-access", "PARENT")))
+	assert.NoError(t, child.Save(withUser("child-access", "CHILD")))
+	assert.NoFileExists(t, parentFile)
+	assert.FileExists(t, filepath.Join(dir, "users", "PARENT", "token.json"))
+
+	loaded, err = parent.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "parent-access", loaded.AccessToken)
+	assert.Equal(t, "PARENT", tokenUserID(loaded))
+	loaded, err = child.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "child-access", loaded.AccessToken)
+
+	// Profiles authorized as the same user share the token
+	assert.NoError(t, tablet.Save(withUser("child-refreshed", "CHILD")))
+	loaded, err = child.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "child-refreshed", loaded.AccessToken)
+
+	assert.Error(t, parent.Save(withUser("access", "../PARENT")))
+}
+
+func TestKeychainUserTokenStore(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	withUser := func(access string, userID string) *oauth2.Token {
+		return (&oauth2.Token{AccessToken: access, RefreshToken: "refresh"}).WithExtra(map[string]interface{}{"user_id": userID})
+	}
+	apiCred := &data.Credentials{CId: "test-client-id", TokenStore: "keychain"}
+	parent, err := newTokenStore(apiCred, "", nil)
+	assert.NoError(t, err)
+	child, err := newTokenStore(apiCred, "child", nil)
+	assert.NoError(t, err)
+
+	// The keychain keeps the token of each user, not of each profile
+	assert.NoError(t, keychainTokenStore{user: "test-client-id"}.Save(&oauth2.Token{AccessToken: "legacy"}))
+	assert.NoError(t, parent.Save(withUser("parent-access", "PARENT")))
+	assert.NoError(t, child.Save(withUser("child-access", "CHILD")))
+	_, err = keychainTokenStore{user: "test-client-id"}.Load()
+	assert.Error(t, err)
+
+	loaded, err := parent.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "parent-access", loaded.AccessToken)
+	loaded, err = keychainTokenStore{user: "test-client-id@CHILD"}.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "child-access", loaded.AccessToken)
+}
+
+func TestLoadToken(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := []struct {
+		testName    string
+		content     string
+		expectedErr bool
+	}{
+		{testName: "SUCCESS - access and refresh token", content: `{"access_token":"a","refresh_token":"r"}`, expectedErr: false},
+		{testName: "FAILURE - invalid JSON", content: `{`, expectedErr: true},
+		{testName: "FAILURE - empty token", content: `{}`, expectedErr: true},
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			fileName := filepath.Join(dir, fmt.Sprintf("token%d.json", i))
+			assert.NoError(t, os.WriteFile(fileName, []byte(tc.content), 0600))
+			_, err := loadToken(fileName)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	_, err := loadToken(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestCachedTokenRefresh(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "old-refresh" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"new-access","token_type":"Bearer","refresh_token":"new-refresh","expires_in":28800}`))
+	}))
+	defer tokenServer.Close()
+
+	cfg := &oauth2.Config{ClientID: "test-client-id", Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}}
+	dir := t.TempDir()
+
+	// Valid token is returned as is, the token endpoint is not contacted
+	validFile := filepath.Join(dir, "valid.json")
+	assert.NoError(t, saveToken(validFile, &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}))
+	tok, err := cachedToken(context.Background(), cfg, fileTokenStore{fileName: validFile})
+	assert.NoError(t, err)
+	assert.Equal(t, "access", tok.AccessToken)
+
+	// Expired token is refreshed
+	expiredFile := filepath.Join(dir, "expired.json")
+	assert.NoError(t, saveToken(expiredFile, &oauth2.Token{AccessToken: "old-access", RefreshToken: "old-refresh", Expiry: time.Now().Add(-time.Hour)}))
+	tok, err = cachedToken(context.Background(), cfg, fileTokenStore{fileName: expiredFile})
+	assert.NoError(t, err)
+	assert.Equal(t, "new-access", tok.AccessToken)
+	assert.Equal(t, "new-refresh", tok.RefreshToken)
+
+	// Revoked refresh token falls back to an error
+	revokedFile := filepath.Join(dir, "revoked.json")
+	assert.NoError(t, saveToken(revokedFile, &oauth2.Token{AccessToken: "old-access", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Hour)}))
+	_, err = cachedToken(context.Background(), cfg, fileTokenStore{fileName: revokedFile})
+	assert.Error(t, err)
+}
+
+func TestKeychainTokenStore(t *testing.T) {
+	keyring.MockInit()
+	store := keychainTokenStore{user: "test-client-id"}
+
+	_, err := store.Load()
+	assert.Error(t, err)
+
+	tok := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}
+	assert.NoError(t, store.Save(tok))
+	loaded, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "access", loaded.AccessToken)
+	assert.Equal(t, "refresh", loaded.RefreshToken)
+}
+
+func TestNewTokenStore(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		tokenStore    string
+		expectedStore interface{}
+		expectedErr   bool
+	}{
+		{testName: "SUCCESS - default file store", tokenStore: "", expectedStore: fileTokenStore{}},
+		{testName: "SUCCESS - file store", tokenStore: "file", expectedStore: fileTokenStore{}},
+		{testName: "SUCCESS - keychain store", tokenStore: "keychain", expectedStore: keychainTokenStore{}},
+		{testName: "SUCCESS - encrypted store", tokenStore: "encrypted", expectedStore: encryptedTokenStore{}},
+		{testName: "FAILURE - unknown store", tokenStore: "vault", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			store, err := newTokenStore(&data.Credentials{CId: "test-client-id", TokenStore: tc.tokenStore}, "", &ageCrypter{})
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				// Keyed by the Fitbit user whatever the store
+				if assert.IsType(t, userTokenStore{}, store) {
+					assert.IsType(t, tc.expectedStore, store.(userTokenStore).profileStore)
+					assert.IsType(t, tc.expectedStore, store.(userTokenStore).userStore("ABC123"))
+				}
+			}
+		})
+	}
+}
+
+func TestTokenCacheFile(t *testing.T) {
+	fileName, err := tokenCacheFile("")
+	assert.NoError(t, err)
+	assert.Equal(t, "token.json", filepath.Base(fileName))
+
+	fileName, err = tokenCacheFile("partner")
+	assert.NoError(t, err)
+	assert.Equal(t, "token-partner.json", filepath.Base(fileName))
+
+	_, err = tokenCacheFile("../partner")
+	assert.Error(t, err)
+}
+
+func TestParseIntrospectScope(t *testing.T) {
+	assert.Equal(t, []string{"activity", "heartrate", "location"}, parseIntrospectScope("{ACTIVITY=READ, HEARTRATE=READ, LOCATION=READ}"))
+	assert.Equal(t, []string{"profile"}, parseIntrospectScope("{PROFILE=READ}"))
+	assert.Equal(t, []string{}, parseIntrospectScope("{}"))
+	assert.Equal(t, []string{}, parseIntrospectScope(""))
+}
+
+func TestIntrospectToken(t *testing.T) {
+	introspectServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Header.Get("Authorization") != "Bearer access" || r.Form.Get("token") != "access" {
+			http.Error(w, `{"errors":[{"errorType":"invalid_token"}]}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"active":true,"scope":"{ACTIVITY=READ, PROFILE=READ}","client_id":"test-client-id","user_id":"ABC123","token_type":"access_token","exp":1725728400000,"iat":1725699600000}`))
+	}))
+	defer introspectServer.Close()
+
+	info, err := introspectToken(context.Background(), introspectServer.URL, "access")
+	assert.NoError(t, err)
+	assert.True(t, info.Active)
+	assert.Equal(t, "ABC123", info.UserID)
+	assert.Equal(t, "test-client-id", info.ClientID)
+	assert.Equal(t, []string{"activity", "profile"}, parseIntrospectScope(info.Scope))
+
+	_, err = introspectToken(context.Background(), introspectServer.URL, "revoked")
+	assert.Error(t, err)
+}
+
+func TestWithTokenLock(t *testing.T) {
+	tokenLockFile = filepath.Join(t.TempDir(), "token.json.lock")
+	defer func() { tokenLockFile = "" }()
+
+	// The second holder waits until the first one releases the lock. The lock file orders the holders, which
+	// the race detector does not see, so the order is guarded too
+	var order []string
+	var orderMu sync.Mutex
+	appendOrder := func(holder string) {
+		orderMu.Lock()
+		defer orderMu.Unlock()
+		order = append(order, holder)
+	}
+	held := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		withTokenLock(context.Background(), func() error {
+			close(held)
+			time.Sleep(50 * time.Millisecond)
+			appendOrder("first")
+			return nil
+		})
+		close(done)
+	}()
+	<-held
+	assert.NoError(t, withTokenLock(context.Background(), func() error {
+		appendOrder("second")
+		return nil
+	}))
+	<-done
+	assert.Equal(t, []string{"first", "second"}, order)
+
+	assert.EqualError(t, withTokenLock(context.Background(), func() error { return fmt.Errorf("refresh failed") }), "refresh failed")
+}
+
+func TestReauthenticateUsesConcurrentRefresh(t *testing.T) {
+	tokenLockFile = filepath.Join(t.TempDir(), "token.json.lock")
+	defer func() { tokenLockFile = "" }()
+	tokens = fileTokenStore{fileName: filepath.Join(t.TempDir(), "token.json")}
+	oauthCfg = &oauth2.Config{ClientID: "test-client-id", Endpoint: oauth2.Endpoint{TokenURL: "http://127.0.0.1:0/unreachable"}}
+
+	// Another invocation already refreshed the token, the token endpoint is not contacted
+	assert.NoError(t, tokens.Save(&oauth2.Token{AccessToken: "other-access", RefreshToken: "other-refresh", Expiry: time.Now().Add(time.Hour)}))
+	token = &oauth2.Token{AccessToken: "old-access", RefreshToken: "old-refresh", Expiry: time.Now().Add(time.Hour)}
+	assert.NoError(t, reauthenticate())
+	assert.Equal(t, "other-access", token.AccessToken)
+	assert.Equal(t, "other-refresh", token.RefreshToken)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Gets the distance covered during the activity, in meters by local minute, e.g. "2024-09-07T10:05". The intraday
+// data needs a personal application, or one approved by Fitbit for intraday access
+func fetchDistancePerMinute(activity data.Activity) (map[string]float64, error) {
+	start, end, err := activityWindow(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	url := userURL(fmt.Sprintf("activities/distance/date/%s/1d/1min/time/%s/%s.json",
+		activity.StartDate, start.Format("15:04"), end.Format("15:04")))
+	body, err := apiGet(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch distance: %w", err)
+	}
+	var intraday data.DistanceIntraday
+	if err := json.Unmarshal(body, &intraday); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal distance: %s", err)
+	}
+	distance := map[string]float64{}
+	for _, minute := range intraday.Intraday.Dataset {
+		if minute.Value > 0 && len(minute.Time) >= len("15:04") {
+			distance[activity.StartDate+"T"+minute.Time[:len("15:04")]] = distanceMeters(minute.Value, apiUnits)
+		}
+	}
+	return distance, nil
+}
+
+// Sets the cumulative distance of the track points of the TCX from the distance per minute, scaled to the distance
+// of the activity, so the pace can be charted. Without track points, e.g. without heart rate, a track point is
+// created every minute of the first lap
+func addDistanceCurve(xmlDoc *etree.Document, distancePerMinute map[string]float64, totalTime time.Duration, distMeters float64) error {
+	covered := newMinuteTotals(distancePerMinute)
+	scale := 1.0
+	if distMeters > 0 && covered.total() > 0 {
+		scale = distMeters / covered.total()
+	}
+	formatDistance := func(t time.Time) string { return strconv.FormatFloat(covered.at(t)*scale, 'f', 1, 64) }
+
+	trackpoints := xmlDoc.FindElements("//Trackpoint")
+	if len(trackpoints) == 0 {
+		return addMinuteTrackpoints(xmlDoc, totalTime, formatDistance)
+	}
+	for _, trackpoint := range trackpoints {
+		timeElement := trackpoint.SelectElement("Time")
+		if timeElement == nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, timeElement.Text())
+		if err != nil {
+			continue
+		}
+		if distance := trackpoint.SelectElement("DistanceMeters"); distance != nil {
+			distance.SetText(formatDistance(t))
+			continue
+		}
+		// DistanceMeters follows the Time, the Position and the AltitudeMeters of the track point
+		after := timeElement
+		for _, previous := range []string{"Position", "AltitudeMeters"} {
+			if element := trackpoint.SelectElement(previous); element != nil {
+				after = element
+			}
+		}
+		distance := etree.NewElement("DistanceMeters")
+		distance.SetText(formatDistance(t))
+		trackpoint.InsertChildAt(after.Index()+1, distance)
+	}
+	return nil
+}
+
+// Creates a track point every minute of the activity, and one at its end, in the first lap, with the distance
+func addMinuteTrackpoints(xmlDoc *etree.Document, totalTime time.Duration, formatDistance func(time.Time) string) error {
+	activity := xmlDoc.FindElement("/TrainingCenterDatabase/Activities/Activity")
+	if activity == nil || activity.SelectElement("Id") == nil {
+		return fmt.Errorf("TCX activity has no Id")
+	}
+	lap := activity.SelectElement("Lap")
+	if lap == nil {
+		return nil
+	}
+	track := lap.SelectElement("Track")
+	if track == nil {
+		// The track precedes the notes and the extensions of the lap
+		track = etree.NewElement("Track")
+		index := len(lap.Child)
+		for _, next := range []string{"Extensions", "Notes"} {
+			if element := lap.SelectElement(next); element != nil {
+				index = element.Index()
+			}
+		}
+		lap.InsertChildAt(index, track)
+	}
+
+	id := activity.SelectElement("Id").Text()
+	for offset := time.Duration(0); ; offset += time.Minute {
+		offset = min(offset, totalTime)
+		timestamp, err := convertTimestamp(id, offset)
+		if err != nil {
+			return fmt.Errorf("invalid TCX activity Id: %s", err)
+		}
+		t, _ := time.Parse(time.RFC3339, timestamp)
+		trackpoint := track.CreateElement("Trackpoint")
+		trackpoint.CreateElement("Time").SetText(timestamp)
+		trackpoint.CreateElement("DistanceMeters").SetText(formatDistance(t))
+		if offset == totalTime {
+			return nil
+		}
+	}
+}
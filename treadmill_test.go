@@ -0,0 +1,80 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestFetchDistancePerMinute(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1/user/-/activities/distance/date/2024-09-07/1d/1min/time/10:00/10:30.json", r.URL.Path)
+		w.Write([]byte(`{"activities-distance":[{"dateTime":"2024-09-07","value":"6.5"}],
+			"activities-distance-intraday":{"dataset":[{"time":"10:00:00","value":0},{"time":"10:01:00","value":0.16}],"datasetInterval":1,"datasetType":"minute"}}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	distance, err := fetchDistancePerMinute(data.Activity{LogID: 1, StartDate: "2024-09-07", StartTime: "10:00", Duration: 1800000})
+	assert.NoError(t, err)
+	assert.Len(t, distance, 1)
+	assert.InDelta(t, 160.0, distance["2024-09-07T10:01"], 1e-9)
+}
+
+func TestAddDistanceCurve(t *testing.T) {
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+	distancePerMinute := map[string]float64{"2024-09-07T10:00": 150, "2024-09-07T10:01": 150}
+
+	testCases := []struct {
+		testName   string
+		tcx        string
+		distMeters float64
+		expected   []string
+	}{
+		{"SUCCESS - Track points of the heart rate",
+			`<Lap><Track><Trackpoint><Time>2024-09-07T08:00:00Z</Time><HeartRateBpm><Value>110</Value></HeartRateBpm></Trackpoint>` +
+				`<Trackpoint><Time>2024-09-07T08:01:00Z</Time><DistanceMeters>0</DistanceMeters></Trackpoint>` +
+				`<Trackpoint><Time>2024-09-07T08:01:30Z</Time></Trackpoint></Track></Lap>`,
+			0, []string{"0.0", "150.0", "225.0"}},
+		{"SUCCESS - Scaled to the distance of the activity",
+			`<Lap><Track><Trackpoint><Time>2024-09-07T08:01:00Z</Time></Trackpoint><Trackpoint><Time>2024-09-07T08:02:00Z</Time></Trackpoint></Track></Lap>`,
+			600, []string{"300.0", "600.0"}},
+		{"SUCCESS - Track point every minute without track",
+			`<Lap StartTime="2024-09-07T08:00:00Z"><TotalTimeSeconds>150</TotalTimeSeconds><Extensions/></Lap>`,
+			0, []string{"0.0", "150.0", "300.0", "300.0"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			xmlDoc := etree.NewDocument()
+			assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Running"><Id>2024-09-07T10:00:00.000+02:00</Id>`+
+				tc.tcx+`<Creator/></Activity></Activities></TrainingCenterDatabase>`))
+
+			assert.NoError(t, addDistanceCurve(xmlDoc, distancePerMinute, 150*time.Second, tc.distMeters))
+
+			var distances []string
+			for _, trackpoint := range xmlDoc.FindElements("//Trackpoint") {
+				distances = append(distances, trackpoint.SelectElement("DistanceMeters").Text())
+				assert.Equal(t, 1, trackpoint.SelectElement("DistanceMeters").Index())
+			}
+			assert.Equal(t, tc.expected, distances)
+		})
+	}
+}
+
+func TestAddDistanceCurveTrackBeforeExtensions(t *testing.T) {
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity Sport="Running"><Id>2024-09-07T10:00:00.000+02:00</Id>`+
+		`<Lap><TotalTimeSeconds>60</TotalTimeSeconds><Notes/><Extensions/></Lap><Creator/></Activity></Activities></TrainingCenterDatabase>`))
+
+	assert.NoError(t, addDistanceCurve(xmlDoc, map[string]float64{"2024-09-07T10:00": 150}, time.Minute, 0))
+
+	lap := xmlDoc.FindElement("//Lap")
+	assert.Equal(t, 1, lap.SelectElement("Track").Index())
+	assert.Len(t, lap.FindElements("Track/Trackpoint"), 2)
+	assert.Equal(t, "2024-09-07T08:01:00Z", lap.FindElements("Track/Trackpoint")[1].SelectElement("Time").Text())
+}
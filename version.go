@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set with -ldflags, e.g.
+// go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// Returns the commit and the build date, falling back to the VCS information Go embeds in the binary
+func buildInfo() (string, string) {
+	rev, date := commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && rev == "":
+				rev = setting.Value
+				if len(rev) > 7 {
+					rev = rev[:7]
+				}
+			case setting.Key == "vcs.time" && date == "":
+				date = setting.Value
+			}
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return rev, date
+}
+
+// User-Agent header of the API requests, e.g. "FitbitNonLocTcx/1.2.0 (abc1234)"
+func userAgent() string {
+	rev, _ := buildInfo()
+	return fmt.Sprintf("FitbitNonLocTcx/%s (%s)", version, rev)
+}
+
+// Prints the version of the build, for the version command
+func printVersion(out io.Writer) {
+	rev, date := buildInfo()
+	fmt.Fprintf(out, "FitbitNonLocTcx %s\ncommit: %s\nbuilt: %s\ngo: %s %s/%s\n", version, rev, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestPrintVersion(t *testing.T) {
+	version, commit, buildDate = "1.2.0", "abc1234", "2024-09-07T10:00:00Z"
+	defer func() { version, commit, buildDate = "dev", "", "" }()
+
+	var out bytes.Buffer
+	printVersion(&out)
+	assert.Contains(t, out.String(), "FitbitNonLocTcx 1.2.0\ncommit: abc1234\nbuilt: 2024-09-07T10:00:00Z\n")
+	assert.Equal(t, "FitbitNonLocTcx/1.2.0 (abc1234)", userAgent())
+}
+
+func TestAPIRequestUserAgent(t *testing.T) {
+	var agent string
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent = r.Header.Get("User-Agent")
+		w.Write([]byte(`{}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+
+	_, err := apiGet("https://api.fitbit.com/1/user/-/profile.json")
+	assert.NoError(t, err)
+	assert.Equal(t, userAgent(), agent)
+	assert.Contains(t, agent, "FitbitNonLocTcx/dev")
+}
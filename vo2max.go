@@ -0,0 +1,65 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/beevik/etree"
+)
+
+// VO2 Max estimates of the days already fetched, a batch fetches each day once
+var vo2MaxCache = struct {
+	sync.Mutex
+	days map[string]string
+}{days: map[string]string{}}
+
+// Gets the VO2 Max estimate (Cardio Fitness Score) of the date, e.g. "44-48" or "46.2" (measured with GPS
+// runs), empty when the day has none
+func fetchVO2Max(date string) (string, error) {
+	vo2MaxCache.Lock()
+	defer vo2MaxCache.Unlock()
+	if vo2Max, ok := vo2MaxCache.days[date]; ok {
+		return vo2Max, nil
+	}
+
+	body, err := apiGet(userURL("cardioscore/date/" + date + ".json"))
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch Cardio Fitness Score: %w", err)
+	}
+	var scores data.CardioScores
+	if err := json.Unmarshal(body, &scores); err != nil {
+		return "", fmt.Errorf("failed to unmarshal Cardio Fitness Score: %s", err)
+	}
+	vo2Max := ""
+	for _, score := range scores.CardioScore {
+		if score.DateTime == date {
+			vo2Max = score.Value.VO2Max
+		}
+	}
+	vo2MaxCache.days[date] = vo2Max
+	return vo2Max, nil
+}
+
+// Adds a line to the notes of the TCX activity. Notes precede the Training and Creator of the activity
+func addActivityNotes(xmlDoc *etree.Document, text string) {
+	activity := xmlDoc.FindElement("/TrainingCenterDatabase/Activities/Activity")
+	if activity == nil {
+		return
+	}
+	if notes := activity.SelectElement("Notes"); notes != nil {
+		notes.SetText(strings.TrimSpace(notes.Text() + "\n" + text))
+		return
+	}
+	notes := etree.NewElement("Notes")
+	notes.SetText(text)
+	for _, next := range []string{"Training", "Creator", "Extensions"} {
+		if element := activity.SelectElement(next); element != nil {
+			activity.InsertChildAt(element.Index(), notes)
+			return
+		}
+	}
+	activity.AddChild(notes)
+}
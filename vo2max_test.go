@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestFetchVO2Max(t *testing.T) {
+	requests := 0
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/1/user/-/cardioscore/date/2024-09-07.json":
+			w.Write([]byte(`{"cardioScore":[{"dateTime":"2024-09-07","value":{"vo2Max":"44-48"}}]}`))
+		default:
+			w.Write([]byte(`{"cardioScore":[]}`))
+		}
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	defer func() { vo2MaxCache.days = map[string]string{} }()
+
+	vo2Max, err := fetchVO2Max("2024-09-07")
+	assert.NoError(t, err)
+	assert.Equal(t, "44-48", vo2Max)
+	vo2Max, err = fetchVO2Max("2024-09-08")
+	assert.NoError(t, err)
+	assert.Empty(t, vo2Max)
+
+	// Each day is fetched once
+	_, err = fetchVO2Max("2024-09-07")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestAddActivityNotes(t *testing.T) {
+	xmlDoc := etree.NewDocument()
+	assert.NoError(t, xmlDoc.ReadFromString(`<TrainingCenterDatabase><Activities><Activity><Id/><Lap/><Creator/></Activity></Activities></TrainingCenterDatabase>`))
+
+	addActivityNotes(xmlDoc, "VO2 Max (Cardio Fitness Score): 44-48")
+	addActivityNotes(xmlDoc, "Leg day")
+
+	activity := xmlDoc.FindElement("//Activity")
+	assert.Equal(t, "VO2 Max (Cardio Fitness Score): 44-48\nLeg day", activity.SelectElement("Notes").Text())
+	var order []string
+	for _, child := range activity.ChildElements() {
+		order = append(order, child.Tag)
+	}
+	assert.Equal(t, []string{"Id", "Lap", "Notes", "Creator"}, order)
+}
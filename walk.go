@@ -0,0 +1,126 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Name of the synthetic walks made from the all-day steps
+const dailyWalkName = "Daily steps"
+
+// Adds the synthetic walk of the all-day steps to the activities of the date when none was logged, see dailyWalk.
+// A failure only leaves the day without walk
+func addDailyWalk(date string, activities data.Activities) data.Activities {
+	if len(activities.Activities) > 0 {
+		return activities
+	}
+	walk, ok, err := dailyWalk(date, activities.Summary)
+	if err != nil {
+		slog.Warn("Failed to get the steps, exporting no daily walk", "date", date, "err", err)
+		return activities
+	}
+	if !ok {
+		slog.Info("No steps, exporting no daily walk", "date", date)
+		return activities
+	}
+	activities.Activities = append(activities.Activities, walk)
+	return activities
+}
+
+// Creates a Walk activity of the steps of the date, from the first to the last minute with steps, with the
+// distance of the day. Its log ID is the date, e.g. 20240907, real log IDs are much longer so they do not
+// collide. False without steps. The intraday data needs a personal application, or one approved by Fitbit
+func dailyWalk(date string, summary data.DaySummary) (data.Activity, bool, error) {
+	stepsPerMinute, err := fetchStepsPerMinute(data.Activity{StartDate: date, StartTime: "00:00", Duration: (24 * time.Hour).Milliseconds()})
+	if err != nil {
+		return data.Activity{}, false, err
+	}
+	var first, last string
+	steps := 0
+	for minute, count := range stepsPerMinute {
+		if count <= 0 {
+			continue
+		}
+		if first == "" || minute < first {
+			first = minute
+		}
+		last = max(last, minute)
+		steps += count
+	}
+	if steps == 0 {
+		return data.Activity{}, false, nil
+	}
+
+	start, err := time.ParseInLocation("2006-01-02T15:04", first, userLocation)
+	if err != nil {
+		return data.Activity{}, false, fmt.Errorf("invalid steps minute %q: %s", first, err)
+	}
+	end, err := time.ParseInLocation("2006-01-02T15:04", last, userLocation)
+	if err != nil {
+		return data.Activity{}, false, fmt.Errorf("invalid steps minute %q: %s", last, err)
+	}
+	logID, err := strconv.ParseInt(strings.ReplaceAll(date, "-", ""), 10, 64)
+	if err != nil {
+		return data.Activity{}, false, fmt.Errorf("invalid date %q, use YYYY-MM-DD", date)
+	}
+	var distance float64
+	for _, total := range summary.Distances {
+		if total.Activity == "total" {
+			distance = total.Distance
+		}
+	}
+	return data.Activity{
+		LogID:              logID,
+		ActivityID:         activityTypeWalk,
+		ActivityParentID:   activityTypeWalk,
+		ActivityParentName: "Walk",
+		Name:               dailyWalkName,
+		StartDate:          date,
+		StartTime:          start.Format("15:04"),
+		Duration:           end.Add(time.Minute).Sub(start).Milliseconds(),
+		Distance:           distance,
+		HasStartTime:       true,
+		Steps:              steps,
+		Synthetic:          true,
+	}, true, nil
+}
+
+// Creates the TCX of a synthetic walk: a single lap with a track point every minute, with the distance covered
+// until then from the distance per minute. Fitbit gives no calories of the walk, the lap has none
+func newDailyWalkTcx(activity data.Activity) (*etree.Document, error) {
+	xmlDoc, err := newActivityTcx(activity)
+	if err != nil {
+		return nil, err
+	}
+	distancePerMinute, err := fetchDistancePerMinute(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	totalTime := time.Duration(activity.Duration) * time.Millisecond
+	distMeters := distanceMeters(activity.Distance, apiUnits)
+	activityElement := xmlDoc.FindElement("/TrainingCenterDatabase/Activities/Activity")
+	creator := activityElement.SelectElement("Creator")
+	creator.CreateElement("Name").SetText("Fitbit")
+	lap := etree.NewElement("Lap")
+	activityElement.InsertChildAt(creator.Index(), lap)
+	startTime, _ := convertTimestamp(activityElement.SelectElement("Id").Text(), 0)
+	lap.CreateAttr("StartTime", startTime)
+	lap.CreateElement("TotalTimeSeconds").SetText(strconv.FormatFloat(totalTime.Seconds(), 'f', -1, 64))
+	lap.CreateElement("DistanceMeters").SetText(strconv.FormatFloat(distMeters, 'f', -1, 64))
+	lap.CreateElement("Calories").SetText("0")
+	lap.CreateElement("Intensity").SetText("Active")
+	lap.CreateElement("TriggerMethod").SetText("Manual")
+	addActivityNotes(xmlDoc, fmt.Sprintf("%s: %d steps, not a logged activity", dailyWalkName, activity.Steps))
+
+	if err := addDistanceCurve(xmlDoc, distancePerMinute, totalTime, distMeters); err != nil {
+		return nil, err
+	}
+	return xmlDoc, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"FitbitNonLocTcx/data"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestAddDailyWalk(t *testing.T) {
+	testCases := []struct {
+		testName   string
+		activities string
+		steps      string
+		expected   []data.Activity
+	}{
+		{"SUCCESS - Day without activities", `{"activities":[],"summary":{"steps":5210,"distances":[{"activity":"total","distance":3.9},{"activity":"tracker","distance":3.9}]}}`,
+			`[{"time":"07:59:00","value":0},{"time":"08:00:00","value":110},{"time":"12:30:00","value":4000},{"time":"18:44:00","value":1100},{"time":"18:45:00","value":0}]`,
+			[]data.Activity{{LogID: 20240907, ActivityID: 90013, ActivityParentID: 90013, ActivityParentName: "Walk", Name: "Daily steps", StartDate: "2024-09-07", StartTime: "08:00", Duration: 38700000, Distance: 3.9, HasStartTime: true, Steps: 5210, Synthetic: true}}},
+		{"SUCCESS - Day without steps", `{"activities":[],"summary":{"steps":0}}`, `[{"time":"08:00:00","value":0}]`, []data.Activity{}},
+		{"SUCCESS - Day with activities", `{"activities":[{"logId":1,"activityParentName":"Run","startDate":"2024-09-07","startTime":"10:00"}],"summary":{"steps":9000}}`, `[]`,
+			[]data.Activity{{LogID: 1, ActivityParentName: "Run", StartDate: "2024-09-07", StartTime: "10:00"}}},
+		{"FAILURE - Steps not available", `{"activities":[],"summary":{"steps":5210}}`, "", []data.Activity{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/1/user/-/activities/steps/date/2024-09-07/1d/1min/time/00:00/23:59.json" {
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+				if tc.steps == "" {
+					http.Error(w, `{"errors":[{"errorType":"insufficient_permissions"}]}`, http.StatusForbidden)
+					return
+				}
+				w.Write([]byte(`{"activities-steps-intraday":{"dataset":` + tc.steps + `,"datasetInterval":1,"datasetType":"minute"}}`))
+			}))
+			token = &oauth2.Token{AccessToken: "access"}
+
+			var activities data.Activities
+			assert.NoError(t, json.Unmarshal([]byte(tc.activities), &activities))
+			assert.Equal(t, tc.expected, addDailyWalk("2024-09-07", activities).Activities)
+		})
+	}
+}
+
+func TestNewDailyWalkTcx(t *testing.T) {
+	stubFitbitAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/user/-/activities/distance/date/2024-09-07/1d/1min/time/08:00/08:02.json" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"activities-distance-intraday":{"dataset":[{"time":"08:00:00","value":0.08},{"time":"08:01:00","value":0.12}],"datasetInterval":1,"datasetType":"minute"}}`))
+	}))
+	token = &oauth2.Token{AccessToken: "access"}
+	userLocation = time.FixedZone("CEST", 2*60*60)
+	defer func() { userLocation = time.Local }()
+
+	xmlDoc, err := newDailyWalkTcx(data.Activity{LogID: 20240907, ActivityParentName: "Walk", Name: "Daily steps", StartDate: "2024-09-07", StartTime: "08:00", Duration: 120000, Distance: 0.2, Steps: 260, Synthetic: true})
+	assert.NoError(t, err)
+	activity := xmlDoc.FindElement("/TrainingCenterDatabase/Activities/Activity")
+	assert.Equal(t, "Other", activity.SelectAttrValue("Sport", ""))
+	var tags []string
+	for _, child := range activity.ChildElements() {
+		tags = append(tags, child.Tag)
+	}
+	assert.Equal(t, []string{"Id", "Lap", "Notes", "Creator"}, tags)
+	assert.Equal(t, "Daily steps: 260 steps, not a logged activity", activity.SelectElement("Notes").Text())
+	assert.Equal(t, "Fitbit", activity.FindElement("Creator/Name").Text())
+
+	lap := activity.SelectElement("Lap")
+	assert.Equal(t, "2024-09-07T06:00:00Z", lap.SelectAttrValue("StartTime", ""))
+	assert.Equal(t, "120", lap.SelectElement("TotalTimeSeconds").Text())
+	assert.Equal(t, "200", lap.SelectElement("DistanceMeters").Text())
+	var distances []string
+	for _, trackpoint := range lap.FindElements("Track/Trackpoint") {
+		distances = append(distances, trackpoint.SelectElement("DistanceMeters").Text())
+	}
+	assert.Equal(t, []string{"0.0", "80.0", "200.0"}, distances)
+}